@@ -0,0 +1,304 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/cyucelen/wirect/model"
+	"github.com/labstack/echo"
+)
+
+// Headers of sequenced uploads of packets
+const (
+	// HeaderBatchID identifies an upload, retries of the upload send the same ID
+	HeaderBatchID = "X-Batch-ID"
+	// HeaderSequenceRange holds the sequence numbers of the first and the last packet of an upload such as 101-150
+	HeaderSequenceRange = "X-Sequence-Range"
+	// HeaderSequenceAck is the highest sequence number up to which every packet of the sniffer was received
+	HeaderSequenceAck = "X-Sequence-Ack"
+)
+
+const maxBatchIDLength = 64
+
+// maxReceivedRanges bounds the gaps a sniffer may leave behind its acknowledged sequence
+const maxReceivedRanges = 64
+
+// maxKeptBatches is the number of batch IDs kept for every sniffer to tell retries apart from reused IDs
+const maxKeptBatches = 100
+
+type SequenceDatabase interface {
+	GetSnifferSequence(ctx context.Context, snifferMAC string) (model.SnifferSequence, error)
+	// CreatePacketBatch stores the packets together with the sequence of their sniffer, either both or none
+	CreatePacketBatch(ctx context.Context, packets []model.Packet, sequence *model.SnifferSequence) error
+}
+
+// Sequencer stores sequenced uploads of packets idempotently, one upload of a sniffer at a time
+type Sequencer struct {
+	DB SequenceDatabase
+
+	locks snifferLocks
+}
+
+// snifferLocks hold a lock for every sniffer with an upload in progress, the zero value is ready to use
+type snifferLocks struct {
+	mu    sync.Mutex
+	locks map[string]*snifferLock
+}
+
+// snifferLock is the lock of a sniffer, it is dropped once no upload holds or waits for it
+type snifferLock struct {
+	sync.Mutex
+	users int
+}
+
+func NewSequencer(db SequenceDatabase) *Sequencer {
+	return &Sequencer{DB: db}
+}
+
+// lock keeps other uploads of the sniffer from reading its sequence until the returned function is called
+func (s *Sequencer) lock(snifferMAC string) func() {
+	return s.locks.lock(snifferMAC)
+}
+
+// lock waits for the lock of the sniffer and returns the function which releases it
+func (l *snifferLocks) lock(snifferMAC string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = map[string]*snifferLock{}
+	}
+	lock, exists := l.locks[snifferMAC]
+	if !exists {
+		lock = &snifferLock{}
+		l.locks[snifferMAC] = lock
+	}
+	lock.users++
+	l.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		l.mu.Lock()
+		lock.users--
+		if lock.users == 0 {
+			delete(l.locks, snifferMAC)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// GetSequence returns the sequence of the sniffer, a sniffer restarting after a crash resends every packet after Acknowledged
+// which is not in the received ranges
+func (s *Sequencer) GetSequence(ctx echo.Context) error {
+	snifferMAC, err := getSnifferMAC(ctx)
+	if err != nil {
+		return err
+	}
+
+	sequence, err := s.DB.GetSnifferSequence(ctx.Request().Context(), snifferMAC)
+	if err != nil {
+		return newDatabaseError(err)
+	}
+	setSequenceAck(ctx, sequence)
+	return ctx.JSON(http.StatusOK, sequence)
+}
+
+// ResetSequence forgets the sequence of the sniffer, for a sniffer which was reflashed or replaced and numbers its packets
+// from 1 again. Its packets which were stored before are kept.
+func (s *Sequencer) ResetSequence(ctx echo.Context) error {
+	snifferMAC, err := getSnifferMAC(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.lock(snifferMAC)()
+
+	sequence := model.SnifferSequence{SnifferMAC: snifferMAC}
+	if err := s.DB.CreatePacketBatch(ctx.Request().Context(), nil, &sequence); err != nil {
+		return newDatabaseError(err)
+	}
+	setSequenceAck(ctx, sequence)
+	return ctx.JSON(http.StatusOK, sequence)
+}
+
+// createSequencedPackets stores the packets of the upload which were not received before and acknowledges the whole range,
+// rejected packets included since resending them would not change their fate
+func (p *PacketAPI) createSequencedPackets(ctx echo.Context, batch model.Batch, snifferPackets []model.SnifferPacket) error {
+	snifferMAC, err := getSnifferMAC(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.Sequencer.lock(snifferMAC)()
+
+	sequence, err := p.Sequencer.DB.GetSnifferSequence(ctx.Request().Context(), snifferMAC)
+	if err != nil {
+		return newDatabaseError(err)
+	}
+	if err := checkBatch(sequence, batch); err != nil {
+		return err
+	}
+
+	incident := p.Skew.correct(ctx, snifferPackets, true)
+	p.Skew.report(ctx, incident)
+	isDuplicate := func(i int) bool { return isReceived(sequence, batch.First+int64(i)) }
+	result := partitionSnifferPackets(orDefaultValidator(p.Validator), snifferPackets, incident, isDuplicate)
+	p.observeRejected(ctx, len(result.Rejected))
+
+	if !receive(&sequence, batch) {
+		return tooManyRangesError(sequence)
+	}
+	packets := []model.Packet{}
+	for _, accepted := range result.Accepted {
+		packets = append(packets, *toPacket(&accepted, snifferMAC))
+	}
+	if err := p.Sequencer.DB.CreatePacketBatch(ctx.Request().Context(), packets, &sequence); err != nil {
+		return newDatabaseError(err)
+	}
+	p.observeIngested(snifferMAC, len(packets))
+	setSequenceAck(ctx, sequence)
+
+	switch {
+	case len(result.Accepted) > 0:
+		return ctx.JSON(http.StatusCreated, result)
+	case len(result.Duplicates) > 0:
+		return ctx.JSON(http.StatusOK, result)
+	}
+	fieldErrors := []model.FieldError{}
+	for _, rejected := range result.Rejected {
+		fieldErrors = append(fieldErrors, rejected.Errors...)
+	}
+	return newValidationError(fieldErrors...)
+}
+
+// parseBatchHeaders returns the batch of a sequenced upload of count packets, false if the upload is not sequenced.
+// A negative count is an upload whose number of packets is not known in advance.
+func parseBatchHeaders(ctx echo.Context, count int) (model.Batch, bool, error) {
+	id := strings.TrimSpace(ctx.Request().Header.Get(HeaderBatchID))
+	sequenceRange := strings.TrimSpace(ctx.Request().Header.Get(HeaderSequenceRange))
+	if id == "" && sequenceRange == "" {
+		return model.Batch{}, false, nil
+	}
+
+	fieldErrors := []model.FieldError{}
+	switch {
+	case id == "":
+		fieldErrors = append(fieldErrors, requiredFieldError(HeaderBatchID))
+	case len(id) > maxBatchIDLength || strings.IndexFunc(id, func(r rune) bool { return r > unicode.MaxASCII || !unicode.IsPrint(r) }) >= 0:
+		fieldErrors = append(fieldErrors, invalidFieldError(HeaderBatchID, fmt.Sprintf("%s must be at most %d printable ASCII characters", HeaderBatchID, maxBatchIDLength)))
+	}
+
+	batch := model.Batch{ID: id}
+	bounds := strings.SplitN(sequenceRange, "-", 2)
+	var firstErr, lastErr error
+	batch.First, firstErr = strconv.ParseInt(bounds[0], 10, 64)
+	if len(bounds) == 2 {
+		batch.Last, lastErr = strconv.ParseInt(bounds[1], 10, 64)
+	}
+	switch {
+	case sequenceRange == "":
+		fieldErrors = append(fieldErrors, requiredFieldError(HeaderSequenceRange))
+	case len(bounds) != 2 || firstErr != nil || lastErr != nil:
+		fieldErrors = append(fieldErrors, invalidFieldError(HeaderSequenceRange, HeaderSequenceRange+" must be the first and the last sequence number such as 101-150"))
+	case batch.First < 1 || batch.Last < batch.First || (count >= 0 && batch.Last-batch.First+1 != int64(count)):
+		fieldErrors = append(fieldErrors, outOfRangeFieldError(HeaderSequenceRange,
+			fmt.Sprintf("%s must start at 1 or later and cover the %d packets of the upload", HeaderSequenceRange, count)))
+	}
+
+	if len(fieldErrors) > 0 {
+		return model.Batch{}, false, newValidationError(fieldErrors...)
+	}
+	return batch, true, nil
+}
+
+// isReceived tells whether the packet with the sequence number was received before
+func isReceived(sequence model.SnifferSequence, number int64) bool {
+	if number <= sequence.Acknowledged {
+		return true
+	}
+	for _, received := range sequence.Received {
+		if number >= received.First && number <= received.Last {
+			return true
+		}
+	}
+	return false
+}
+
+// receive adds the batch to the sequence and advances its acknowledged number over the ranges which became contiguous.
+// It returns false without changing the sequence if the sequence would have too many received ranges.
+func receive(sequence *model.SnifferSequence, batch model.Batch) bool {
+	if !receiveRange(sequence, batch.SequenceRange) {
+		return false
+	}
+	keepBatch(sequence, batch)
+	return true
+}
+
+// receiveRange adds the range to the sequence like receive without keeping a batch
+func receiveRange(sequence *model.SnifferSequence, received model.SequenceRange) bool {
+	ranges := append(append(model.SequenceRanges{}, sequence.Received...), received)
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].First < ranges[j].First })
+
+	acknowledged := sequence.Acknowledged
+	merged := model.SequenceRanges{}
+	for _, next := range ranges {
+		switch {
+		case next.First <= acknowledged+1:
+			if next.Last > acknowledged {
+				acknowledged = next.Last
+			}
+		case len(merged) > 0 && next.First <= merged[len(merged)-1].Last+1:
+			if next.Last > merged[len(merged)-1].Last {
+				merged[len(merged)-1].Last = next.Last
+			}
+		default:
+			merged = append(merged, next)
+		}
+	}
+	if len(merged) > maxReceivedRanges {
+		return false
+	}
+
+	sequence.Acknowledged = acknowledged
+	sequence.Received = nil
+	if len(merged) > 0 {
+		sequence.Received = merged
+	}
+	return true
+}
+
+// keepBatch remembers the ID of the batch unless it is already kept
+func keepBatch(sequence *model.SnifferSequence, batch model.Batch) {
+	for _, kept := range sequence.Batches {
+		if kept.ID == batch.ID {
+			return
+		}
+	}
+	sequence.Batches = append(sequence.Batches, batch)
+	if len(sequence.Batches) > maxKeptBatches {
+		sequence.Batches = sequence.Batches[len(sequence.Batches)-maxKeptBatches:]
+	}
+}
+
+// checkBatch fails if the ID of the batch was kept with a different range
+func checkBatch(sequence model.SnifferSequence, batch model.Batch) error {
+	for _, kept := range sequence.Batches {
+		if kept.ID == batch.ID && kept.SequenceRange != batch.SequenceRange {
+			return newConflictError(fmt.Sprintf("batch %s was uploaded with the sequence range %d-%d", batch.ID, kept.First, kept.Last))
+		}
+	}
+	return nil
+}
+
+// tooManyRangesError is returned when a sniffer leaves more than maxReceivedRanges gaps behind its acknowledged sequence
+func tooManyRangesError(sequence model.SnifferSequence) error {
+	return newValidationError(outOfRangeFieldError(HeaderSequenceRange,
+		fmt.Sprintf("more than %d ranges are received beyond %d, resend the missing packets first", maxReceivedRanges, sequence.Acknowledged)))
+}
+
+func setSequenceAck(ctx echo.Context, sequence model.SnifferSequence) {
+	ctx.Response().Header().Set(HeaderSequenceAck, strconv.FormatInt(sequence.Acknowledged, 10))
+}
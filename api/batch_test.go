@@ -0,0 +1,174 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cyucelen/wirect/model"
+	"github.com/cyucelen/wirect/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func sendBatch(packetAPI *PacketAPI, batchID, sequenceRange string, packets []model.SnifferPacket) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(packets)
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(payload))
+	req.Header.Set(HeaderBatchID, batchID)
+	req.Header.Set(HeaderSequenceRange, sequenceRange)
+	c, rec := createTestContext(req)
+	addSnifferMACParamToContext(c, defaultTestSnifferMAC)
+	serve(c, packetAPI.CreatePackets)
+	return rec
+}
+
+func createSequencedPacketAPI() (*PacketAPI, *test.InMemoryDB) {
+	db := &test.InMemoryDB{}
+	return &PacketAPI{DB: db, Sequencer: NewSequencer(db)}, db
+}
+
+func createSequencedPackets(count int) []model.SnifferPacket {
+	packets := []model.SnifferPacket{}
+	for i := 0; i < count; i++ {
+		packets = append(packets, model.SnifferPacket{MAC: "AA:AA:AA:AA:AA:01", Timestamp: time.Now().Unix(), RSSI: float64(-40 - i)})
+	}
+	return packets
+}
+
+func TestCreatePacketsInSequenceAreStoredOnce(t *testing.T) {
+	packetAPI, db := createSequencedPacketAPI()
+	packets := createSequencedPackets(3)
+
+	rec := sendBatch(packetAPI, "batch-1", "1-3", packets)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "3", rec.Header().Get(HeaderSequenceAck))
+	assert.Len(t, db.Packets, 3)
+
+	// the retry of an upload whose response was lost stores nothing
+	rec = sendBatch(packetAPI, "batch-1", "1-3", packets)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "3", rec.Header().Get(HeaderSequenceAck))
+	var result model.PacketCollectionResult
+	json.NewDecoder(rec.Body).Decode(&result)
+	assert.Equal(t, []int{0, 1, 2}, result.Duplicates)
+	assert.Empty(t, result.Accepted)
+	assert.Len(t, db.Packets, 3)
+
+	// a batch overlapping the acknowledged packets stores only the new ones
+	rec = sendBatch(packetAPI, "batch-2", "3-5", createSequencedPackets(3))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "5", rec.Header().Get(HeaderSequenceAck))
+	json.NewDecoder(rec.Body).Decode(&result)
+	assert.Equal(t, []int{0}, result.Duplicates)
+	assert.Len(t, db.Packets, 5)
+}
+
+func TestCreatePacketsInSequenceWithGap(t *testing.T) {
+	packetAPI, _ := createSequencedPacketAPI()
+
+	sendBatch(packetAPI, "a", "1-2", createSequencedPackets(2))
+	rec := sendBatch(packetAPI, "c", "5-6", createSequencedPackets(2))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get(HeaderSequenceAck))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	c, rec := createTestContext(req)
+	addSnifferMACParamToContext(c, defaultTestSnifferMAC)
+	serve(c, packetAPI.Sequencer.GetSequence)
+	var sequence model.SnifferSequence
+	json.NewDecoder(rec.Body).Decode(&sequence)
+	assert.Equal(t, int64(2), sequence.Acknowledged)
+	assert.Equal(t, model.SequenceRanges{{First: 5, Last: 6}}, sequence.Received)
+
+	// resending the gap acknowledges everything received
+	rec = sendBatch(packetAPI, "b", "3-4", createSequencedPackets(2))
+	assert.Equal(t, "6", rec.Header().Get(HeaderSequenceAck))
+}
+
+func TestResetSequence(t *testing.T) {
+	packetAPI, db := createSequencedPacketAPI()
+	sendBatch(packetAPI, "a", "1-2", createSequencedPackets(2))
+
+	req := httptest.NewRequest(http.MethodDelete, "/", nil)
+	c, rec := createTestContext(req)
+	addSnifferMACParamToContext(c, defaultTestSnifferMAC)
+	serve(c, packetAPI.Sequencer.ResetSequence)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get(HeaderSequenceAck))
+
+	// a reflashed sniffer numbering from 1 again is stored instead of acknowledged as a duplicate
+	rec = sendBatch(packetAPI, "a", "1-2", createSequencedPackets(2))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Len(t, db.Packets, 4)
+	assert.Empty(t, packetAPI.Sequencer.locks.locks)
+}
+
+func TestCreatePacketsInSequenceAcknowledgesRejectedPackets(t *testing.T) {
+	packetAPI, db := createSequencedPacketAPI()
+
+	rec := sendBatch(packetAPI, "a", "1-1", []model.SnifferPacket{{MAC: "not a mac", Timestamp: time.Now().Unix()}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get(HeaderSequenceAck))
+	assert.Empty(t, db.Packets)
+}
+
+func TestCreatePacketsInSequenceWithReusedBatchID(t *testing.T) {
+	packetAPI, db := createSequencedPacketAPI()
+
+	sendBatch(packetAPI, "a", "1-2", createSequencedPackets(2))
+	rec := sendBatch(packetAPI, "a", "3-4", createSequencedPackets(2))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Equal(t, CodeConflict, decodeError(rec).Code)
+	assert.Len(t, db.Packets, 2)
+}
+
+func TestCreatePacketsInSequenceWithTooManyGaps(t *testing.T) {
+	packetAPI, _ := createSequencedPacketAPI()
+
+	for i := 0; i < maxReceivedRanges; i++ {
+		first := int64(3 + 2*i)
+		rec := sendBatch(packetAPI, fmt.Sprintf("batch-%d", i), fmt.Sprintf("%d-%d", first, first), createSequencedPackets(1))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	}
+	rec := sendBatch(packetAPI, "last", "1000-1000", createSequencedPackets(1))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, HeaderSequenceRange, decodeError(rec).Details[0].Field)
+}
+
+func TestCreatePacketsWithNotValidBatchHeaders(t *testing.T) {
+	packetAPI, db := createSequencedPacketAPI()
+	packets := createSequencedPackets(2)
+
+	notValidHeaders := map[string][2]string{
+		HeaderBatchID:       {"", "1-2"},
+		HeaderSequenceRange: {"a", "1-3"},
+	}
+	for field, headers := range notValidHeaders {
+		rec := sendBatch(packetAPI, headers[0], headers[1], packets)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, field)
+		assert.Equal(t, field, decodeError(rec).Details[0].Field)
+	}
+	for _, sequenceRange := range []string{"1", "a-b", "0-1", "2-1", "-1-0"} {
+		rec := sendBatch(packetAPI, "a", sequenceRange, packets)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, sequenceRange)
+	}
+	rec := sendBatch(packetAPI, "bad\x7fid", "1-2", packets)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Empty(t, db.Packets)
+}
+
+func TestReceiveMergesRanges(t *testing.T) {
+	sequence := model.SnifferSequence{Acknowledged: 2, Received: model.SequenceRanges{{First: 6, Last: 7}, {First: 10, Last: 12}}}
+
+	assert.True(t, receive(&sequence, model.Batch{ID: "a", SequenceRange: model.SequenceRange{First: 8, Last: 9}}))
+	assert.Equal(t, int64(2), sequence.Acknowledged)
+	assert.Equal(t, model.SequenceRanges{{First: 6, Last: 12}}, sequence.Received)
+
+	assert.True(t, receive(&sequence, model.Batch{ID: "b", SequenceRange: model.SequenceRange{First: 3, Last: 5}}))
+	assert.Equal(t, int64(12), sequence.Acknowledged)
+	assert.Nil(t, sequence.Received)
+	assert.Len(t, sequence.Batches, 2)
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cyucelen/wirect/model"
+	"github.com/labstack/echo"
+)
+
+// maxRSSIOffset bounds the calibration offset of a sniffer, a larger difference means broken hardware or a bad calibration
+const maxRSSIOffset = 30
+
+// Bounds of the path loss exponent, 2 is free space and walls add up to about 4
+const minPathLossExponent = 1
+const maxPathLossExponent = 6
+
+const defaultCalibrationRange = 5 * time.Minute
+
+// maxCalibrationRange bounds the range of a calibration since every packet of the sniffer in the range is loaded at once
+const maxCalibrationRange = time.Hour
+
+// minCalibrationSamples is the number of packets of the reference device needed to average out the noise of RSSI
+const minCalibrationSamples = 5
+
+// maxCalibrationDistance is the largest distance of the reference device in meters
+const maxCalibrationDistance = 100
+
+type CalibrationDatabase interface {
+	PacketDatabase
+	SnifferDatabase
+}
+
+// CalibrationAPI derives the RSSI offset of a sniffer from a reference device at a known distance
+type CalibrationAPI struct {
+	DB    CalibrationDatabase
+	Clock clock.Clock
+	Model PathLossModel
+}
+
+// For returns the path loss model around the sniffer
+func (m PathLossModel) For(sniffer model.Sniffer) PathLossModel {
+	if sniffer.PathLossExponent != nil {
+		m.Exponent = *sniffer.PathLossExponent
+	}
+	return m
+}
+
+// RSSI returns the expected RSSI of a device distance meters away
+func (m PathLossModel) RSSI(distance float64) float64 {
+	return m.ReferenceRSSI - 10*m.Exponent*math.Log10(distance)
+}
+
+// calibrated returns the RSSI read by the sniffer as the reference hardware would read it
+func calibrated(sniffer model.Sniffer, rssi float64) float64 {
+	return rssi + sniffer.RSSIOffset
+}
+
+// Calibrate compares the mean RSSI of the reference device in the range with the RSSI the path loss model expects
+// at its distance and stores the difference as the RSSI offset of the sniffer.
+// The range defaults to the last five minutes, so the device can be placed and the request sent a few minutes later.
+func (c *CalibrationAPI) Calibrate(ctx echo.Context) error {
+	snifferMAC, err := getSnifferMAC(ctx)
+	if err != nil {
+		return err
+	}
+
+	request := new(model.CalibrationRequest)
+	if err := ctx.Bind(request); err != nil {
+		return newInvalidJSONError(err)
+	}
+	if fieldErrors := c.validate(request); len(fieldErrors) > 0 {
+		return newValidationError(fieldErrors...)
+	}
+	if err := checkRangeSpan(request.From, request.Until, maxCalibrationRange); err != nil {
+		return err
+	}
+
+	sniffer, err := findSniffer(ctx, c.DB, snifferMAC)
+	if err != nil {
+		return err
+	}
+
+	packets, err := c.DB.GetPacketsBySnifferBetweenDates(ctx.Request().Context(), snifferMAC, request.From, request.Until)
+	if err != nil {
+		return newDatabaseError(err)
+	}
+	total, samples := 0.0, 0
+	for _, packet := range packets {
+		if packet.MAC == request.DeviceMAC {
+			total += packet.RSSI
+			samples++
+		}
+	}
+	if samples < minCalibrationSamples {
+		message := fmt.Sprintf("the sniffer saw the device %d times in the range, at least %d are needed", samples, minCalibrationSamples)
+		return newValidationError(outOfRangeFieldError("deviceMAC", message))
+	}
+
+	pathLoss := c.Model.For(sniffer)
+	if request.ReferenceRSSI != 0 {
+		pathLoss.ReferenceRSSI = request.ReferenceRSSI
+	}
+	calibration := model.Calibration{
+		SnifferMAC:   snifferMAC,
+		DeviceMAC:    request.DeviceMAC,
+		Distance:     request.Distance,
+		From:         request.From,
+		Until:        request.Until,
+		Samples:      samples,
+		MeasuredRSSI: math.Round(total/float64(samples)*10) / 10,
+		ExpectedRSSI: math.Round(pathLoss.RSSI(request.Distance)*10) / 10,
+	}
+	calibration.RSSIOffset = math.Round((calibration.ExpectedRSSI-calibration.MeasuredRSSI)*10) / 10
+	if math.Abs(calibration.RSSIOffset) > maxRSSIOffset {
+		message := fmt.Sprintf("the offset %g is beyond %d, check the distance and the reference RSSI", calibration.RSSIOffset, maxRSSIOffset)
+		return newValidationError(outOfRangeFieldError("distance", message))
+	}
+
+	sniffer.RSSIOffset = calibration.RSSIOffset
+	if err := c.DB.UpdateSniffer(ctx.Request().Context(), &sniffer); err != nil {
+		return newDatabaseError(err)
+	}
+	return ctx.JSON(http.StatusOK, calibration)
+}
+
+func (c *CalibrationAPI) validate(request *model.CalibrationRequest) []model.FieldError {
+	fieldErrors := []model.FieldError{}
+
+	if request.DeviceMAC == "" {
+		fieldErrors = append(fieldErrors, requiredFieldError("deviceMAC"))
+	} else if mac, err := NormalizeMAC(request.DeviceMAC); err != nil {
+		fieldErrors = append(fieldErrors, invalidFieldError("deviceMAC", err.Error()))
+	} else {
+		request.DeviceMAC = mac
+	}
+
+	if !(request.Distance > 0 && request.Distance <= maxCalibrationDistance) {
+		fieldErrors = append(fieldErrors, outOfRangeFieldError("distance", fmt.Sprintf("distance must be more than 0 and at most %d meters", maxCalibrationDistance)))
+	}
+	if request.ReferenceRSSI > 0 {
+		fieldErrors = append(fieldErrors, outOfRangeFieldError("referenceRSSI", "referenceRSSI must be negative"))
+	}
+
+	if request.Until == 0 {
+		request.Until = orDefaultClock(c.Clock).Now().Unix()
+	}
+	if request.From == 0 {
+		request.From = request.Until - int64(defaultCalibrationRange/time.Second)
+	}
+	if request.From > request.Until {
+		fieldErrors = append(fieldErrors, outOfRangeFieldError("from", "from must not be after until"))
+	}
+
+	return fieldErrors
+}
+
+// findSniffer returns the registered sniffer with the MAC
+func findSniffer(ctx echo.Context, db SnifferDatabase, snifferMAC string) (model.Sniffer, error) {
+	sniffers, err := db.GetSniffers(ctx.Request().Context())
+	if err != nil {
+		return model.Sniffer{}, newDatabaseError(err)
+	}
+	for _, sniffer := range sniffers {
+		if sniffer.MAC == snifferMAC {
+			return sniffer, nil
+		}
+	}
+	return model.Sniffer{}, newNotFoundError("sniffer is not registered")
+}
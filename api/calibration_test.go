@@ -0,0 +1,147 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cyucelen/wirect/model"
+	"github.com/cyucelen/wirect/test"
+	"github.com/stretchr/testify/assert"
+)
+
+const referenceDeviceMAC = "CC:CC:CC:CC:CC:CC"
+
+func createCalibrationAPI(now time.Time, samples int, rssi float64) (*CalibrationAPI, *test.InMemoryDB) {
+	mockClock := clock.NewMock()
+	mockClock.Set(now)
+
+	db := &test.InMemoryDB{Sniffers: []model.Sniffer{{MAC: defaultTestSnifferMAC, Name: "hall"}}}
+	for i := 0; i < samples; i++ {
+		db.Packets = append(db.Packets, model.Packet{
+			SnifferMAC: defaultTestSnifferMAC, MAC: referenceDeviceMAC, RSSI: rssi + float64(i%3-1), Timestamp: now.Add(-time.Duration(i) * time.Second).Unix(),
+		})
+	}
+	db.Packets = append(db.Packets, model.Packet{SnifferMAC: defaultTestSnifferMAC, MAC: "DD:DD:DD:DD:DD:DD", RSSI: -90, Timestamp: now.Unix()})
+	return &CalibrationAPI{DB: db, Clock: mockClock, Model: DefaultPathLossModel}, db
+}
+
+func TestCalibrate(t *testing.T) {
+	now := time.Unix(100000, 0)
+	// the sniffer reads the device 10 meters away 6 dB weaker than the reference hardware
+	calibrationAPI, db := createCalibrationAPI(now, 6, rssiAt(10)-6)
+
+	request := model.CalibrationRequest{DeviceMAC: "cc-cc-cc-cc-cc-cc", Distance: 10}
+	rec := sendTestRequestToHandler(defaultTestSnifferMAC, request, calibrationAPI.Calibrate, http.MethodPost)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var calibration model.Calibration
+	json.NewDecoder(rec.Body).Decode(&calibration)
+	assert.Equal(t, referenceDeviceMAC, calibration.DeviceMAC)
+	assert.Equal(t, 6, calibration.Samples)
+	assert.Equal(t, now.Add(-defaultCalibrationRange).Unix(), calibration.From)
+	assert.Equal(t, -67.0, calibration.ExpectedRSSI)
+	assert.Equal(t, 6.0, calibration.RSSIOffset)
+
+	assert.Equal(t, 6.0, db.Sniffers[0].RSSIOffset)
+	assert.Equal(t, "hall", db.Sniffers[0].Name)
+}
+
+func TestCalibrateWithTooFewSamples(t *testing.T) {
+	calibrationAPI, db := createCalibrationAPI(time.Unix(100000, 0), minCalibrationSamples-1, -60)
+
+	request := model.CalibrationRequest{DeviceMAC: referenceDeviceMAC, Distance: 5}
+	rec := sendTestRequestToHandler(defaultTestSnifferMAC, request, calibrationAPI.Calibrate, http.MethodPost)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "deviceMAC", decodeError(rec).Details[0].Field)
+	assert.Zero(t, db.Sniffers[0].RSSIOffset)
+}
+
+func TestCalibrateWithImplausibleOffset(t *testing.T) {
+	calibrationAPI, db := createCalibrationAPI(time.Unix(100000, 0), 6, -20)
+
+	request := model.CalibrationRequest{DeviceMAC: referenceDeviceMAC, Distance: 50}
+	rec := sendTestRequestToHandler(defaultTestSnifferMAC, request, calibrationAPI.Calibrate, http.MethodPost)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Zero(t, db.Sniffers[0].RSSIOffset)
+}
+
+func TestCalibrateNotRegisteredSniffer(t *testing.T) {
+	calibrationAPI, _ := createCalibrationAPI(time.Unix(100000, 0), 6, -60)
+
+	request := model.CalibrationRequest{DeviceMAC: referenceDeviceMAC, Distance: 5}
+	rec := sendTestRequestToHandler("00:00:00:00:00:09", request, calibrationAPI.Calibrate, http.MethodPost)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestCalibrateWithNotValidRequest(t *testing.T) {
+	calibrationAPI, _ := createCalibrationAPI(time.Unix(100000, 0), 6, -60)
+
+	notValidRequests := map[string]model.CalibrationRequest{
+		"deviceMAC":     {Distance: 5},
+		"distance":      {DeviceMAC: referenceDeviceMAC, Distance: 0},
+		"referenceRSSI": {DeviceMAC: referenceDeviceMAC, Distance: 5, ReferenceRSSI: 10},
+		"from":          {DeviceMAC: referenceDeviceMAC, Distance: 5, From: 200, Until: 100},
+	}
+	for field, request := range notValidRequests {
+		rec := sendTestRequestToHandler(defaultTestSnifferMAC, request, calibrationAPI.Calibrate, http.MethodPost)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, field)
+		assert.Equal(t, field, decodeError(rec).Details[0].Field)
+	}
+	notValidMAC := model.CalibrationRequest{DeviceMAC: "not a mac", Distance: 5}
+	rec := sendTestRequestToHandler(defaultTestSnifferMAC, notValidMAC, calibrationAPI.Calibrate, http.MethodPost)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	tooLong := model.CalibrationRequest{DeviceMAC: referenceDeviceMAC, Distance: 5, From: 100000 - 2*3600, Until: 100000}
+	rec = sendTestRequestToHandler(defaultTestSnifferMAC, tooLong, calibrationAPI.Calibrate, http.MethodPost)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "out_of_range", decodeError(rec).Details[0].Code)
+}
+
+func TestGetRoutersAppliesCalibration(t *testing.T) {
+	db := &test.InMemoryDB{
+		Sniffers: []model.Sniffer{{MAC: defaultTestSnifferMAC, RSSIOffset: 4.5}},
+		Routers:  []model.Router{{SnifferMAC: defaultTestSnifferMAC, SSID: "eduroam", RSSI: -70}, {SnifferMAC: defaultTestSnifferMAC, SSID: "guest"}},
+	}
+	routerAPI := RouterAPI{DB: db, Sniffers: db}
+
+	rec := sendTestRequestToHandler(defaultTestSnifferMAC, nil, routerAPI.GetRouters, http.MethodGet)
+	var routers []model.RouterExternal
+	json.NewDecoder(rec.Body).Decode(&routers)
+	assert.Equal(t, []model.RouterExternal{{SSID: "eduroam", RSSI: -65.5}, {SSID: "guest"}}, routers)
+
+	// sniffers which are not registered are not calibrated
+	db.Sniffers = nil
+	rec = sendTestRequestToHandler(defaultTestSnifferMAC, nil, routerAPI.GetRouters, http.MethodGet)
+	json.NewDecoder(rec.Body).Decode(&routers)
+	assert.Equal(t, -70.0, routers[0].RSSI)
+}
+
+func TestGetHeatmapAppliesCalibration(t *testing.T) {
+	now := time.Unix(100000, 0)
+	positioningAPI := createPositioningAPI(now)
+	db := positioningAPI.DB.(*test.InMemoryDB)
+	// the second sniffer reads 10 dB weaker, so the device at 5,3 is located at 5,3 only when it is calibrated
+	for i := range db.Packets {
+		if db.Packets[i].SnifferMAC == "00:00:00:00:00:02" {
+			db.Packets[i].RSSI -= 10
+		}
+	}
+	db.Sniffers[1].RSSIOffset = 10
+
+	rec := sendHeatmapRequest(positioningAPI, "1", "cellSize=2")
+	var heatmap model.Heatmap
+	json.NewDecoder(rec.Body).Decode(&heatmap)
+	assert.Equal(t, 1, heatmap.Cells[3][4])
+}
+
+func TestPathLossModelForSniffer(t *testing.T) {
+	exponent := 2.0
+	pathLoss := DefaultPathLossModel.For(model.Sniffer{PathLossExponent: &exponent})
+	assert.Equal(t, 2.0, pathLoss.Exponent)
+	assert.Equal(t, DefaultPathLossModel.ReferenceRSSI, pathLoss.ReferenceRSSI)
+	assert.InDelta(t, -60, pathLoss.RSSI(10), 1e-9)
+	assert.Equal(t, DefaultPathLossModel, DefaultPathLossModel.For(model.Sniffer{}))
+}
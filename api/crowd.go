@@ -1,9 +1,12 @@
 package api
 
 import (
+	"context"
+	"fmt"
+	"math"
 	"net/http"
-	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/benbjohnson/clock"
@@ -19,88 +22,218 @@ type CrowdDatabase interface {
 }
 
 type CrowdAPI struct {
-	DB                CrowdDatabase
-	Interval          time.Duration
-	intervalInSeconds int64
-	clock             clock.Clock
+	DB         CrowdDatabase
+	Interval   time.Duration
+	MaxBuckets int64
+	clock      clock.Clock
 }
 
 type CrowdParams struct {
 	from           int64
 	until          int64
 	forEverySecond int64
+	windowSeconds  int64
 }
 
 const defaultCalculationInterval = 5 * time.Minute
+const defaultMaxBuckets = 1000
+const defaultCrowdRange = 10 * time.Minute
+const defaultCrowdStep = time.Minute
 
 func CreateCrowdAPI(db CrowdDatabase, options ...Option) *CrowdAPI {
-	crowdAPI := &CrowdAPI{DB: db, Interval: defaultCalculationInterval, clock: clock.New()}
+	crowdAPI := &CrowdAPI{DB: db, Interval: defaultCalculationInterval, MaxBuckets: defaultMaxBuckets, clock: clock.New()}
 
 	for i := range options {
 		options[i](crowdAPI)
 	}
 
-	crowdAPI.intervalInSeconds = int64(crowdAPI.Interval / time.Second)
-
 	return crowdAPI
 }
 
 func (c *CrowdAPI) GetCrowd(ctx echo.Context) error {
-	snifferMAC, _ := url.QueryUnescape(ctx.Param("snifferMAC")) // TODO: test error case
-	params := c.getCrowdParams(ctx)
-	crowd := c.getCrowdBetweenDates(ctx, snifferMAC, params.from, params.until, params.forEverySecond)
-	ctx.JSON(http.StatusOK, crowd)
-	return nil
+	snifferMAC, err := getSnifferMAC(ctx)
+	if err != nil {
+		return err
+	}
+	params, err := c.getCrowdParams(ctx)
+	if err != nil {
+		return err
+	}
+	crowd, err := c.getCrowdBetweenDates(ctx.Request().Context(), snifferMAC, params)
+	if err != nil {
+		return newDatabaseError(err)
+	}
+	return ctx.JSON(http.StatusOK, crowd)
 }
 
 func (c *CrowdAPI) GetTotalSniffedMACDaily(ctx echo.Context) error {
-	snifferMAC, _ := url.QueryUnescape(ctx.Param("snifferMAC"))
+	snifferMAC, err := getSnifferMAC(ctx)
+	if err != nil {
+		return err
+	}
 	now := c.clock.Now()
-	totalSniffedCount := c.DB.GetUniqueMACCountBySnifferBetweenDates(snifferMAC, now.AddDate(0, 0, -1).Unix(), now.Unix())
-	ctx.JSON(http.StatusOK, model.TotalSniffed{Count: totalSniffedCount})
-	return nil
+	totalSniffedCount, err := c.DB.GetUniqueMACCountBySnifferBetweenDates(ctx.Request().Context(), snifferMAC, now.AddDate(0, 0, -1).Unix(), now.Unix())
+	if err != nil {
+		return newDatabaseError(err)
+	}
+	return ctx.JSON(http.StatusOK, model.TotalSniffed{Count: totalSniffedCount})
 }
 
-func (c *CrowdAPI) getCrowdBetweenDates(ctx echo.Context, snifferMAC string, from, until, forEverySeconds int64) []model.Crowd {
+// CurrentCrowd calculates the crowd around the sniffer at the moment
+func (c *CrowdAPI) CurrentCrowd(ctx context.Context, snifferMAC string) (model.Crowd, error) {
+	return c.getCrowd(ctx, snifferMAC, c.clock.Now().Unix(), int64(c.Interval/time.Second))
+}
+
+// CurrentCrowds calculates the crowd around every sniffer at the moment with a single query,
+// sniffers which did not sniff any MAC are left out
+func (c *CrowdAPI) CurrentCrowds(ctx context.Context) (map[string]int, error) {
+	now := c.clock.Now().Unix()
+	return c.DB.GetUniqueMACCountsBetweenDates(ctx, now-int64(c.Interval/time.Second), now)
+}
+
+func (c *CrowdAPI) getCrowdBetweenDates(ctx context.Context, snifferMAC string, params CrowdParams) ([]model.Crowd, error) {
 	crowd := []model.Crowd{}
 
-	for t := from; t < until; t += forEverySeconds {
-		crowd = append(crowd, c.getCrowd(snifferMAC, t))
+	for t := params.from; t < params.until; t += params.forEverySecond {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		bucket, err := c.getCrowd(ctx, snifferMAC, t, params.windowSeconds)
+		if err != nil {
+			return nil, err
+		}
+		crowd = append(crowd, bucket)
+	}
+	bucket, err := c.getCrowd(ctx, snifferMAC, params.until, params.windowSeconds)
+	if err != nil {
+		return nil, err
 	}
-	crowd = append(crowd, c.getCrowd(snifferMAC, until))
 
-	return crowd
+	return append(crowd, bucket), nil
 }
 
-func (c *CrowdAPI) getCrowd(snifferMAC string, when int64) model.Crowd {
-	count := c.DB.GetUniqueMACCountBySnifferBetweenDates(snifferMAC, when-c.intervalInSeconds, when)
+func (c *CrowdAPI) getCrowd(ctx context.Context, snifferMAC string, when, windowSeconds int64) (model.Crowd, error) {
+	count, err := c.DB.GetUniqueMACCountBySnifferBetweenDates(ctx, snifferMAC, when-windowSeconds, when)
+	if err != nil {
+		return model.Crowd{}, err
+	}
 	return model.Crowd{
 		Count: count,
 		Time:  time.Unix(when, 0),
+	}, nil
+}
+
+// getCrowdParams reads the optional from, until, for and window query parameters.
+// Missing parameters default to the crowd of the last 10 minutes for every minute.
+func (c *CrowdAPI) getCrowdParams(ctx echo.Context) (CrowdParams, error) {
+	now := c.clock.Now()
+	fieldErrors := []model.FieldError{}
+
+	until, fieldError := parseTimeParam(ctx, "until", now, now)
+	fieldErrors = append(fieldErrors, fieldError...)
+
+	from, fieldError := parseTimeParam(ctx, "from", now, until.Add(-defaultCrowdRange))
+	fieldErrors = append(fieldErrors, fieldError...)
+
+	forEvery, fieldError := parseDurationParam(ctx, "for", defaultCrowdStep)
+	fieldErrors = append(fieldErrors, fieldError...)
+
+	window, fieldError := parseDurationParam(ctx, "window", c.Interval)
+	fieldErrors = append(fieldErrors, fieldError...)
+
+	if len(fieldErrors) > 0 {
+		return CrowdParams{}, newValidationError(fieldErrors...)
+	}
+
+	params := CrowdParams{
+		from:           from.Unix(),
+		until:          until.Unix(),
+		forEverySecond: int64(forEvery / time.Second),
+		windowSeconds:  int64(window / time.Second),
+	}
+
+	if params.from > params.until {
+		fieldErrors = append(fieldErrors, outOfRangeFieldError("from", "from must not be after until"))
 	}
+	if params.forEverySecond < 1 {
+		fieldErrors = append(fieldErrors, outOfRangeFieldError("for", "for must be at least 1 second"))
+	}
+	if params.windowSeconds < 1 {
+		fieldErrors = append(fieldErrors, outOfRangeFieldError("window", "window must be at least 1 second"))
+	}
+	if len(fieldErrors) > 0 {
+		return CrowdParams{}, newValidationError(fieldErrors...)
+	}
+
+	// from and until are bounded by parseTimeParam, a negative span can only come from an overflow
+	span := params.until - params.from
+	if span < 0 {
+		return CrowdParams{}, newValidationError(outOfRangeFieldError("from", "range from until is too long"))
+	}
+	if buckets := span/params.forEverySecond + 1; buckets > c.MaxBuckets {
+		message := fmt.Sprintf("range from %d until %d for every %d seconds has %d buckets, at most %d are allowed",
+			params.from, params.until, params.forEverySecond, buckets, c.MaxBuckets)
+		return CrowdParams{}, newValidationError(outOfRangeFieldError("for", message))
+	}
+
+	return params, nil
 }
 
-func (c *CrowdAPI) getCrowdParams(ctx echo.Context) CrowdParams {
-	params := ctx.QueryParams()
-	from, fromExists := params["from"]
-	until, untilExists := params["until"]
-	forEvery, forExists := params["for"]
+// Times of query parameters are between the years 1 and 9999 so the number of seconds between two of them cannot overflow
+const (
+	minParamSeconds = -62135596800
+	maxParamSeconds = 253402300799
+)
 
-	crowdParams := CrowdParams{}
+// parseTimeParam accepts unix seconds, RFC3339 or a duration relative to now such as -2h
+func parseTimeParam(ctx echo.Context, name string, now, defaultValue time.Time) (time.Time, []model.FieldError) {
+	value := ctx.QueryParam(name)
+	if value == "" {
+		return defaultValue, nil
+	}
 
-	if fromExists && untilExists && forExists {
-		crowdParams.from, _ = strconv.ParseInt(from[0], 10, 64)
-		crowdParams.until, _ = strconv.ParseInt(until[0], 10, 64)
-		crowdParams.forEverySecond, _ = strconv.ParseInt(forEvery[0], 10, 64)
-		return crowdParams
+	t, parsed := now, value == "now"
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		t, parsed = time.Unix(seconds, 0), true
+	} else if rfc3339, err := time.Parse(time.RFC3339, value); err == nil {
+		t, parsed = rfc3339, true
+	} else if strings.HasPrefix(value, "-") || strings.HasPrefix(value, "+") {
+		if offset, err := time.ParseDuration(value); err == nil {
+			t, parsed = now.Add(offset), true
+		}
 	}
 
-	now := c.clock.Now()
+	if !parsed {
+		message := name + " must be unix seconds, an RFC3339 time or a relative duration such as -2h"
+		return time.Time{}, []model.FieldError{invalidFieldError(name, message)}
+	}
+	if t.Unix() < minParamSeconds || t.Unix() > maxParamSeconds {
+		return time.Time{}, []model.FieldError{outOfRangeFieldError(name, name+" must be between the years 1 and 9999")}
+	}
+	return t, nil
+}
+
+const maxDurationSeconds = int64(math.MaxInt64 / time.Second)
+
+// parseDurationParam accepts seconds or a duration such as 30s
+func parseDurationParam(ctx echo.Context, name string, defaultValue time.Duration) (time.Duration, []model.FieldError) {
+	value := ctx.QueryParam(name)
+	if value == "" {
+		return defaultValue, nil
+	}
 
-	crowdParams.from = now.Add(-10 * time.Minute).Unix()
-	crowdParams.until = now.Unix()
-	crowdParams.forEverySecond = 60
-	return crowdParams
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		// a duration holds about 292 years of seconds, more would overflow
+		if seconds > maxDurationSeconds || seconds < -maxDurationSeconds {
+			return 0, []model.FieldError{outOfRangeFieldError(name, fmt.Sprintf("%s must be at most %d seconds", name, maxDurationSeconds))}
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return duration, nil
+	}
+
+	return 0, []model.FieldError{invalidFieldError(name, name+" must be seconds or a duration such as 30s")}
 }
 
 func SetCrowdCalculationInterval(interval time.Duration) Option {
@@ -109,6 +242,12 @@ func SetCrowdCalculationInterval(interval time.Duration) Option {
 	}
 }
 
+func SetCrowdMaxBuckets(maxBuckets int64) Option {
+	return func(crowdAPI *CrowdAPI) {
+		crowdAPI.MaxBuckets = maxBuckets
+	}
+}
+
 func SetCrowdClock(clock clock.Clock) Option {
 	return func(crowdAPI *CrowdAPI) {
 		crowdAPI.clock = clock
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -105,6 +106,20 @@ func TestGetTotalSniffedMACDaily(t *testing.T) {
 	assert.Equal(t, expectedTotalSniffed, actualTotalSniffed)
 }
 
+func TestGetCrowdWithCanceledRequest(t *testing.T) {
+	crowdAPI := CreateCrowdAPI(createDBContainsPacketsOfTwoUniquePerson(time.Now(), "11:22:00:33:44:55"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	c, rec := createTestContext(req)
+	addSnifferMACParamToContext(c, "11:22:00:33:44:55")
+	serve(c, crowdAPI.GetCrowd)
+
+	assert.Equal(t, StatusClientClosedRequest, rec.Code)
+	assert.Equal(t, CodeClientAborted, decodeError(rec).Code)
+}
+
 func createDBContainsPacketsOfTwoUniquePerson(now time.Time, snifferMAC string) *test.InMemoryDB {
 	db := &test.InMemoryDB{}
 
@@ -141,8 +156,94 @@ func createDBContainsPacketsOfTwoUniquePerson(now time.Time, snifferMAC string)
 		},
 	}
 	for _, packet := range packets {
-		db.CreatePacket(&packet)
+		db.CreatePacket(context.Background(), &packet)
 	}
 
 	return db
 }
+
+func sendGetCrowdRequest(crowdAPI *CrowdAPI, snifferMAC string, query url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/?"+query.Encode(), nil)
+	c, rec := createTestContext(req)
+	c.SetPath("/sniffers/:snifferMAC/crowd")
+	c.SetParamNames("snifferMAC")
+	c.SetParamValues(url.QueryEscape(snifferMAC))
+	serve(c, crowdAPI.GetCrowd)
+	return rec
+}
+
+func TestGetCrowdWithPartialAndRelativeParams(t *testing.T) {
+	mockClock := clock.NewMock()
+	mockClock.Add(1 * time.Hour)
+	now := mockClock.Now()
+	snifferMAC := "11:22:00:33:44:55"
+	mockPacketDB := createDBContainsPacketsOfTwoUniquePerson(now, snifferMAC)
+
+	crowdAPI := CreateCrowdAPI(mockPacketDB, SetCrowdClock(mockClock), SetCrowdCalculationInterval(5*time.Minute))
+
+	testCases := []struct {
+		query         url.Values
+		expectedCrowd []model.Crowd
+	}{
+		{
+			query:         url.Values{"from": {"-20s"}, "for": {"20s"}},
+			expectedCrowd: []model.Crowd{{Count: 0, Time: now.Add(-20 * time.Second)}, {Count: 2, Time: now}},
+		},
+		{
+			query:         url.Values{"from": {now.Add(-10 * time.Second).UTC().Format(time.RFC3339)}, "until": {"now"}, "for": {"10"}},
+			expectedCrowd: []model.Crowd{{Count: 2, Time: now.Add(-10 * time.Second)}, {Count: 2, Time: now}},
+		},
+		{
+			query:         url.Values{"from": {"-1m"}, "for": {"1m"}, "window": {"6s"}},
+			expectedCrowd: []model.Crowd{{Count: 0, Time: now.Add(-1 * time.Minute)}, {Count: 1, Time: now}},
+		},
+	}
+
+	for _, testCase := range testCases {
+		rec := sendGetCrowdRequest(crowdAPI, snifferMAC, testCase.query)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var actualCrowd []model.Crowd
+		json.NewDecoder(rec.Body).Decode(&actualCrowd)
+		for i := range actualCrowd {
+			actualCrowd[i].Time = actualCrowd[i].Time.Local()
+		}
+		assert.Equal(t, testCase.expectedCrowd, actualCrowd, testCase.query.Encode())
+	}
+}
+
+func TestGetCrowdWithInvalidParams(t *testing.T) {
+	mockClock := clock.NewMock()
+	mockClock.Add(1 * time.Hour)
+	crowdAPI := CreateCrowdAPI(&test.InMemoryDB{}, SetCrowdClock(mockClock), SetCrowdMaxBuckets(100))
+
+	testCases := []struct {
+		query         url.Values
+		expectedField string
+	}{
+		{query: url.Values{"from": {"yesterday"}}, expectedField: "from"},
+		{query: url.Values{"until": {"12:00"}}, expectedField: "until"},
+		{query: url.Values{"for": {"0"}}, expectedField: "for"},
+		{query: url.Values{"for": {"-10s"}}, expectedField: "for"},
+		{query: url.Values{"for": {"often"}}, expectedField: "for"},
+		{query: url.Values{"window": {"0s"}}, expectedField: "window"},
+		{query: url.Values{"from": {"-1h"}, "until": {"-2h"}}, expectedField: "from"},
+		{query: url.Values{"from": {"-1h"}, "for": {"1s"}}, expectedField: "for"},
+		{query: url.Values{"from": {"-9223372036854775000"}, "for": {"1"}}, expectedField: "from"},
+		{query: url.Values{"until": {"9223372036854775000"}}, expectedField: "until"},
+		{query: url.Values{"from": {"-62135596800"}, "until": {"253402300799"}, "for": {"1"}}, expectedField: "for"},
+		{query: url.Values{"for": {"9223372036854775"}}, expectedField: "for"},
+		{query: url.Values{"window": {"-9223372036854775"}}, expectedField: "window"},
+	}
+
+	for _, testCase := range testCases {
+		rec := sendGetCrowdRequest(crowdAPI, "11:22:00:33:44:55", testCase.query)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, testCase.query.Encode())
+
+		actualError := decodeError(rec)
+		assert.Equal(t, CodeValidationFailed, actualError.Code)
+		if assert.Len(t, actualError.Details, 1, testCase.query.Encode()) {
+			assert.Equal(t, testCase.expectedField, actualError.Details[0].Field)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+)
+
+var errBodyTooLarge = errors.New("request body is too large")
+
+// DecompressBody is a middleware which inflates request bodies sent with a gzip or deflate Content-Encoding,
+// deflate being the zlib format as in HTTP. Bodies longer than maxSize once inflated, or as they are when they are not
+// compressed, fail to read. Zero does not limit them.
+func DecompressBody(maxSize int64) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			req := ctx.Request()
+			var body io.ReadCloser
+			var err error
+			switch encoding := strings.ToLower(strings.TrimSpace(req.Header.Get(echo.HeaderContentEncoding))); encoding {
+			case "", "identity":
+				req.Body = &limitedBody{ReadCloser: req.Body, remaining: maxSize, limited: maxSize > 0}
+				return next(ctx)
+			case "gzip", "x-gzip":
+				body, err = gzip.NewReader(req.Body)
+			case "deflate":
+				body, err = zlib.NewReader(req.Body)
+			default:
+				return newError(http.StatusUnsupportedMediaType, codeOfStatus(http.StatusUnsupportedMediaType),
+					fmt.Sprintf("Content-Encoding %s is not supported, use gzip or deflate", encoding))
+			}
+			if err != nil {
+				e := newError(http.StatusBadRequest, CodeBadRequest, "request body does not match its Content-Encoding")
+				e.Internal = err
+				return e
+			}
+
+			compressed := req.Body
+			defer compressed.Close()
+			req.Body = &limitedBody{ReadCloser: body, remaining: maxSize, limited: maxSize > 0}
+			req.Header.Del(echo.HeaderContentEncoding)
+			req.Header.Del(echo.HeaderContentLength)
+			req.ContentLength = -1
+			return next(ctx)
+		}
+	}
+}
+
+// limitedBody fails with errBodyTooLarge once more than its limit was read
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	limited   bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if !b.limited {
+		return b.ReadCloser.Read(p)
+	}
+	if b.remaining < 0 {
+		return 0, errBodyTooLarge
+	}
+	// read one byte beyond the limit to tell a body of exactly the limit from a longer one
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		// the bytes up to the limit are still read, so a stream keeps the lines before it
+		return n + int(b.remaining), errBodyTooLarge
+	}
+	return n, err
+}
+
+// newBodyReadError is returned when the body of a request could not be read
+func newBodyReadError(err error) *Error {
+	e := newError(http.StatusBadRequest, CodeBadRequest, "request body could not be read")
+	if err == errBodyTooLarge {
+		e = newError(http.StatusRequestEntityTooLarge, codeOfStatus(http.StatusRequestEntityTooLarge), err.Error())
+	}
+	e.Internal = err
+	return e
+}
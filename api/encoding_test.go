@@ -0,0 +1,169 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cyucelen/wirect/model"
+	"github.com/cyucelen/wirect/packetcodec"
+	"github.com/cyucelen/wirect/test"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func sendEncodedRequest(handler handlerFunc, contentType, contentEncoding string, body []byte, maxSize int64) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	c, rec := createTestContext(req)
+	req.Header.Set(echo.HeaderContentType, contentType)
+	if contentEncoding != "" {
+		req.Header.Set(echo.HeaderContentEncoding, contentEncoding)
+	}
+	addSnifferMACParamToContext(c, defaultTestSnifferMAC)
+	serve(c, handlerFunc(DecompressBody(maxSize)(echo.HandlerFunc(handler))))
+	return rec
+}
+
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	var buf bytes.Buffer
+	var writer io.WriteCloser
+	if encoding == "gzip" {
+		writer = gzip.NewWriter(&buf)
+	} else {
+		writer = zlib.NewWriter(&buf)
+	}
+	_, err := writer.Write(data)
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Close())
+	return buf.Bytes()
+}
+
+func createEncodedPackets(count int) []model.SnifferPacket {
+	packets := []model.SnifferPacket{}
+	for i := 0; i < count; i++ {
+		packets = append(packets, model.SnifferPacket{MAC: "AA:AA:AA:AA:AA:01", Timestamp: time.Now().Unix() - int64(i), RSSI: float64(-40 - i%50)})
+	}
+	return packets
+}
+
+func TestCreatePacketsFromBinaryBatch(t *testing.T) {
+	for _, contentEncoding := range []string{"", "gzip", "deflate"} {
+		t.Run(contentEncoding, func(t *testing.T) {
+			db := &test.InMemoryDB{}
+			packetAPI := &PacketAPI{DB: db}
+			body, _ := packetcodec.Encode(createEncodedPackets(3), true)
+			if contentEncoding != "" {
+				body = compress(t, contentEncoding, body)
+			}
+
+			rec := sendEncodedRequest(packetAPI.CreatePackets, packetcodec.MIMEType, contentEncoding, body, 1<<20)
+
+			assert.Equal(t, http.StatusCreated, rec.Code)
+			assert.Len(t, db.Packets, 3)
+			assert.Equal(t, "AA:AA:AA:AA:AA:01", db.Packets[2].MAC)
+			assert.Equal(t, float64(-42), db.Packets[2].RSSI)
+		})
+	}
+}
+
+func TestCreatePacketFromBinaryBatch(t *testing.T) {
+	db := &test.InMemoryDB{}
+	packetAPI := &PacketAPI{DB: db}
+
+	body, _ := packetcodec.Encode(createEncodedPackets(1), false)
+	rec := sendEncodedRequest(packetAPI.CreatePacket, packetcodec.MIMEType+"; charset=binary", "", body, 0)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Len(t, db.Packets, 1)
+
+	body, _ = packetcodec.Encode(createEncodedPackets(2), false)
+	rec = sendEncodedRequest(packetAPI.CreatePacket, packetcodec.MIMEType, "", body, 0)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, CodeInvalidBinary, decodeError(rec).Code)
+	assert.Len(t, db.Packets, 1)
+}
+
+func TestCreatePacketsFromCorruptedBinaryBatch(t *testing.T) {
+	db := &test.InMemoryDB{}
+	body, _ := packetcodec.Encode(createEncodedPackets(3), true)
+	body[len(body)-1] ^= 0xFF
+
+	rec := sendEncodedRequest((&PacketAPI{DB: db}).CreatePackets, packetcodec.MIMEType, "", body, 0)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, CodeInvalidBinary, decodeError(rec).Code)
+	assert.Empty(t, db.Packets)
+}
+
+func TestCreatePacketsFromCompressedJSON(t *testing.T) {
+	db := &test.InMemoryDB{}
+	payload, _ := json.Marshal(createEncodedPackets(2))
+
+	rec := sendEncodedRequest((&PacketAPI{DB: db}).CreatePackets, echo.MIMEApplicationJSON, "gzip", compress(t, "gzip", payload), 1<<20)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Len(t, db.Packets, 2)
+}
+
+func TestCreatePacketStreamFromCompressedBody(t *testing.T) {
+	db := &test.InMemoryDB{}
+	body := compress(t, "deflate", []byte(streamLine(-40)+"\n"+streamLine(-50)+"\n"))
+
+	rec := sendEncodedRequest((&PacketAPI{DB: db}).CreatePacketStream, MIMEApplicationNDJSON, "deflate", body, 0)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Len(t, db.Packets, 2)
+}
+
+func TestDecompressBodyBeyondMaxSize(t *testing.T) {
+	db := &test.InMemoryDB{}
+	payload, _ := json.Marshal(createEncodedPackets(100))
+	body := compress(t, "gzip", payload)
+
+	rec := sendEncodedRequest((&PacketAPI{DB: db}).CreatePackets, echo.MIMEApplicationJSON, "gzip", body, int64(len(payload)-1))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	binary, _ := packetcodec.Encode(createEncodedPackets(100), false)
+	rec = sendEncodedRequest((&PacketAPI{DB: db}).CreatePackets, packetcodec.MIMEType, "gzip", compress(t, "gzip", binary), int64(len(binary)-1))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Empty(t, db.Packets)
+
+	// a body of exactly the limit is read
+	rec = sendEncodedRequest((&PacketAPI{DB: db}).CreatePackets, packetcodec.MIMEType, "gzip", compress(t, "gzip", binary), int64(len(binary)))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+}
+
+func TestDecompressBodyLimitsUncompressedBody(t *testing.T) {
+	db := &test.InMemoryDB{}
+	binary, _ := packetcodec.Encode(createEncodedPackets(100), false)
+
+	rec := sendEncodedRequest((&PacketAPI{DB: db}).CreatePackets, packetcodec.MIMEType, "", binary, int64(len(binary)-1))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	payload, _ := json.Marshal(createEncodedPackets(100))
+	rec = sendEncodedRequest((&PacketAPI{DB: db}).CreatePackets, echo.MIMEApplicationJSON, "", payload, int64(len(payload)-1))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Empty(t, db.Packets)
+
+	body := []byte(streamLine(-40) + "\n" + streamLine(-50) + "\n")
+	rec = sendEncodedRequest((&PacketAPI{DB: db}).CreatePacketStream, MIMEApplicationNDJSON, "", body, int64(len(body)/2+1))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Len(t, db.Packets, 1)
+	var result model.PacketStreamResult
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	assert.Equal(t, 1, result.Accepted)
+	assert.Equal(t, 2, result.FailedLine)
+}
+
+func TestDecompressBodyWithUnknownEncoding(t *testing.T) {
+	rec := sendEncodedRequest((&PacketAPI{DB: &test.InMemoryDB{}}).CreatePackets, echo.MIMEApplicationJSON, "br", []byte("[]"), 0)
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+
+	rec = sendEncodedRequest((&PacketAPI{DB: &test.InMemoryDB{}}).CreatePackets, echo.MIMEApplicationJSON, "gzip", []byte("[]"), 0)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
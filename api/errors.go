@@ -0,0 +1,173 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/cyucelen/wirect/model"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+)
+
+// Error codes which are sent to clients in model.Error
+const (
+	CodeBadRequest       = "bad_request"
+	CodeInvalidJSON      = "invalid_json"
+	CodeInvalidBinary    = "invalid_binary"
+	CodeValidationFailed = "validation_failed"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeInternal         = "internal_error"
+	CodeDatabaseTimeout  = "database_timeout"
+	CodeDatabaseBusy     = "database_busy"
+	CodeClientAborted    = "client_aborted"
+)
+
+// StatusClientClosedRequest is the non-standard status of requests whose client went away before the response,
+// it only shows up in logs and metrics
+const StatusClientClosedRequest = 499
+
+// Error is returned by handlers and rendered by HTTPErrorHandler
+type Error struct {
+	Status   int
+	Body     model.Error
+	Internal error
+	// Response is rendered instead of Body if it is set, such as a result which tells what succeeded before the error
+	Response interface{}
+}
+
+func (e *Error) Error() string {
+	if e.Internal != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Body.Code, e.Body.Message, e.Internal)
+	}
+	return fmt.Sprintf("%s: %s", e.Body.Code, e.Body.Message)
+}
+
+func newError(status int, code, message string, details ...model.FieldError) *Error {
+	return &Error{Status: status, Body: model.Error{Code: code, Message: message, Details: details}}
+}
+
+func newInvalidJSONError(err error) *Error {
+	if he, ok := err.(*echo.HTTPError); ok && he.Internal == errBodyTooLarge {
+		return newBodyReadError(he.Internal)
+	}
+	e := newError(http.StatusBadRequest, CodeInvalidJSON, "request body is not valid JSON")
+	if he, ok := err.(*echo.HTTPError); ok {
+		e.Body.Message = fmt.Sprint(he.Message)
+	}
+	e.Internal = err
+	return e
+}
+
+func newValidationError(details ...model.FieldError) *Error {
+	return newError(http.StatusBadRequest, CodeValidationFailed, "request payload is not valid", details...)
+}
+
+func newNotFoundError(message string) *Error {
+	return newError(http.StatusNotFound, CodeNotFound, message)
+}
+
+func newConflictError(message string) *Error {
+	return newError(http.StatusConflict, CodeConflict, message)
+}
+
+func newInternalError(err error) *Error {
+	e := newError(http.StatusInternalServerError, CodeInternal, "internal server error")
+	e.Internal = err
+	return e
+}
+
+// newDatabaseError tells apart queries which ran out of time or found the database locked,
+// both of which are worth retrying, from queries canceled because the client went away and other failures
+func newDatabaseError(err error) *Error {
+	var e *Error
+	switch {
+	case err == context.Canceled:
+		e = newError(StatusClientClosedRequest, CodeClientAborted, "client closed the request")
+	case err == context.DeadlineExceeded:
+		e = newError(http.StatusServiceUnavailable, CodeDatabaseTimeout, "database did not answer in time")
+	case strings.Contains(err.Error(), "database is locked"):
+		e = newError(http.StatusServiceUnavailable, CodeDatabaseBusy, "database is busy")
+	default:
+		e = newError(http.StatusInternalServerError, CodeInternal, "internal server error")
+	}
+	e.Internal = err
+	return e
+}
+
+func requiredFieldError(field string) model.FieldError {
+	return model.FieldError{Field: field, Code: "required", Message: field + " is required"}
+}
+
+func invalidFieldError(field, message string) model.FieldError {
+	return model.FieldError{Field: field, Code: "invalid", Message: message}
+}
+
+func outOfRangeFieldError(field, message string) model.FieldError {
+	return model.FieldError{Field: field, Code: "out_of_range", Message: message}
+}
+
+// HTTPErrorHandler renders errors returned by handlers as model.Error
+func HTTPErrorHandler(err error, ctx echo.Context) {
+	e := toError(err)
+	setOutcome(ctx, e.Body.Code)
+
+	switch {
+	case e.Status == StatusClientClosedRequest:
+		logWarn(ctx, "client aborted request", log.JSON{"error": e.Error()})
+	case e.Status >= http.StatusInternalServerError:
+		logError(ctx, "request failed", log.JSON{"error": e.Error()})
+	}
+
+	if ctx.Response().Committed {
+		return
+	}
+
+	var renderErr error
+	if ctx.Request().Method == http.MethodHead {
+		renderErr = ctx.NoContent(e.Status)
+	} else if e.Response != nil {
+		renderErr = ctx.JSON(e.Status, e.Response)
+	} else {
+		renderErr = ctx.JSON(e.Status, e.Body)
+	}
+	if renderErr != nil {
+		logError(ctx, "rendering error response failed", log.JSON{"error": renderErr.Error()})
+	}
+}
+
+// ErrorStatus returns the status code HTTPErrorHandler responds to err with
+func ErrorStatus(err error) int {
+	return toError(err).Status
+}
+
+func toError(err error) *Error {
+	switch e := err.(type) {
+	case *Error:
+		return e
+	case *echo.HTTPError:
+		converted := newError(e.Code, codeOfStatus(e.Code), fmt.Sprint(e.Message))
+		converted.Internal = e.Internal
+		return converted
+	}
+	return newInternalError(err)
+}
+
+func codeOfStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusInternalServerError:
+		return CodeInternal
+	case StatusClientClosedRequest:
+		return CodeClientAborted
+	}
+	return strings.ToLower(strings.Replace(http.StatusText(status), " ", "_", -1))
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cyucelen/wirect/model"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPErrorHandler(t *testing.T) {
+	testCases := []struct {
+		err            error
+		expectedStatus int
+		expectedBody   model.Error
+	}{
+		{
+			err:            newValidationError(requiredFieldError("MAC")),
+			expectedStatus: http.StatusBadRequest,
+			expectedBody: model.Error{
+				Code: CodeValidationFailed, Message: "request payload is not valid",
+				Details: []model.FieldError{{Field: "MAC", Code: "required", Message: "MAC is required"}},
+			},
+		},
+		{
+			err:            echo.ErrNotFound,
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   model.Error{Code: CodeNotFound, Message: "Not Found"},
+		},
+		{
+			err:            echo.ErrUnsupportedMediaType,
+			expectedStatus: http.StatusUnsupportedMediaType,
+			expectedBody:   model.Error{Code: "unsupported_media_type", Message: "Unsupported Media Type"},
+		},
+		{
+			err:            errors.New("database is locked"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   model.Error{Code: CodeInternal, Message: "internal server error"},
+		},
+		{
+			err:            newDatabaseError(context.DeadlineExceeded),
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   model.Error{Code: CodeDatabaseTimeout, Message: "database did not answer in time"},
+		},
+		{
+			err:            newDatabaseError(context.Canceled),
+			expectedStatus: StatusClientClosedRequest,
+			expectedBody:   model.Error{Code: CodeClientAborted, Message: "client closed the request"},
+		},
+		{
+			err:            newDatabaseError(errors.New("database is locked")),
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   model.Error{Code: CodeDatabaseBusy, Message: "database is busy"},
+		},
+		{
+			err:            newDatabaseError(errors.New("database disk image is malformed")),
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   model.Error{Code: CodeInternal, Message: "internal server error"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		c, rec := createTestContext(httptest.NewRequest(http.MethodGet, "/", nil))
+		HTTPErrorHandler(testCase.err, c)
+
+		assert.Equal(t, testCase.expectedStatus, rec.Code)
+		assert.Equal(t, testCase.expectedBody, decodeError(rec))
+	}
+}
+
+func TestHTTPErrorHandlerWithCommittedResponse(t *testing.T) {
+	c, rec := createTestContext(httptest.NewRequest(http.MethodGet, "/", nil))
+	c.NoContent(http.StatusOK)
+
+	HTTPErrorHandler(newNotFoundError(""), c)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Body.String())
+}
+
+func TestHTTPErrorHandlerLogsClientAbort(t *testing.T) {
+	c, _ := createTestContext(httptest.NewRequest(http.MethodGet, "/", nil))
+	logs := &bytes.Buffer{}
+	c.Logger().SetOutput(logs)
+	c.Logger().SetLevel(log.DEBUG)
+
+	HTTPErrorHandler(newDatabaseError(context.Canceled), c)
+
+	assert.Contains(t, logs.String(), "client aborted request")
+	assert.NotContains(t, logs.String(), "request failed")
+	assert.Equal(t, CodeClientAborted, Outcome(c))
+}
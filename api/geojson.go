@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/cyucelen/wirect/model"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+)
+
+type GeoJSONDatabase interface {
+	SnifferDatabase
+	RouterDatabase
+	PacketDatabase
+}
+
+// GeoJSONAPI exports sniffers with a location for maps such as Leaflet or QGIS
+type GeoJSONAPI struct {
+	DB    GeoJSONDatabase
+	Crowd *CrowdAPI
+}
+
+// snifferOfflineAfter is how long a sniffer may not send packets before it is shown offline
+const snifferOfflineAfter = 15 * time.Minute
+
+// lastSeenRange is how far back the last packet of a sniffer is looked up, sniffers silent for longer have no lastSeen
+const lastSeenRange = 24 * time.Hour
+
+// GetSniffersGeoJSON returns a FeatureCollection of the sniffers with a location, their current crowd, whether they are online
+// and their relocation status. Sniffers without a latitude and longitude are left out.
+// The crowds and last packets of all sniffers are read at once, a sniffer whose fingerprint can not be read is listed without its relocation status.
+func (g *GeoJSONAPI) GetSniffersGeoJSON(ctx echo.Context) error {
+	sniffers, err := g.DB.GetSniffers(ctx.Request().Context())
+	if err != nil {
+		return newDatabaseError(err)
+	}
+
+	crowds, err := g.Crowd.CurrentCrowds(ctx.Request().Context())
+	if err != nil {
+		return newDatabaseError(err)
+	}
+	now := g.Crowd.clock.Now()
+	lastSeen, err := g.DB.GetLastSeenOfSniffersBetweenDates(ctx.Request().Context(), now.Add(-lastSeenRange).Unix(), now.Unix())
+	if err != nil {
+		return newDatabaseError(err)
+	}
+
+	collection := model.SnifferFeatureCollection{Type: "FeatureCollection", Features: []model.SnifferFeature{}}
+	for _, sniffer := range sniffers {
+		if sniffer.Latitude == nil || sniffer.Longitude == nil {
+			continue
+		}
+
+		properties := model.SnifferProperties{
+			MAC:         sniffer.MAC,
+			Name:        sniffer.Name,
+			Description: sniffer.Description,
+			Building:    sniffer.Building,
+			Floor:       sniffer.Floor,
+			Room:        sniffer.Room,
+			Tags:        sniffer.Tags,
+			Crowd:       crowds[sniffer.MAC],
+			Status:      model.SnifferOffline,
+			LastSeen:    lastSeen[sniffer.MAC],
+			Relocation:  model.RelocationUnknown,
+		}
+		if seen, ok := lastSeen[sniffer.MAC]; ok && now.Unix()-seen <= int64(snifferOfflineAfter/time.Second) {
+			properties.Status = model.SnifferOnline
+		}
+
+		fingerprint, err := g.DB.GetSnifferFingerprint(ctx.Request().Context(), sniffer.MAC)
+		if err != nil {
+			if ctxErr := ctx.Request().Context().Err(); ctxErr != nil {
+				return newDatabaseError(ctxErr)
+			}
+			logWarn(ctx, "reading fingerprint of sniffer failed", log.JSON{"sniffer": sniffer.MAC, "error": err.Error()})
+		} else {
+			relocation := toRelocation(&fingerprint)
+			properties.Relocation = relocation.Status
+			properties.RelocatedAt = relocation.RelocatedAt
+		}
+
+		collection.Features = append(collection.Features, model.SnifferFeature{
+			Type:       "Feature",
+			ID:         sniffer.MAC,
+			Geometry:   model.Point{Type: "Point", Coordinates: []float64{*sniffer.Longitude, *sniffer.Latitude}},
+			Properties: properties,
+		})
+	}
+
+	encoded, err := json.Marshal(collection)
+	if err != nil {
+		return err
+	}
+	return ctx.Blob(http.StatusOK, model.MIMEApplicationGeoJSON, encoded)
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cyucelen/wirect/model"
+	"github.com/cyucelen/wirect/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetSniffersGeoJSON(t *testing.T) {
+	now := time.Unix(10000, 0)
+	mockClock := clock.NewMock()
+	mockClock.Set(now)
+
+	latitude, longitude := 41.0082, 28.9784
+	db := &test.InMemoryDB{
+		Sniffers: []model.Sniffer{
+			{MAC: "00:00:00:00:00:01", Name: "hall", Latitude: &latitude, Longitude: &longitude, Building: "Library", Floor: "2", Room: "204", Tags: model.Tags{"entrance"}},
+			{MAC: "00:00:00:00:00:02", Name: "unplaced"},
+			{MAC: "00:00:00:00:00:03", Name: "silent", Latitude: &latitude, Longitude: &longitude},
+		},
+		Packets: []model.Packet{
+			{SnifferMAC: "00:00:00:00:00:01", MAC: "BB:BB:BB:BB:BB:01", Timestamp: now.Unix() - 60},
+			{SnifferMAC: "00:00:00:00:00:01", MAC: "BB:BB:BB:BB:BB:02", Timestamp: now.Unix() - 30},
+			{SnifferMAC: "00:00:00:00:00:03", MAC: "BB:BB:BB:BB:BB:01", Timestamp: now.Unix() - 3600},
+		},
+		Fingerprints: []model.SnifferFingerprint{
+			{SnifferMAC: "00:00:00:00:00:01", Baseline: model.Fingerprint{"SSID:1010": -60}, RelocatedAt: 9000},
+		},
+	}
+	geoJSONAPI := GeoJSONAPI{DB: db, Crowd: CreateCrowdAPI(db, SetCrowdClock(mockClock))}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	c, rec := createTestContext(req)
+	serve(c, geoJSONAPI.GetSniffersGeoJSON)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, model.MIMEApplicationGeoJSON, rec.Header().Get("Content-Type"))
+
+	var collection model.SnifferFeatureCollection
+	json.NewDecoder(rec.Body).Decode(&collection)
+	assert.Equal(t, model.SnifferFeatureCollection{
+		Type: "FeatureCollection",
+		Features: []model.SnifferFeature{{
+			Type:     "Feature",
+			ID:       "00:00:00:00:00:01",
+			Geometry: model.Point{Type: "Point", Coordinates: []float64{28.9784, 41.0082}},
+			Properties: model.SnifferProperties{
+				MAC: "00:00:00:00:00:01", Name: "hall", Building: "Library", Floor: "2", Room: "204", Tags: model.Tags{"entrance"},
+				Crowd: 2, Status: model.SnifferOnline, LastSeen: now.Unix() - 30, Relocation: model.RelocationPossible, RelocatedAt: 9000,
+			},
+		}, {
+			Type:     "Feature",
+			ID:       "00:00:00:00:00:03",
+			Geometry: model.Point{Type: "Point", Coordinates: []float64{28.9784, 41.0082}},
+			Properties: model.SnifferProperties{
+				MAC: "00:00:00:00:00:03", Name: "silent", Status: model.SnifferOffline, LastSeen: now.Unix() - 3600, Relocation: model.RelocationUnknown,
+			},
+		}},
+	}, collection)
+}
+
+// fingerprintFailingDB fails to read the fingerprint of a single sniffer
+type fingerprintFailingDB struct {
+	*test.InMemoryDB
+	snifferMAC string
+}
+
+func (f *fingerprintFailingDB) GetSnifferFingerprint(ctx context.Context, snifferMAC string) (model.SnifferFingerprint, error) {
+	if snifferMAC == f.snifferMAC {
+		return model.SnifferFingerprint{}, errors.New("disk I/O error")
+	}
+	return f.InMemoryDB.GetSnifferFingerprint(ctx, snifferMAC)
+}
+
+func TestGetSniffersGeoJSONListsSniffersWhoseFingerprintFailed(t *testing.T) {
+	mockClock := clock.NewMock()
+	mockClock.Set(time.Unix(10000, 0))
+
+	latitude, longitude := 41.0082, 28.9784
+	db := &fingerprintFailingDB{InMemoryDB: &test.InMemoryDB{
+		Sniffers: []model.Sniffer{
+			{MAC: "00:00:00:00:00:01", Name: "hall", Latitude: &latitude, Longitude: &longitude},
+			{MAC: "00:00:00:00:00:02", Name: "lab", Latitude: &latitude, Longitude: &longitude},
+		},
+		Fingerprints: []model.SnifferFingerprint{
+			{SnifferMAC: "00:00:00:00:00:02", Baseline: model.Fingerprint{"SSID:1010": -60}},
+		},
+	}, snifferMAC: "00:00:00:00:00:01"}
+	geoJSONAPI := GeoJSONAPI{DB: db, Crowd: CreateCrowdAPI(db, SetCrowdClock(mockClock))}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	c, rec := createTestContext(req)
+	serve(c, geoJSONAPI.GetSniffersGeoJSON)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var collection model.SnifferFeatureCollection
+	json.NewDecoder(rec.Body).Decode(&collection)
+	if assert.Len(t, collection.Features, 2) {
+		assert.Equal(t, model.RelocationUnknown, collection.Features[0].Properties.Relocation)
+		assert.Equal(t, model.RelocationStable, collection.Features[1].Properties.Relocation)
+	}
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+)
+
+// MACPrivacy decides how MAC addresses are written to logs
+type MACPrivacy string
+
+const (
+	// MACPrivacyNone logs MAC addresses as they are
+	MACPrivacyNone MACPrivacy = "none"
+	// MACPrivacyMask keeps the vendor prefix and hides the rest, such as AA:BB:CC:XX:XX:XX
+	MACPrivacyMask MACPrivacy = "mask"
+	// MACPrivacyHash replaces MAC addresses with a short hash so log lines can still be correlated
+	MACPrivacyHash MACPrivacy = "hash"
+)
+
+// MACRedactor applies a privacy setting to the MAC addresses which are logged
+type MACRedactor struct {
+	Privacy MACPrivacy
+	// secret keys the hashes, without it anyone could hash every MAC address of a vendor and reverse them
+	secret []byte
+}
+
+// NewMACRedactor returns a redactor which keys hashes with secret, an empty secret is replaced by a random one
+// so hashes only correlate within one run of the server
+func NewMACRedactor(privacy MACPrivacy, secret string) MACRedactor {
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = make([]byte, sha256.Size)
+		if _, err := rand.Read(key); err != nil {
+			panic(err)
+		}
+	}
+	return MACRedactor{Privacy: privacy, secret: key}
+}
+
+// Redact returns the MAC address in the form allowed by the privacy setting
+func (r MACRedactor) Redact(mac string) string {
+	normalized, err := NormalizeMAC(mac)
+	if err == nil {
+		mac = normalized
+	}
+
+	switch r.Privacy {
+	case MACPrivacyMask:
+		if err != nil {
+			return "XX:XX:XX:XX:XX:XX"
+		}
+		return mac[:8] + ":XX:XX:XX"
+	case MACPrivacyHash:
+		hash := hmac.New(sha256.New, r.secret)
+		hash.Write([]byte(mac))
+		return "mac-" + hex.EncodeToString(hash.Sum(nil)[:6])
+	}
+	return mac
+}
+
+// Keys of the values which are stored in the echo context for logging
+const (
+	macRedactorKey = "mac_redactor"
+	outcomeKey     = "outcome"
+)
+
+// SetMACRedactor stores the redactor which is applied to MAC addresses logged during the request
+func SetMACRedactor(ctx echo.Context, redactor MACRedactor) {
+	ctx.Set(macRedactorKey, redactor)
+}
+
+// RedactMAC redacts the MAC address with the redactor of the request
+func RedactMAC(ctx echo.Context, mac string) string {
+	redactor, ok := ctx.Get(macRedactorKey).(MACRedactor)
+	if !ok {
+		return mac
+	}
+	return redactor.Redact(mac)
+}
+
+// LogFields returns the fields every log line about the request carries
+func LogFields(ctx echo.Context) log.JSON {
+	fields := log.JSON{
+		"request_id": ctx.Response().Header().Get(echo.HeaderXRequestID),
+		"method":     ctx.Request().Method,
+		"route":      ctx.Path(),
+	}
+	if snifferMAC := ctx.Param("snifferMAC"); snifferMAC != "" {
+		if unescaped, err := url.QueryUnescape(snifferMAC); err == nil {
+			snifferMAC = unescaped
+		}
+		fields["sniffer"] = RedactMAC(ctx, snifferMAC)
+	}
+	return fields
+}
+
+// Outcome returns the error code which the request failed with or ok
+func Outcome(ctx echo.Context) string {
+	if outcome, ok := ctx.Get(outcomeKey).(string); ok {
+		return outcome
+	}
+	if ctx.Response().Status >= http.StatusBadRequest {
+		return codeOfStatus(ctx.Response().Status)
+	}
+	return "ok"
+}
+
+func setOutcome(ctx echo.Context, outcome string) {
+	ctx.Set(outcomeKey, outcome)
+}
+
+func logWarn(ctx echo.Context, message string, fields log.JSON) {
+	ctx.Logger().Warnj(withFields(LogFields(ctx), message, fields))
+}
+
+func logError(ctx echo.Context, message string, fields log.JSON) {
+	ctx.Logger().Errorj(withFields(LogFields(ctx), message, fields))
+}
+
+func withFields(base log.JSON, message string, fields log.JSON) log.JSON {
+	base["message"] = message
+	for key, value := range fields {
+		base[key] = value
+	}
+	return base
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactMAC(t *testing.T) {
+	assert.Equal(t, "AA:BB:CC:DD:EE:FF", NewMACRedactor(MACPrivacyNone, "").Redact("AA:BB:CC:DD:EE:FF"))
+	assert.Equal(t, "AA:BB:CC:XX:XX:XX", NewMACRedactor(MACPrivacyMask, "").Redact("aa-bb-cc-dd-ee-ff"))
+	assert.Equal(t, "XX:XX:XX:XX:XX:XX", NewMACRedactor(MACPrivacyMask, "").Redact("not a mac"))
+
+	hash := NewMACRedactor(MACPrivacyHash, "secret")
+	hashed := hash.Redact("AA:BB:CC:DD:EE:FF")
+	assert.Equal(t, hashed, hash.Redact("aabb.ccdd.eeff"))
+	assert.Equal(t, hashed, NewMACRedactor(MACPrivacyHash, "secret").Redact("AA:BB:CC:DD:EE:FF"))
+	assert.NotEqual(t, hashed, hash.Redact("AA:BB:CC:DD:EE:00"))
+	assert.NotContains(t, hashed, "AA")
+
+	// the hash depends on the secret, without one every start gets a random secret
+	assert.NotEqual(t, hashed, NewMACRedactor(MACPrivacyHash, "other").Redact("AA:BB:CC:DD:EE:FF"))
+	assert.NotEqual(t, NewMACRedactor(MACPrivacyHash, "").Redact("AA:BB:CC:DD:EE:FF"), NewMACRedactor(MACPrivacyHash, "").Redact("AA:BB:CC:DD:EE:FF"))
+}
+
+func TestLogFields(t *testing.T) {
+	c, _ := createTestContext(httptest.NewRequest(http.MethodPost, "/", nil))
+	addSnifferMACParamToContext(c, "aa:bb:cc:dd:ee:ff")
+	c.Response().Header().Set("X-Request-ID", "request-1")
+	SetMACRedactor(c, NewMACRedactor(MACPrivacyMask, ""))
+
+	fields := LogFields(c)
+
+	assert.Equal(t, "request-1", fields["request_id"])
+	assert.Equal(t, http.MethodPost, fields["method"])
+	assert.Equal(t, "AA:BB:CC:XX:XX:XX", fields["sniffer"])
+}
+
+func TestOutcome(t *testing.T) {
+	c, _ := createTestContext(httptest.NewRequest(http.MethodPost, "/", nil))
+	c.NoContent(http.StatusOK)
+	assert.Equal(t, "ok", Outcome(c))
+
+	c, _ = createTestContext(httptest.NewRequest(http.MethodPost, "/", nil))
+	HTTPErrorHandler(newValidationError(requiredFieldError("MAC")), c)
+	assert.Equal(t, CodeValidationFailed, Outcome(c))
+}
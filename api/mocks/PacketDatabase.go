@@ -2,6 +2,7 @@
 
 package mocks
 
+import context "context"
 import mock "github.com/stretchr/testify/mock"
 import model "github.com/cyucelen/wirect/model"
 
@@ -11,15 +12,15 @@ type PacketDatabase struct {
 	CreatedPackets []model.Packet
 }
 
-// CreatePacket provides a mock function with given fields: packet
-func (_m *PacketDatabase) CreatePacket(packet *model.Packet) error {
-	ret := _m.Called(packet)
+// CreatePacket provides a mock function with given fields: ctx, packet
+func (_m *PacketDatabase) CreatePacket(ctx context.Context, packet *model.Packet) error {
+	ret := _m.Called(ctx, packet)
 
 	_m.CreatedPackets = append(_m.CreatedPackets, *packet)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(*model.Packet) error); ok {
-		r0 = rf(packet)
+	if rf, ok := ret.Get(0).(func(context.Context, *model.Packet) error); ok {
+		r0 = rf(ctx, packet)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -27,64 +28,152 @@ func (_m *PacketDatabase) CreatePacket(packet *model.Packet) error {
 	return r0
 }
 
-// GetPacketsBySniffer provides a mock function with given fields: snifferMAC
-func (_m *PacketDatabase) GetPacketsBySniffer(snifferMAC string) []model.Packet {
-	ret := _m.Called(snifferMAC)
+// CreatePackets provides a mock function with given fields: ctx, packets
+func (_m *PacketDatabase) CreatePackets(ctx context.Context, packets []model.Packet) error {
+	ret := _m.Called(ctx, packets)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, []model.Packet) error); ok {
+		r0 = rf(ctx, packets)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetUniqueMACCountsBetweenDates provides a mock function with given fields: ctx, from, until
+func (_m *PacketDatabase) GetUniqueMACCountsBetweenDates(ctx context.Context, from int64, until int64) (map[string]int, error) {
+	ret := _m.Called(ctx, from, until)
+
+	var r0 map[string]int
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64) map[string]int); ok {
+		r0 = rf(ctx, from, until)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]int)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int64, int64) error); ok {
+		r1 = rf(ctx, from, until)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetLastSeenOfSniffersBetweenDates provides a mock function with given fields: ctx, from, until
+func (_m *PacketDatabase) GetLastSeenOfSniffersBetweenDates(ctx context.Context, from int64, until int64) (map[string]int64, error) {
+	ret := _m.Called(ctx, from, until)
+
+	var r0 map[string]int64
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64) map[string]int64); ok {
+		r0 = rf(ctx, from, until)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]int64)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int64, int64) error); ok {
+		r1 = rf(ctx, from, until)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetPacketsBySniffer provides a mock function with given fields: ctx, snifferMAC
+func (_m *PacketDatabase) GetPacketsBySniffer(ctx context.Context, snifferMAC string) ([]model.Packet, error) {
+	ret := _m.Called(ctx, snifferMAC)
 
 	var r0 []model.Packet
-	if rf, ok := ret.Get(0).(func(string) []model.Packet); ok {
-		r0 = rf(snifferMAC)
+	if rf, ok := ret.Get(0).(func(context.Context, string) []model.Packet); ok {
+		r0 = rf(ctx, snifferMAC)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]model.Packet)
 		}
 	}
 
-	return r0
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, snifferMAC)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
 }
 
-// GetPacketsBySnifferBetweenDates provides a mock function with given fields: snifferMAC, from, until
-func (_m *PacketDatabase) GetPacketsBySnifferBetweenDates(snifferMAC string, from int64, until int64) []model.Packet {
-	ret := _m.Called(snifferMAC, from, until)
+// GetPacketsBySnifferBetweenDates provides a mock function with given fields: ctx, snifferMAC, from, until
+func (_m *PacketDatabase) GetPacketsBySnifferBetweenDates(ctx context.Context, snifferMAC string, from int64, until int64) ([]model.Packet, error) {
+	ret := _m.Called(ctx, snifferMAC, from, until)
 
 	var r0 []model.Packet
-	if rf, ok := ret.Get(0).(func(string, int64, int64) []model.Packet); ok {
-		r0 = rf(snifferMAC, from, until)
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64, int64) []model.Packet); ok {
+		r0 = rf(ctx, snifferMAC, from, until)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]model.Packet)
 		}
 	}
 
-	return r0
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64, int64) error); ok {
+		r1 = rf(ctx, snifferMAC, from, until)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
 }
 
-// GetPacketsBySnifferSince provides a mock function with given fields: snifferMAC, since
-func (_m *PacketDatabase) GetPacketsBySnifferSince(snifferMAC string, since int64) []model.Packet {
-	ret := _m.Called(snifferMAC, since)
+// GetPacketsBySnifferSince provides a mock function with given fields: ctx, snifferMAC, since
+func (_m *PacketDatabase) GetPacketsBySnifferSince(ctx context.Context, snifferMAC string, since int64) ([]model.Packet, error) {
+	ret := _m.Called(ctx, snifferMAC, since)
 
 	var r0 []model.Packet
-	if rf, ok := ret.Get(0).(func(string, int64) []model.Packet); ok {
-		r0 = rf(snifferMAC, since)
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) []model.Packet); ok {
+		r0 = rf(ctx, snifferMAC, since)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]model.Packet)
 		}
 	}
 
-	return r0
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64) error); ok {
+		r1 = rf(ctx, snifferMAC, since)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
 }
 
-// GetUniqueMACCountBySnifferBetweenDates provides a mock function with given fields: snifferMAC, from, until
-func (_m *PacketDatabase) GetUniqueMACCountBySnifferBetweenDates(snifferMAC string, from int64, until int64) int {
-	ret := _m.Called(snifferMAC, from, until)
+// GetUniqueMACCountBySnifferBetweenDates provides a mock function with given fields: ctx, snifferMAC, from, until
+func (_m *PacketDatabase) GetUniqueMACCountBySnifferBetweenDates(ctx context.Context, snifferMAC string, from int64, until int64) (int, error) {
+	ret := _m.Called(ctx, snifferMAC, from, until)
 
 	var r0 int
-	if rf, ok := ret.Get(0).(func(string, int64, int64) int); ok {
-		r0 = rf(snifferMAC, from, until)
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64, int64) int); ok {
+		r0 = rf(ctx, snifferMAC, from, until)
 	} else {
 		r0 = ret.Get(0).(int)
 	}
 
-	return r0
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64, int64) error); ok {
+		r1 = rf(ctx, snifferMAC, from, until)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
 }
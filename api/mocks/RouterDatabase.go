@@ -2,6 +2,7 @@
 
 package mocks
 
+import context "context"
 import mock "github.com/stretchr/testify/mock"
 import model "github.com/cyucelen/wirect/model"
 
@@ -10,13 +11,13 @@ type RouterDatabase struct {
 	mock.Mock
 }
 
-// CreateRouter provides a mock function with given fields: router
-func (_m *RouterDatabase) CreateRouter(router *model.Router) error {
-	ret := _m.Called(router)
+// CreateRouter provides a mock function with given fields: ctx, router
+func (_m *RouterDatabase) CreateRouter(ctx context.Context, router *model.Router) error {
+	ret := _m.Called(ctx, router)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(*model.Router) error); ok {
-		r0 = rf(router)
+	if rf, ok := ret.Get(0).(func(context.Context, *model.Router) error); ok {
+		r0 = rf(ctx, router)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -24,18 +25,97 @@ func (_m *RouterDatabase) CreateRouter(router *model.Router) error {
 	return r0
 }
 
-// GetRoutersBySniffer provides a mock function with given fields: snifferMAC
-func (_m *RouterDatabase) GetRoutersBySniffer(snifferMAC string) []model.Router {
-	ret := _m.Called(snifferMAC)
+// GetRoutersBySniffer provides a mock function with given fields: ctx, snifferMAC
+func (_m *RouterDatabase) GetRoutersBySniffer(ctx context.Context, snifferMAC string) ([]model.Router, error) {
+	ret := _m.Called(ctx, snifferMAC)
 
 	var r0 []model.Router
-	if rf, ok := ret.Get(0).(func(string) []model.Router); ok {
-		r0 = rf(snifferMAC)
+	if rf, ok := ret.Get(0).(func(context.Context, string) []model.Router); ok {
+		r0 = rf(ctx, snifferMAC)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]model.Router)
 		}
 	}
 
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, snifferMAC)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateRouterSighting provides a mock function with given fields: ctx, sighting
+func (_m *RouterDatabase) CreateRouterSighting(ctx context.Context, sighting *model.RouterSighting) error {
+	ret := _m.Called(ctx, sighting)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.RouterSighting) error); ok {
+		r0 = rf(ctx, sighting)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetRouterSightingsBySnifferBetweenDates provides a mock function with given fields: ctx, snifferMAC, from, until
+func (_m *RouterDatabase) GetRouterSightingsBySnifferBetweenDates(ctx context.Context, snifferMAC string, from int64, until int64) ([]model.RouterSighting, error) {
+	ret := _m.Called(ctx, snifferMAC, from, until)
+
+	var r0 []model.RouterSighting
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64, int64) []model.RouterSighting); ok {
+		r0 = rf(ctx, snifferMAC, from, until)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.RouterSighting)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64, int64) error); ok {
+		r1 = rf(ctx, snifferMAC, from, until)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetSnifferFingerprint provides a mock function with given fields: ctx, snifferMAC
+func (_m *RouterDatabase) GetSnifferFingerprint(ctx context.Context, snifferMAC string) (model.SnifferFingerprint, error) {
+	ret := _m.Called(ctx, snifferMAC)
+
+	var r0 model.SnifferFingerprint
+	if rf, ok := ret.Get(0).(func(context.Context, string) model.SnifferFingerprint); ok {
+		r0 = rf(ctx, snifferMAC)
+	} else {
+		r0 = ret.Get(0).(model.SnifferFingerprint)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, snifferMAC)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateSnifferFingerprint provides a mock function with given fields: ctx, fingerprint
+func (_m *RouterDatabase) UpdateSnifferFingerprint(ctx context.Context, fingerprint *model.SnifferFingerprint) error {
+	ret := _m.Called(ctx, fingerprint)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.SnifferFingerprint) error); ok {
+		r0 = rf(ctx, fingerprint)
+	} else {
+		r0 = ret.Error(0)
+	}
+
 	return r0
 }
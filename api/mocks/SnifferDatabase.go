@@ -2,6 +2,7 @@
 
 package mocks
 
+import context "context"
 import mock "github.com/stretchr/testify/mock"
 import model "github.com/cyucelen/wirect/model"
 
@@ -10,13 +11,13 @@ type SnifferDatabase struct {
 	mock.Mock
 }
 
-// CreateSniffer provides a mock function with given fields: sniffer
-func (_m *SnifferDatabase) CreateSniffer(sniffer *model.Sniffer) error {
-	ret := _m.Called(sniffer)
+// CreateSniffer provides a mock function with given fields: ctx, sniffer
+func (_m *SnifferDatabase) CreateSniffer(ctx context.Context, sniffer *model.Sniffer) error {
+	ret := _m.Called(ctx, sniffer)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(*model.Sniffer) error); ok {
-		r0 = rf(sniffer)
+	if rf, ok := ret.Get(0).(func(context.Context, *model.Sniffer) error); ok {
+		r0 = rf(ctx, sniffer)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -24,29 +25,36 @@ func (_m *SnifferDatabase) CreateSniffer(sniffer *model.Sniffer) error {
 	return r0
 }
 
-// GetSniffers provides a mock function with given fields:
-func (_m *SnifferDatabase) GetSniffers() []model.Sniffer {
-	ret := _m.Called()
+// GetSniffers provides a mock function with given fields: ctx
+func (_m *SnifferDatabase) GetSniffers(ctx context.Context) ([]model.Sniffer, error) {
+	ret := _m.Called(ctx)
 
 	var r0 []model.Sniffer
-	if rf, ok := ret.Get(0).(func() []model.Sniffer); ok {
-		r0 = rf()
+	if rf, ok := ret.Get(0).(func(context.Context) []model.Sniffer); ok {
+		r0 = rf(ctx)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]model.Sniffer)
 		}
 	}
 
-	return r0
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
 }
 
-// UpdateSniffer provides a mock function with given fields: sniffer
-func (_m *SnifferDatabase) UpdateSniffer(sniffer *model.Sniffer) error {
-	ret := _m.Called(sniffer)
+// UpdateSniffer provides a mock function with given fields: ctx, sniffer
+func (_m *SnifferDatabase) UpdateSniffer(ctx context.Context, sniffer *model.Sniffer) error {
+	ret := _m.Called(ctx, sniffer)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(*model.Sniffer) error); ok {
-		r0 = rf(sniffer)
+	if rf, ok := ret.Get(0).(func(context.Context, *model.Sniffer) error); ok {
+		r0 = rf(ctx, sniffer)
 	} else {
 		r0 = ret.Error(0)
 	}
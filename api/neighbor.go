@@ -0,0 +1,200 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cyucelen/wirect/model"
+	"github.com/labstack/echo"
+)
+
+// MIMETextGraphviz is the content type of graphs in the DOT language
+const MIMETextGraphviz = "text/vnd.graphviz; charset=UTF-8"
+
+const defaultNeighborRange = time.Hour
+const defaultNeighborWindow = 5 * time.Minute
+
+// maxNeighborRange bounds the range of the graph since the packets of every sniffer in the range are loaded at once
+const maxNeighborRange = 24 * time.Hour
+
+type NeighborDatabase interface {
+	PacketDatabase
+	SnifferDatabase
+	RouterDatabase
+}
+
+// NeighborAPI infers which sniffers are close to each other from the routers and devices they share
+type NeighborAPI struct {
+	DB    NeighborDatabase
+	Clock clock.Clock
+	// Window is the default time window in which a device seen by two sniffers counts as co-observed
+	Window time.Duration
+}
+
+// snifferObservations are the routers and the devices by window a sniffer saw in the range
+type snifferObservations struct {
+	routers map[string]bool
+	devices map[string]bool
+	macs    map[string]bool
+}
+
+// GetSnifferGraph returns the graph of sniffers as JSON, or in the DOT language of Graphviz if the format query parameter is dot
+func (n *NeighborAPI) GetSnifferGraph(ctx echo.Context) error {
+	from, until, err := parseRangeParams(ctx, orDefaultClock(n.Clock).Now(), defaultNeighborRange)
+	if err != nil {
+		return err
+	}
+	if err := checkRangeSpan(from, until, maxNeighborRange); err != nil {
+		return err
+	}
+
+	fieldErrors := []model.FieldError{}
+	window, fieldError := parseDurationParam(ctx, "window", n.window())
+	fieldErrors = append(fieldErrors, fieldError...)
+	if len(fieldError) == 0 && window < time.Second {
+		fieldErrors = append(fieldErrors, outOfRangeFieldError("window", "window must be at least 1s"))
+	}
+	minWeight, fieldError := parseMinWeight(ctx)
+	fieldErrors = append(fieldErrors, fieldError...)
+	format := ctx.QueryParam("format")
+	if format != "" && format != "json" && format != "dot" {
+		fieldErrors = append(fieldErrors, invalidFieldError("format", "format must be json or dot"))
+	}
+	if len(fieldErrors) > 0 {
+		return newValidationError(fieldErrors...)
+	}
+
+	sniffers, err := n.DB.GetSniffers(ctx.Request().Context())
+	if err != nil {
+		return newDatabaseError(err)
+	}
+
+	graph := model.SnifferGraph{From: from, Until: until, Nodes: []model.GraphNode{}, Edges: []model.GraphEdge{}}
+	observations := []snifferObservations{}
+	for _, sniffer := range sniffers {
+		observed, err := n.observe(ctx, sniffer.MAC, from, until, int64(window/time.Second))
+		if err != nil {
+			return err
+		}
+		observations = append(observations, observed)
+		graph.Nodes = append(graph.Nodes, model.GraphNode{SnifferMAC: sniffer.MAC, Name: sniffer.Name, Routers: len(observed.routers), Devices: len(observed.macs)})
+	}
+
+	for i := range sniffers {
+		for j := i + 1; j < len(sniffers); j++ {
+			edge := connect(sniffers[i].MAC, sniffers[j].MAC, observations[i], observations[j])
+			if edge.Weight > 0 && edge.Weight >= minWeight {
+				graph.Edges = append(graph.Edges, edge)
+			}
+		}
+	}
+	sort.SliceStable(graph.Edges, func(i, j int) bool {
+		return graph.Edges[i].Weight > graph.Edges[j].Weight
+	})
+
+	if format == "dot" {
+		return ctx.Blob(http.StatusOK, MIMETextGraphviz, []byte(toDOT(graph)))
+	}
+	return ctx.JSON(http.StatusOK, graph)
+}
+
+func (n *NeighborAPI) window() time.Duration {
+	if n.Window == 0 {
+		return defaultNeighborWindow
+	}
+	return n.Window
+}
+
+func (n *NeighborAPI) observe(ctx echo.Context, snifferMAC string, from, until, windowSeconds int64) (snifferObservations, error) {
+	observed := snifferObservations{routers: map[string]bool{}, devices: map[string]bool{}, macs: map[string]bool{}}
+
+	sightings, err := n.DB.GetRouterSightingsBySnifferBetweenDates(ctx.Request().Context(), snifferMAC, from, until)
+	if err != nil {
+		return observed, newDatabaseError(err)
+	}
+	for _, sighting := range sightings {
+		if sighting.BSSID != "" {
+			observed.routers[sighting.BSSID] = true
+		} else {
+			observed.routers["SSID:"+sighting.SSID] = true
+		}
+	}
+
+	packets, err := n.DB.GetPacketsBySnifferBetweenDates(ctx.Request().Context(), snifferMAC, from, until)
+	if err != nil {
+		return observed, newDatabaseError(err)
+	}
+	for _, packet := range packets {
+		// windows are aligned to the epoch so they do not move with the range
+		window := packet.Timestamp / windowSeconds
+		observed.devices[strconv.FormatInt(window, 10)+"/"+packet.MAC] = true
+		observed.macs[packet.MAC] = true
+	}
+	return observed, nil
+}
+
+func connect(a, b string, observedA, observedB snifferObservations) model.GraphEdge {
+	edge := model.GraphEdge{From: a, To: b}
+	edge.SharedRouters, edge.RouterSimilarity = similarity(observedA.routers, observedB.routers)
+	edge.CoObservations, edge.DeviceSimilarity = similarity(observedA.devices, observedB.devices)
+	edge.Weight = round((edge.RouterSimilarity + edge.DeviceSimilarity) / 2)
+	edge.RouterSimilarity = round(edge.RouterSimilarity)
+	edge.DeviceSimilarity = round(edge.DeviceSimilarity)
+	return edge
+}
+
+// similarity returns the size of the intersection of the sets and their Jaccard index
+func similarity(a, b map[string]bool) (int, float64) {
+	shared := 0
+	for key := range a {
+		if b[key] {
+			shared++
+		}
+	}
+	union := len(a) + len(b) - shared
+	if union == 0 {
+		return 0, 0
+	}
+	return shared, float64(shared) / float64(union)
+}
+
+func round(value float64) float64 {
+	return math.Round(value*1000) / 1000
+}
+
+func parseMinWeight(ctx echo.Context) (float64, []model.FieldError) {
+	value := ctx.QueryParam("minWeight")
+	if value == "" {
+		return 0, nil
+	}
+	minWeight, err := strconv.ParseFloat(value, 64)
+	if err != nil || minWeight < 0 || minWeight > 1 {
+		return 0, []model.FieldError{outOfRangeFieldError("minWeight", "minWeight must be a number from 0 to 1")}
+	}
+	return minWeight, nil
+}
+
+// toDOT writes the graph as an undirected Graphviz graph, heavier edges are drawn thicker
+func toDOT(graph model.SnifferGraph) string {
+	var dot strings.Builder
+	dot.WriteString("graph sniffers {\n")
+	for _, node := range graph.Nodes {
+		label := node.Name
+		if label == "" {
+			label = node.SnifferMAC
+		}
+		fmt.Fprintf(&dot, "  %s [label=%s];\n", strconv.Quote(node.SnifferMAC), strconv.Quote(label))
+	}
+	for _, edge := range graph.Edges {
+		fmt.Fprintf(&dot, "  %s -- %s [weight=%g, penwidth=%g, label=\"%g\"];\n",
+			strconv.Quote(edge.From), strconv.Quote(edge.To), edge.Weight, round(1+4*edge.Weight), edge.Weight)
+	}
+	dot.WriteString("}\n")
+	return dot.String()
+}
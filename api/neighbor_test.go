@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cyucelen/wirect/model"
+	"github.com/cyucelen/wirect/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func createNeighborAPI() *NeighborAPI {
+	mockClock := clock.NewMock()
+	mockClock.Set(time.Unix(10000, 0))
+
+	db := &test.InMemoryDB{
+		Sniffers: []model.Sniffer{{MAC: "00:00:00:00:00:01", Name: "hall"}, {MAC: "00:00:00:00:00:02", Name: "lab"}, {MAC: "00:00:00:00:00:03"}},
+		RouterSightings: []model.RouterSighting{
+			{SnifferMAC: "00:00:00:00:00:01", SSID: "eduroam", BSSID: "AA:AA:AA:AA:AA:01", Timestamp: 9000},
+			{SnifferMAC: "00:00:00:00:00:01", SSID: "1010", Timestamp: 9000},
+			{SnifferMAC: "00:00:00:00:00:02", SSID: "eduroam", BSSID: "AA:AA:AA:AA:AA:01", Timestamp: 9500},
+			{SnifferMAC: "00:00:00:00:00:02", SSID: "eduroam", BSSID: "AA:AA:AA:AA:AA:02", Timestamp: 9500},
+			{SnifferMAC: "00:00:00:00:00:03", SSID: "Arch", Timestamp: 9500},
+		},
+		Packets: []model.Packet{
+			{SnifferMAC: "00:00:00:00:00:01", MAC: "BB:BB:BB:BB:BB:01", Timestamp: 9000},
+			{SnifferMAC: "00:00:00:00:00:02", MAC: "BB:BB:BB:BB:BB:01", Timestamp: 9100},
+			{SnifferMAC: "00:00:00:00:00:01", MAC: "BB:BB:BB:BB:BB:02", Timestamp: 9000},
+			{SnifferMAC: "00:00:00:00:00:02", MAC: "BB:BB:BB:BB:BB:02", Timestamp: 9900},
+			{SnifferMAC: "00:00:00:00:00:03", MAC: "BB:BB:BB:BB:BB:03", Timestamp: 9000},
+		},
+	}
+	return &NeighborAPI{DB: db, Clock: mockClock}
+}
+
+func sendSnifferGraphRequest(neighborAPI *NeighborAPI, query string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+	c, rec := createTestContext(req)
+	serve(c, neighborAPI.GetSnifferGraph)
+	return rec
+}
+
+func TestGetSnifferGraph(t *testing.T) {
+	neighborAPI := createNeighborAPI()
+
+	rec := sendSnifferGraphRequest(neighborAPI, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var graph model.SnifferGraph
+	json.NewDecoder(rec.Body).Decode(&graph)
+	assert.Equal(t, model.SnifferGraph{
+		From: 6400, Until: 10000,
+		Nodes: []model.GraphNode{
+			{SnifferMAC: "00:00:00:00:00:01", Name: "hall", Routers: 2, Devices: 2},
+			{SnifferMAC: "00:00:00:00:00:02", Name: "lab", Routers: 2, Devices: 2},
+			{SnifferMAC: "00:00:00:00:00:03", Routers: 1, Devices: 1},
+		},
+		Edges: []model.GraphEdge{
+			{From: "00:00:00:00:00:01", To: "00:00:00:00:00:02", Weight: 0.333, SharedRouters: 1, RouterSimilarity: 0.333, CoObservations: 1, DeviceSimilarity: 0.333},
+		},
+	}, graph)
+}
+
+func TestGetSnifferGraphWithWiderWindowAndMinWeight(t *testing.T) {
+	neighborAPI := createNeighborAPI()
+
+	rec := sendSnifferGraphRequest(neighborAPI, "window=1h")
+	var graph model.SnifferGraph
+	json.NewDecoder(rec.Body).Decode(&graph)
+	if assert.Len(t, graph.Edges, 1) {
+		assert.Equal(t, 2, graph.Edges[0].CoObservations)
+		assert.Equal(t, 0.667, graph.Edges[0].Weight)
+	}
+
+	rec = sendSnifferGraphRequest(neighborAPI, "minWeight=0.5")
+	json.NewDecoder(rec.Body).Decode(&graph)
+	assert.Empty(t, graph.Edges)
+}
+
+func TestGetSnifferGraphAsDOT(t *testing.T) {
+	neighborAPI := createNeighborAPI()
+
+	rec := sendSnifferGraphRequest(neighborAPI, "format=dot")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, MIMETextGraphviz, rec.Header().Get("Content-Type"))
+	assert.Equal(t, `graph sniffers {
+  "00:00:00:00:00:01" [label="hall"];
+  "00:00:00:00:00:02" [label="lab"];
+  "00:00:00:00:00:03" [label="00:00:00:00:00:03"];
+  "00:00:00:00:00:01" -- "00:00:00:00:00:02" [weight=0.333, penwidth=2.332, label="0.333"];
+}
+`, rec.Body.String())
+}
+
+func TestGetSnifferGraphWithInvalidParams(t *testing.T) {
+	neighborAPI := createNeighborAPI()
+
+	for _, query := range []string{"format=png", "window=0", "window=soon", "minWeight=2", "from=-1h&until=-2h", "from=-25h"} {
+		rec := sendSnifferGraphRequest(neighborAPI, query)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+}
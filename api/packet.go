@@ -1,37 +1,77 @@
 package api
 
 import (
-	"errors"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"mime"
 	"net/http"
 	"net/url"
 
 	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
 
 	"github.com/cyucelen/wirect/model"
+	"github.com/cyucelen/wirect/packetcodec"
 )
 
 type PacketDatabase interface {
-	CreatePacket(packet *model.Packet) error
-	GetPacketsBySniffer(snifferMAC string) []model.Packet
-	GetPacketsBySnifferSince(snifferMAC string, since int64) []model.Packet
-	GetPacketsBySnifferBetweenDates(snifferMAC string, from, until int64) []model.Packet
-	GetUniqueMACCountBySnifferBetweenDates(snifferMAC string, from, until int64) int
+	CreatePacket(ctx context.Context, packet *model.Packet) error
+	// CreatePackets stores the packets in one transaction, either all or none
+	CreatePackets(ctx context.Context, packets []model.Packet) error
+	GetPacketsBySniffer(ctx context.Context, snifferMAC string) ([]model.Packet, error)
+	GetPacketsBySnifferSince(ctx context.Context, snifferMAC string, since int64) ([]model.Packet, error)
+	GetPacketsBySnifferBetweenDates(ctx context.Context, snifferMAC string, from, until int64) ([]model.Packet, error)
+	GetUniqueMACCountBySnifferBetweenDates(ctx context.Context, snifferMAC string, from, until int64) (int, error)
+	// GetUniqueMACCountsBetweenDates counts the unique MACs of every sniffer with packets in the range at once
+	GetUniqueMACCountsBetweenDates(ctx context.Context, from, until int64) (map[string]int, error)
+	// GetLastSeenOfSniffersBetweenDates returns the timestamp of the latest packet in the range of every sniffer with packets in it
+	GetLastSeenOfSniffersBetweenDates(ctx context.Context, from, until int64) (map[string]int64, error)
+}
+
+// IngestObserver is notified about packets which were stored or rejected
+type IngestObserver interface {
+	PacketsIngested(snifferMAC string, count int)
+	PacketsRejected(snifferMAC string, count int)
 }
 
 type PacketAPI struct {
-	DB PacketDatabase
+	DB        PacketDatabase
+	Validator *Validator
+	Observer  IngestObserver
+	// Skew corrects or quarantines the packets of sniffers whose clock is skewed, nil stores them as they are
+	Skew *SkewCorrector
+	// Sequencer stores uploads with a batch ID and a sequence range idempotently, nil ignores their headers
+	Sequencer *Sequencer
 }
 
 func (p *PacketAPI) CreatePacket(ctx echo.Context) error {
 	var snifferPacket model.SnifferPacket
-	if err := ctx.Bind(&snifferPacket); err != nil {
-		ctx.JSON(http.StatusBadRequest, nil)
-		return err
+	if isPacketBatch(ctx) {
+		snifferPackets, err := decodePacketBatch(ctx)
+		if err != nil {
+			return err
+		}
+		if len(snifferPackets) != 1 {
+			return newError(http.StatusBadRequest, CodeInvalidBinary, fmt.Sprintf("batch holds %d packets instead of 1", len(snifferPackets)))
+		}
+		snifferPacket = snifferPackets[0]
+	} else if err := ctx.Bind(&snifferPacket); err != nil {
+		return newInvalidJSONError(err)
 	}
 
-	if !isSnifferPacketValid(snifferPacket) {
-		ctx.JSON(http.StatusBadRequest, nil)
-		return errors.New("")
+	snifferPackets := []model.SnifferPacket{snifferPacket}
+	incident := p.Skew.correct(ctx, snifferPackets, false)
+	p.Skew.report(ctx, incident)
+	snifferPacket = snifferPackets[0]
+	if isQuarantined(incident) {
+		p.observeRejected(ctx, 1)
+		return newValidationError(clockSkewFieldError("timestamp", incident.Offset))
+	}
+
+	if fieldErrors := orDefaultValidator(p.Validator).SnifferPacket(&snifferPacket, ""); len(fieldErrors) > 0 {
+		p.observeRejected(ctx, 1)
+		return newValidationError(fieldErrors...)
 	}
 
 	snifferMAC, err := getSnifferMAC(ctx)
@@ -40,28 +80,49 @@ func (p *PacketAPI) CreatePacket(ctx echo.Context) error {
 	}
 	packet := toPacket(&snifferPacket, snifferMAC)
 
-	if err := p.DB.CreatePacket(packet); err != nil {
-		ctx.JSON(http.StatusInternalServerError, nil)
-		return err
+	if err := p.DB.CreatePacket(ctx.Request().Context(), packet); err != nil {
+		return newDatabaseError(err)
 	}
+	p.observeIngested(snifferMAC, 1)
 
-	ctx.JSON(http.StatusCreated, snifferPacket)
-	return nil
+	return ctx.JSON(http.StatusCreated, snifferPacket)
 }
 
 func (p *PacketAPI) CreatePackets(ctx echo.Context) error {
 	var snifferPackets []model.SnifferPacket
 
-	if err := ctx.Bind(&snifferPackets); err != nil {
-		ctx.JSON(http.StatusBadRequest, "")
-		return err
+	if isPacketBatch(ctx) {
+		var err error
+		if snifferPackets, err = decodePacketBatch(ctx); err != nil {
+			return err
+		}
+	} else if err := ctx.Bind(&snifferPackets); err != nil {
+		return newInvalidJSONError(err)
 	}
 
-	validSnifferPackets := filterValidSnifferPackets(snifferPackets)
+	if p.Sequencer != nil {
+		batch, sequenced, err := parseBatchHeaders(ctx, len(snifferPackets))
+		if err != nil {
+			return err
+		}
+		if sequenced {
+			return p.createSequencedPackets(ctx, batch, snifferPackets)
+		}
+	}
+
+	incident := p.Skew.correct(ctx, snifferPackets, false)
+	p.Skew.report(ctx, incident)
+
+	result := partitionSnifferPackets(orDefaultValidator(p.Validator), snifferPackets, incident, nil)
 
-	if len(validSnifferPackets) == 0 {
-		ctx.JSON(http.StatusBadRequest, nil)
-		return errors.New("")
+	p.observeRejected(ctx, len(result.Rejected))
+
+	if len(result.Accepted) == 0 {
+		fieldErrors := []model.FieldError{}
+		for _, rejected := range result.Rejected {
+			fieldErrors = append(fieldErrors, rejected.Errors...)
+		}
+		return newValidationError(fieldErrors...)
 	}
 
 	snifferMAC, err := getSnifferMAC(ctx)
@@ -69,53 +130,117 @@ func (p *PacketAPI) CreatePackets(ctx echo.Context) error {
 		return err
 	}
 
-	for _, validSnifferPacket := range validSnifferPackets {
-		packet := toPacket(&validSnifferPacket, snifferMAC)
+	packets := make([]model.Packet, 0, len(result.Accepted))
+	for i := range result.Accepted {
+		packets = append(packets, *toPacket(&result.Accepted[i], snifferMAC))
+	}
+	// the accepted packets are stored together, either all of them or none
+	if err := p.DB.CreatePackets(ctx.Request().Context(), packets); err != nil {
+		return newDatabaseError(err)
+	}
+	p.observeIngested(snifferMAC, len(result.Accepted))
 
-		if err := p.DB.CreatePacket(packet); err != nil {
-			ctx.JSON(http.StatusInternalServerError, nil)
-			return err
-		}
+	if len(result.Rejected) > 0 {
+		logWarn(ctx, "packets rejected", log.JSON{"accepted": len(result.Accepted), "rejected": len(result.Rejected)})
 	}
 
-	ctx.JSON(http.StatusCreated, snifferPackets)
-	return nil
+	return ctx.JSON(http.StatusCreated, result)
+}
+
+func (p *PacketAPI) observeIngested(snifferMAC string, count int) {
+	if p.Observer != nil && count > 0 {
+		p.Observer.PacketsIngested(snifferMAC, count)
+	}
+}
+
+func (p *PacketAPI) observeRejected(ctx echo.Context, count int) {
+	if p.Observer == nil || count == 0 {
+		return
+	}
+	if snifferMAC, err := getSnifferMAC(ctx); err == nil {
+		p.Observer.PacketsRejected(snifferMAC, count)
+	}
 }
 
 func getSnifferMAC(ctx echo.Context) (string, error) {
 	snifferMAC, err := url.QueryUnescape(ctx.Param("snifferMAC"))
 	if err != nil {
-		ctx.JSON(http.StatusNotFound, nil)
-		return "", err
+		notFound := newNotFoundError("sniffer MAC in path is not URL encoded properly")
+		notFound.Internal = err
+		return "", notFound
 	}
 
 	if snifferMAC == "" {
-		ctx.JSON(http.StatusNotFound, nil)
-		return "", errors.New("")
+		return "", newNotFoundError("sniffer MAC in path is empty")
+	}
+
+	normalizedMAC, err := NormalizeMAC(snifferMAC)
+	if err != nil {
+		return "", newNotFoundError("sniffer MAC in path is not a MAC address")
 	}
 
-	return snifferMAC, nil
+	return normalizedMAC, nil
 }
 
-func filterValidSnifferPackets(snifferPackets []model.SnifferPacket) []model.SnifferPacket {
-	validSnifferPackets := []model.SnifferPacket{}
-	for _, snifferPacket := range snifferPackets {
-		if isSnifferPacketValid(snifferPacket) {
-			validSnifferPackets = append(validSnifferPackets, snifferPacket)
+// partitionSnifferPackets validates the packets, every packet is rejected if the incident quarantined them.
+// Packets for which isDuplicate is true are neither validated nor accepted, nil means there are no duplicates.
+func partitionSnifferPackets(validator *Validator, snifferPackets []model.SnifferPacket, incident *model.SkewIncident, isDuplicate func(int) bool) model.PacketCollectionResult {
+	result := model.PacketCollectionResult{
+		Accepted: []model.SnifferPacket{},
+		Rejected: []model.RejectedPacket{},
+	}
+
+	for i, snifferPacket := range snifferPackets {
+		if isDuplicate != nil && isDuplicate(i) {
+			result.Duplicates = append(result.Duplicates, i)
+			continue
 		}
+		if isQuarantined(incident) {
+			fieldError := clockSkewFieldError(fmt.Sprintf("[%d].timestamp", i), incident.Offset)
+			result.Rejected = append(result.Rejected, model.RejectedPacket{Index: i, Packet: snifferPacket, Errors: []model.FieldError{fieldError}})
+			continue
+		}
+		fieldErrors := validator.SnifferPacket(&snifferPacket, fmt.Sprintf("[%d].", i))
+		if len(fieldErrors) == 0 {
+			result.Accepted = append(result.Accepted, snifferPacket)
+			continue
+		}
+		result.Rejected = append(result.Rejected, model.RejectedPacket{Index: i, Packet: snifferPacket, Errors: fieldErrors})
 	}
-	return validSnifferPackets
+
+	return result
 }
 
-func isSnifferPacketValid(snifferPacket model.SnifferPacket) bool {
-	return snifferPacket.MAC != "" && snifferPacket.Timestamp != 0
+func isQuarantined(incident *model.SkewIncident) bool {
+	return incident != nil && incident.Action == model.SkewQuarantined
+}
+
+// isPacketBatch tells whether the body of the request is a batch encoded by packetcodec instead of JSON
+func isPacketBatch(ctx echo.Context) bool {
+	mediaType, _, err := mime.ParseMediaType(ctx.Request().Header.Get(echo.HeaderContentType))
+	return err == nil && mediaType == packetcodec.MIMEType
+}
+
+func decodePacketBatch(ctx echo.Context) ([]model.SnifferPacket, error) {
+	data, err := ioutil.ReadAll(ctx.Request().Body)
+	if err != nil {
+		return nil, newBodyReadError(err)
+	}
+	snifferPackets, err := packetcodec.Decode(data)
+	if err != nil {
+		e := newError(http.StatusBadRequest, CodeInvalidBinary, err.Error())
+		e.Internal = err
+		return nil, e
+	}
+	return snifferPackets, nil
 }
 
 func toPacket(snifferPacket *model.SnifferPacket, snifferMAC string) *model.Packet {
 	return &model.Packet{
-		MAC:        snifferPacket.MAC,
-		Timestamp:  snifferPacket.Timestamp,
-		RSSI:       snifferPacket.RSSI,
-		SnifferMAC: snifferMAC,
+		MAC:               snifferPacket.MAC,
+		Timestamp:         snifferPacket.Timestamp,
+		RSSI:              snifferPacket.RSSI,
+		OriginalTimestamp: snifferPacket.OriginalTimestamp,
+		SnifferMAC:        snifferMAC,
 	}
 }
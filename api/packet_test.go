@@ -33,7 +33,8 @@ func createMockPacketDB() *test.InMemoryDB {
 
 func createFailingMockPacketDB() *mocks.PacketDatabase {
 	mockPacketDB := &mocks.PacketDatabase{}
-	mockPacketDB.On("CreatePacket", mock.AnythingOfType("*model.Packet")).Return(errors.New(""))
+	mockPacketDB.On("CreatePacket", mock.Anything, mock.AnythingOfType("*model.Packet")).Return(errors.New(""))
+	mockPacketDB.On("CreatePackets", mock.Anything, mock.AnythingOfType("[]model.Packet")).Return(errors.New(""))
 	return mockPacketDB
 }
 
@@ -42,12 +43,12 @@ const defaultTestSnifferMAC = "00:00:00:00:00:00"
 func (s *PacketAPISuite) BeforeTest(string, string) {
 	s.packetDB = createMockPacketDB()
 	s.packetDB.Sniffers = append(s.packetDB.Sniffers, model.Sniffer{MAC: defaultTestSnifferMAC})
-	s.packetAPI = &PacketAPI{s.packetDB}
+	s.packetAPI = &PacketAPI{DB: s.packetDB}
 }
 
 func (s *PacketAPISuite) TestCreatePacket() {
 	snifferPacket := model.SnifferPacket{
-		MAC: "22:44:66:88:AA:CC", Timestamp: time.Now().UTC().Unix(), RSSI: 123,
+		MAC: "22:44:66:88:AA:CC", Timestamp: time.Now().UTC().Unix(), RSSI: -67,
 	}
 
 	rec := sendTestRequestToHandler(defaultTestSnifferMAC, snifferPacket, s.packetAPI.CreatePacket, http.MethodPost)
@@ -63,8 +64,8 @@ func (s *PacketAPISuite) TestCreatePacket() {
 
 func (s *PacketAPISuite) TestCreatePacketWithEmptyRequiredFields() {
 	notValidSnifferPackets := []model.SnifferPacket{
-		{MAC: "", Timestamp: time.Now().UTC().Unix(), RSSI: 123},
-		{MAC: "01:02:03:04:05:06", RSSI: 123},
+		{MAC: "", Timestamp: time.Now().UTC().Unix(), RSSI: -67},
+		{MAC: "01:02:03:04:05:06", RSSI: -67},
 	}
 
 	for _, notValidSnifferPacket := range notValidSnifferPackets {
@@ -75,10 +76,11 @@ func (s *PacketAPISuite) TestCreatePacketWithEmptyRequiredFields() {
 
 func (s *PacketAPISuite) TestCreatePacketWithInvalidSnifferMACParam() {
 	snifferPacket := model.SnifferPacket{
-		MAC: "22:44:66:88:AA:CC", Timestamp: time.Now().UTC().Unix(), RSSI: 123,
+		MAC: "22:44:66:88:AA:CC", Timestamp: time.Now().UTC().Unix(), RSSI: -67,
 	}
 	rec := sendTestRequestToHandlerWithInvalidParam(snifferPacket, s.packetAPI.CreatePacket)
 	assert.Equal(s.T(), http.StatusNotFound, rec.Code)
+	assert.Equal(s.T(), CodeNotFound, decodeError(rec).Code)
 }
 
 func (s *PacketAPISuite) TestCreatePacketWithEmptyJSON() {
@@ -93,28 +95,30 @@ func (s *PacketAPISuite) TestCreatePacketWithCorruptedJSON() {
 
 func TestCreatePacketWithFailingDB(t *testing.T) {
 	mockFailingPacketDB := createFailingMockPacketDB()
-	packetAPI := PacketAPI{mockFailingPacketDB}
+	packetAPI := PacketAPI{DB: mockFailingPacketDB}
 
 	snifferPacket := model.SnifferPacket{
-		MAC: "22:44:66:88:AA:CC", Timestamp: time.Now().UTC().Unix(), RSSI: 123,
+		MAC: "22:44:66:88:AA:CC", Timestamp: time.Now().UTC().Unix(), RSSI: -67,
 	}
 
 	rec := sendTestRequestToHandler(defaultTestSnifferMAC, snifferPacket, packetAPI.CreatePacket, http.MethodPost)
 	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, model.Error{Code: CodeInternal, Message: "internal server error"}, decodeError(rec))
 }
 
 func (s *PacketAPISuite) TestCreatePackets() {
 	snifferPackets := []model.SnifferPacket{
-		{MAC: "22:44:66:88:AA:CC", Timestamp: time.Now().UTC().Unix(), RSSI: 123},
-		{MAC: "33:11:22:44:55:66", Timestamp: time.Now().UTC().Unix(), RSSI: 222},
+		{MAC: "22:44:66:88:AA:CC", Timestamp: time.Now().UTC().Unix(), RSSI: -67},
+		{MAC: "33:11:22:44:55:66", Timestamp: time.Now().UTC().Unix(), RSSI: -72},
 	}
 
 	rec := sendTestRequestToHandler(defaultTestSnifferMAC, snifferPackets, s.packetAPI.CreatePackets, http.MethodPost)
 	assert.Equal(s.T(), http.StatusCreated, rec.Code)
 
-	var actualSnifferPackets []model.SnifferPacket
-	json.NewDecoder(rec.Body).Decode(&actualSnifferPackets)
-	assert.Equal(s.T(), snifferPackets, actualSnifferPackets)
+	var actualResult model.PacketCollectionResult
+	json.NewDecoder(rec.Body).Decode(&actualResult)
+	assert.Equal(s.T(), snifferPackets, actualResult.Accepted)
+	assert.Empty(s.T(), actualResult.Rejected)
 
 	expectedPackets := []model.Packet{}
 	for _, snifferPacket := range snifferPackets {
@@ -125,31 +129,44 @@ func (s *PacketAPISuite) TestCreatePackets() {
 
 func (s *PacketAPISuite) TestCreatePacketsWithEmptyRequiredFields() {
 	onlyNotValidPackets := []model.SnifferPacket{
-		{MAC: "", Timestamp: time.Now().UTC().Unix(), RSSI: 123},
-		{MAC: "01:02:03:04:05:06", RSSI: 123},
+		{MAC: "", Timestamp: time.Now().UTC().Unix(), RSSI: -67},
+		{MAC: "01:02:03:04:05:06", RSSI: -67},
 	}
 
 	rec := sendTestRequestToHandler(defaultTestSnifferMAC, onlyNotValidPackets, s.packetAPI.CreatePackets, http.MethodPost)
 	assert.Len(s.T(), s.packetDB.Packets, 0)
 	assert.Equal(s.T(), http.StatusBadRequest, rec.Code)
 
+	actualError := decodeError(rec)
+	assert.Equal(s.T(), CodeValidationFailed, actualError.Code)
+	assert.Equal(s.T(), []model.FieldError{requiredFieldError("[0].MAC"), requiredFieldError("[1].timestamp")}, actualError.Details)
+
 	validAndNotValidPackets := []model.SnifferPacket{
-		{MAC: "", Timestamp: time.Now().UTC().Unix(), RSSI: 123},
-		{MAC: "22:44:66:88:AA:CC", Timestamp: time.Now().UTC().Unix(), RSSI: 123},
-		{MAC: "01:02:03:04:05:06", Timestamp: time.Now().UTC().Unix(), RSSI: 123},
-		{MAC: "01:02:03:04:05:06", RSSI: 123},
-		{MAC: "33:11:22:44:55:66", Timestamp: time.Now().UTC().Unix(), RSSI: 222},
+		{MAC: "", Timestamp: time.Now().UTC().Unix(), RSSI: -67},
+		{MAC: "22:44:66:88:AA:CC", Timestamp: time.Now().UTC().Unix(), RSSI: -67},
+		{MAC: "01:02:03:04:05:06", Timestamp: time.Now().UTC().Unix(), RSSI: -67},
+		{MAC: "01:02:03:04:05:06", RSSI: -67},
+		{MAC: "33:11:22:44:55:66", Timestamp: time.Now().UTC().Unix(), RSSI: -72},
 	}
 
 	rec = sendTestRequestToHandler(defaultTestSnifferMAC, validAndNotValidPackets, s.packetAPI.CreatePackets, http.MethodPost)
 	assert.Len(s.T(), s.packetDB.Packets, 3)
 	assert.Equal(s.T(), http.StatusCreated, rec.Code)
+
+	var actualResult model.PacketCollectionResult
+	json.NewDecoder(rec.Body).Decode(&actualResult)
+	assert.Len(s.T(), actualResult.Accepted, 3)
+	expectedRejected := []model.RejectedPacket{
+		{Index: 0, Packet: validAndNotValidPackets[0], Errors: []model.FieldError{requiredFieldError("[0].MAC")}},
+		{Index: 3, Packet: validAndNotValidPackets[3], Errors: []model.FieldError{requiredFieldError("[3].timestamp")}},
+	}
+	assert.Equal(s.T(), expectedRejected, actualResult.Rejected)
 }
 
 func (s *PacketAPISuite) TestCreatePacketsWithInvalidSnifferMACParam() {
 	snifferPacket := []model.SnifferPacket{
 		{
-			MAC: "22:44:66:88:AA:CC", Timestamp: time.Now().UTC().Unix(), RSSI: 123,
+			MAC: "22:44:66:88:AA:CC", Timestamp: time.Now().UTC().Unix(), RSSI: -67,
 		},
 	}
 	rec := sendTestRequestToHandlerWithInvalidParam(snifferPacket, s.packetAPI.CreatePackets)
@@ -167,11 +184,11 @@ func (s *PacketAPISuite) TestCreatePacketsWithCorruptedJSON() {
 
 func TestCreatePacketsWithFailingDB(t *testing.T) {
 	mockPacketDB := createFailingMockPacketDB()
-	packetAPI := PacketAPI{mockPacketDB}
+	packetAPI := PacketAPI{DB: mockPacketDB}
 
 	snifferPackets := []model.SnifferPacket{
-		{MAC: "22:44:66:88:AA:CC", Timestamp: time.Now().UTC().Unix(), RSSI: 123},
-		{MAC: "33:11:22:44:55:66", Timestamp: time.Now().UTC().Unix(), RSSI: 222},
+		{MAC: "22:44:66:88:AA:CC", Timestamp: time.Now().UTC().Unix(), RSSI: -67},
+		{MAC: "33:11:22:44:55:66", Timestamp: time.Now().UTC().Unix(), RSSI: -72},
 	}
 
 	rec := sendTestRequestToHandler(defaultTestSnifferMAC, snifferPackets, packetAPI.CreatePackets, http.MethodPost)
@@ -0,0 +1,285 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cyucelen/wirect/model"
+	"github.com/labstack/echo"
+)
+
+// PathLossModel converts RSSI to distance with the log-distance path loss model,
+// RSSI = ReferenceRSSI - 10 * Exponent * log10(distance in meters)
+type PathLossModel struct {
+	// ReferenceRSSI is the RSSI of a device 1 meter away
+	ReferenceRSSI float64
+	Exponent      float64
+}
+
+// DefaultPathLossModel fits indoor spaces with some walls
+var DefaultPathLossModel = PathLossModel{ReferenceRSSI: -40, Exponent: 2.7}
+
+// minDistance keeps devices right next to a sniffer from getting an infinite weight
+const minDistance = 0.1
+
+// Distance returns the estimated distance in meters of a device seen with rssi
+func (m PathLossModel) Distance(rssi float64) float64 {
+	return math.Max(minDistance, math.Pow(10, (m.ReferenceRSSI-rssi)/(10*m.Exponent)))
+}
+
+type PositioningDatabase interface {
+	PacketDatabase
+	SnifferDatabase
+}
+
+// PositioningAPI estimates where devices are on floors with sniffers which have floorplan coordinates
+type PositioningAPI struct {
+	DB    PositioningDatabase
+	Clock clock.Clock
+	Model PathLossModel
+}
+
+const defaultHeatmapRange = time.Hour
+const defaultPositioningWindow = time.Minute
+const defaultCellSize = 1.0
+
+// maxHeatmapCells bounds the grid of a heatmap
+const maxHeatmapCells = 250000
+
+// maxHeatmapRange and maxHeatmapWindows bound the packets which are loaded at once and the positions which are estimated
+const maxHeatmapRange = 24 * time.Hour
+const maxHeatmapWindows = 10000
+
+// minAnchors is the number of sniffers which must see a device in a window to estimate its position
+const minAnchors = 3
+
+// heatmapMargin is the number of cells the grid extends beyond the outermost sniffers
+const heatmapMargin = 2
+
+const gaussNewtonIterations = 20
+
+// anchor is a sniffer at a known position and the estimated distance of a device from it
+type anchor struct {
+	x, y, distance float64
+}
+
+// GetHeatmap estimates the position of every device in every window from the RSSI of the sniffers on the floor which saw it
+// and counts the positions in a grid
+func (p *PositioningAPI) GetHeatmap(ctx echo.Context) error {
+	floor, err := url.QueryUnescape(ctx.Param("floor"))
+	if err != nil || floor == "" {
+		return newNotFoundError("floor in path is not URL encoded properly")
+	}
+
+	from, until, err := parseRangeParams(ctx, orDefaultClock(p.Clock).Now(), defaultHeatmapRange)
+	if err != nil {
+		return err
+	}
+	if err := checkRangeSpan(from, until, maxHeatmapRange); err != nil {
+		return err
+	}
+
+	fieldErrors := []model.FieldError{}
+	window, fieldError := parseDurationParam(ctx, "window", defaultPositioningWindow)
+	fieldErrors = append(fieldErrors, fieldError...)
+	if len(fieldError) == 0 && window < time.Second {
+		fieldErrors = append(fieldErrors, outOfRangeFieldError("window", "window must be at least 1s"))
+	} else if len(fieldError) == 0 && (until-from)/int64(window/time.Second)+1 > maxHeatmapWindows {
+		fieldErrors = append(fieldErrors, outOfRangeFieldError("window", fmt.Sprintf("window is too small for the range, the heatmap must have at most %d windows", maxHeatmapWindows)))
+	}
+	cellSize, fieldError := parseCellSize(ctx)
+	fieldErrors = append(fieldErrors, fieldError...)
+	if len(fieldErrors) > 0 {
+		return newValidationError(fieldErrors...)
+	}
+
+	sniffers, err := p.DB.GetSniffers(ctx.Request().Context())
+	if err != nil {
+		return newDatabaseError(err)
+	}
+	placed := []model.Sniffer{}
+	for _, sniffer := range sniffers {
+		if sniffer.Floor == floor && sniffer.X != nil && sniffer.Y != nil {
+			placed = append(placed, sniffer)
+		}
+	}
+	if len(placed) == 0 {
+		return newNotFoundError("no sniffer has coordinates on floor " + floor)
+	}
+
+	heatmap := newHeatmap(floor, from, until, cellSize, placed)
+	if heatmap == nil {
+		return newValidationError(outOfRangeFieldError("cellSize", fmt.Sprintf("cellSize is too small for the floor, the heatmap must have at most %d cells", maxHeatmapCells)))
+	}
+
+	anchors, err := p.collectAnchors(ctx, placed, from, until, int64(window/time.Second))
+	if err != nil {
+		return err
+	}
+	for _, ofDevices := range anchors {
+		for _, ofDevice := range ofDevices {
+			if len(ofDevice) >= minAnchors {
+				x, y := estimatePosition(ofDevice)
+				addPosition(heatmap, x, y)
+			}
+		}
+	}
+
+	return ctx.JSON(http.StatusOK, heatmap)
+}
+
+// collectAnchors returns the anchors of every device by window, a sniffer which saw a device more than once in a window
+// is a single anchor at the distance of the mean calibrated RSSI
+func (p *PositioningAPI) collectAnchors(ctx echo.Context, sniffers []model.Sniffer, from, until, windowSeconds int64) (map[int64]map[string][]anchor, error) {
+	anchors := map[int64]map[string][]anchor{}
+	type rssiSum struct {
+		total float64
+		count int
+	}
+
+	for _, sniffer := range sniffers {
+		packets, err := p.DB.GetPacketsBySnifferBetweenDates(ctx.Request().Context(), sniffer.MAC, from, until)
+		if err != nil {
+			return nil, newDatabaseError(err)
+		}
+
+		sums := map[int64]map[string]*rssiSum{}
+		for _, packet := range packets {
+			window := packet.Timestamp / windowSeconds
+			if sums[window] == nil {
+				sums[window] = map[string]*rssiSum{}
+			}
+			if sums[window][packet.MAC] == nil {
+				sums[window][packet.MAC] = &rssiSum{}
+			}
+			sums[window][packet.MAC].total += packet.RSSI
+			sums[window][packet.MAC].count++
+		}
+
+		for window, ofDevices := range sums {
+			if anchors[window] == nil {
+				anchors[window] = map[string][]anchor{}
+			}
+			for mac, sum := range ofDevices {
+				distance := p.Model.For(sniffer).Distance(calibrated(sniffer, sum.total/float64(sum.count)))
+				anchors[window][mac] = append(anchors[window][mac], anchor{x: *sniffer.X, y: *sniffer.Y, distance: distance})
+			}
+		}
+	}
+	return anchors, nil
+}
+
+// estimatePosition finds the point whose distances from the anchors fit their estimated distances best by weighted
+// least squares with Gauss-Newton iterations from the weighted centroid. Closer anchors weigh more since the error of
+// the path loss model grows with the distance.
+func estimatePosition(anchors []anchor) (float64, float64) {
+	x, y, total := 0.0, 0.0, 0.0
+	for _, a := range anchors {
+		weight := 1 / (a.distance * a.distance)
+		x += weight * a.x
+		y += weight * a.y
+		total += weight
+	}
+	x, y = x/total, y/total
+
+	for i := 0; i < gaussNewtonIterations; i++ {
+		var a11, a12, a22, b1, b2 float64
+		for _, a := range anchors {
+			dx, dy := x-a.x, y-a.y
+			r := math.Hypot(dx, dy)
+			if r < 1e-9 {
+				continue
+			}
+			weight := 1 / (a.distance * a.distance)
+			jx, jy, residual := dx/r, dy/r, r-a.distance
+			a11 += weight * jx * jx
+			a12 += weight * jx * jy
+			a22 += weight * jy * jy
+			b1 += weight * jx * residual
+			b2 += weight * jy * residual
+		}
+
+		det := a11*a22 - a12*a12
+		if math.Abs(det) < 1e-12 {
+			break
+		}
+		stepX, stepY := (a22*b1-a12*b2)/det, (a11*b2-a12*b1)/det
+		x, y = x-stepX, y-stepY
+		if math.Hypot(stepX, stepY) < 1e-3 {
+			break
+		}
+	}
+	return x, y
+}
+
+// newHeatmap creates an empty grid covering the sniffers with a margin around them, nil if it would have too many cells
+func newHeatmap(floor string, from, until int64, cellSize float64, sniffers []model.Sniffer) *model.Heatmap {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, sniffer := range sniffers {
+		minX, maxX = math.Min(minX, *sniffer.X), math.Max(maxX, *sniffer.X)
+		minY, maxY = math.Min(minY, *sniffer.Y), math.Max(maxY, *sniffer.Y)
+	}
+
+	width := math.Floor((maxX-minX)/cellSize) + 1 + 2*heatmapMargin
+	height := math.Floor((maxY-minY)/cellSize) + 1 + 2*heatmapMargin
+	if width*height > maxHeatmapCells {
+		return nil
+	}
+
+	heatmap := &model.Heatmap{
+		Floor:    floor,
+		From:     from,
+		Until:    until,
+		CellSize: cellSize,
+		OriginX:  minX - heatmapMargin*cellSize,
+		OriginY:  minY - heatmapMargin*cellSize,
+		Width:    int(width),
+		Height:   int(height),
+	}
+
+	heatmap.Cells = make([][]int, heatmap.Height)
+	for row := range heatmap.Cells {
+		heatmap.Cells[row] = make([]int, heatmap.Width)
+	}
+	return heatmap
+}
+
+// addPosition counts a position in its cell, positions outside of the grid are counted in the nearest cell on its edge
+func addPosition(heatmap *model.Heatmap, x, y float64) {
+	column := clampInt(int(math.Floor((x-heatmap.OriginX)/heatmap.CellSize)), 0, heatmap.Width-1)
+	row := clampInt(int(math.Floor((y-heatmap.OriginY)/heatmap.CellSize)), 0, heatmap.Height-1)
+
+	heatmap.Cells[row][column]++
+	heatmap.Estimates++
+	if heatmap.Cells[row][column] > heatmap.Max {
+		heatmap.Max = heatmap.Cells[row][column]
+	}
+}
+
+func clampInt(value, min, max int) int {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
+
+func parseCellSize(ctx echo.Context) (float64, []model.FieldError) {
+	value := ctx.QueryParam("cellSize")
+	if value == "" {
+		return defaultCellSize, nil
+	}
+	cellSize, err := strconv.ParseFloat(value, 64)
+	if err != nil || !(cellSize > 0) || math.IsInf(cellSize, 0) {
+		return 0, []model.FieldError{outOfRangeFieldError("cellSize", "cellSize must be a positive number of meters")}
+	}
+	return cellSize, nil
+}
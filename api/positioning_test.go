@@ -0,0 +1,120 @@
+package api
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cyucelen/wirect/model"
+	"github.com/cyucelen/wirect/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func rssiAt(distance float64) float64 {
+	return DefaultPathLossModel.ReferenceRSSI - 10*DefaultPathLossModel.Exponent*math.Log10(distance)
+}
+
+func TestPathLossModelDistance(t *testing.T) {
+	assert.InDelta(t, 1, DefaultPathLossModel.Distance(-40), 1e-9)
+	assert.InDelta(t, 10, DefaultPathLossModel.Distance(-67), 1e-9)
+	assert.Equal(t, minDistance, DefaultPathLossModel.Distance(0))
+}
+
+func TestEstimatePosition(t *testing.T) {
+	anchors := []anchor{
+		{x: 0, y: 0, distance: math.Hypot(4, 3)},
+		{x: 10, y: 0, distance: math.Hypot(6, 3)},
+		{x: 0, y: 10, distance: math.Hypot(4, 7)},
+		{x: 10, y: 10, distance: math.Hypot(6, 7)},
+	}
+
+	x, y := estimatePosition(anchors)
+	assert.InDelta(t, 4, x, 0.01)
+	assert.InDelta(t, 3, y, 0.01)
+
+	// a wrong distance from a far sniffer moves the estimate less than one from a close sniffer
+	anchors[3].distance += 3
+	x, y = estimatePosition(anchors)
+	assert.InDelta(t, 4, x, 1)
+	assert.InDelta(t, 3, y, 1)
+}
+
+func createPositioningAPI(now time.Time) *PositioningAPI {
+	mockClock := clock.NewMock()
+	mockClock.Set(now)
+	at := func(value float64) *float64 { return &value }
+
+	db := &test.InMemoryDB{
+		Sniffers: []model.Sniffer{
+			{MAC: "00:00:00:00:00:01", Floor: "1", X: at(0), Y: at(0)},
+			{MAC: "00:00:00:00:00:02", Floor: "1", X: at(10), Y: at(0)},
+			{MAC: "00:00:00:00:00:03", Floor: "1", X: at(0), Y: at(10)},
+			{MAC: "00:00:00:00:00:04", Floor: "2", X: at(0), Y: at(0)},
+			{MAC: "00:00:00:00:00:05", Floor: "1"},
+		},
+	}
+	timestamp := now.Add(-10 * time.Minute).Unix()
+	device := func(snifferMAC, mac string, distance float64) model.Packet {
+		return model.Packet{SnifferMAC: snifferMAC, MAC: mac, RSSI: rssiAt(distance), Timestamp: timestamp}
+	}
+	db.Packets = []model.Packet{
+		device("00:00:00:00:00:01", "BB:BB:BB:BB:BB:01", math.Hypot(5, 3)),
+		device("00:00:00:00:00:02", "BB:BB:BB:BB:BB:01", math.Hypot(5, 3)),
+		device("00:00:00:00:00:03", "BB:BB:BB:BB:BB:01", math.Hypot(5, 7)),
+		device("00:00:00:00:00:01", "BB:BB:BB:BB:BB:02", 2),
+		device("00:00:00:00:00:02", "BB:BB:BB:BB:BB:02", 8),
+	}
+	return &PositioningAPI{DB: db, Clock: mockClock, Model: DefaultPathLossModel}
+}
+
+func sendHeatmapRequest(positioningAPI *PositioningAPI, floor, query string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+	c, rec := createTestContext(req)
+	c.SetPath("/floors/:floor/heatmap")
+	c.SetParamNames("floor")
+	c.SetParamValues(url.PathEscape(floor))
+	serve(c, positioningAPI.GetHeatmap)
+	return rec
+}
+
+func TestGetHeatmap(t *testing.T) {
+	now := time.Unix(100000, 0)
+	positioningAPI := createPositioningAPI(now)
+
+	rec := sendHeatmapRequest(positioningAPI, "1", "cellSize=2")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var heatmap model.Heatmap
+	json.NewDecoder(rec.Body).Decode(&heatmap)
+	assert.Equal(t, "1", heatmap.Floor)
+	assert.Equal(t, now.Add(-time.Hour).Unix(), heatmap.From)
+	assert.Equal(t, -4.0, heatmap.OriginX)
+	assert.Equal(t, -4.0, heatmap.OriginY)
+	assert.Equal(t, 10, heatmap.Width)
+	assert.Equal(t, 10, heatmap.Height)
+	assert.Equal(t, 1, heatmap.Estimates)
+	assert.Equal(t, 1, heatmap.Max)
+	// the device at 5,3 is in the cell from 4,2 to 6,4
+	assert.Equal(t, 1, heatmap.Cells[3][4])
+}
+
+func TestGetHeatmapOfFloorWithoutPlacedSniffers(t *testing.T) {
+	positioningAPI := createPositioningAPI(time.Unix(100000, 0))
+
+	rec := sendHeatmapRequest(positioningAPI, "3", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestGetHeatmapWithInvalidParams(t *testing.T) {
+	positioningAPI := createPositioningAPI(time.Unix(100000, 0))
+
+	for _, query := range []string{"cellSize=0", "cellSize=big", "cellSize=0.001", "window=0", "from=-1h&until=-2h", "from=-25h", "from=-24h&window=1s"} {
+		rec := sendHeatmapRequest(positioningAPI, "1", query)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"math"
+	"net/http"
+
+	"github.com/cyucelen/wirect/model"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+)
+
+// baselineSmoothing is the weight of an upload which matches the baseline in the RSSI of the baseline,
+// so the baseline follows slow changes such as furniture being moved
+const baselineSmoothing = 0.1
+
+// RelocationDetector compares the routers uploaded by a sniffer with the baseline fingerprint of its location.
+// The first upload becomes the baseline. A single upload which differs is not enough since a sniffer
+// may miss routers in a scan, the sniffer is possibly relocated once Confirmations uploads in a row differ.
+// Concurrent uploads of a sniffer update its fingerprint one at a time.
+type RelocationDetector struct {
+	// JaccardThreshold is the Jaccard distance between the routers of an upload and of the baseline at which they differ
+	JaccardThreshold float64
+	// RSSIShift is the mean absolute RSSI difference of the routers in both at which they differ
+	RSSIShift     float64
+	Confirmations int
+
+	locks snifferLocks
+}
+
+// Check updates the fingerprint with an upload taken at now and reports whether the sniffer just became possibly relocated
+func (d *RelocationDetector) Check(fingerprint *model.SnifferFingerprint, upload model.Fingerprint, now int64) bool {
+	if len(upload) == 0 {
+		return false
+	}
+
+	fingerprint.LastChecked = now
+	if len(fingerprint.Baseline) == 0 {
+		fingerprint.Baseline = upload.Copy()
+		fingerprint.BaselineSince = now
+		fingerprint.Distance, fingerprint.RSSIShift, fingerprint.Strikes = 0, 0, 0
+		return false
+	}
+
+	fingerprint.Distance = jaccardDistance(fingerprint.Baseline, upload)
+	fingerprint.RSSIShift = rssiShift(fingerprint.Baseline, upload)
+	if fingerprint.Distance < d.JaccardThreshold && fingerprint.RSSIShift < d.RSSIShift {
+		fingerprint.Strikes = 0
+		for router, rssi := range upload {
+			if baseline, known := fingerprint.Baseline[router]; known && baseline != 0 && rssi != 0 {
+				fingerprint.Baseline[router] = baseline + baselineSmoothing*(rssi-baseline)
+			}
+		}
+		return false
+	}
+
+	fingerprint.Strikes++
+	if fingerprint.Strikes < d.Confirmations || fingerprint.RelocatedAt != 0 {
+		return false
+	}
+	fingerprint.RelocatedAt = now
+	return true
+}
+
+// jaccardDistance is the share of the routers seen in either fingerprint which are not seen in both
+func jaccardDistance(a, b model.Fingerprint) float64 {
+	shared := 0
+	for router := range a {
+		if _, seen := b[router]; seen {
+			shared++
+		}
+	}
+	union := len(a) + len(b) - shared
+	if union == 0 {
+		return 0
+	}
+	return 1 - float64(shared)/float64(union)
+}
+
+// rssiShift is the mean absolute RSSI difference of the routers with a reported RSSI in both fingerprints
+func rssiShift(a, b model.Fingerprint) float64 {
+	total, count := 0.0, 0
+	for router, rssiA := range a {
+		if rssiB, seen := b[router]; seen && rssiA != 0 && rssiB != 0 {
+			total += math.Abs(rssiA - rssiB)
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return total / float64(count)
+}
+
+// toFingerprint keys routers by BSSID, or by SSID if the BSSID is not reported, keeping the latest report of each
+func toFingerprint(routers []model.RouterExternal) model.Fingerprint {
+	fingerprint := model.Fingerprint{}
+	latest := map[string]int64{}
+	for _, router := range routers {
+		key := router.BSSID
+		if key == "" {
+			key = "SSID:" + router.SSID
+		}
+		if seen, exists := latest[key]; !exists || router.LastSeen >= seen {
+			fingerprint[key] = router.RSSI
+			latest[key] = router.LastSeen
+		}
+	}
+	return fingerprint
+}
+
+func toRelocation(fingerprint *model.SnifferFingerprint) model.Relocation {
+	relocation := model.Relocation{
+		SnifferMAC:    fingerprint.SnifferMAC,
+		Status:        model.RelocationStable,
+		RelocatedAt:   fingerprint.RelocatedAt,
+		BaselineSince: fingerprint.BaselineSince,
+		LastChecked:   fingerprint.LastChecked,
+		Routers:       len(fingerprint.Baseline),
+		Distance:      fingerprint.Distance,
+		RSSIShift:     fingerprint.RSSIShift,
+	}
+	switch {
+	case len(fingerprint.Baseline) == 0:
+		relocation.Status = model.RelocationUnknown
+	case fingerprint.RelocatedAt != 0:
+		relocation.Status = model.RelocationPossible
+	}
+	return relocation
+}
+
+// checkRelocation compares the uploaded routers with the fingerprint of the sniffer. Routers are already stored
+// when it runs, so failures are logged instead of failing the upload which the sniffer would retry.
+func (r *RouterAPI) checkRelocation(ctx echo.Context, snifferMAC string, routers []model.RouterExternal) {
+	if r.Relocation == nil {
+		return
+	}
+	// the fingerprint is read, updated and written back, so an upload running alongside would lose its strike
+	defer r.Relocation.locks.lock(snifferMAC)()
+
+	fingerprint, err := r.DB.GetSnifferFingerprint(ctx.Request().Context(), snifferMAC)
+	if err != nil {
+		logError(ctx, "fingerprint could not be read", log.JSON{"error": err.Error()})
+		return
+	}
+
+	if r.Relocation.Check(&fingerprint, toFingerprint(routers), orDefaultClock(r.Clock).Now().Unix()) {
+		logWarn(ctx, "sniffer possibly relocated", log.JSON{"distance": fingerprint.Distance, "RSSIShift": fingerprint.RSSIShift})
+	}
+
+	if err := r.DB.UpdateSnifferFingerprint(ctx.Request().Context(), &fingerprint); err != nil {
+		logError(ctx, "fingerprint could not be updated", log.JSON{"error": err.Error()})
+	}
+}
+
+// GetRelocation returns whether the routers around the sniffer still match its baseline
+func (r *RouterAPI) GetRelocation(ctx echo.Context) error {
+	snifferMAC, err := getSnifferMAC(ctx)
+	if err != nil {
+		return err
+	}
+
+	fingerprint, err := r.DB.GetSnifferFingerprint(ctx.Request().Context(), snifferMAC)
+	if err != nil {
+		return newDatabaseError(err)
+	}
+	return ctx.JSON(http.StatusOK, toRelocation(&fingerprint))
+}
+
+// ResetRelocation forgets the baseline of the sniffer after it was moved on purpose, the next upload becomes the new baseline
+func (r *RouterAPI) ResetRelocation(ctx echo.Context) error {
+	snifferMAC, err := getSnifferMAC(ctx)
+	if err != nil {
+		return err
+	}
+
+	if r.Relocation != nil {
+		defer r.Relocation.locks.lock(snifferMAC)()
+	}
+	fingerprint := model.SnifferFingerprint{SnifferMAC: snifferMAC}
+	if err := r.DB.UpdateSnifferFingerprint(ctx.Request().Context(), &fingerprint); err != nil {
+		return newDatabaseError(err)
+	}
+	return ctx.JSON(http.StatusOK, toRelocation(&fingerprint))
+}
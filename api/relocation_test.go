@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cyucelen/wirect/model"
+	"github.com/cyucelen/wirect/test"
+	"github.com/stretchr/testify/assert"
+)
+
+var testRelocationDetector = &RelocationDetector{JaccardThreshold: 0.6, RSSIShift: 15, Confirmations: 2}
+
+func TestJaccardDistance(t *testing.T) {
+	a := model.Fingerprint{"1": -50, "2": -60, "3": -70}
+
+	assert.Equal(t, 0.0, jaccardDistance(a, a))
+	assert.Equal(t, 0.5, jaccardDistance(a, model.Fingerprint{"2": -60, "3": -70, "4": -80}))
+	assert.Equal(t, 1.0, jaccardDistance(a, model.Fingerprint{"4": -80}))
+	assert.Equal(t, 0.0, jaccardDistance(model.Fingerprint{}, model.Fingerprint{}))
+}
+
+func TestRSSIShiftIgnoresUnreportedRSSI(t *testing.T) {
+	a := model.Fingerprint{"1": -50, "2": -60, "3": 0}
+	b := model.Fingerprint{"1": -70, "2": -50, "3": -40, "4": -90}
+
+	assert.Equal(t, 15.0, rssiShift(a, b))
+	assert.Equal(t, 0.0, rssiShift(a, model.Fingerprint{"4": -90}))
+}
+
+func TestRelocationDetector(t *testing.T) {
+	fingerprint := model.SnifferFingerprint{SnifferMAC: defaultTestSnifferMAC}
+	baseline := model.Fingerprint{"1": -50, "2": -60, "3": -70}
+
+	assert.False(t, testRelocationDetector.Check(&fingerprint, model.Fingerprint{}, 900))
+	assert.Zero(t, fingerprint.BaselineSince)
+
+	assert.False(t, testRelocationDetector.Check(&fingerprint, baseline, 1000))
+	assert.Equal(t, baseline, fingerprint.Baseline)
+	assert.Equal(t, int64(1000), fingerprint.BaselineSince)
+
+	assert.False(t, testRelocationDetector.Check(&fingerprint, model.Fingerprint{"1": -40, "2": -60}, 1100))
+	assert.Equal(t, -49.0, fingerprint.Baseline["1"])
+	assert.Len(t, fingerprint.Baseline, 3)
+
+	moved := model.Fingerprint{"4": -50, "5": -60}
+	assert.False(t, testRelocationDetector.Check(&fingerprint, moved, 1200))
+	assert.Equal(t, 1, fingerprint.Strikes)
+	assert.False(t, testRelocationDetector.Check(&fingerprint, baseline, 1300))
+	assert.Zero(t, fingerprint.Strikes)
+
+	assert.False(t, testRelocationDetector.Check(&fingerprint, moved, 1400))
+	assert.True(t, testRelocationDetector.Check(&fingerprint, moved, 1500))
+	assert.Equal(t, int64(1500), fingerprint.RelocatedAt)
+	assert.Equal(t, 1.0, fingerprint.Distance)
+
+	assert.False(t, testRelocationDetector.Check(&fingerprint, moved, 1600))
+	assert.Equal(t, int64(1500), fingerprint.RelocatedAt)
+}
+
+func TestRelocationDetectorNoticesRSSIShift(t *testing.T) {
+	fingerprint := model.SnifferFingerprint{Baseline: model.Fingerprint{"1": -50, "2": -60}}
+	shifted := model.Fingerprint{"1": -75, "2": -80}
+
+	testRelocationDetector.Check(&fingerprint, shifted, 1000)
+	assert.True(t, testRelocationDetector.Check(&fingerprint, shifted, 1100))
+	assert.Equal(t, 0.0, fingerprint.Distance)
+	assert.Equal(t, 22.5, fingerprint.RSSIShift)
+}
+
+func TestToFingerprintKeepsLatestReportOfEachRouter(t *testing.T) {
+	routers := []model.RouterExternal{
+		{SSID: "eduroam", BSSID: "AA:AA:AA:AA:AA:01", RSSI: -60, LastSeen: 1100},
+		{SSID: "eduroam", BSSID: "AA:AA:AA:AA:AA:01", RSSI: -70, LastSeen: 1000},
+		{SSID: "1010", LastSeen: 1000},
+	}
+
+	assert.Equal(t, model.Fingerprint{"AA:AA:AA:AA:AA:01": -60, "SSID:1010": 0}, toFingerprint(routers))
+}
+
+func TestRelocationEndpoints(t *testing.T) {
+	mockClock := clock.NewMock()
+	mockClock.Set(time.Unix(10000, 0))
+	db := &test.InMemoryDB{}
+	routerAPI := &RouterAPI{DB: db, Clock: mockClock, Relocation: testRelocationDetector}
+
+	relocation := sendRelocationRequest(routerAPI.GetRelocation)
+	assert.Equal(t, model.Relocation{SnifferMAC: defaultTestSnifferMAC, Status: model.RelocationUnknown}, relocation)
+
+	uploads := [][]model.RouterExternal{
+		{{SSID: "eduroam", BSSID: "AA:AA:AA:AA:AA:01", RSSI: -60}, {SSID: "1010", RSSI: -70}},
+		{{SSID: "eduroam", BSSID: "AA:AA:AA:AA:AA:01", RSSI: -62}, {SSID: "1010", RSSI: -71}},
+	}
+	for _, routers := range uploads {
+		rec := sendTestRequestToHandler(defaultTestSnifferMAC, routers, routerAPI.CreateRouters, http.MethodPost)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	}
+	relocation = sendRelocationRequest(routerAPI.GetRelocation)
+	assert.Equal(t, model.RelocationStable, relocation.Status)
+	assert.Equal(t, 2, relocation.Routers)
+
+	for i := 0; i < 2; i++ {
+		mockClock.Add(time.Minute)
+		sendTestRequestToHandler(defaultTestSnifferMAC, []model.RouterExternal{{SSID: "Arch", RSSI: -50}}, routerAPI.CreateRouters, http.MethodPost)
+	}
+	relocation = sendRelocationRequest(routerAPI.GetRelocation)
+	assert.Equal(t, model.RelocationPossible, relocation.Status)
+	assert.Equal(t, mockClock.Now().Unix(), relocation.RelocatedAt)
+
+	relocation = sendRelocationRequest(routerAPI.ResetRelocation)
+	assert.Equal(t, model.RelocationUnknown, relocation.Status)
+	relocation = sendRelocationRequest(routerAPI.GetRelocation)
+	assert.Equal(t, model.RelocationUnknown, relocation.Status)
+}
+
+// slowFingerprintDB serializes the queries of concurrent uploads and takes a while to read fingerprints,
+// so uploads which do not wait for each other read the same fingerprint
+type slowFingerprintDB struct {
+	*test.InMemoryDB
+	mu sync.Mutex
+}
+
+func (s *slowFingerprintDB) CreateRouter(ctx context.Context, router *model.Router) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.InMemoryDB.CreateRouter(ctx, router)
+}
+
+func (s *slowFingerprintDB) CreateRouterSighting(ctx context.Context, sighting *model.RouterSighting) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.InMemoryDB.CreateRouterSighting(ctx, sighting)
+}
+
+func (s *slowFingerprintDB) GetSnifferFingerprint(ctx context.Context, snifferMAC string) (model.SnifferFingerprint, error) {
+	s.mu.Lock()
+	fingerprint, err := s.InMemoryDB.GetSnifferFingerprint(ctx, snifferMAC)
+	s.mu.Unlock()
+	time.Sleep(time.Millisecond)
+	return fingerprint, err
+}
+
+func (s *slowFingerprintDB) UpdateSnifferFingerprint(ctx context.Context, fingerprint *model.SnifferFingerprint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.InMemoryDB.UpdateSnifferFingerprint(ctx, fingerprint)
+}
+
+func TestConcurrentUploadsOfSnifferKeepEveryStrike(t *testing.T) {
+	db := &slowFingerprintDB{InMemoryDB: &test.InMemoryDB{
+		Fingerprints: []model.SnifferFingerprint{{SnifferMAC: defaultTestSnifferMAC, Baseline: model.Fingerprint{"SSID:1010": -60}}},
+	}}
+	detector := &RelocationDetector{JaccardThreshold: 0.6, RSSIShift: 15, Confirmations: 100}
+	routerAPI := &RouterAPI{DB: db, Clock: clock.NewMock(), Relocation: detector}
+
+	const uploads = 10
+	var wg sync.WaitGroup
+	for i := 0; i < uploads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sendTestRequestToHandler(defaultTestSnifferMAC, []model.RouterExternal{{SSID: "Arch", RSSI: -50}}, routerAPI.CreateRouters, http.MethodPost)
+		}()
+	}
+	wg.Wait()
+
+	fingerprint, _ := db.GetSnifferFingerprint(context.Background(), defaultTestSnifferMAC)
+	assert.Equal(t, uploads, fingerprint.Strikes)
+}
+
+func sendRelocationRequest(handler handlerFunc) model.Relocation {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	c, rec := createTestContext(req)
+	c.SetPath("/:snifferMAC/relocation")
+	c.SetParamNames("snifferMAC")
+	c.SetParamValues(url.QueryEscape(defaultTestSnifferMAC))
+	serve(c, handler)
+
+	var relocation model.Relocation
+	json.NewDecoder(rec.Body).Decode(&relocation)
+	return relocation
+}
@@ -1,26 +1,54 @@
 package api
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"net/url"
+	"sort"
+	"time"
 
+	"github.com/benbjohnson/clock"
 	"github.com/cyucelen/wirect/model"
 	"github.com/labstack/echo"
 )
 
 type RouterDatabase interface {
-	CreateRouter(router *model.Router) error
-	GetRoutersBySniffer(snifferMAC string) []model.Router
+	CreateRouter(ctx context.Context, router *model.Router) error
+	GetRoutersBySniffer(ctx context.Context, snifferMAC string) ([]model.Router, error)
+	CreateRouterSighting(ctx context.Context, sighting *model.RouterSighting) error
+	GetRouterSightingsBySnifferBetweenDates(ctx context.Context, snifferMAC string, from, until int64) ([]model.RouterSighting, error)
+	GetSnifferFingerprint(ctx context.Context, snifferMAC string) (model.SnifferFingerprint, error)
+	UpdateSnifferFingerprint(ctx context.Context, fingerprint *model.SnifferFingerprint) error
 }
 
 type RouterAPI struct {
-	DB RouterDatabase
+	DB        RouterDatabase
+	Validator *Validator
+	Clock     clock.Clock
+	// Detector checks every uploaded router for imitations of authorized networks, nil disables the checks
+	Detector      *RogueDetector
+	RogueObserver RogueObserver
+	// Relocation compares every upload with the fingerprint of the location of the sniffer, nil disables the checks
+	Relocation *RelocationDetector
+	// Sniffers holds the calibration which is applied to the RSSI of routers in queries, nil leaves RSSI as reported
+	Sniffers SnifferDatabase
 }
 
+const defaultRouterHistoryRange = 24 * time.Hour
+
 func (r *RouterAPI) CreateRouters(ctx echo.Context) error {
 	var routers []model.RouterExternal
 	if err := ctx.Bind(&routers); err != nil {
-		ctx.JSON(http.StatusBadRequest, "")
-		return err
+		return newInvalidJSONError(err)
+	}
+
+	fieldErrors := []model.FieldError{}
+	for i := range routers {
+		fieldErrors = append(fieldErrors, orDefaultValidator(r.Validator).Router(&routers[i], fmt.Sprintf("[%d].", i))...)
+	}
+	if len(fieldErrors) > 0 {
+		return newValidationError(fieldErrors...)
 	}
 
 	snifferMAC, err := getSnifferMAC(ctx)
@@ -30,14 +58,18 @@ func (r *RouterAPI) CreateRouters(ctx echo.Context) error {
 
 	for _, router := range routers {
 		internalRouter := toInternalRouter(snifferMAC, &router)
-		if err := r.DB.CreateRouter(internalRouter); err != nil {
-			ctx.JSON(http.StatusInternalServerError, nil)
-			return err
+		if err := r.DB.CreateRouter(ctx.Request().Context(), internalRouter); err != nil {
+			return newDatabaseError(err)
+		}
+		sighting := toRouterSighting(snifferMAC, &router)
+		if err := r.DB.CreateRouterSighting(ctx.Request().Context(), sighting); err != nil {
+			return newDatabaseError(err)
 		}
+		detectRogues(ctx, r.Detector, r.RogueObserver, sighting)
 	}
+	r.checkRelocation(ctx, snifferMAC, routers)
 
-	ctx.JSON(http.StatusCreated, routers)
-	return nil
+	return ctx.JSON(http.StatusCreated, routers)
 }
 
 func (r *RouterAPI) GetRouters(ctx echo.Context) error {
@@ -46,28 +78,270 @@ func (r *RouterAPI) GetRouters(ctx echo.Context) error {
 		return err
 	}
 
-	routers := r.DB.GetRoutersBySniffer(snifferMAC)
+	routers, err := r.DB.GetRoutersBySniffer(ctx.Request().Context(), snifferMAC)
+	if err != nil {
+		return newDatabaseError(err)
+	}
+	sniffer, err := r.getCalibration(ctx, snifferMAC)
+	if err != nil {
+		return err
+	}
 	externalRouters := []model.RouterExternal{}
 
 	for _, router := range routers {
+		if router.RSSI != 0 {
+			router.RSSI = calibrated(sniffer, router.RSSI)
+		}
 		externalRouters = append(externalRouters, *toExternal(&router))
 	}
 
-	ctx.JSON(http.StatusOK, externalRouters)
+	return ctx.JSON(http.StatusOK, externalRouters)
+}
+
+// GetRouterHistory lists every sighting of routers by the sniffer in the range, oldest first
+func (r *RouterAPI) GetRouterHistory(ctx echo.Context) error {
+	sightings, err := r.getSightings(ctx)
+	if err != nil {
+		return err
+	}
+
+	history := []model.RouterExternal{}
+	for _, sighting := range sightings {
+		history = append(history, *sightingToExternal(&sighting))
+	}
+
+	return ctx.JSON(http.StatusOK, history)
+}
+
+// GetBSSIDs summarizes the sightings of every access point seen by the sniffer in the range, most recent first.
+// Access points sharing an SSID are listed separately.
+func (r *RouterAPI) GetBSSIDs(ctx echo.Context) error {
+	sightings, err := r.getSightings(ctx)
+	if err != nil {
+		return err
+	}
+
+	return ctx.JSON(http.StatusOK, summarizeSightings(sightings, false))
+}
+
+// GetBSSID summarizes the sightings of a single access point by the sniffer in the range together with their history
+func (r *RouterAPI) GetBSSID(ctx echo.Context) error {
+	bssid, err := getBSSID(ctx)
+	if err != nil {
+		return err
+	}
+
+	sightings, err := r.getSightings(ctx)
+	if err != nil {
+		return err
+	}
+
+	ofBSSID := []model.RouterSighting{}
+	for _, sighting := range sightings {
+		if sighting.BSSID == bssid {
+			ofBSSID = append(ofBSSID, sighting)
+		}
+	}
+
+	details := summarizeSightings(ofBSSID, true)
+	if len(details) == 0 {
+		return newNotFoundError("access point was not seen by the sniffer in the range")
+	}
+	return ctx.JSON(http.StatusOK, details[0])
+}
+
+// getSightings reads the sniffer and the optional from and until query parameters, which default to the last 24 hours
+func (r *RouterAPI) getSightings(ctx echo.Context) ([]model.RouterSighting, error) {
+	snifferMAC, err := getSnifferMAC(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	from, until, err := parseRangeParams(ctx, orDefaultClock(r.Clock).Now(), defaultRouterHistoryRange)
+	if err != nil {
+		return nil, err
+	}
+
+	sightings, err := r.DB.GetRouterSightingsBySnifferBetweenDates(ctx.Request().Context(), snifferMAC, from, until)
+	if err != nil {
+		return nil, newDatabaseError(err)
+	}
+	sniffer, err := r.getCalibration(ctx, snifferMAC)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sightings {
+		if sightings[i].RSSI != 0 {
+			sightings[i].RSSI = calibrated(sniffer, sightings[i].RSSI)
+		}
+	}
+	return sightings, nil
+}
+
+// getCalibration returns the sniffer with its calibration, sniffers which are not registered are not calibrated
+func (r *RouterAPI) getCalibration(ctx echo.Context, snifferMAC string) (model.Sniffer, error) {
+	if r.Sniffers == nil {
+		return model.Sniffer{MAC: snifferMAC}, nil
+	}
+	sniffer, err := findSniffer(ctx, r.Sniffers, snifferMAC)
+	if notFound, ok := err.(*Error); ok && notFound.Status == http.StatusNotFound {
+		return model.Sniffer{MAC: snifferMAC}, nil
+	}
+	return sniffer, err
+}
+
+// parseRangeParams reads the optional from and until query parameters, until defaults to now and from to defaultRange before until
+func parseRangeParams(ctx echo.Context, now time.Time, defaultRange time.Duration) (int64, int64, error) {
+	fieldErrors := []model.FieldError{}
+
+	until, fieldError := parseTimeParam(ctx, "until", now, now)
+	fieldErrors = append(fieldErrors, fieldError...)
+
+	from, fieldError := parseTimeParam(ctx, "from", now, until.Add(-defaultRange))
+	fieldErrors = append(fieldErrors, fieldError...)
+
+	if len(fieldErrors) == 0 && from.After(until) {
+		fieldErrors = append(fieldErrors, outOfRangeFieldError("from", "from must not be after until"))
+	}
+	if len(fieldErrors) > 0 {
+		return 0, 0, newValidationError(fieldErrors...)
+	}
+
+	return from.Unix(), until.Unix(), nil
+}
+
+// checkRangeSpan rejects ranges which are longer than maxRange, for endpoints which load every packet of the range at once
+func checkRangeSpan(from, until int64, maxRange time.Duration) error {
+	if until-from > int64(maxRange/time.Second) {
+		return newValidationError(outOfRangeFieldError("from", fmt.Sprintf("from must be at most %v before until", maxRange)))
+	}
 	return nil
 }
 
+func orDefaultClock(c clock.Clock) clock.Clock {
+	if c == nil {
+		return clock.New()
+	}
+	return c
+}
+
+func getBSSID(ctx echo.Context) (string, error) {
+	bssid, err := url.QueryUnescape(ctx.Param("BSSID"))
+	if err != nil {
+		notFound := newNotFoundError("BSSID in path is not URL encoded properly")
+		notFound.Internal = err
+		return "", notFound
+	}
+
+	normalizedBSSID, err := NormalizeMAC(bssid)
+	if err != nil {
+		return "", newNotFoundError("BSSID in path is not a MAC address")
+	}
+
+	return normalizedBSSID, nil
+}
+
+// summarizeSightings groups the sightings by BSSID, sightings without a BSSID are left out.
+// The sightings must be ordered by time, the SSID, channel, band and security of a detail are the latest ones.
+func summarizeSightings(sightings []model.RouterSighting, withHistory bool) []model.RouterDetail {
+	details := map[string]*model.RouterDetail{}
+	rssiSums := map[string]float64{}
+
+	for _, sighting := range sightings {
+		if sighting.BSSID == "" {
+			continue
+		}
+
+		detail, exists := details[sighting.BSSID]
+		if !exists {
+			detail = &model.RouterDetail{
+				BSSID:     sighting.BSSID,
+				FirstSeen: sighting.Timestamp,
+				MinRSSI:   sighting.RSSI,
+				MaxRSSI:   sighting.RSSI,
+			}
+			details[sighting.BSSID] = detail
+		}
+
+		detail.SSID = sighting.SSID
+		detail.Channel = sighting.Channel
+		detail.Band = sighting.Band
+		detail.Security = sighting.Security
+		detail.LastSeen = sighting.Timestamp
+		detail.Sightings++
+		if sighting.RSSI < detail.MinRSSI {
+			detail.MinRSSI = sighting.RSSI
+		}
+		if sighting.RSSI > detail.MaxRSSI {
+			detail.MaxRSSI = sighting.RSSI
+		}
+		rssiSums[sighting.BSSID] += sighting.RSSI
+
+		if withHistory {
+			detail.History = append(detail.History, *sightingToExternal(&sighting))
+		}
+	}
+
+	summaries := []model.RouterDetail{}
+	for bssid, detail := range details {
+		detail.MeanRSSI = rssiSums[bssid] / float64(detail.Sightings)
+		summaries = append(summaries, *detail)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].LastSeen != summaries[j].LastSeen {
+			return summaries[i].LastSeen > summaries[j].LastSeen
+		}
+		return summaries[i].BSSID < summaries[j].BSSID
+	})
+	return summaries
+}
+
 func toInternalRouter(snifferMAC string, router *model.RouterExternal) *model.Router {
 	return &model.Router{
 		SSID:       router.SSID,
 		SnifferMAC: snifferMAC,
 		LastSeen:   router.LastSeen,
+		BSSID:      router.BSSID,
+		Channel:    router.Channel,
+		Band:       router.Band,
+		Security:   router.Security,
+		RSSI:       router.RSSI,
+	}
+}
+
+func toRouterSighting(snifferMAC string, router *model.RouterExternal) *model.RouterSighting {
+	return &model.RouterSighting{
+		SnifferMAC: snifferMAC,
+		SSID:       router.SSID,
+		BSSID:      router.BSSID,
+		Channel:    router.Channel,
+		Band:       router.Band,
+		Security:   router.Security,
+		RSSI:       router.RSSI,
+		Timestamp:  router.LastSeen,
 	}
 }
 
 func toExternal(router *model.Router) *model.RouterExternal {
 	return &model.RouterExternal{
 		SSID:     router.SSID,
+		BSSID:    router.BSSID,
+		Channel:  router.Channel,
+		Band:     router.Band,
+		Security: router.Security,
+		RSSI:     router.RSSI,
 		LastSeen: router.LastSeen,
 	}
 }
+
+func sightingToExternal(sighting *model.RouterSighting) *model.RouterExternal {
+	return &model.RouterExternal{
+		SSID:     sighting.SSID,
+		BSSID:    sighting.BSSID,
+		Channel:  sighting.Channel,
+		Band:     sighting.Band,
+		Security: sighting.Security,
+		RSSI:     sighting.RSSI,
+		LastSeen: sighting.Timestamp,
+	}
+}
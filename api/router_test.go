@@ -4,7 +4,12 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
 
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/suite"
@@ -33,13 +38,13 @@ func (s *RouterAPISuite) BeforeTest(string, string) {
 
 func createMockRouterDB(routers []model.Router) *mocks.RouterDatabase {
 	mockRouterDB := &mocks.RouterDatabase{}
-	mockRouterDB.On("GetRoutersBySniffer", mock.Anything).Return(routers)
+	mockRouterDB.On("GetRoutersBySniffer", mock.Anything, mock.Anything).Return(routers, nil)
 	return mockRouterDB
 }
 
 func createFailingMockRouterDB() *mocks.RouterDatabase {
 	mockRouterDatabase := &mocks.RouterDatabase{}
-	mockRouterDatabase.On("CreateRouter", mock.AnythingOfType("*model.Router")).Return(errors.New(""))
+	mockRouterDatabase.On("CreateRouter", mock.Anything, mock.AnythingOfType("*model.Router")).Return(errors.New(""))
 	return mockRouterDatabase
 }
 
@@ -160,3 +165,128 @@ func (s *RouterAPISuite) TestGetRoutersWithInvalidSnifferMACParam() {
 	rec := sendTestRequestToHandlerWithInvalidParam(routers, routerAPI.GetRouters)
 	assert.Equal(s.T(), http.StatusNotFound, rec.Code)
 }
+
+func sendRouterHistoryRequest(routerAPI *RouterAPI, handler handlerFunc, bssid, query string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+	c, rec := createTestContext(req)
+	c.SetPath("/:snifferMAC/bssids/:BSSID")
+	c.SetParamNames("snifferMAC", "BSSID")
+	c.SetParamValues(url.QueryEscape(defaultTestSnifferMAC), url.QueryEscape(bssid))
+	serve(c, handler)
+
+	return rec
+}
+
+func createRouterAPIWithSightings(now time.Time) (*RouterAPI, *test.InMemoryDB) {
+	mockClock := clock.NewMock()
+	mockClock.Set(now)
+	db := &test.InMemoryDB{}
+	routerAPI := &RouterAPI{DB: db, Clock: mockClock}
+
+	routers := []model.RouterExternal{
+		{SSID: "eduroam", BSSID: "AA:AA:AA:AA:AA:01", Channel: 1, Band: "2.4GHz", Security: "wpa2-enterprise", RSSI: -70, LastSeen: now.Add(-2 * time.Hour).Unix()},
+		{SSID: "eduroam", BSSID: "AA:AA:AA:AA:AA:02", Channel: 36, Band: "5GHz", Security: "wpa2-enterprise", RSSI: -50, LastSeen: now.Add(-time.Hour).Unix()},
+		{SSID: "eduroam", BSSID: "AA:AA:AA:AA:AA:01", Channel: 6, Band: "2.4GHz", Security: "wpa2-enterprise", RSSI: -60, LastSeen: now.Add(-30 * time.Minute).Unix()},
+		{SSID: "1010", LastSeen: now.Add(-10 * time.Minute).Unix()},
+		{SSID: "old", BSSID: "AA:AA:AA:AA:AA:03", LastSeen: now.Add(-48 * time.Hour).Unix()},
+	}
+	rec := sendTestRequestToHandler(defaultTestSnifferMAC, routers, routerAPI.CreateRouters, http.MethodPost)
+	if rec.Code != http.StatusCreated {
+		panic(rec.Body.String())
+	}
+	return routerAPI, db
+}
+
+func (s *RouterAPISuite) TestCreateRoutersRecordsEverySighting() {
+	now := time.Now()
+	_, db := createRouterAPIWithSightings(now)
+
+	assert.Len(s.T(), db.RouterSightings, 5)
+	assert.Len(s.T(), db.Routers, 4)
+	assert.Equal(s.T(), model.Router{
+		AccessPoint: "AA:AA:AA:AA:AA:01", SSID: "eduroam", SnifferMAC: defaultTestSnifferMAC, LastSeen: now.Add(-30 * time.Minute).Unix(),
+		BSSID: "AA:AA:AA:AA:AA:01", Channel: 6, Band: "2.4GHz", Security: "wpa2-enterprise", RSSI: -60,
+	}, db.Routers[0])
+}
+
+func (s *RouterAPISuite) TestGetRoutersListsAccessPointsSharingAnSSIDSeparately() {
+	now := time.Now()
+	routerAPI, _ := createRouterAPIWithSightings(now)
+
+	rec := sendTestRequestToHandler(defaultTestSnifferMAC, nil, routerAPI.GetRouters, http.MethodGet)
+	var routers []model.RouterExternal
+	json.NewDecoder(rec.Body).Decode(&routers)
+	bssids := []string{}
+	for _, router := range routers {
+		bssids = append(bssids, router.BSSID)
+	}
+	assert.Equal(s.T(), []string{"", "AA:AA:AA:AA:AA:01", "AA:AA:AA:AA:AA:02", "AA:AA:AA:AA:AA:03"}, bssids)
+}
+
+func (s *RouterAPISuite) TestGetRouterHistory() {
+	now := time.Now()
+	routerAPI, _ := createRouterAPIWithSightings(now)
+
+	rec := sendRouterHistoryRequest(routerAPI, routerAPI.GetRouterHistory, "", "")
+	assert.Equal(s.T(), http.StatusOK, rec.Code)
+
+	var history []model.RouterExternal
+	json.NewDecoder(rec.Body).Decode(&history)
+	if assert.Len(s.T(), history, 4) {
+		assert.Equal(s.T(), "AA:AA:AA:AA:AA:01", history[0].BSSID)
+		assert.Equal(s.T(), now.Add(-2*time.Hour).Unix(), history[0].LastSeen)
+		assert.Equal(s.T(), "1010", history[3].SSID)
+	}
+
+	rec = sendRouterHistoryRequest(routerAPI, routerAPI.GetRouterHistory, "", "from=-90m&until=-20m")
+	json.NewDecoder(rec.Body).Decode(&history)
+	assert.Len(s.T(), history, 2)
+
+	rec = sendRouterHistoryRequest(routerAPI, routerAPI.GetRouterHistory, "", "from=-1h&until=-2h")
+	assert.Equal(s.T(), http.StatusBadRequest, rec.Code)
+}
+
+func (s *RouterAPISuite) TestGetBSSIDsListsAccessPointsSharingAnSSIDSeparately() {
+	now := time.Now()
+	routerAPI, _ := createRouterAPIWithSightings(now)
+
+	rec := sendRouterHistoryRequest(routerAPI, routerAPI.GetBSSIDs, "", "")
+	assert.Equal(s.T(), http.StatusOK, rec.Code)
+
+	var details []model.RouterDetail
+	json.NewDecoder(rec.Body).Decode(&details)
+	assert.Equal(s.T(), []model.RouterDetail{
+		{
+			BSSID: "AA:AA:AA:AA:AA:01", SSID: "eduroam", Channel: 6, Band: "2.4GHz", Security: "wpa2-enterprise",
+			FirstSeen: now.Add(-2 * time.Hour).Unix(), LastSeen: now.Add(-30 * time.Minute).Unix(), Sightings: 2,
+			MinRSSI: -70, MaxRSSI: -60, MeanRSSI: -65,
+		},
+		{
+			BSSID: "AA:AA:AA:AA:AA:02", SSID: "eduroam", Channel: 36, Band: "5GHz", Security: "wpa2-enterprise",
+			FirstSeen: now.Add(-time.Hour).Unix(), LastSeen: now.Add(-time.Hour).Unix(), Sightings: 1,
+			MinRSSI: -50, MaxRSSI: -50, MeanRSSI: -50,
+		},
+	}, details)
+}
+
+func (s *RouterAPISuite) TestGetBSSID() {
+	now := time.Now()
+	routerAPI, _ := createRouterAPIWithSightings(now)
+
+	rec := sendRouterHistoryRequest(routerAPI, routerAPI.GetBSSID, "aa-aa-aa-aa-aa-01", "")
+	assert.Equal(s.T(), http.StatusOK, rec.Code)
+
+	var detail model.RouterDetail
+	json.NewDecoder(rec.Body).Decode(&detail)
+	assert.Equal(s.T(), 2, detail.Sightings)
+	if assert.Len(s.T(), detail.History, 2) {
+		assert.Equal(s.T(), 1, detail.History[0].Channel)
+		assert.Equal(s.T(), 6, detail.History[1].Channel)
+	}
+
+	rec = sendRouterHistoryRequest(routerAPI, routerAPI.GetBSSID, "AA:AA:AA:AA:AA:03", "")
+	assert.Equal(s.T(), http.StatusNotFound, rec.Code)
+
+	rec = sendRouterHistoryRequest(routerAPI, routerAPI.GetBSSID, "not-a-bssid", "")
+	assert.Equal(s.T(), http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cyucelen/wirect/model"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+)
+
+type SecurityDatabase interface {
+	SnifferDatabase
+	RouterDatabase
+}
+
+// RogueObserver is notified about every suspicious sighting of a router as it is uploaded
+type RogueObserver interface {
+	RogueAccessPointDetected(rogue model.RogueAccessPoint)
+}
+
+// AuthorizedAccessPoint is an access point of a network which is protected against imitation.
+// An empty Security authorizes any security type.
+type AuthorizedAccessPoint struct {
+	SSID     string
+	BSSID    string
+	Security string
+}
+
+// RogueDetector finds sightings which use the SSID of an authorized network with an unknown BSSID
+// or an authorized BSSID with different security. SSIDs which are not authorized are never suspicious,
+// neither are sightings without a BSSID since older sniffers do not report it.
+type RogueDetector struct {
+	// authorized maps SSIDs to their authorized BSSIDs and the security of each
+	authorized map[string]map[string]string
+}
+
+func NewRogueDetector(allowlist []AuthorizedAccessPoint) *RogueDetector {
+	authorized := map[string]map[string]string{}
+	for _, accessPoint := range allowlist {
+		bssid, err := NormalizeMAC(accessPoint.BSSID)
+		if err != nil {
+			continue
+		}
+		if authorized[accessPoint.SSID] == nil {
+			authorized[accessPoint.SSID] = map[string]string{}
+		}
+		authorized[accessPoint.SSID][bssid] = strings.ToLower(accessPoint.Security)
+	}
+	return &RogueDetector{authorized: authorized}
+}
+
+// Check returns the sighting as a rogue access point if it is suspicious
+func (d *RogueDetector) Check(sighting *model.RouterSighting) (model.RogueAccessPoint, bool) {
+	bssids, protected := d.authorized[sighting.SSID]
+	if !protected || sighting.BSSID == "" {
+		return model.RogueAccessPoint{}, false
+	}
+
+	rogue := model.RogueAccessPoint{
+		SnifferMAC: sighting.SnifferMAC,
+		SSID:       sighting.SSID,
+		BSSID:      sighting.BSSID,
+		Channel:    sighting.Channel,
+		Band:       sighting.Band,
+		Security:   sighting.Security,
+		RSSI:       sighting.RSSI,
+		LastSeen:   sighting.Timestamp,
+	}
+
+	security, known := bssids[sighting.BSSID]
+	switch {
+	case !known:
+		rogue.Reason = model.RogueUnknownBSSID
+	case security != "" && sighting.Security != "" && security != sighting.Security:
+		rogue.Reason = model.RogueSecurityMismatch
+		rogue.ExpectedSecurity = security
+	default:
+		return model.RogueAccessPoint{}, false
+	}
+	return rogue, true
+}
+
+type SecurityAPI struct {
+	DB       SecurityDatabase
+	Detector *RogueDetector
+	Clock    clock.Clock
+}
+
+// GetRogueAccessPoints lists the suspicious sightings in the range by sniffer, the sniffer query parameter limits it to one sniffer
+func (s *SecurityAPI) GetRogueAccessPoints(ctx echo.Context) error {
+	from, until, err := parseRangeParams(ctx, orDefaultClock(s.Clock).Now(), defaultRouterHistoryRange)
+	if err != nil {
+		return err
+	}
+
+	sniffers, err := s.getSniffers(ctx)
+	if err != nil {
+		return err
+	}
+
+	result := []model.SnifferRogueAccessPoints{}
+	for _, sniffer := range sniffers {
+		sightings, err := s.DB.GetRouterSightingsBySnifferBetweenDates(ctx.Request().Context(), sniffer.MAC, from, until)
+		if err != nil {
+			return newDatabaseError(err)
+		}
+
+		rogues := []model.RogueAccessPoint{}
+		for i := range sightings {
+			if rogue, suspicious := s.Detector.Check(&sightings[i]); suspicious {
+				if rogue.RSSI != 0 {
+					rogue.RSSI = calibrated(sniffer, rogue.RSSI)
+				}
+				rogues = append(rogues, rogue)
+			}
+		}
+		if len(rogues) > 0 {
+			result = append(result, model.SnifferRogueAccessPoints{SnifferMAC: sniffer.MAC, RogueAccessPoints: rogues})
+		}
+	}
+
+	return ctx.JSON(http.StatusOK, result)
+}
+
+// getSniffers returns the sniffers with their calibration, the one of the sniffer query parameter if it is given.
+// A sniffer which is not registered is not calibrated.
+func (s *SecurityAPI) getSniffers(ctx echo.Context) ([]model.Sniffer, error) {
+	snifferMAC := ""
+	if sniffer := ctx.QueryParam("sniffer"); sniffer != "" {
+		var err error
+		if snifferMAC, err = NormalizeMAC(sniffer); err != nil {
+			return nil, newValidationError(invalidFieldError("sniffer", "sniffer must be a MAC address"))
+		}
+	}
+
+	sniffers, err := s.DB.GetSniffers(ctx.Request().Context())
+	if err != nil {
+		return nil, newDatabaseError(err)
+	}
+	if snifferMAC == "" {
+		return sniffers, nil
+	}
+	for _, sniffer := range sniffers {
+		if sniffer.MAC == snifferMAC {
+			return []model.Sniffer{sniffer}, nil
+		}
+	}
+	return []model.Sniffer{{MAC: snifferMAC}}, nil
+}
+
+// detectRogues checks the sighting and reports it to the observer and the log if it is suspicious
+func detectRogues(ctx echo.Context, detector *RogueDetector, observer RogueObserver, sighting *model.RouterSighting) {
+	if detector == nil {
+		return
+	}
+	rogue, suspicious := detector.Check(sighting)
+	if !suspicious {
+		return
+	}
+
+	logWarn(ctx, "rogue access point detected", log.JSON{"SSID": rogue.SSID, "BSSID": rogue.BSSID, "reason": rogue.Reason})
+	if observer != nil {
+		observer.RogueAccessPointDetected(rogue)
+	}
+}
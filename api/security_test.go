@@ -0,0 +1,144 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cyucelen/wirect/model"
+	"github.com/cyucelen/wirect/test"
+	"github.com/stretchr/testify/assert"
+)
+
+var testAllowlist = []AuthorizedAccessPoint{
+	{SSID: "eduroam", BSSID: "aa-aa-aa-aa-aa-01", Security: "WPA2-Enterprise"},
+	{SSID: "eduroam", BSSID: "AA:AA:AA:AA:AA:02"},
+}
+
+type rogueRecorder struct {
+	rogues []model.RogueAccessPoint
+}
+
+func (r *rogueRecorder) RogueAccessPointDetected(rogue model.RogueAccessPoint) {
+	r.rogues = append(r.rogues, rogue)
+}
+
+func TestRogueDetector(t *testing.T) {
+	detector := NewRogueDetector(testAllowlist)
+
+	tests := []struct {
+		name     string
+		sighting model.RouterSighting
+		reason   string
+	}{
+		{"authorized", model.RouterSighting{SSID: "eduroam", BSSID: "AA:AA:AA:AA:AA:01", Security: "wpa2-enterprise"}, ""},
+		{"any security is authorized", model.RouterSighting{SSID: "eduroam", BSSID: "AA:AA:AA:AA:AA:02", Security: "open"}, ""},
+		{"unknown security", model.RouterSighting{SSID: "eduroam", BSSID: "AA:AA:AA:AA:AA:01"}, ""},
+		{"unprotected SSID", model.RouterSighting{SSID: "cafe", BSSID: "AA:AA:AA:AA:AA:09", Security: "open"}, ""},
+		{"no BSSID", model.RouterSighting{SSID: "eduroam"}, ""},
+		{"evil twin", model.RouterSighting{SSID: "eduroam", BSSID: "AA:AA:AA:AA:AA:09", Security: "wpa2-enterprise"}, model.RogueUnknownBSSID},
+		{"downgraded security", model.RouterSighting{SSID: "eduroam", BSSID: "AA:AA:AA:AA:AA:01", Security: "open"}, model.RogueSecurityMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rogue, suspicious := detector.Check(&tt.sighting)
+			assert.Equal(t, tt.reason != "", suspicious)
+			assert.Equal(t, tt.reason, rogue.Reason)
+		})
+	}
+
+	rogue, _ := detector.Check(&model.RouterSighting{SSID: "eduroam", BSSID: "AA:AA:AA:AA:AA:01", Security: "wep"})
+	assert.Equal(t, "wpa2-enterprise", rogue.ExpectedSecurity)
+}
+
+func TestCreateRoutersNotifiesAboutRogueAccessPoints(t *testing.T) {
+	recorder := &rogueRecorder{}
+	routerAPI := RouterAPI{DB: &test.InMemoryDB{}, Detector: NewRogueDetector(testAllowlist), RogueObserver: recorder}
+
+	routers := []model.RouterExternal{
+		{SSID: "eduroam", BSSID: "AA:AA:AA:AA:AA:01", Security: "wpa2-enterprise", LastSeen: 1000},
+		{SSID: "eduroam", BSSID: "aa:aa:aa:aa:aa:09", Security: "wpa2-enterprise", RSSI: -40, LastSeen: 1100},
+	}
+	rec := sendTestRequestToHandler(defaultTestSnifferMAC, routers, routerAPI.CreateRouters, http.MethodPost)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	assert.Equal(t, []model.RogueAccessPoint{{
+		SnifferMAC: defaultTestSnifferMAC, SSID: "eduroam", BSSID: "AA:AA:AA:AA:AA:09", Security: "wpa2-enterprise",
+		RSSI: -40, LastSeen: 1100, Reason: model.RogueUnknownBSSID,
+	}}, recorder.rogues)
+}
+
+func TestGetRogueAccessPoints(t *testing.T) {
+	now := time.Now()
+	mockClock := clock.NewMock()
+	mockClock.Set(now)
+
+	db := &test.InMemoryDB{Sniffers: []model.Sniffer{{MAC: "00:00:00:00:00:01"}, {MAC: defaultTestSnifferMAC}}}
+	detector := NewRogueDetector(testAllowlist)
+	routerAPI := RouterAPI{DB: db, Clock: mockClock}
+	securityAPI := SecurityAPI{DB: db, Detector: detector, Clock: mockClock}
+
+	routers := []model.RouterExternal{
+		{SSID: "eduroam", BSSID: "AA:AA:AA:AA:AA:01", Security: "open", LastSeen: now.Add(-time.Hour).Unix()},
+		{SSID: "eduroam", BSSID: "AA:AA:AA:AA:AA:02", LastSeen: now.Add(-time.Hour).Unix()},
+		{SSID: "eduroam", BSSID: "AA:AA:AA:AA:AA:09", LastSeen: now.Add(-48 * time.Hour).Unix()},
+	}
+	sendTestRequestToHandler(defaultTestSnifferMAC, routers, routerAPI.CreateRouters, http.MethodPost)
+
+	rec := sendRogueAccessPointsRequest(securityAPI, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var result []model.SnifferRogueAccessPoints
+	json.NewDecoder(rec.Body).Decode(&result)
+	assert.Equal(t, []model.SnifferRogueAccessPoints{{
+		SnifferMAC: defaultTestSnifferMAC,
+		RogueAccessPoints: []model.RogueAccessPoint{{
+			SnifferMAC: defaultTestSnifferMAC, SSID: "eduroam", BSSID: "AA:AA:AA:AA:AA:01", Security: "open",
+			ExpectedSecurity: "wpa2-enterprise", LastSeen: now.Add(-time.Hour).Unix(), Reason: model.RogueSecurityMismatch,
+		}},
+	}}, result)
+
+	rec = sendRogueAccessPointsRequest(securityAPI, "from=-72h&sniffer=00-00-00-00-00-00")
+	json.NewDecoder(rec.Body).Decode(&result)
+	if assert.Len(t, result, 1) {
+		assert.Len(t, result[0].RogueAccessPoints, 2)
+	}
+
+	rec = sendRogueAccessPointsRequest(securityAPI, "sniffer=00:00:00:00:00:01")
+	assert.Equal(t, "[]\n", rec.Body.String())
+
+	rec = sendRogueAccessPointsRequest(securityAPI, "sniffer=nope")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestGetRogueAccessPointsAreCalibrated(t *testing.T) {
+	now := time.Now()
+	mockClock := clock.NewMock()
+	mockClock.Set(now)
+
+	db := &test.InMemoryDB{Sniffers: []model.Sniffer{{MAC: defaultTestSnifferMAC, RSSIOffset: 5}}}
+	routerAPI := RouterAPI{DB: db, Clock: mockClock}
+	securityAPI := SecurityAPI{DB: db, Detector: NewRogueDetector(testAllowlist), Clock: mockClock}
+
+	routers := []model.RouterExternal{{SSID: "eduroam", BSSID: "AA:AA:AA:AA:AA:09", RSSI: -60, LastSeen: now.Unix()}}
+	sendTestRequestToHandler(defaultTestSnifferMAC, routers, routerAPI.CreateRouters, http.MethodPost)
+
+	for _, query := range []string{"", "sniffer=" + defaultTestSnifferMAC} {
+		rec := sendRogueAccessPointsRequest(securityAPI, query)
+		var result []model.SnifferRogueAccessPoints
+		json.NewDecoder(rec.Body).Decode(&result)
+		if assert.Len(t, result, 1, query) {
+			assert.Equal(t, -55.0, result[0].RogueAccessPoints[0].RSSI, query)
+		}
+	}
+}
+
+func sendRogueAccessPointsRequest(securityAPI SecurityAPI, query string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+	c, rec := createTestContext(req)
+	serve(c, securityAPI.GetRogueAccessPoints)
+	return rec
+}
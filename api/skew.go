@@ -0,0 +1,196 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cyucelen/wirect/model"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+)
+
+// SkewMode decides what happens to the packets of an upload from a sniffer whose clock is skewed beyond the tolerance
+type SkewMode string
+
+const (
+	// SkewModeOff stores the packets as they are
+	SkewModeOff SkewMode = "off"
+	// SkewModeCorrect shifts the timestamps of the packets by the offset of the clock of the sniffer
+	SkewModeCorrect SkewMode = "correct"
+	// SkewModeQuarantine rejects the packets and keeps them aside in the incident
+	SkewModeQuarantine SkewMode = "quarantine"
+)
+
+// maxSkewIncidents is the number of incidents kept for every sniffer
+const maxSkewIncidents = 50
+
+// maxQuarantinedPackets is the number of packets kept in a single incident
+const maxQuarantinedPackets = 1000
+
+// minPlausibleTimestamp is the start of 2019, only clocks which lost their time, such as ones counting from 1970 since
+// boot, stamp packets before it
+const minPlausibleTimestamp = 1546300800
+
+// SkewCorrector finds uploads of sniffers whose clock is skewed. Only implausible timestamps count as skew, since
+// sniffers buffer packets while they are offline and upload them late: the offset of an upload whose latest timestamp
+// is before 2019 or further in the future than the tolerance is the time the server received it minus that timestamp.
+// The offset measured by the synchronizations of the sniffer is preferred if it makes the timestamps plausible.
+// Uploads beyond the tolerance are incidents which are kept in memory.
+type SkewCorrector struct {
+	Mode      SkewMode
+	Tolerance time.Duration
+	Clock     clock.Clock
+	// Clocks holds the offsets measured by synchronizations, nil estimates every offset from the timestamps
+	Clocks *ClockTracker
+
+	mu        sync.Mutex
+	incidents map[string][]model.SkewIncident
+	counts    map[string]int
+}
+
+func NewSkewCorrector(mode SkewMode, tolerance time.Duration, clock clock.Clock) *SkewCorrector {
+	return &SkewCorrector{
+		Mode:      mode,
+		Tolerance: tolerance,
+		Clock:     clock,
+		incidents: map[string][]model.SkewIncident{},
+		counts:    map[string]int{},
+	}
+}
+
+// correct shifts the timestamps of the packets in place if their upload is skewed and the mode corrects them.
+// Resends of a sequenced upload are never shifted, since their packets were buffered for an unknown time.
+// It returns the incident of a skewed upload without its sniffer, nil otherwise.
+func (s *SkewCorrector) correct(ctx echo.Context, packets []model.SnifferPacket, resend bool) *model.SkewIncident {
+	incident := s.estimate(ctx, packets, resend)
+	applySkew(incident, packets)
+	return incident
+}
+
+// estimate returns the incident of the upload without changing its packets if it is skewed, nil otherwise
+func (s *SkewCorrector) estimate(ctx echo.Context, packets []model.SnifferPacket, resend bool) *model.SkewIncident {
+	if s == nil || s.Mode == SkewModeOff || (resend && s.Mode == SkewModeCorrect) {
+		return nil
+	}
+
+	incident := model.SkewIncident{Time: orDefaultClock(s.Clock).Now().Unix()}
+	for _, packet := range packets {
+		if packet.Timestamp == 0 {
+			continue
+		}
+		if incident.Packets == 0 || packet.Timestamp < incident.OriginalFrom {
+			incident.OriginalFrom = packet.Timestamp
+		}
+		if incident.Packets == 0 || packet.Timestamp > incident.OriginalUntil {
+			incident.OriginalUntil = packet.Timestamp
+		}
+		incident.Packets++
+	}
+	if incident.Packets == 0 {
+		return nil
+	}
+	tolerance := int64(s.Tolerance / time.Second)
+	if !isPlausibleTimestamp(incident.OriginalUntil, incident.Time, tolerance) {
+		incident.Offset = incident.Time - incident.OriginalUntil
+		// the offset measured by synchronizations is more precise, unless the sniffer lost its time after it synchronized
+		if offset, synchronized := s.synchronizedOffset(ctx); synchronized && isPlausibleTimestamp(incident.OriginalUntil+offset, incident.Time, tolerance) {
+			incident.Offset = offset
+		}
+	}
+	if incident.Offset <= tolerance && incident.Offset >= -tolerance {
+		return nil
+	}
+
+	if s.Mode == SkewModeQuarantine {
+		incident.Action = model.SkewQuarantined
+		quarantined := packets
+		if len(quarantined) > maxQuarantinedPackets {
+			quarantined = quarantined[:maxQuarantinedPackets]
+		}
+		incident.Quarantined = append([]model.SnifferPacket{}, quarantined...)
+		for i := range incident.Quarantined {
+			incident.Quarantined[i].OriginalTimestamp = 0
+		}
+		return &incident
+	}
+	incident.Action = model.SkewCorrected
+	return &incident
+}
+
+// applySkew shifts the timestamps of the packets in place by the offset of the incident if it corrects them.
+// Original timestamps sent by sniffers are dropped, they are only set here.
+func applySkew(incident *model.SkewIncident, packets []model.SnifferPacket) {
+	for i := range packets {
+		packets[i].OriginalTimestamp = 0
+		if incident != nil && incident.Action == model.SkewCorrected && packets[i].Timestamp != 0 {
+			packets[i].OriginalTimestamp = packets[i].Timestamp
+			packets[i].Timestamp += incident.Offset
+		}
+	}
+}
+
+// isPlausibleTimestamp tells whether a sniffer could have stamped a packet at timestamp when the server received it at now
+func isPlausibleTimestamp(timestamp, now, tolerance int64) bool {
+	return timestamp >= minPlausibleTimestamp && timestamp <= now+tolerance
+}
+
+// synchronizedOffset returns how many seconds the server is ahead of the sniffer of the request by its synchronizations,
+// false if it did not synchronize
+func (s *SkewCorrector) synchronizedOffset(ctx echo.Context) (int64, bool) {
+	if s.Clocks == nil {
+		return 0, false
+	}
+	snifferMAC, err := getSnifferMAC(ctx)
+	if err != nil {
+		return 0, false
+	}
+	status, synchronized := s.Clocks.Status(snifferMAC)
+	if !synchronized {
+		return 0, false
+	}
+	return int64(math.Round(status.OffsetMillis / 1000)), true
+}
+
+// report keeps the incident of the sniffer of the request and logs it
+func (s *SkewCorrector) report(ctx echo.Context, incident *model.SkewIncident) {
+	if s == nil || incident == nil {
+		return
+	}
+	snifferMAC, err := getSnifferMAC(ctx)
+	if err != nil {
+		return
+	}
+	incident.SnifferMAC = snifferMAC
+
+	s.mu.Lock()
+	incidents := append(s.incidents[snifferMAC], *incident)
+	if len(incidents) > maxSkewIncidents {
+		incidents = incidents[len(incidents)-maxSkewIncidents:]
+	}
+	s.incidents[snifferMAC] = incidents
+	s.counts[snifferMAC]++
+	s.mu.Unlock()
+
+	logWarn(ctx, "clock of sniffer is skewed", log.JSON{"offset": incident.Offset, "action": incident.Action, "packets": incident.Packets})
+}
+
+// Incidents returns the kept incidents of the sniffer, most recent first, and how many there were since the server started
+func (s *SkewCorrector) Incidents(snifferMAC string) ([]model.SkewIncident, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.incidents[snifferMAC]
+	incidents := make([]model.SkewIncident, 0, len(kept))
+	for i := len(kept) - 1; i >= 0; i-- {
+		incidents = append(incidents, kept[i])
+	}
+	return incidents, s.counts[snifferMAC]
+}
+
+func clockSkewFieldError(field string, offset int64) model.FieldError {
+	message := fmt.Sprintf("the clock of the sniffer is %d seconds off the clock of the server, the packet was quarantined", -offset)
+	return model.FieldError{Field: field, Code: "clock_skew", Message: message}
+}
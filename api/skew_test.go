@@ -0,0 +1,179 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cyucelen/wirect/model"
+	"github.com/cyucelen/wirect/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func createSkewedPacketAPI(mode SkewMode, now time.Time) (*PacketAPI, *test.InMemoryDB) {
+	mockClock := clock.NewMock()
+	mockClock.Set(now)
+	db := &test.InMemoryDB{}
+	rules := DefaultValidationRules
+	return &PacketAPI{
+		DB:        db,
+		Validator: NewValidator(rules, mockClock),
+		Skew:      NewSkewCorrector(mode, 10*time.Minute, mockClock),
+	}, db
+}
+
+// packetsOfRebootedSniffer are sent by a sniffer which lost its clock and counts from 1970 since it booted 100 seconds ago
+var packetsOfRebootedSniffer = []model.SnifferPacket{
+	{MAC: "AA:AA:AA:AA:AA:01", Timestamp: 40, RSSI: -60},
+	{MAC: "AA:AA:AA:AA:AA:02", Timestamp: 100, RSSI: -70},
+}
+
+func TestCreatePacketsCorrectsSkewedClock(t *testing.T) {
+	now := time.Unix(1560000000, 0)
+	packetAPI, db := createSkewedPacketAPI(SkewModeCorrect, now)
+
+	rec := sendTestRequestToHandler(defaultTestSnifferMAC, packetsOfRebootedSniffer, packetAPI.CreatePackets, http.MethodPost)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	offset := now.Unix() - 100
+	assert.Equal(t, []model.Packet{
+		{MAC: "AA:AA:AA:AA:AA:01", Timestamp: 40 + offset, RSSI: -60, OriginalTimestamp: 40, SnifferMAC: defaultTestSnifferMAC},
+		{MAC: "AA:AA:AA:AA:AA:02", Timestamp: now.Unix(), RSSI: -70, OriginalTimestamp: 100, SnifferMAC: defaultTestSnifferMAC},
+	}, db.Packets)
+
+	incidents, count := packetAPI.Skew.Incidents(defaultTestSnifferMAC)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, []model.SkewIncident{{
+		SnifferMAC: defaultTestSnifferMAC, Time: now.Unix(), Offset: offset, Action: model.SkewCorrected,
+		Packets: 2, OriginalFrom: 40, OriginalUntil: 100,
+	}}, incidents)
+}
+
+func TestCreatePacketsQuarantinesSkewedClock(t *testing.T) {
+	now := time.Unix(1560000000, 0)
+	packetAPI, db := createSkewedPacketAPI(SkewModeQuarantine, now)
+
+	rec := sendTestRequestToHandler(defaultTestSnifferMAC, packetsOfRebootedSniffer, packetAPI.CreatePackets, http.MethodPost)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	details := decodeError(rec).Details
+	if assert.Len(t, details, 2) {
+		assert.Equal(t, "[1].timestamp", details[1].Field)
+		assert.Equal(t, "clock_skew", details[1].Code)
+	}
+	assert.Empty(t, db.Packets)
+
+	incidents, _ := packetAPI.Skew.Incidents(defaultTestSnifferMAC)
+	if assert.Len(t, incidents, 1) {
+		assert.Equal(t, model.SkewQuarantined, incidents[0].Action)
+		assert.Equal(t, packetsOfRebootedSniffer, incidents[0].Quarantined)
+	}
+}
+
+func TestCreatePacketWithinSkewTolerance(t *testing.T) {
+	now := time.Unix(1560000000, 0)
+	packetAPI, db := createSkewedPacketAPI(SkewModeQuarantine, now)
+
+	// original timestamps sent by sniffers are not stored
+	snifferPacket := model.SnifferPacket{MAC: "AA:AA:AA:AA:AA:01", Timestamp: now.Add(-9 * time.Minute).Unix(), RSSI: -60, OriginalTimestamp: 5}
+	rec := sendTestRequestToHandler(defaultTestSnifferMAC, snifferPacket, packetAPI.CreatePacket, http.MethodPost)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Zero(t, db.Packets[0].OriginalTimestamp)
+
+	futurePacket := model.SnifferPacket{MAC: "AA:AA:AA:AA:AA:01", Timestamp: now.Add(time.Hour).Unix(), RSSI: -60}
+	rec = sendTestRequestToHandler(defaultTestSnifferMAC, futurePacket, packetAPI.CreatePacket, http.MethodPost)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "clock_skew", decodeError(rec).Details[0].Code)
+
+	_, count := packetAPI.Skew.Incidents(defaultTestSnifferMAC)
+	assert.Equal(t, 1, count)
+}
+
+func TestSkewCorrectorKeepsLatestIncidents(t *testing.T) {
+	now := time.Unix(1560000000, 0)
+	packetAPI, _ := createSkewedPacketAPI(SkewModeCorrect, now)
+
+	for i := 0; i <= maxSkewIncidents; i++ {
+		packets := []model.SnifferPacket{{MAC: "AA:AA:AA:AA:AA:01", Timestamp: int64(i + 1), RSSI: -60}}
+		sendTestRequestToHandler(defaultTestSnifferMAC, packets, packetAPI.CreatePackets, http.MethodPost)
+	}
+
+	incidents, count := packetAPI.Skew.Incidents(defaultTestSnifferMAC)
+	assert.Equal(t, maxSkewIncidents+1, count)
+	assert.Len(t, incidents, maxSkewIncidents)
+	assert.Equal(t, int64(maxSkewIncidents+1), incidents[0].OriginalUntil)
+
+	statusAPI := StatusAPI{Skew: packetAPI.Skew}
+	rec := sendTestRequestToHandler(defaultTestSnifferMAC, nil, statusAPI.GetSkewIncidents, http.MethodGet)
+	var listed []model.SkewIncident
+	json.NewDecoder(rec.Body).Decode(&listed)
+	assert.Equal(t, incidents, listed)
+
+	rec = sendTestRequestToHandler(defaultTestSnifferMAC, nil, statusAPI.GetSnifferStatus, http.MethodGet)
+	var status model.SnifferStatus
+	json.NewDecoder(rec.Body).Decode(&status)
+	assert.Equal(t, maxSkewIncidents+1, status.SkewIncidents)
+	assert.Equal(t, &incidents[0], status.LastSkew)
+}
+
+func TestCreatePacketsKeepsBufferedPackets(t *testing.T) {
+	now := time.Unix(1560000000, 0)
+	packetAPI, db := createSkewedPacketAPI(SkewModeCorrect, now)
+
+	// a sniffer which was offline for hours uploads what it buffered
+	buffered := []model.SnifferPacket{{MAC: "AA:AA:AA:AA:AA:01", Timestamp: now.Add(-3 * time.Hour).Unix(), RSSI: -60}}
+	rec := sendTestRequestToHandler(defaultTestSnifferMAC, buffered, packetAPI.CreatePackets, http.MethodPost)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, buffered[0].Timestamp, db.Packets[0].Timestamp)
+
+	_, count := packetAPI.Skew.Incidents(defaultTestSnifferMAC)
+	assert.Zero(t, count)
+}
+
+func TestCreatePacketsCorrectsBySynchronizedOffset(t *testing.T) {
+	now := time.Unix(1560000000, 0)
+	packetAPI, db := createSkewedPacketAPI(SkewModeCorrect, now)
+	packetAPI.Skew.Clocks = NewClockTracker()
+	packetAPI.Skew.Clocks.Record(defaultTestSnifferMAC, now, -2*time.Hour, 0)
+
+	// the packet was buffered for a few seconds, the synchronizations of the sniffer found its clock two hours ahead
+	packets := []model.SnifferPacket{{MAC: "AA:AA:AA:AA:AA:01", Timestamp: now.Add(2*time.Hour - 5*time.Second).Unix(), RSSI: -60}}
+	rec := sendTestRequestToHandler(defaultTestSnifferMAC, packets, packetAPI.CreatePackets, http.MethodPost)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, now.Add(-5*time.Second).Unix(), db.Packets[0].Timestamp)
+
+	// the synchronized offset does not explain the timestamps of a sniffer which lost its time again
+	rec = sendTestRequestToHandler(defaultTestSnifferMAC, packetsOfRebootedSniffer, packetAPI.CreatePackets, http.MethodPost)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, now.Unix(), db.Packets[2].Timestamp)
+}
+
+func TestCreatePacketsOfSnifferWhichCorrectedItsClockAreNotShifted(t *testing.T) {
+	now := time.Unix(1560000000, 0)
+	packetAPI, db := createSkewedPacketAPI(SkewModeCorrect, now)
+	packetAPI.Skew.Clocks = NewClockTracker()
+	packetAPI.Skew.Clocks.Record(defaultTestSnifferMAC, now, time.Hour, 0)
+
+	// the sniffer set its clock by the synchronization, so its timestamps are plausible
+	packets := []model.SnifferPacket{{MAC: "AA:AA:AA:AA:AA:01", Timestamp: now.Add(-time.Minute).Unix(), RSSI: -60}}
+	rec := sendTestRequestToHandler(defaultTestSnifferMAC, packets, packetAPI.CreatePackets, http.MethodPost)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, packets[0].Timestamp, db.Packets[0].Timestamp)
+	_, count := packetAPI.Skew.Incidents(defaultTestSnifferMAC)
+	assert.Zero(t, count)
+}
+
+func TestCreateSequencedPacketsAreNotShifted(t *testing.T) {
+	now := time.Unix(1560000000, 0)
+	packetAPI, db := createSkewedPacketAPI(SkewModeCorrect, now)
+	packetAPI.Sequencer = NewSequencer(db)
+
+	// the packets are validated as the sniffer stamped them, so the ones of 1970 are rejected instead of shifted
+	rec := sendBatch(packetAPI, "batch-1", "1-2", packetsOfRebootedSniffer)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get(HeaderSequenceAck))
+	assert.Empty(t, db.Packets)
+	_, count := packetAPI.Skew.Incidents(defaultTestSnifferMAC)
+	assert.Zero(t, count)
+}
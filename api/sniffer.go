@@ -1,7 +1,8 @@
 package api
 
 import (
-	"errors"
+	"context"
+	"encoding/json"
 	"net/http"
 
 	"github.com/cyucelen/wirect/model"
@@ -9,58 +10,72 @@ import (
 )
 
 type SnifferDatabase interface {
-	CreateSniffer(sniffer *model.Sniffer) error
-	GetSniffers() []model.Sniffer
-	UpdateSniffer(sniffer *model.Sniffer) error
+	CreateSniffer(ctx context.Context, sniffer *model.Sniffer) error
+	GetSniffers(ctx context.Context) ([]model.Sniffer, error)
+	UpdateSniffer(ctx context.Context, sniffer *model.Sniffer) error
 }
 
 type SnifferAPI struct {
-	DB SnifferDatabase
+	DB        SnifferDatabase
+	Validator *Validator
 }
 
 func (s *SnifferAPI) CreateSniffer(ctx echo.Context) error {
 	sniffer := new(model.Sniffer)
 
-	if err := ctx.Bind(sniffer); err != nil || !isSnifferValid(sniffer) {
-		ctx.JSON(http.StatusBadRequest, nil)
-		return err
+	if err := ctx.Bind(sniffer); err != nil {
+		return newInvalidJSONError(err)
 	}
 
-	if err := s.DB.CreateSniffer(sniffer); err != nil {
-		ctx.JSON(http.StatusInternalServerError, nil)
-		return err
+	if fieldErrors := orDefaultValidator(s.Validator).Sniffer(sniffer); len(fieldErrors) > 0 {
+		return newValidationError(fieldErrors...)
+	}
+
+	if err := s.DB.CreateSniffer(ctx.Request().Context(), sniffer); err != nil {
+		return newDatabaseError(err)
 	}
-	ctx.JSON(http.StatusCreated, sniffer)
-	return nil
+	return ctx.JSON(http.StatusCreated, sniffer)
 }
 
 func (s *SnifferAPI) GetSniffers(ctx echo.Context) error {
-	ctx.JSON(http.StatusOK, s.DB.GetSniffers())
-	return nil
+	sniffers, err := s.DB.GetSniffers(ctx.Request().Context())
+	if err != nil {
+		return newDatabaseError(err)
+	}
+	return ctx.JSON(http.StatusOK, sniffers)
 }
 
 func (s *SnifferAPI) UpdateSniffer(ctx echo.Context) error {
-	sniffer := new(model.Sniffer)
-	if err := ctx.Bind(sniffer); err != nil {
-		ctx.JSON(http.StatusBadRequest, nil)
-		return nil
+	var body json.RawMessage
+	if err := ctx.Bind(&body); err != nil {
+		return newInvalidJSONError(err)
 	}
 
-	var err error
-	sniffer.MAC, err = getSnifferMAC(ctx)
+	snifferMAC, err := getSnifferMAC(ctx)
 	if err != nil {
 		return err
 	}
 
-	if err := s.DB.UpdateSniffer(sniffer); err != nil {
-		ctx.JSON(http.StatusInternalServerError, nil)
-		return errors.New("")
+	// the body is decoded over the stored sniffer so fields which are not sent, such as the calibration, are kept
+	sniffer := &model.Sniffer{}
+	stored, err := findSniffer(ctx, s.DB, snifferMAC)
+	if err == nil {
+		sniffer = &stored
+	} else if notFound, ok := err.(*Error); !ok || notFound.Status != http.StatusNotFound {
+		return err
 	}
+	if err := json.Unmarshal(body, sniffer); err != nil {
+		return newInvalidJSONError(err)
+	}
+	sniffer.MAC = snifferMAC
 
-	ctx.JSON(http.StatusOK, nil)
-	return nil
-}
+	if fieldErrors := orDefaultValidator(s.Validator).Sniffer(sniffer); len(fieldErrors) > 0 {
+		return newValidationError(fieldErrors...)
+	}
+
+	if err := s.DB.UpdateSniffer(ctx.Request().Context(), sniffer); err != nil {
+		return newDatabaseError(err)
+	}
 
-func isSnifferValid(sniffer *model.Sniffer) bool {
-	return sniffer.MAC != ""
+	return ctx.JSON(http.StatusOK, nil)
 }
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
@@ -14,23 +15,24 @@ import (
 
 func createMockSnifferDB(sniffers []model.Sniffer) *mocks.SnifferDatabase {
 	mockSnifferDB := &mocks.SnifferDatabase{}
-	mockSnifferDB.On("CreateSniffer", mock.AnythingOfType("*model.Sniffer")).Return(nil)
-	mockSnifferDB.On("GetSniffers").Return(sniffers)
-	mockSnifferDB.On("UpdateSniffer", mock.AnythingOfType("*model.Sniffer")).Return(nil)
+	mockSnifferDB.On("CreateSniffer", mock.Anything, mock.AnythingOfType("*model.Sniffer")).Return(nil)
+	mockSnifferDB.On("GetSniffers", mock.Anything).Return(sniffers, nil)
+	mockSnifferDB.On("UpdateSniffer", mock.Anything, mock.AnythingOfType("*model.Sniffer")).Return(nil)
 	return mockSnifferDB
 }
 
 func createFailingMockSnifferDB() *mocks.SnifferDatabase {
 	mockSnifferDB := &mocks.SnifferDatabase{}
-	mockSnifferDB.On("CreateSniffer", mock.AnythingOfType("*model.Sniffer")).Return(errors.New(""))
-	mockSnifferDB.On("UpdateSniffer", mock.AnythingOfType("*model.Sniffer")).Return(errors.New(""))
+	mockSnifferDB.On("CreateSniffer", mock.Anything, mock.AnythingOfType("*model.Sniffer")).Return(errors.New(""))
+	mockSnifferDB.On("UpdateSniffer", mock.Anything, mock.AnythingOfType("*model.Sniffer")).Return(errors.New(""))
+	mockSnifferDB.On("GetSniffers", mock.Anything).Return([]model.Sniffer{}, nil)
 
 	return mockSnifferDB
 }
 
 func TestCreateSniffer(t *testing.T) {
 	mockSnifferDB := createMockSnifferDB([]model.Sniffer{})
-	snifferAPI := &SnifferAPI{mockSnifferDB}
+	snifferAPI := &SnifferAPI{DB: mockSnifferDB}
 
 	expectedSniffer := model.Sniffer{MAC: "11:22:33:44:55:66", Name: "lib_sniffer", Description: "library"}
 
@@ -40,21 +42,21 @@ func TestCreateSniffer(t *testing.T) {
 	var actualSniffer model.Sniffer
 	json.NewDecoder(rec.Body).Decode(&actualSniffer)
 	assert.Equal(t, expectedSniffer, actualSniffer)
-	mockSnifferDB.AssertCalled(t, "CreateSniffer", &expectedSniffer)
+	mockSnifferDB.AssertCalled(t, "CreateSniffer", mock.Anything, &expectedSniffer)
 }
 
 func TestCreateSnifferWithEmptyJSON(t *testing.T) {
 	mockSnifferDB := createMockSnifferDB([]model.Sniffer{})
-	snifferAPI := &SnifferAPI{mockSnifferDB}
+	snifferAPI := &SnifferAPI{DB: mockSnifferDB}
 
 	responseCode := sendTestRequestToHandlerWithEmptyJSON(snifferAPI.CreateSniffer)
 	assert.Equal(t, http.StatusBadRequest, responseCode)
-	mockSnifferDB.AssertNotCalled(t, "CreateSniffer", &model.Sniffer{})
+	mockSnifferDB.AssertNotCalled(t, "CreateSniffer", mock.Anything, &model.Sniffer{})
 }
 
 func TestCreateSnifferWithCorruptedJSON(t *testing.T) {
 	mockSnifferDB := createMockSnifferDB([]model.Sniffer{})
-	snifferAPI := &SnifferAPI{mockSnifferDB}
+	snifferAPI := &SnifferAPI{DB: mockSnifferDB}
 
 	responseCode := sendTestRequestToHandlerWithCorruptedJSON(snifferAPI.CreateSniffer)
 	assert.Equal(t, http.StatusBadRequest, responseCode)
@@ -62,7 +64,7 @@ func TestCreateSnifferWithCorruptedJSON(t *testing.T) {
 
 func TestCreateSnifferWithFailingDB(t *testing.T) {
 	mockSnifferDB := createFailingMockSnifferDB()
-	snifferAPI := &SnifferAPI{mockSnifferDB}
+	snifferAPI := &SnifferAPI{DB: mockSnifferDB}
 
 	sniffer := model.Sniffer{MAC: "11:22:33:44:55:66", Name: "lib_sniffer", Description: "library"}
 
@@ -76,7 +78,7 @@ func TestGetSniffers(t *testing.T) {
 		{MAC: "11:22:33:44:55:66", Name: "copy_sniffer", Description: "copy_center"},
 	}
 	mockSnifferDB := createMockSnifferDB(expectedSniffers)
-	snifferAPI := &SnifferAPI{mockSnifferDB}
+	snifferAPI := &SnifferAPI{DB: mockSnifferDB}
 
 	rec := sendTestRequestToHandler("", nil, snifferAPI.GetSniffers, http.MethodGet)
 	var actualSniffers []model.Sniffer
@@ -84,9 +86,19 @@ func TestGetSniffers(t *testing.T) {
 	assert.Equal(t, expectedSniffers, actualSniffers)
 }
 
+func TestGetSniffersWithFailingDB(t *testing.T) {
+	mockSnifferDB := &mocks.SnifferDatabase{}
+	mockSnifferDB.On("GetSniffers", mock.Anything).Return(nil, context.DeadlineExceeded)
+	snifferAPI := &SnifferAPI{DB: mockSnifferDB}
+
+	rec := sendTestRequestToHandler("", nil, snifferAPI.GetSniffers, http.MethodGet)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, CodeDatabaseTimeout, decodeError(rec).Code)
+}
+
 func TestUpdateSniffer(t *testing.T) {
 	mockSnifferDB := createMockSnifferDB([]model.Sniffer{})
-	snifferAPI := &SnifferAPI{mockSnifferDB}
+	snifferAPI := &SnifferAPI{DB: mockSnifferDB}
 
 	snifferUpdate := model.Sniffer{Name: "room_sniffer", Description: "room"}
 	snifferMAC := "11:22:33:44:55:66"
@@ -96,12 +108,38 @@ func TestUpdateSniffer(t *testing.T) {
 
 	expectedSnifferUpdate := snifferUpdate
 	expectedSnifferUpdate.MAC = snifferMAC
-	mockSnifferDB.AssertCalled(t, "UpdateSniffer", &expectedSnifferUpdate)
+	mockSnifferDB.AssertCalled(t, "UpdateSniffer", mock.Anything, &expectedSnifferUpdate)
+}
+
+func TestUpdateSnifferKeepsFieldsWhichAreNotSent(t *testing.T) {
+	x, y, exponent := 3.0, 4.0, 3.1
+	stored := model.Sniffer{MAC: "11:22:33:44:55:66", Name: "hall", Floor: "1", X: &x, Y: &y, RSSIOffset: -4, PathLossExponent: &exponent}
+	mockSnifferDB := createMockSnifferDB([]model.Sniffer{stored})
+	snifferAPI := &SnifferAPI{DB: mockSnifferDB}
+
+	rec := sendTestRequestToHandler(stored.MAC, map[string]interface{}{"name": "room_sniffer", "x": nil, "y": nil}, snifferAPI.UpdateSniffer, http.MethodPut)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	expected := model.Sniffer{MAC: stored.MAC, Name: "room_sniffer", Floor: "1", RSSIOffset: -4, PathLossExponent: &exponent}
+	mockSnifferDB.AssertCalled(t, "UpdateSniffer", mock.Anything, &expected)
+}
+
+func TestUpdateSnifferValidatesLocation(t *testing.T) {
+	mockSnifferDB := createMockSnifferDB([]model.Sniffer{})
+	snifferAPI := &SnifferAPI{DB: mockSnifferDB}
+
+	latitude := 41.0082
+	snifferUpdate := model.Sniffer{Name: "room_sniffer", Latitude: &latitude}
+
+	rec := sendTestRequestToHandler("11:22:33:44:55:66", snifferUpdate, snifferAPI.UpdateSniffer, http.MethodPut)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "longitude", decodeError(rec).Details[0].Field)
+	mockSnifferDB.AssertNotCalled(t, "UpdateSniffer", mock.Anything, mock.Anything)
 }
 
 func TestUpdateSnifferWithInvalidSnifferMACParam(t *testing.T) {
 	mockSnifferDB := createMockSnifferDB([]model.Sniffer{})
-	snifferAPI := &SnifferAPI{mockSnifferDB}
+	snifferAPI := &SnifferAPI{DB: mockSnifferDB}
 
 	snifferUpdate := model.Sniffer{Name: "room_sniffer", Description: "room"}
 	rec := sendTestRequestToHandlerWithInvalidParam(snifferUpdate, snifferAPI.UpdateSniffer)
@@ -110,25 +148,25 @@ func TestUpdateSnifferWithInvalidSnifferMACParam(t *testing.T) {
 
 func TestUpdateSnifferWithEmptyJSON(t *testing.T) {
 	mockSnifferDB := &mocks.SnifferDatabase{}
-	snifferAPI := &SnifferAPI{mockSnifferDB}
+	snifferAPI := &SnifferAPI{DB: mockSnifferDB}
 
 	responseCode := sendTestRequestToHandlerWithEmptyJSON(snifferAPI.UpdateSniffer)
 	assert.Equal(t, http.StatusNotFound, responseCode)
-	mockSnifferDB.AssertNotCalled(t, "UpdateSniffer", &model.Sniffer{})
+	mockSnifferDB.AssertNotCalled(t, "UpdateSniffer", mock.Anything, &model.Sniffer{})
 }
 
 func TestUpdateSnifferWithCorruptedJSON(t *testing.T) {
 	mockSnifferDB := createMockSnifferDB([]model.Sniffer{})
-	snifferAPI := &SnifferAPI{mockSnifferDB}
+	snifferAPI := &SnifferAPI{DB: mockSnifferDB}
 
 	responseCode := sendTestRequestToHandlerWithCorruptedJSON(snifferAPI.UpdateSniffer)
 	assert.Equal(t, http.StatusBadRequest, responseCode)
-	mockSnifferDB.AssertNotCalled(t, "UpdateSniffer", &model.Sniffer{})
+	mockSnifferDB.AssertNotCalled(t, "UpdateSniffer", mock.Anything, &model.Sniffer{})
 }
 
 func TestUpdateWithFailingDBUpdate(t *testing.T) {
 	mockSnifferDB := createFailingMockSnifferDB()
-	snifferAPI := &SnifferAPI{mockSnifferDB}
+	snifferAPI := &SnifferAPI{DB: mockSnifferDB}
 
 	snifferUpdate := model.Sniffer{Name: "room_sniffer", Description: "room"}
 	snifferMAC := "11:22:33:44:55:66"
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/cyucelen/wirect/model"
+	"github.com/labstack/echo"
+)
+
+// StatusAPI reports what the server keeps in memory about sniffers
+type StatusAPI struct {
+	Clocks *ClockTracker
+	Skew   *SkewCorrector
+}
+
+// GetSnifferStatus returns the status of the sniffer, parts the server knows nothing about yet are left out
+func (s *StatusAPI) GetSnifferStatus(ctx echo.Context) error {
+	snifferMAC, err := getSnifferMAC(ctx)
+	if err != nil {
+		return err
+	}
+
+	status := model.SnifferStatus{SnifferMAC: snifferMAC}
+	if s.Clocks != nil {
+		if clockStatus, synchronized := s.Clocks.Status(snifferMAC); synchronized {
+			status.Clock = &clockStatus
+		}
+	}
+	if s.Skew != nil {
+		incidents, count := s.Skew.Incidents(snifferMAC)
+		status.SkewIncidents = count
+		if len(incidents) > 0 {
+			incidents[0].Quarantined = nil
+			status.LastSkew = &incidents[0]
+		}
+	}
+	return ctx.JSON(http.StatusOK, status)
+}
+
+// GetSkewIncidents lists the latest uploads of the sniffer whose clock was skewed together with the packets they quarantined
+func (s *StatusAPI) GetSkewIncidents(ctx echo.Context) error {
+	snifferMAC, err := getSnifferMAC(ctx)
+	if err != nil {
+		return err
+	}
+
+	incidents := []model.SkewIncident{}
+	if s.Skew != nil {
+		incidents, _ = s.Skew.Incidents(snifferMAC)
+	}
+	return ctx.JSON(http.StatusOK, incidents)
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cyucelen/wirect/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetSnifferStatus(t *testing.T) {
+	clocks := NewClockTracker()
+	clocks.Record(defaultTestSnifferMAC, time.Unix(100000, 0), -300*time.Millisecond, 0)
+	statusAPI := StatusAPI{Clocks: clocks}
+
+	rec := sendTestRequestToHandler(defaultTestSnifferMAC, nil, statusAPI.GetSnifferStatus, http.MethodGet)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var status model.SnifferStatus
+	json.NewDecoder(rec.Body).Decode(&status)
+	assert.Equal(t, model.SnifferStatus{
+		SnifferMAC: defaultTestSnifferMAC,
+		Clock:      &model.ClockStatus{Samples: 1, LastSync: 100000, OffsetMillis: -300},
+	}, status)
+
+	rec = sendTestRequestToHandler("00:00:00:00:00:09", nil, statusAPI.GetSnifferStatus, http.MethodGet)
+	status = model.SnifferStatus{}
+	json.NewDecoder(rec.Body).Decode(&status)
+	assert.Equal(t, model.SnifferStatus{SnifferMAC: "00:00:00:00:00:09"}, status)
+}
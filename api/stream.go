@@ -0,0 +1,276 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/cyucelen/wirect/model"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+)
+
+// MIMEApplicationNDJSON is the content type of newline delimited JSON
+const MIMEApplicationNDJSON = "application/x-ndjson"
+
+// streamChunkSize is the number of packets of a stream which are validated and stored together
+const streamChunkSize = 500
+
+// maxStreamLineLength bounds a line of a stream, a packet takes less than a hundred bytes
+const maxStreamLineLength = 4096
+
+// maxStreamDetails is the number of rejected and of duplicate lines listed in the result of a stream, the rest are only counted
+const maxStreamDetails = 100
+
+// streamedPacket is a packet of a stream with its line and its sequence number, which is zero if the stream is not sequenced
+type streamedPacket struct {
+	line     int
+	sequence int64
+	packet   model.SnifferPacket
+}
+
+// packetStream holds the state of a stream of packets while it is read
+type packetStream struct {
+	api        *PacketAPI
+	ctx        echo.Context
+	snifferMAC string
+	sequenced  bool
+	batch      model.Batch
+	sequence   model.SnifferSequence
+	result     model.PacketStreamResult
+	chunk      []streamedPacket
+	// skew is the incident of the stream which is estimated from its first packets, skewEstimated tells whether it was
+	skew          *model.SkewIncident
+	skewEstimated bool
+	// last is the sequence number of the last line read, stored the one up to which every line was stored or rejected
+	last, stored int64
+	// storedLines is the line up to which every line was stored, rejected or skipped
+	storedLines int
+}
+
+// CreatePacketStream reads newline delimited SnifferPackets and stores them in chunks as they arrive,
+// so a stream can be longer than what fits in memory and the chunks before a failure stay stored.
+// It answers with the fate of every line. Lines which are not valid are rejected without ending the stream.
+func (p *PacketAPI) CreatePacketStream(ctx echo.Context) error {
+	snifferMAC, err := getSnifferMAC(ctx)
+	if err != nil {
+		return err
+	}
+
+	stream := &packetStream{
+		api:        p,
+		ctx:        ctx,
+		snifferMAC: snifferMAC,
+		result:     model.PacketStreamResult{Rejected: []model.RejectedLine{}, Duplicates: []int{}},
+	}
+	if p.Sequencer != nil {
+		stream.batch, stream.sequenced, err = parseBatchHeaders(ctx, -1)
+		if err != nil {
+			return err
+		}
+	}
+	if stream.sequenced {
+		defer p.Sequencer.lock(snifferMAC)()
+		stream.sequence, err = p.Sequencer.DB.GetSnifferSequence(ctx.Request().Context(), snifferMAC)
+		if err != nil {
+			return newDatabaseError(err)
+		}
+		if err := checkBatch(stream.sequence, stream.batch); err != nil {
+			return err
+		}
+		keepBatch(&stream.sequence, stream.batch)
+		stream.last = stream.batch.First - 1
+		stream.stored = stream.last
+	}
+
+	err = stream.read(bufio.NewReaderSize(ctx.Request().Body, maxStreamLineLength))
+	if stream.sequenced {
+		setSequenceAck(ctx, stream.sequence)
+	}
+	if err != nil {
+		return stream.fail(err)
+	}
+
+	if stream.result.RejectedCount > 0 {
+		logWarn(ctx, "packets rejected", log.JSON{"accepted": stream.result.Accepted, "rejected": stream.result.RejectedCount})
+	}
+	if stream.result.Accepted > 0 {
+		return ctx.JSON(http.StatusCreated, stream.result)
+	}
+	return ctx.JSON(http.StatusOK, stream.result)
+}
+
+// fail attaches the result of the stream until the error to the error, so the client knows from which line to resend
+func (s *packetStream) fail(err error) error {
+	e := toError(err)
+	s.result.FailedLine = s.storedLines + 1
+	s.result.Error = &e.Body
+	e.Response = s.result
+	return e
+}
+
+// read reads the stream line by line and stores every full chunk
+func (s *packetStream) read(reader *bufio.Reader) error {
+	records := int64(0)
+	for line := 1; ; line++ {
+		content, tooLong, err := readLine(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if flushErr := s.flush(); flushErr != nil {
+				return flushErr
+			}
+			e := newBodyReadError(err)
+			e.Body.Message = fmt.Sprintf("stream broke off at line %d: %s", line, e.Body.Message)
+			return e
+		}
+		s.result.Lines = line
+		if len(content) == 0 && !tooLong {
+			continue
+		}
+
+		records++
+		record := streamedPacket{line: line}
+		if s.sequenced {
+			record.sequence = s.batch.First + records - 1
+			if record.sequence <= s.batch.Last {
+				s.last = record.sequence
+			}
+		}
+
+		switch {
+		case s.sequenced && record.sequence > s.batch.Last:
+			s.reject(line, outOfRangeFieldError(HeaderSequenceRange, fmt.Sprintf("line is beyond the sequence range which ends at %d", s.batch.Last)))
+		case tooLong:
+			s.reject(line, invalidFieldError("", fmt.Sprintf("line is longer than %d bytes", maxStreamLineLength)))
+		case s.sequenced && isReceived(s.sequence, record.sequence):
+			s.duplicate(line)
+		default:
+			if err := json.Unmarshal(content, &record.packet); err != nil {
+				s.reject(line, model.FieldError{Code: CodeInvalidJSON, Message: err.Error()})
+				continue
+			}
+			s.chunk = append(s.chunk, record)
+		}
+
+		if len(s.chunk) == streamChunkSize {
+			if err := s.flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return s.flush()
+}
+
+// flush validates and stores the packets of the chunk, a sequenced stream acknowledges them together with storing them
+func (s *packetStream) flush() error {
+	chunk := s.chunk
+	s.chunk = nil
+	if len(chunk) == 0 && s.last == s.stored {
+		s.storedLines = s.result.Lines
+		return nil
+	}
+
+	snifferPackets := make([]model.SnifferPacket, len(chunk))
+	for i := range chunk {
+		snifferPackets[i] = chunk[i].packet
+	}
+	// the clock of the sniffer is the same for the whole stream, so its offset is estimated once
+	if !s.skewEstimated && len(snifferPackets) > 0 {
+		s.skew = s.api.Skew.estimate(s.ctx, snifferPackets, s.sequenced)
+		s.skewEstimated = true
+		s.api.Skew.report(s.ctx, s.skew)
+	}
+	incident := s.skew
+	applySkew(incident, snifferPackets)
+
+	packets := []model.Packet{}
+	rejected := 0
+	for i := range snifferPackets {
+		var fieldErrors []model.FieldError
+		if isQuarantined(incident) {
+			fieldErrors = []model.FieldError{clockSkewFieldError("timestamp", incident.Offset)}
+		} else {
+			fieldErrors = orDefaultValidator(s.api.Validator).SnifferPacket(&snifferPackets[i], "")
+		}
+		if len(fieldErrors) > 0 {
+			s.reject(chunk[i].line, fieldErrors...)
+			rejected++
+			continue
+		}
+		packets = append(packets, *toPacket(&snifferPackets[i], s.snifferMAC))
+	}
+	s.api.observeRejected(s.ctx, rejected)
+
+	if err := s.store(packets); err != nil {
+		return err
+	}
+	s.storedLines = s.result.Lines
+	s.result.Accepted += len(packets)
+	s.api.observeIngested(s.snifferMAC, len(packets))
+	return nil
+}
+
+func (s *packetStream) store(packets []model.Packet) error {
+	ctx := s.ctx.Request().Context()
+	if !s.sequenced {
+		if err := s.api.DB.CreatePackets(ctx, packets); err != nil {
+			return newDatabaseError(err)
+		}
+		return nil
+	}
+
+	// every line since the last chunk is covered, the lines which are not in the chunk were rejected or received before
+	sequence := s.sequence.Copy()
+	if !receiveRange(&sequence, model.SequenceRange{First: s.stored + 1, Last: s.last}) {
+		return tooManyRangesError(sequence)
+	}
+	if err := s.api.Sequencer.DB.CreatePacketBatch(ctx, packets, &sequence); err != nil {
+		return newDatabaseError(err)
+	}
+	s.sequence = sequence
+	s.stored = s.last
+	return nil
+}
+
+func (s *packetStream) reject(line int, fieldErrors ...model.FieldError) {
+	s.result.RejectedCount++
+	if len(s.result.Rejected) < maxStreamDetails {
+		s.result.Rejected = append(s.result.Rejected, model.RejectedLine{Line: line, Errors: fieldErrors})
+	}
+}
+
+func (s *packetStream) duplicate(line int) {
+	s.result.DuplicateCount++
+	if len(s.result.Duplicates) < maxStreamDetails {
+		s.result.Duplicates = append(s.result.Duplicates, line)
+	}
+}
+
+// readLine returns the next line without its line ending. A line longer than the buffer of the reader is skipped and
+// reported as too long, so a single broken line does not end the stream. A line which was cut off by an error is not
+// returned, only the error.
+func readLine(reader *bufio.Reader) ([]byte, bool, error) {
+	line, err := reader.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		for err == bufio.ErrBufferFull {
+			_, err = reader.ReadSlice('\n')
+		}
+		if err == io.EOF {
+			err = nil
+		}
+		return nil, true, err
+	}
+	// the last line may end without a line ending
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r")), false, nil
+}
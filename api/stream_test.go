@@ -0,0 +1,206 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cyucelen/wirect/model"
+	"github.com/cyucelen/wirect/test"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func sendStream(packetAPI *PacketAPI, headers map[string]string, lines ...string) (*httptest.ResponseRecorder, model.PacketStreamResult) {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(strings.Join(lines, "\n")))
+	c, rec := createTestContext(req)
+	req.Header.Set(echo.HeaderContentType, MIMEApplicationNDJSON)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	addSnifferMACParamToContext(c, defaultTestSnifferMAC)
+	serve(c, packetAPI.CreatePacketStream)
+
+	var result model.PacketStreamResult
+	json.Unmarshal(rec.Body.Bytes(), &result)
+	return rec, result
+}
+
+func streamLine(rssi int) string {
+	return fmt.Sprintf(`{"MAC":"AA:AA:AA:AA:AA:01","timestamp":%d,"RSSI":%d}`, time.Now().Unix(), rssi)
+}
+
+func TestCreatePacketStream(t *testing.T) {
+	db := &test.InMemoryDB{}
+	packetAPI := &PacketAPI{DB: db}
+
+	rec, result := sendStream(packetAPI, nil,
+		streamLine(-40),
+		"",
+		`{"MAC":"AA:AA:AA:AA:AA:01",`,
+		`{"MAC":"not a mac","timestamp":1,"RSSI":-40}`,
+		streamLine(-50),
+	)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, 5, result.Lines)
+	assert.Equal(t, 2, result.Accepted)
+	assert.Len(t, result.Rejected, 2)
+	assert.Equal(t, 3, result.Rejected[0].Line)
+	assert.Equal(t, CodeInvalidJSON, result.Rejected[0].Errors[0].Code)
+	assert.Equal(t, 4, result.Rejected[1].Line)
+	assert.Len(t, db.Packets, 2)
+	assert.Equal(t, defaultTestSnifferMAC, db.Packets[1].SnifferMAC)
+}
+
+func TestCreatePacketStreamWithoutValidPackets(t *testing.T) {
+	db := &test.InMemoryDB{}
+
+	rec, result := sendStream(&PacketAPI{DB: db}, nil, "[]", "", "null")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 0, result.Accepted)
+	assert.Len(t, result.Rejected, 2)
+	assert.Empty(t, db.Packets)
+}
+
+func TestCreatePacketStreamLongerThanAChunk(t *testing.T) {
+	db := &test.InMemoryDB{}
+	lines := []string{}
+	for i := 0; i < 2*streamChunkSize+1; i++ {
+		lines = append(lines, streamLine(-40))
+	}
+
+	rec, result := sendStream(&PacketAPI{DB: db}, nil, lines...)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, 2*streamChunkSize+1, result.Accepted)
+	assert.Len(t, db.Packets, 2*streamChunkSize+1)
+}
+
+// chunkFailingDB fails to store every chunk after the first ones
+type chunkFailingDB struct {
+	*test.InMemoryDB
+	chunks int
+}
+
+func (c *chunkFailingDB) CreatePackets(ctx context.Context, packets []model.Packet) error {
+	if c.chunks == 0 {
+		return errors.New("disk is full")
+	}
+	c.chunks--
+	return c.InMemoryDB.CreatePackets(ctx, packets)
+}
+
+func TestCreatePacketStreamReportsStoredLinesOnFailure(t *testing.T) {
+	db := &chunkFailingDB{InMemoryDB: &test.InMemoryDB{}, chunks: 1}
+	lines := []string{"not json"}
+	for i := 0; i < 2*streamChunkSize; i++ {
+		lines = append(lines, streamLine(-40))
+	}
+
+	rec, result := sendStream(&PacketAPI{DB: db}, nil, lines...)
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, streamChunkSize, result.Accepted)
+	assert.Equal(t, 1, result.RejectedCount)
+	assert.Equal(t, streamChunkSize+2, result.FailedLine)
+	if assert.NotNil(t, result.Error) {
+		assert.Equal(t, CodeInternal, result.Error.Code)
+	}
+	assert.Len(t, db.Packets, streamChunkSize)
+}
+
+func TestCreatePacketStreamWithTooLongLine(t *testing.T) {
+	db := &test.InMemoryDB{}
+
+	longLine := `{"MAC":"` + strings.Repeat("A", maxStreamLineLength) + `"}`
+	rec, result := sendStream(&PacketAPI{DB: db}, nil, streamLine(-40), longLine, streamLine(-50))
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, 2, result.Accepted)
+	assert.Len(t, result.Rejected, 1)
+	assert.Equal(t, 2, result.Rejected[0].Line)
+	assert.Len(t, db.Packets, 2)
+}
+
+func TestCreatePacketStreamInSequence(t *testing.T) {
+	packetAPI, db := createSequencedPacketAPI()
+	headers := map[string]string{HeaderBatchID: "stream-1", HeaderSequenceRange: "1-3"}
+	lines := []string{streamLine(-40), "not json", streamLine(-50)}
+
+	rec, result := sendStream(packetAPI, headers, lines...)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, 2, result.Accepted)
+	// the rejected line is acknowledged too
+	assert.Equal(t, "3", rec.Header().Get(HeaderSequenceAck))
+	assert.Len(t, db.Packets, 2)
+
+	// a retried stream stores nothing
+	rec, result = sendStream(packetAPI, headers, lines...)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []int{1, 2, 3}, result.Duplicates)
+	assert.Len(t, db.Packets, 2)
+
+	// lines beyond the range are rejected
+	headers = map[string]string{HeaderBatchID: "stream-2", HeaderSequenceRange: "3-4"}
+	rec, result = sendStream(packetAPI, headers, streamLine(-40), streamLine(-40), streamLine(-40))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, []int{1}, result.Duplicates)
+	assert.Equal(t, 1, result.Accepted)
+	assert.Len(t, result.Rejected, 1)
+	assert.Equal(t, 3, result.Rejected[0].Line)
+	assert.Equal(t, "4", rec.Header().Get(HeaderSequenceAck))
+}
+
+func TestCreatePacketStreamWithReusedBatchID(t *testing.T) {
+	packetAPI, _ := createSequencedPacketAPI()
+
+	sendStream(packetAPI, map[string]string{HeaderBatchID: "stream-1", HeaderSequenceRange: "1-2"}, streamLine(-40), streamLine(-40))
+	rec, _ := sendStream(packetAPI, map[string]string{HeaderBatchID: "stream-1", HeaderSequenceRange: "3-4"}, streamLine(-40), streamLine(-40))
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestCreatePacketStreamListsFirstRejectedLines(t *testing.T) {
+	db := &test.InMemoryDB{}
+	lines := []string{}
+	for i := 0; i < maxStreamDetails+50; i++ {
+		lines = append(lines, "not json")
+	}
+	lines = append(lines, streamLine(-40))
+
+	rec, result := sendStream(&PacketAPI{DB: db}, nil, lines...)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, 1, result.Accepted)
+	assert.Equal(t, maxStreamDetails+50, result.RejectedCount)
+	assert.Len(t, result.Rejected, maxStreamDetails)
+	assert.Equal(t, maxStreamDetails, result.Rejected[maxStreamDetails-1].Line)
+}
+
+func TestCreatePacketStreamEstimatesSkewOnce(t *testing.T) {
+	now := time.Unix(1560000000, 0)
+	packetAPI, db := createSkewedPacketAPI(SkewModeCorrect, now)
+
+	// the sniffer counts from 1970 since it booted and keeps counting while it streams
+	lines := []string{}
+	for i := 0; i < streamChunkSize+1; i++ {
+		lines = append(lines, fmt.Sprintf(`{"MAC":"AA:AA:AA:AA:AA:01","timestamp":%d,"RSSI":-40}`, 100+i))
+	}
+
+	rec, result := sendStream(packetAPI, nil, lines...)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, streamChunkSize+1, result.Accepted)
+	offset := now.Unix() - int64(100+streamChunkSize-1)
+	assert.Equal(t, int64(100+streamChunkSize)+offset, db.Packets[streamChunkSize].Timestamp)
+	_, count := packetAPI.Skew.Incidents(defaultTestSnifferMAC)
+	assert.Equal(t, 1, count)
+}
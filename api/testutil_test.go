@@ -8,6 +8,7 @@ import (
 	"net/url"
 	"strings"
 
+	"github.com/cyucelen/wirect/model"
 	"github.com/labstack/echo"
 )
 
@@ -18,6 +19,7 @@ func createTestContext(req *http.Request) (echo.Context, *httptest.ResponseRecor
 
 	rec := httptest.NewRecorder()
 	e := echo.New()
+	e.HTTPErrorHandler = HTTPErrorHandler
 	c := e.NewContext(req, rec)
 
 	return c, rec
@@ -28,7 +30,7 @@ func sendTestRequestToHandler(snifferMAC string, payload interface{}, handler ha
 	req := httptest.NewRequest(httpMethod, "/", bytes.NewReader(payloadJSON))
 	c, rec := createTestContext(req)
 	addSnifferMACParamToContext(c, snifferMAC)
-	handler(c)
+	serve(c, handler)
 
 	return rec
 }
@@ -36,7 +38,7 @@ func sendTestRequestToHandler(snifferMAC string, payload interface{}, handler ha
 func sendTestRequestToHandlerWithRawBody(payload string, handler handlerFunc) *httptest.ResponseRecorder {
 	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(payload))
 	c, rec := createTestContext(req)
-	handler(c)
+	serve(c, handler)
 
 	return rec
 }
@@ -48,7 +50,7 @@ func sendTestRequestToHandlerWithInvalidParam(payload interface{}, handler handl
 	c.SetPath("/:snifferMAC")
 	c.SetParamNames("snifferMAC")
 	c.SetParamValues("%%")
-	handler(c)
+	serve(c, handler)
 
 	return rec
 }
@@ -65,6 +67,20 @@ func sendTestRequestToHandlerWithCorruptedJSON(handler handlerFunc) int {
 	return rec.Code
 }
 
+func serve(ctx echo.Context, handler handlerFunc) error {
+	err := handler(ctx)
+	if err != nil {
+		ctx.Echo().HTTPErrorHandler(err, ctx)
+	}
+	return err
+}
+
+func decodeError(rec *httptest.ResponseRecorder) model.Error {
+	var e model.Error
+	json.NewDecoder(rec.Body).Decode(&e)
+	return e
+}
+
 func addSnifferMACParamToContext(ctx echo.Context, snifferMAC string) {
 	ctx.SetPath("/:snifferMAC")
 	ctx.SetParamNames("snifferMAC")
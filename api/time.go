@@ -1,18 +1,210 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/benbjohnson/clock"
 	"github.com/cyucelen/wirect/model"
 	"github.com/labstack/echo"
 )
 
+// maxClockSamples is the number of synchronizations kept for every sniffer to estimate its drift
+const maxClockSamples = 64
+
+// minDriftSpan is the time the synchronizations of a sniffer must span before its drift is estimated,
+// shorter spans give drifts dominated by the jitter of the network
+const minDriftSpan = 10 * time.Minute
+
+// maxSyncDelay and maxSyncOffset bound the delay and offset of a synchronization so they fit in a time.Duration
+const maxSyncDelay = time.Minute
+const maxSyncOffset = 100 * 365 * 24 * time.Hour
+
+// clockIdleTimeout is the time after its last synchronization a sniffer is forgotten, so removed sniffers are not kept
+const clockIdleTimeout = 24 * time.Hour
+
 type TimeAPI struct {
 	Clock clock.Clock
+	// Clocks records the clock of every registered sniffer which synchronizes, nil leaves them unrecorded
+	Clocks *ClockTracker
+	// DB tells which sniffers are registered, it is required with Clocks
+	DB SnifferDatabase
 }
 
 func (t *TimeAPI) GetTime(ctx echo.Context) error {
-	ctx.JSON(http.StatusOK, model.Time{Now: t.Clock.Now().Unix()})
-	return nil
+	return ctx.JSON(http.StatusOK, model.Time{Now: t.Clock.Now().Unix()})
+}
+
+// SyncTime answers a synchronization of the sniffer with the times the request was received and the answer was sent
+// and records the offset of the sniffer if it is registered
+func (t *TimeAPI) SyncTime(ctx echo.Context) error {
+	receive := orDefaultClock(t.Clock).Now()
+
+	snifferMAC, err := getSnifferMAC(ctx)
+	if err != nil {
+		return err
+	}
+
+	request := new(model.TimeSyncRequest)
+	if err := ctx.Bind(request); err != nil {
+		return newInvalidJSONError(err)
+	}
+	if fieldErrors := validateTimeSync(request, receive); len(fieldErrors) > 0 {
+		return newValidationError(fieldErrors...)
+	}
+
+	unit := precisionUnits[request.Precision]
+	answer := model.TimeSync{
+		Originate: request.Originate,
+		Receive:   receive.UnixNano() / int64(unit),
+		Precision: request.Precision,
+	}
+	if t.Clocks != nil {
+		// synchronizations with made up MACs are answered without growing the tracker
+		_, err := findSniffer(ctx, t.DB, snifferMAC)
+		if err != nil && ErrorStatus(err) != http.StatusNotFound {
+			return err
+		}
+		if err == nil {
+			delay := time.Duration(request.Delay) * unit
+			offset := time.Duration(answer.Receive-answer.Originate)*unit - delay/2
+			t.Clocks.Record(snifferMAC, receive, offset, delay)
+		}
+	}
+
+	answer.Transmit = orDefaultClock(t.Clock).Now().UnixNano() / int64(unit)
+	return ctx.JSON(http.StatusOK, answer)
+}
+
+var precisionUnits = map[string]time.Duration{
+	model.PrecisionMillisecond: time.Millisecond,
+	model.PrecisionMicrosecond: time.Microsecond,
+}
+
+func validateTimeSync(request *model.TimeSyncRequest, receive time.Time) []model.FieldError {
+	fieldErrors := []model.FieldError{}
+	if request.Precision == "" {
+		request.Precision = model.PrecisionMillisecond
+	}
+	unit, ok := precisionUnits[request.Precision]
+	if !ok {
+		return append(fieldErrors, invalidFieldError("precision", "precision must be ms or us"))
+	}
+
+	offset := receive.UnixNano()/int64(unit) - request.Originate
+	switch {
+	case request.Originate <= 0:
+		fieldErrors = append(fieldErrors, requiredFieldError("originate"))
+	case offset > int64(maxSyncOffset/unit) || offset < -int64(maxSyncOffset/unit):
+		fieldErrors = append(fieldErrors, outOfRangeFieldError("originate", "originate must be within 100 years of the time of the server"))
+	}
+	if request.Delay < 0 || request.Delay > int64(maxSyncDelay/unit) {
+		fieldErrors = append(fieldErrors, outOfRangeFieldError("delay", fmt.Sprintf("delay must be from 0 to %v", maxSyncDelay)))
+	}
+	return fieldErrors
+}
+
+// ClockTracker estimates the offset and drift of the clock of every sniffer from its synchronizations.
+// It is kept in memory, so the estimates start over when the server restarts.
+type ClockTracker struct {
+	mu     sync.Mutex
+	clocks map[string]*snifferClock
+	// lastPruned is when idle sniffers were last forgotten
+	lastPruned time.Time
+}
+
+type snifferClock struct {
+	samples []clockSample
+	delay   time.Duration
+}
+
+type clockSample struct {
+	at     time.Time
+	offset time.Duration
+}
+
+func NewClockTracker() *ClockTracker {
+	return &ClockTracker{clocks: map[string]*snifferClock{}}
+}
+
+// Record adds a synchronization of the sniffer received at the time, offset is how far the server is ahead of the sniffer
+func (c *ClockTracker) Record(snifferMAC string, at time.Time, offset, delay time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.prune(at)
+	sniffer, exists := c.clocks[snifferMAC]
+	if !exists {
+		sniffer = &snifferClock{}
+		c.clocks[snifferMAC] = sniffer
+	}
+	sniffer.samples = append(sniffer.samples, clockSample{at: at, offset: offset})
+	if len(sniffer.samples) > maxClockSamples {
+		sniffer.samples = sniffer.samples[len(sniffer.samples)-maxClockSamples:]
+	}
+	if delay > 0 {
+		sniffer.delay = delay
+	}
+}
+
+// prune forgets the sniffers which did not synchronize for clockIdleTimeout, at most once per timeout
+func (c *ClockTracker) prune(now time.Time) {
+	if now.Sub(c.lastPruned) < clockIdleTimeout {
+		return
+	}
+	for snifferMAC, sniffer := range c.clocks {
+		if now.Sub(sniffer.samples[len(sniffer.samples)-1].at) >= clockIdleTimeout {
+			delete(c.clocks, snifferMAC)
+		}
+	}
+	c.lastPruned = now
+}
+
+// Status returns the estimated clock of the sniffer, false if it never synchronized
+func (c *ClockTracker) Status(snifferMAC string) (model.ClockStatus, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sniffer, exists := c.clocks[snifferMAC]
+	if !exists {
+		return model.ClockStatus{}, false
+	}
+	last := sniffer.samples[len(sniffer.samples)-1]
+	status := model.ClockStatus{
+		Samples:      len(sniffer.samples),
+		LastSync:     last.at.Unix(),
+		OffsetMillis: millis(last.offset),
+		DelayMillis:  millis(sniffer.delay),
+	}
+	if last.at.Sub(sniffer.samples[0].at) >= minDriftSpan {
+		drift := round(driftOf(sniffer.samples) * 1e6)
+		status.DriftPPM = &drift
+	}
+	return status, true
+}
+
+// driftOf fits a line to the offsets over time by least squares and returns its slope, the offset gained every second
+func driftOf(samples []clockSample) float64 {
+	first := samples[0].at
+	var sumX, sumY, sumXY, sumXX float64
+	for _, sample := range samples {
+		x := sample.at.Sub(first).Seconds()
+		y := sample.offset.Seconds()
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	n := float64(len(samples))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0
+	}
+	return (n*sumXY - sumX*sumY) / denominator
+}
+
+func millis(d time.Duration) float64 {
+	return round(float64(d) / float64(time.Millisecond))
 }
@@ -11,6 +11,7 @@ import (
 
 	"github.com/benbjohnson/clock"
 	"github.com/cyucelen/wirect/model"
+	"github.com/cyucelen/wirect/test"
 )
 
 func TestGetTime(t *testing.T) {
@@ -32,3 +33,100 @@ func TestGetTime(t *testing.T) {
 	assert.Equal(t, expectedTime, actualTime.Now)
 	assert.Equal(t, http.StatusOK, rec.Code)
 }
+
+func TestSyncTime(t *testing.T) {
+	mockClock := clock.NewMock()
+	mockClock.Set(time.Unix(100000, 0))
+	clocks := NewClockTracker()
+	db := &test.InMemoryDB{Sniffers: []model.Sniffer{{MAC: defaultTestSnifferMAC}}}
+	timeAPI := &TimeAPI{Clock: mockClock, Clocks: clocks, DB: db}
+
+	// the sniffer is 2.5 seconds behind and measured a round trip of 40ms before
+	request := model.TimeSyncRequest{Originate: 100000*1000 - 2500, Delay: 40}
+	rec := sendTestRequestToHandler(defaultTestSnifferMAC, request, timeAPI.SyncTime, http.MethodPost)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var answer model.TimeSync
+	json.NewDecoder(rec.Body).Decode(&answer)
+	assert.Equal(t, model.TimeSync{Originate: request.Originate, Receive: 100000 * 1000, Transmit: 100000 * 1000, Precision: "ms"}, answer)
+
+	status, synchronized := clocks.Status(defaultTestSnifferMAC)
+	assert.True(t, synchronized)
+	assert.Equal(t, 2480.0, status.OffsetMillis)
+	assert.Equal(t, 40.0, status.DelayMillis)
+	assert.Nil(t, status.DriftPPM)
+
+	request = model.TimeSyncRequest{Originate: 100000*1000000 - 7, Precision: "us"}
+	rec = sendTestRequestToHandler(defaultTestSnifferMAC, request, timeAPI.SyncTime, http.MethodPost)
+	json.NewDecoder(rec.Body).Decode(&answer)
+	assert.Equal(t, int64(100000*1000000), answer.Receive)
+	assert.Equal(t, "us", answer.Precision)
+}
+
+func TestSyncTimeDoesNotRecordUnregisteredSniffers(t *testing.T) {
+	mockClock := clock.NewMock()
+	mockClock.Set(time.Unix(100000, 0))
+	timeAPI := &TimeAPI{Clock: mockClock, Clocks: NewClockTracker(), DB: &test.InMemoryDB{}}
+
+	request := model.TimeSyncRequest{Originate: 100000*1000 - 2500}
+	rec := sendTestRequestToHandler(defaultTestSnifferMAC, request, timeAPI.SyncTime, http.MethodPost)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	_, synchronized := timeAPI.Clocks.Status(defaultTestSnifferMAC)
+	assert.False(t, synchronized)
+}
+
+func TestSyncTimeWithNotValidRequest(t *testing.T) {
+	timeAPI := &TimeAPI{Clock: clock.NewMock(), Clocks: NewClockTracker()}
+
+	notValidRequests := []struct {
+		field   string
+		request model.TimeSyncRequest
+	}{
+		{"originate", model.TimeSyncRequest{}},
+		{"originate", model.TimeSyncRequest{Originate: 1 << 62}},
+		{"precision", model.TimeSyncRequest{Originate: 1, Precision: "ns"}},
+		{"delay", model.TimeSyncRequest{Originate: 1, Delay: -1}},
+		{"delay", model.TimeSyncRequest{Originate: 1, Delay: 1 << 62}},
+	}
+	for _, notValid := range notValidRequests {
+		rec := sendTestRequestToHandler(defaultTestSnifferMAC, notValid.request, timeAPI.SyncTime, http.MethodPost)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, notValid.field)
+		assert.Equal(t, notValid.field, decodeError(rec).Details[0].Field)
+	}
+	_, synchronized := timeAPI.Clocks.Status(defaultTestSnifferMAC)
+	assert.False(t, synchronized)
+}
+
+func TestClockTrackerEstimatesDrift(t *testing.T) {
+	clocks := NewClockTracker()
+	start := time.Unix(100000, 0)
+
+	// the sniffer loses 50 microseconds every second
+	for i := 0; i <= maxClockSamples; i++ {
+		elapsed := time.Duration(i) * time.Minute
+		clocks.Record(defaultTestSnifferMAC, start.Add(elapsed), time.Second+elapsed/20000, 0)
+	}
+
+	status, _ := clocks.Status(defaultTestSnifferMAC)
+	assert.Equal(t, maxClockSamples, status.Samples)
+	assert.Equal(t, start.Add(maxClockSamples*time.Minute).Unix(), status.LastSync)
+	assert.Equal(t, 1192.0, status.OffsetMillis)
+	if assert.NotNil(t, status.DriftPPM) {
+		assert.Equal(t, 50.0, *status.DriftPPM)
+	}
+}
+
+func TestClockTrackerForgetsIdleSniffers(t *testing.T) {
+	clocks := NewClockTracker()
+	start := time.Unix(100000, 0)
+
+	clocks.Record("00:00:00:00:00:01", start, time.Second, 0)
+	clocks.Record(defaultTestSnifferMAC, start.Add(clockIdleTimeout/2), time.Second, 0)
+	clocks.Record(defaultTestSnifferMAC, start.Add(clockIdleTimeout), time.Second, 0)
+
+	_, synchronized := clocks.Status("00:00:00:00:00:01")
+	assert.False(t, synchronized)
+	_, synchronized = clocks.Status(defaultTestSnifferMAC)
+	assert.True(t, synchronized)
+}
@@ -0,0 +1,331 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cyucelen/wirect/model"
+)
+
+// ValidationMode decides what happens to values which are out of their plausible range
+type ValidationMode string
+
+const (
+	// ValidationModeReject rejects payloads with out of range values
+	ValidationModeReject ValidationMode = "reject"
+	// ValidationModeClamp moves out of range values to the nearest bound
+	ValidationModeClamp ValidationMode = "clamp"
+)
+
+// ValidationRules holds the plausible ranges of values sent by sniffers
+type ValidationRules struct {
+	Mode          ValidationMode
+	MinRSSI       float64
+	MaxRSSI       float64
+	MaxPastAge    time.Duration
+	MaxFutureSkew time.Duration
+	MaxSSIDLength int
+}
+
+// DefaultValidationRules are used when no rules are configured
+var DefaultValidationRules = ValidationRules{
+	Mode:          ValidationModeReject,
+	MinRSSI:       -120,
+	MaxRSSI:       0,
+	MaxPastAge:    7 * 24 * time.Hour,
+	MaxFutureSkew: 5 * time.Minute,
+	MaxSSIDLength: 32,
+}
+
+// Validator validates and normalizes payloads sent by sniffers
+type Validator struct {
+	Rules ValidationRules
+	Clock clock.Clock
+}
+
+var defaultValidator = NewValidator(DefaultValidationRules, clock.New())
+
+func NewValidator(rules ValidationRules, clock clock.Clock) *Validator {
+	return &Validator{Rules: rules, Clock: clock}
+}
+
+func orDefaultValidator(v *Validator) *Validator {
+	if v == nil {
+		return defaultValidator
+	}
+	return v
+}
+
+// SnifferPacket normalizes the packet in place and returns the reasons it is not valid
+func (v *Validator) SnifferPacket(snifferPacket *model.SnifferPacket, fieldPrefix string) []model.FieldError {
+	fieldErrors := []model.FieldError{}
+
+	if snifferPacket.MAC == "" {
+		fieldErrors = append(fieldErrors, requiredFieldError(fieldPrefix+"MAC"))
+	} else if mac, err := NormalizeMAC(snifferPacket.MAC); err != nil {
+		fieldErrors = append(fieldErrors, invalidFieldError(fieldPrefix+"MAC", err.Error()))
+	} else {
+		snifferPacket.MAC = mac
+	}
+
+	if snifferPacket.Timestamp == 0 {
+		fieldErrors = append(fieldErrors, requiredFieldError(fieldPrefix+"timestamp"))
+	} else {
+		fieldErrors = append(fieldErrors, v.checkTimestamp(&snifferPacket.Timestamp, fieldPrefix+"timestamp")...)
+	}
+
+	fieldErrors = append(fieldErrors, v.checkRSSI(&snifferPacket.RSSI, fieldPrefix+"RSSI")...)
+
+	return fieldErrors
+}
+
+// Bands of WiFi a router can be seen on
+var bands = []string{"2.4GHz", "5GHz", "6GHz"}
+
+// Security types of WiFi a router can have
+var securityTypes = []string{"open", "wep", "wpa", "wpa2", "wpa3", "wpa2-enterprise", "wpa3-enterprise"}
+
+// maxChannel is the highest WiFi channel number, it is used on the 6GHz band
+const maxChannel = 233
+
+// Router normalizes the router in place and returns the reasons it is not valid.
+// BSSID, channel, band, security and RSSI are optional since older sniffers only report the SSID.
+func (v *Validator) Router(router *model.RouterExternal, fieldPrefix string) []model.FieldError {
+	fieldErrors := []model.FieldError{}
+	field := fieldPrefix + "SSID"
+
+	switch {
+	case router.SSID == "":
+		fieldErrors = append(fieldErrors, requiredFieldError(field))
+	case len(router.SSID) > v.Rules.MaxSSIDLength:
+		fieldErrors = append(fieldErrors, outOfRangeFieldError(field, fmt.Sprintf("%s must be at most %d bytes", field, v.Rules.MaxSSIDLength)))
+	case !utf8.ValidString(router.SSID) || strings.IndexFunc(router.SSID, unicode.IsControl) >= 0:
+		fieldErrors = append(fieldErrors, invalidFieldError(field, field+" must be printable UTF-8"))
+	}
+
+	if router.BSSID != "" {
+		if bssid, err := NormalizeMAC(router.BSSID); err != nil {
+			fieldErrors = append(fieldErrors, invalidFieldError(fieldPrefix+"BSSID", "BSSID must consist of 6 hexadecimal octets"))
+		} else {
+			router.BSSID = bssid
+		}
+	}
+
+	if router.Channel < 0 || router.Channel > maxChannel {
+		field := fieldPrefix + "channel"
+		fieldErrors = append(fieldErrors, outOfRangeFieldError(field, fmt.Sprintf("%s must be between 1 and %d", field, maxChannel)))
+	}
+
+	if router.Band != "" {
+		if band, ok := oneOf(router.Band, bands); ok {
+			router.Band = band
+		} else {
+			field := fieldPrefix + "band"
+			fieldErrors = append(fieldErrors, invalidFieldError(field, field+" must be one of "+strings.Join(bands, ", ")))
+		}
+	}
+
+	if router.Security != "" {
+		if security, ok := oneOf(router.Security, securityTypes); ok {
+			router.Security = security
+		} else {
+			field := fieldPrefix + "security"
+			fieldErrors = append(fieldErrors, invalidFieldError(field, field+" must be one of "+strings.Join(securityTypes, ", ")))
+		}
+	}
+
+	if router.RSSI != 0 {
+		fieldErrors = append(fieldErrors, v.checkRSSI(&router.RSSI, fieldPrefix+"RSSI")...)
+	}
+
+	return fieldErrors
+}
+
+// oneOf returns the value of values which equals value ignoring case
+func oneOf(value string, values []string) (string, bool) {
+	for _, candidate := range values {
+		if strings.EqualFold(value, candidate) {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// maxLocationLength is the maximum length of the building, floor and room of a sniffer in bytes
+const maxLocationLength = 64
+
+// maxTags is the maximum number of tags of a sniffer, maxTagLength the maximum length of a tag in bytes
+const maxTags = 16
+const maxTagLength = 32
+
+// Sniffer normalizes the sniffer in place and returns the reasons it is not valid.
+// The location is optional, but latitude and longitude must be given together,
+// as must x and y which also need the floor they are on.
+func (v *Validator) Sniffer(sniffer *model.Sniffer) []model.FieldError {
+	fieldErrors := []model.FieldError{}
+
+	if sniffer.MAC == "" {
+		fieldErrors = append(fieldErrors, requiredFieldError("MAC"))
+	} else if mac, err := NormalizeMAC(sniffer.MAC); err != nil {
+		fieldErrors = append(fieldErrors, invalidFieldError("MAC", err.Error()))
+	} else {
+		sniffer.MAC = mac
+	}
+
+	switch {
+	case sniffer.Latitude == nil && sniffer.Longitude != nil:
+		fieldErrors = append(fieldErrors, requiredFieldError("latitude"))
+	case sniffer.Latitude != nil && sniffer.Longitude == nil:
+		fieldErrors = append(fieldErrors, requiredFieldError("longitude"))
+	}
+	if sniffer.Latitude != nil && !(*sniffer.Latitude >= -90 && *sniffer.Latitude <= 90) {
+		fieldErrors = append(fieldErrors, outOfRangeFieldError("latitude", "latitude must be between -90 and 90"))
+	}
+	if sniffer.Longitude != nil && !(*sniffer.Longitude >= -180 && *sniffer.Longitude <= 180) {
+		fieldErrors = append(fieldErrors, outOfRangeFieldError("longitude", "longitude must be between -180 and 180"))
+	}
+
+	switch {
+	case sniffer.X == nil && sniffer.Y != nil:
+		fieldErrors = append(fieldErrors, requiredFieldError("x"))
+	case sniffer.X != nil && sniffer.Y == nil:
+		fieldErrors = append(fieldErrors, requiredFieldError("y"))
+	case sniffer.X != nil && strings.TrimSpace(sniffer.Floor) == "":
+		fieldErrors = append(fieldErrors, requiredFieldError("floor"))
+	}
+
+	if math.Abs(sniffer.RSSIOffset) > maxRSSIOffset {
+		fieldErrors = append(fieldErrors, outOfRangeFieldError("RSSIOffset", fmt.Sprintf("RSSIOffset must be between -%d and %d", maxRSSIOffset, maxRSSIOffset)))
+	}
+	if sniffer.PathLossExponent != nil && !(*sniffer.PathLossExponent >= minPathLossExponent && *sniffer.PathLossExponent <= maxPathLossExponent) {
+		message := fmt.Sprintf("pathLossExponent must be between %d and %d", minPathLossExponent, maxPathLossExponent)
+		fieldErrors = append(fieldErrors, outOfRangeFieldError("pathLossExponent", message))
+	}
+
+	fieldErrors = append(fieldErrors, checkText(&sniffer.Building, "building", maxLocationLength)...)
+	fieldErrors = append(fieldErrors, checkText(&sniffer.Floor, "floor", maxLocationLength)...)
+	fieldErrors = append(fieldErrors, checkText(&sniffer.Room, "room", maxLocationLength)...)
+	fieldErrors = append(fieldErrors, checkTags(&sniffer.Tags)...)
+
+	return fieldErrors
+}
+
+// checkText trims the text and checks that it is printable and not too long
+func checkText(text *string, field string, maxLength int) []model.FieldError {
+	*text = strings.TrimSpace(*text)
+	switch {
+	case len(*text) > maxLength:
+		return []model.FieldError{outOfRangeFieldError(field, fmt.Sprintf("%s must be at most %d bytes", field, maxLength))}
+	case !utf8.ValidString(*text) || strings.IndexFunc(*text, unicode.IsControl) >= 0:
+		return []model.FieldError{invalidFieldError(field, field+" must be printable UTF-8")}
+	}
+	return nil
+}
+
+// checkTags trims the tags and drops duplicates, no tags are stored as nil
+func checkTags(tags *model.Tags) []model.FieldError {
+	if len(*tags) > maxTags {
+		return []model.FieldError{outOfRangeFieldError("tags", fmt.Sprintf("tags must have at most %d items", maxTags))}
+	}
+
+	fieldErrors := []model.FieldError{}
+	normalized := model.Tags{}
+	seen := map[string]bool{}
+	for i, tag := range *tags {
+		field := fmt.Sprintf("tags[%d]", i)
+		if strings.TrimSpace(tag) == "" {
+			fieldErrors = append(fieldErrors, requiredFieldError(field))
+			continue
+		}
+		fieldErrors = append(fieldErrors, checkText(&tag, field, maxTagLength)...)
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+
+	*tags = nil
+	if len(normalized) > 0 {
+		*tags = normalized
+	}
+	return fieldErrors
+}
+
+func (v *Validator) checkTimestamp(timestamp *int64, field string) []model.FieldError {
+	now := v.Clock.Now()
+	earliest := now.Add(-v.Rules.MaxPastAge).Unix()
+	latest := now.Add(v.Rules.MaxFutureSkew).Unix()
+
+	if *timestamp >= earliest && *timestamp <= latest {
+		return nil
+	}
+
+	if v.Rules.Mode == ValidationModeClamp {
+		*timestamp = clampInt64(*timestamp, earliest, latest)
+		return nil
+	}
+
+	return []model.FieldError{outOfRangeFieldError(field, fmt.Sprintf("%s must be between %d and %d", field, earliest, latest))}
+}
+
+func (v *Validator) checkRSSI(rssi *float64, field string) []model.FieldError {
+	if *rssi >= v.Rules.MinRSSI && *rssi <= v.Rules.MaxRSSI {
+		return nil
+	}
+
+	if v.Rules.Mode == ValidationModeClamp {
+		*rssi = clampFloat64(*rssi, v.Rules.MinRSSI, v.Rules.MaxRSSI)
+		return nil
+	}
+
+	return []model.FieldError{outOfRangeFieldError(field, fmt.Sprintf("%s must be between %g and %g", field, v.Rules.MinRSSI, v.Rules.MaxRSSI))}
+}
+
+var errInvalidMAC = errors.New("MAC must consist of 6 hexadecimal octets")
+
+// NormalizeMAC converts a MAC address written with colons, dashes, dots or no separators
+// to the canonical upper case colon separated form
+func NormalizeMAC(mac string) (string, error) {
+	hexDigits := strings.Map(func(r rune) rune {
+		if r == ':' || r == '-' || r == '.' {
+			return -1
+		}
+		return unicode.ToUpper(r)
+	}, strings.TrimSpace(mac))
+
+	if len(hexDigits) != 12 || strings.Trim(hexDigits, "0123456789ABCDEF") != "" {
+		return "", errInvalidMAC
+	}
+
+	octets := make([]string, 6)
+	for i := range octets {
+		octets[i] = hexDigits[2*i : 2*i+2]
+	}
+	return strings.Join(octets, ":"), nil
+}
+
+func clampInt64(value, min, max int64) int64 {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
+
+func clampFloat64(value, min, max float64) float64 {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
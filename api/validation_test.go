@@ -0,0 +1,180 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cyucelen/wirect/model"
+	"github.com/cyucelen/wirect/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func createValidatorAt(mode ValidationMode, now time.Time) *Validator {
+	mockClock := clock.NewMock()
+	mockClock.Set(now)
+	rules := DefaultValidationRules
+	rules.Mode = mode
+	return NewValidator(rules, mockClock)
+}
+
+func TestNormalizeMAC(t *testing.T) {
+	validMACs := []string{
+		"aa:bb:cc:dd:ee:ff", "AA-BB-CC-DD-EE-FF", "aabb.ccdd.eeff", "AABBCCDDEEFF", " aA:bB:cC:dD:eE:fF ",
+	}
+	for _, mac := range validMACs {
+		normalizedMAC, err := NormalizeMAC(mac)
+		assert.Nil(t, err)
+		assert.Equal(t, "AA:BB:CC:DD:EE:FF", normalizedMAC)
+	}
+
+	invalidMACs := []string{"", "AA:BB:CC:DD:EE", "AA:BB:CC:DD:EE:FF:00", "GG:BB:CC:DD:EE:FF", "not a mac"}
+	for _, mac := range invalidMACs {
+		_, err := NormalizeMAC(mac)
+		assert.Error(t, err, mac)
+	}
+}
+
+func TestValidateSnifferPacketInRejectMode(t *testing.T) {
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	validator := createValidatorAt(ValidationModeReject, now)
+
+	snifferPacket := model.SnifferPacket{MAC: "aa-bb-cc-dd-ee-ff", Timestamp: now.Unix(), RSSI: -60}
+	assert.Empty(t, validator.SnifferPacket(&snifferPacket, ""))
+	assert.Equal(t, "AA:BB:CC:DD:EE:FF", snifferPacket.MAC)
+
+	notValidSnifferPackets := map[string]model.SnifferPacket{
+		"MAC":       {MAC: "AA:BB", Timestamp: now.Unix(), RSSI: -60},
+		"RSSI":      {MAC: "AA:BB:CC:DD:EE:FF", Timestamp: now.Unix(), RSSI: 1234},
+		"timestamp": {MAC: "AA:BB:CC:DD:EE:FF", Timestamp: now.Add(365 * 24 * time.Hour).Unix(), RSSI: -60},
+	}
+	for field, notValidSnifferPacket := range notValidSnifferPackets {
+		fieldErrors := validator.SnifferPacket(&notValidSnifferPacket, "")
+		if assert.Len(t, fieldErrors, 1) {
+			assert.Equal(t, field, fieldErrors[0].Field)
+		}
+	}
+
+	tooOld := model.SnifferPacket{MAC: "AA:BB:CC:DD:EE:FF", Timestamp: now.Add(-8 * 24 * time.Hour).Unix(), RSSI: -60}
+	fieldErrors := validator.SnifferPacket(&tooOld, "[2].")
+	assert.Equal(t, "[2].timestamp", fieldErrors[0].Field)
+	assert.Equal(t, "out_of_range", fieldErrors[0].Code)
+}
+
+func TestValidateSnifferPacketInClampMode(t *testing.T) {
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	validator := createValidatorAt(ValidationModeClamp, now)
+
+	snifferPacket := model.SnifferPacket{MAC: "AA:BB:CC:DD:EE:FF", Timestamp: now.Add(time.Hour).Unix(), RSSI: 1234}
+	assert.Empty(t, validator.SnifferPacket(&snifferPacket, ""))
+	assert.Equal(t, now.Add(DefaultValidationRules.MaxFutureSkew).Unix(), snifferPacket.Timestamp)
+	assert.Equal(t, DefaultValidationRules.MaxRSSI, snifferPacket.RSSI)
+
+	snifferPacket = model.SnifferPacket{MAC: "AA:BB:CC:DD:EE:FF", Timestamp: 1, RSSI: -500}
+	assert.Empty(t, validator.SnifferPacket(&snifferPacket, ""))
+	assert.Equal(t, now.Add(-DefaultValidationRules.MaxPastAge).Unix(), snifferPacket.Timestamp)
+	assert.Equal(t, DefaultValidationRules.MinRSSI, snifferPacket.RSSI)
+}
+
+func TestValidateRouter(t *testing.T) {
+	validator := NewValidator(DefaultValidationRules, clock.New())
+
+	assert.Empty(t, validator.Router(&model.RouterExternal{SSID: "eduroam"}, ""))
+
+	notValidSSIDs := []string{"", strings.Repeat("a", 33), "bad\x00ssid", "\xff\xfe"}
+	for _, ssid := range notValidSSIDs {
+		assert.Len(t, validator.Router(&model.RouterExternal{SSID: ssid}, ""), 1, ssid)
+	}
+}
+
+func TestValidateRouterDetails(t *testing.T) {
+	validator := NewValidator(DefaultValidationRules, clock.New())
+
+	router := model.RouterExternal{SSID: "eduroam", BSSID: "aa-bb-cc-dd-ee-ff", Channel: 36, Band: "5ghz", Security: "WPA2-Enterprise", RSSI: -60}
+	assert.Empty(t, validator.Router(&router, ""))
+	assert.Equal(t, model.RouterExternal{SSID: "eduroam", BSSID: "AA:BB:CC:DD:EE:FF", Channel: 36, Band: "5GHz", Security: "wpa2-enterprise", RSSI: -60}, router)
+
+	notValidRouters := []model.RouterExternal{
+		{SSID: "eduroam", BSSID: "not a bssid"},
+		{SSID: "eduroam", Channel: -1},
+		{SSID: "eduroam", Channel: 234},
+		{SSID: "eduroam", Band: "60GHz"},
+		{SSID: "eduroam", Security: "wpa4"},
+		{SSID: "eduroam", RSSI: -500},
+	}
+	for _, router := range notValidRouters {
+		assert.Len(t, validator.Router(&router, "[0]."), 1, router)
+	}
+}
+
+func TestValidateSnifferLocation(t *testing.T) {
+	validator := NewValidator(DefaultValidationRules, clock.New())
+	latitude, longitude := 41.0082, 28.9784
+
+	sniffer := model.Sniffer{
+		MAC: "11-22-33-44-55-66", Latitude: &latitude, Longitude: &longitude,
+		Building: " Library ", Floor: "2", Room: "204", Tags: model.Tags{"entrance", " entrance", "indoor"},
+	}
+	assert.Empty(t, validator.Sniffer(&sniffer))
+	assert.Equal(t, "Library", sniffer.Building)
+	assert.Equal(t, model.Tags{"entrance", "indoor"}, sniffer.Tags)
+
+	sniffer = model.Sniffer{MAC: "11:22:33:44:55:66", Tags: model.Tags{}}
+	assert.Empty(t, validator.Sniffer(&sniffer))
+	assert.Nil(t, sniffer.Tags)
+
+	outOfRange, zero, steep := 181.0, 0.0, 7.0
+	tooManyTags := model.Tags{}
+	for i := 0; i <= maxTags; i++ {
+		tooManyTags = append(tooManyTags, strings.Repeat("a", i+1))
+	}
+	notValidSniffers := []model.Sniffer{
+		{MAC: "11:22:33:44:55:66", Latitude: &zero},
+		{MAC: "11:22:33:44:55:66", Longitude: &zero},
+		{MAC: "11:22:33:44:55:66", Latitude: &outOfRange, Longitude: &zero},
+		{MAC: "11:22:33:44:55:66", Latitude: &zero, Longitude: &outOfRange, Room: "ok"},
+		{MAC: "11:22:33:44:55:66", Building: strings.Repeat("b", maxLocationLength+1)},
+		{MAC: "11:22:33:44:55:66", Floor: "2\a3"},
+		{MAC: "11:22:33:44:55:66", Room: "\xff"},
+		{MAC: "11:22:33:44:55:66", Tags: model.Tags{"ok", " "}},
+		{MAC: "11:22:33:44:55:66", Tags: model.Tags{strings.Repeat("t", maxTagLength+1)}},
+		{MAC: "11:22:33:44:55:66", Tags: tooManyTags},
+		{MAC: "11:22:33:44:55:66", X: &zero, Y: &zero},
+		{MAC: "11:22:33:44:55:66", X: &zero, Floor: "1"},
+		{MAC: "11:22:33:44:55:66", RSSIOffset: -maxRSSIOffset - 1},
+		{MAC: "11:22:33:44:55:66", PathLossExponent: &zero},
+		{MAC: "11:22:33:44:55:66", PathLossExponent: &steep},
+	}
+	for _, sniffer := range notValidSniffers {
+		assert.Len(t, validator.Sniffer(&sniffer), 1, sniffer)
+	}
+}
+
+func TestCreatePacketNormalizesSnifferMACParam(t *testing.T) {
+	db := &test.InMemoryDB{}
+	packetAPI := PacketAPI{DB: db}
+
+	snifferPacket := model.SnifferPacket{MAC: "22:44:66:88:aa:cc", Timestamp: time.Now().Unix(), RSSI: -50}
+	rec := sendTestRequestToHandler("01-02-03-0a-0b-0c", snifferPacket, packetAPI.CreatePacket, http.MethodPost)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	assert.Equal(t, "01:02:03:0A:0B:0C", db.Packets[0].SnifferMAC)
+	assert.Equal(t, "22:44:66:88:AA:CC", db.Packets[0].MAC)
+
+	rec = sendTestRequestToHandler("not-a-mac", snifferPacket, packetAPI.CreatePacket, http.MethodPost)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestCreateRoutersWithNotValidSSID(t *testing.T) {
+	db := &test.InMemoryDB{}
+	routerAPI := RouterAPI{DB: db}
+
+	routers := []model.RouterExternal{{SSID: "1010"}, {SSID: ""}}
+	rec := sendTestRequestToHandler(defaultTestSnifferMAC, routers, routerAPI.CreateRouters, http.MethodPost)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, []model.FieldError{requiredFieldError("[1].SSID")}, decodeError(rec).Details)
+	assert.Empty(t, db.Routers)
+}
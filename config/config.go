@@ -0,0 +1,262 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	toml "github.com/pelletier/go-toml"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Config holds every setting of the wirect server
+type Config struct {
+	Database    Database    `yaml:"database"`
+	Server      Server      `yaml:"server"`
+	Crowd       Crowd       `yaml:"crowd"`
+	Validation  Validation  `yaml:"validation"`
+	Skew        Skew        `yaml:"skew"`
+	Log         Log         `yaml:"log"`
+	Privacy     Privacy     `yaml:"privacy"`
+	Security    Security    `yaml:"security"`
+	Relocation  Relocation  `yaml:"relocation"`
+	Positioning Positioning `yaml:"positioning"`
+}
+
+type Database struct {
+	Dialect            string   `yaml:"dialect"`
+	DSN                string   `yaml:"dsn"`
+	QueryTimeout       Duration `yaml:"query_timeout"`
+	BusyTimeout        Duration `yaml:"busy_timeout"`
+	ReadConnections    int      `yaml:"read_connections"`
+	CheckpointInterval Duration `yaml:"checkpoint_interval"`
+	Retention          Duration `yaml:"retention"`
+}
+
+type Server struct {
+	ListenAddress   string   `yaml:"listen_address"`
+	CORSOrigins     []string `yaml:"cors_origins"`
+	ShutdownTimeout Duration `yaml:"shutdown_timeout"`
+}
+
+type Crowd struct {
+	CalculationInterval Duration `yaml:"calculation_interval"`
+	MaxBuckets          int64    `yaml:"max_buckets"`
+}
+
+type Validation struct {
+	Mode          string   `yaml:"mode"`
+	MinRSSI       float64  `yaml:"min_rssi"`
+	MaxRSSI       float64  `yaml:"max_rssi"`
+	MaxPastAge    Duration `yaml:"max_past_age"`
+	MaxFutureSkew Duration `yaml:"max_future_skew"`
+	MaxSSIDLength int      `yaml:"max_ssid_length"`
+}
+
+type Log struct {
+	Level    string `yaml:"level"`
+	Requests bool   `yaml:"requests"`
+}
+
+type Privacy struct {
+	MACRedaction string `yaml:"mac_redaction"`
+	// HashSecret keys the hashes of MAC addresses, when it is empty a random secret is used which changes on every restart
+	HashSecret string `yaml:"hash_secret"`
+}
+
+type Security struct {
+	// AuthorizedAccessPoints can only be set in configuration files
+	AuthorizedAccessPoints []AuthorizedAccessPoint `yaml:"authorized_access_points"`
+	WebhookURL             string                  `yaml:"webhook_url"`
+}
+
+type Skew struct {
+	Mode      string   `yaml:"mode"`
+	Tolerance Duration `yaml:"tolerance"`
+}
+
+type Relocation struct {
+	JaccardThreshold float64 `yaml:"jaccard_threshold"`
+	RSSIShift        float64 `yaml:"rssi_shift"`
+	Confirmations    int     `yaml:"confirmations"`
+}
+
+type Positioning struct {
+	ReferenceRSSI    float64 `yaml:"reference_rssi"`
+	PathLossExponent float64 `yaml:"path_loss_exponent"`
+}
+
+// AuthorizedAccessPoint is an access point of a network which is protected against rogue access points
+type AuthorizedAccessPoint struct {
+	SSID     string `yaml:"ssid"`
+	BSSID    string `yaml:"bssid"`
+	Security string `yaml:"security"`
+}
+
+// Duration is a time.Duration which is written as a string such as 5m in configuration files
+type Duration time.Duration
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	return d.Set(s)
+}
+
+func (d *Duration) Set(s string) error {
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Default returns the configuration which is used for settings that are not set anywhere else
+func Default() Config {
+	return Config{
+		Database: Database{
+			Dialect:            "sqlite3",
+			DSN:                "./wirect.db",
+			QueryTimeout:       Duration(5 * time.Second),
+			BusyTimeout:        Duration(5 * time.Second),
+			ReadConnections:    4,
+			CheckpointInterval: Duration(5 * time.Minute),
+			Retention:          Duration(24 * time.Hour),
+		},
+		Server: Server{ListenAddress: ":1323", CORSOrigins: []string{"*"}, ShutdownTimeout: Duration(30 * time.Second)},
+		Crowd:  Crowd{CalculationInterval: Duration(5 * time.Minute), MaxBuckets: 1000},
+		Validation: Validation{
+			Mode:          "reject",
+			MinRSSI:       -120,
+			MaxRSSI:       0,
+			MaxPastAge:    Duration(7 * 24 * time.Hour),
+			MaxFutureSkew: Duration(5 * time.Minute),
+			MaxSSIDLength: 32,
+		},
+		Log:         Log{Level: "info", Requests: true},
+		Privacy:     Privacy{MACRedaction: "hash"},
+		Security:    Security{AuthorizedAccessPoints: []AuthorizedAccessPoint{}},
+		Skew:        Skew{Mode: "off", Tolerance: Duration(10 * time.Minute)},
+		Relocation:  Relocation{JaccardThreshold: 0.6, RSSIShift: 15, Confirmations: 3},
+		Positioning: Positioning{ReferenceRSSI: -40, PathLossExponent: 2.7},
+	}
+}
+
+// ReadFile overrides the configuration with the YAML or TOML file at path
+func (c *Config) ReadFile(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return yaml.UnmarshalStrict(content, c)
+	case ".toml":
+		tree, err := toml.LoadBytes(content)
+		if err != nil {
+			return err
+		}
+		// TOML is converted to YAML to decode both formats with the same struct tags
+		converted, err := yaml.Marshal(tree.ToMap())
+		if err != nil {
+			return err
+		}
+		return yaml.UnmarshalStrict(converted, c)
+	}
+
+	return fmt.Errorf("unknown configuration file format %q, use .yaml, .yml or .toml", filepath.Ext(path))
+}
+
+// Validate returns an error describing every invalid setting
+func (c *Config) Validate() error {
+	problems := []string{}
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.Database.Dialect != "", "database.dialect must not be empty")
+	check(c.Database.DSN != "", "database.dsn must not be empty")
+	check(c.Database.QueryTimeout >= 0, "database.query_timeout must not be negative")
+	check(c.Database.BusyTimeout >= 0, "database.busy_timeout must not be negative")
+	check(c.Database.ReadConnections > 0, "database.read_connections must be positive")
+	check(c.Database.CheckpointInterval >= 0, "database.checkpoint_interval must not be negative")
+	check(c.Database.Retention >= 0, "database.retention must not be negative")
+	check(c.Server.ListenAddress != "", "server.listen_address must not be empty")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	check(c.Crowd.CalculationInterval >= Duration(time.Second), "crowd.calculation_interval must be at least 1s")
+	check(c.Crowd.MaxBuckets > 0, "crowd.max_buckets must be positive")
+	check(c.Validation.Mode == "reject" || c.Validation.Mode == "clamp", "validation.mode must be reject or clamp")
+	check(c.Validation.MinRSSI < c.Validation.MaxRSSI, "validation.min_rssi must be less than validation.max_rssi")
+	check(c.Validation.MaxPastAge > 0, "validation.max_past_age must be positive")
+	check(c.Validation.MaxFutureSkew >= 0, "validation.max_future_skew must not be negative")
+	check(c.Validation.MaxSSIDLength > 0, "validation.max_ssid_length must be positive")
+	check(c.Skew.Mode == "off" || c.Skew.Mode == "correct" || c.Skew.Mode == "quarantine", "skew.mode must be off, correct or quarantine")
+	check(c.Skew.Tolerance > 0, "skew.tolerance must be positive")
+	check(isLogLevel(c.Log.Level), "log.level must be one of debug, info, warn, error or off")
+	check(isMACRedaction(c.Privacy.MACRedaction), "privacy.mac_redaction must be one of none, mask or hash")
+	for i, accessPoint := range c.Security.AuthorizedAccessPoints {
+		check(accessPoint.SSID != "", "security.authorized_access_points[%d].ssid must not be empty", i)
+		check(isMAC(accessPoint.BSSID), "security.authorized_access_points[%d].bssid must be a MAC address", i)
+	}
+	check(c.Security.WebhookURL == "" || isHTTPURL(c.Security.WebhookURL), "security.webhook_url must be an http or https URL")
+	check(c.Relocation.JaccardThreshold > 0 && c.Relocation.JaccardThreshold <= 1, "relocation.jaccard_threshold must be greater than 0 and at most 1")
+	check(c.Relocation.RSSIShift > 0, "relocation.rssi_shift must be positive")
+	check(c.Relocation.Confirmations > 0, "relocation.confirmations must be positive")
+	check(c.Positioning.ReferenceRSSI < 0, "positioning.reference_rssi must be negative")
+	check(c.Positioning.PathLossExponent >= 1 && c.Positioning.PathLossExponent <= 6, "positioning.path_loss_exponent must be between 1 and 6")
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// YAML returns the configuration in the format of a configuration file
+func (c *Config) YAML() string {
+	out, _ := yaml.Marshal(c)
+	return string(out)
+}
+
+func isLogLevel(level string) bool {
+	switch level {
+	case "debug", "info", "warn", "error", "off":
+		return true
+	}
+	return false
+}
+
+func isMACRedaction(redaction string) bool {
+	switch redaction {
+	case "none", "mask", "hash":
+		return true
+	}
+	return false
+}
+
+func isMAC(mac string) bool {
+	hardwareAddr, err := net.ParseMAC(mac)
+	return err == nil && len(hardwareAddr) == 6
+}
+
+func isHTTPURL(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestFile(t *testing.T, name, content string) string {
+	dir, err := ioutil.TempDir("", "wirect-config")
+	assert.Nil(t, err)
+	path := filepath.Join(dir, name)
+	assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func env(vars map[string]string) func(string) string {
+	return func(key string) string {
+		return vars[key]
+	}
+}
+
+func TestDefaultIsValid(t *testing.T) {
+	config := Default()
+	assert.Nil(t, config.Validate())
+}
+
+func TestLoadYAML(t *testing.T) {
+	path := writeTestFile(t, "wirect.yaml", `
+database:
+  dialect: sqlite3
+  dsn: /var/lib/wirect/wirect.db
+server:
+  listen_address: ":8080"
+  cors_origins: ["https://wirect.example.com"]
+crowd:
+  calculation_interval: 2m
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	config, printConfig, err := Load([]string{"--config", path}, env(nil))
+	assert.Nil(t, err)
+	assert.False(t, printConfig)
+
+	expected := Default()
+	expected.Database.DSN = "/var/lib/wirect/wirect.db"
+	expected.Server.ListenAddress = ":8080"
+	expected.Server.CORSOrigins = []string{"https://wirect.example.com"}
+	expected.Crowd.CalculationInterval = Duration(2 * time.Minute)
+	assert.Equal(t, expected, config)
+}
+
+func TestLoadTOML(t *testing.T) {
+	path := writeTestFile(t, "wirect.toml", `
+[database]
+dsn = "/var/lib/wirect/wirect.db"
+
+[validation]
+mode = "clamp"
+min_rssi = -100.0
+max_past_age = "24h"
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	config, _, err := Load([]string{"--config", path}, env(nil))
+	assert.Nil(t, err)
+
+	expected := Default()
+	expected.Database.DSN = "/var/lib/wirect/wirect.db"
+	expected.Validation.Mode = "clamp"
+	expected.Validation.MinRSSI = -100
+	expected.Validation.MaxPastAge = Duration(24 * time.Hour)
+	assert.Equal(t, expected, config)
+}
+
+func TestLoadWithUnknownKey(t *testing.T) {
+	path := writeTestFile(t, "wirect.yml", "database:\n  dns: typo.db\n")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	_, _, err := Load([]string{"--config", path}, env(nil))
+	assert.Error(t, err)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeTestFile(t, "wirect.yaml", "server:\n  listen_address: \":8080\"\nlog:\n  level: warn\n")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	vars := map[string]string{
+		"WIRECT_CONFIG":                path,
+		"WIRECT_SERVER_LISTEN_ADDRESS": ":9090",
+		"WIRECT_SERVER_CORS_ORIGINS":   "https://a.example.com, https://b.example.com",
+		"WIRECT_LOG_LEVEL":             "error",
+	}
+	args := []string{"--log-level", "debug", "--log-requests=false", "--print-config"}
+
+	config, printConfig, err := Load(args, env(vars))
+	assert.Nil(t, err)
+	assert.True(t, printConfig)
+
+	assert.Equal(t, ":9090", config.Server.ListenAddress)
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com"}, config.Server.CORSOrigins)
+	assert.Equal(t, "debug", config.Log.Level)
+	assert.False(t, config.Log.Requests)
+}
+
+func TestLoadWithInvalidValues(t *testing.T) {
+	invalidArgs := [][]string{
+		{"--crowd-calculation-interval", "soon"},
+		{"--crowd-max-buckets", "0"},
+		{"--validation-mode", "ignore"},
+		{"--validation-min-rssi", "10"},
+		{"--log-level", "verbose"},
+		{"--privacy-mac-redaction", "encrypt"},
+		{"--security-webhook-url", "ftp://example.com"},
+		{"--relocation-jaccard-threshold", "1.5"},
+		{"--relocation-confirmations", "0"},
+		{"--positioning-path-loss-exponent", "0.5"},
+		{"--skew-mode", "drop"},
+		{"--skew-tolerance", "0s"},
+		{"--database-dsn", ""},
+		{"--unknown-flag"},
+		{"--config", "wirect.ini"},
+	}
+
+	for _, args := range invalidArgs {
+		_, _, err := Load(args, env(nil))
+		assert.Error(t, err, "%v", args)
+	}
+
+	_, _, err := Load(nil, env(map[string]string{"WIRECT_CROWD_MAX_BUCKETS": "many"}))
+	assert.Error(t, err)
+}
+
+func TestLoadAuthorizedAccessPoints(t *testing.T) {
+	path := writeTestFile(t, "security.yaml", `
+security:
+  authorized_access_points:
+    - {ssid: eduroam, bssid: "aa-bb-cc-dd-ee-01", security: wpa2-enterprise}
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	config, _, err := Load([]string{"--config", path}, env(nil))
+	assert.Nil(t, err)
+	assert.Equal(t, []AuthorizedAccessPoint{{SSID: "eduroam", BSSID: "aa-bb-cc-dd-ee-01", Security: "wpa2-enterprise"}}, config.Security.AuthorizedAccessPoints)
+
+	path = writeTestFile(t, "security.yaml", `
+security:
+  authorized_access_points:
+    - {ssid: eduroam, bssid: "not a bssid"}
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+	_, _, err = Load([]string{"--config", path}, env(nil))
+	assert.Error(t, err)
+}
+
+func TestYAMLRoundTrip(t *testing.T) {
+	config := Default()
+	config.Crowd.CalculationInterval = Duration(90 * time.Second)
+
+	path := writeTestFile(t, "printed.yaml", config.YAML())
+	defer os.RemoveAll(filepath.Dir(path))
+
+	actual := Default()
+	assert.Nil(t, actual.ReadFile(path))
+	assert.Equal(t, config, actual)
+}
+
+func TestExampleConfigMatchesDefault(t *testing.T) {
+	config, _, err := Load([]string{"--config", "../wirect.example.yaml"}, env(nil))
+	assert.Nil(t, err)
+	assert.Equal(t, Default(), config)
+}
@@ -0,0 +1,215 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+const envPrefix = "WIRECT_"
+
+type setting struct {
+	key   string
+	usage string
+	value flag.Value
+}
+
+// settings lists every setting which can be overridden by an environment variable or a flag
+func (c *Config) settings() []setting {
+	return []setting{
+		{"database.dialect", "database dialect such as sqlite3, mysql, postgres, bolt for the embedded store which does not need cgo or memory for recent data only", (*stringValue)(&c.Database.Dialect)},
+		{"database.dsn", "database connection string, for memory the snapshot file or :memory: for no snapshots", (*stringValue)(&c.Database.DSN)},
+		{"database.query_timeout", "maximum duration of a database query, 0 for no limit", &c.Database.QueryTimeout},
+		{"database.busy_timeout", "time a sqlite query waits for a lock held by another process", &c.Database.BusyTimeout},
+		{"database.read_connections", "number of read-only sqlite connections serving queries concurrently with writes", (*intValue)(&c.Database.ReadConnections)},
+		{"database.checkpoint_interval", "interval of sqlite WAL checkpoints and memory snapshots, 0 to leave them to sqlite and snapshot only on shutdown", &c.Database.CheckpointInterval},
+		{"database.retention", "age after which the memory dialect evicts packets, 0 to keep every packet", &c.Database.Retention},
+		{"server.listen_address", "address the HTTP server listens on", (*stringValue)(&c.Server.ListenAddress)},
+		{"server.cors_origins", "comma separated origins allowed by CORS", (*stringListValue)(&c.Server.CORSOrigins)},
+		{"server.shutdown_timeout", "time to drain requests and background jobs on shutdown", &c.Server.ShutdownTimeout},
+		{"crowd.calculation_interval", "time window a device is counted in the crowd", &c.Crowd.CalculationInterval},
+		{"crowd.max_buckets", "maximum number of crowd calculations in a single request", (*int64Value)(&c.Crowd.MaxBuckets)},
+		{"validation.mode", "reject or clamp out of range values", (*stringValue)(&c.Validation.Mode)},
+		{"validation.min_rssi", "minimum plausible RSSI", (*float64Value)(&c.Validation.MinRSSI)},
+		{"validation.max_rssi", "maximum plausible RSSI", (*float64Value)(&c.Validation.MaxRSSI)},
+		{"validation.max_past_age", "maximum age of a packet timestamp", &c.Validation.MaxPastAge},
+		{"validation.max_future_skew", "maximum distance of a packet timestamp into the future", &c.Validation.MaxFutureSkew},
+		{"validation.max_ssid_length", "maximum SSID length in bytes", (*intValue)(&c.Validation.MaxSSIDLength)},
+		{"skew.mode", "what happens to uploads of sniffers with a skewed clock, one of off, correct or quarantine", (*stringValue)(&c.Skew.Mode)},
+		{"skew.tolerance", "offset of the clock of a sniffer, measured by its synchronizations or by packets stamped in the future, at which it is skewed", &c.Skew.Tolerance},
+		{"log.level", "log level, one of debug, info, warn, error or off", (*stringValue)(&c.Log.Level)},
+		{"log.requests", "log every HTTP request", (*boolValue)(&c.Log.Requests)},
+		{"privacy.mac_redaction", "how MAC addresses appear in logs, one of none, mask or hash", (*stringValue)(&c.Privacy.MACRedaction)},
+		{"privacy.hash_secret", "secret which keys the hashes of MAC addresses, empty for a random secret on every start", (*stringValue)(&c.Privacy.HashSecret)},
+		{"relocation.jaccard_threshold", "Jaccard distance between the routers around a sniffer and its baseline at which they differ", (*float64Value)(&c.Relocation.JaccardThreshold)},
+		{"relocation.rssi_shift", "mean RSSI difference of routers around a sniffer from its baseline at which they differ", (*float64Value)(&c.Relocation.RSSIShift)},
+		{"relocation.confirmations", "number of differing uploads in a row after which a sniffer is possibly relocated", (*intValue)(&c.Relocation.Confirmations)},
+		{"positioning.reference_rssi", "RSSI of a device 1 meter away from a sniffer", (*float64Value)(&c.Positioning.ReferenceRSSI)},
+		{"positioning.path_loss_exponent", "how fast the RSSI falls with the distance, 2 in free space and up to 4 through walls", (*float64Value)(&c.Positioning.PathLossExponent)},
+		{"security.webhook_url", "URL rogue access point events are posted to as JSON, empty to disable", (*stringValue)(&c.Security.WebhookURL)},
+	}
+}
+
+// Load builds the configuration from defaults, a configuration file, environment variables
+// and command line flags where each source overrides the previous ones.
+// It also reports whether --print-config was given.
+func Load(args []string, getenv func(string) string) (Config, bool, error) {
+	flagConfig := Default()
+	fs := flag.NewFlagSet("wirect", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	configPath := fs.String("config", getenv(envPrefix+"CONFIG"), "path of a YAML or TOML configuration file")
+	printConfig := fs.Bool("print-config", false, "print the effective configuration and exit")
+	for _, s := range flagConfig.settings() {
+		fs.Var(s.value, flagName(s.key), s.usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, false, err
+	}
+
+	config := Default()
+	if *configPath != "" {
+		if err := config.ReadFile(*configPath); err != nil {
+			return Config{}, false, fmt.Errorf("reading %s: %v", *configPath, err)
+		}
+	}
+
+	if err := config.applyEnv(getenv); err != nil {
+		return Config{}, false, err
+	}
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		if s, ok := config.setting(f.Name); ok && flagErr == nil {
+			flagErr = s.value.Set(f.Value.String())
+		}
+	})
+	if flagErr != nil {
+		return Config{}, false, flagErr
+	}
+
+	return config, *printConfig, config.Validate()
+}
+
+// Usage returns the description of every flag and its environment variable
+func Usage() string {
+	config := Default()
+	var usage strings.Builder
+	usage.WriteString("  --config string\n\tpath of a YAML or TOML configuration file (" + envPrefix + "CONFIG)\n")
+	usage.WriteString("  --print-config\n\tprint the effective configuration and exit\n")
+	for _, s := range config.settings() {
+		fmt.Fprintf(&usage, "  --%s\n\t%s (%s, default %q)\n", flagName(s.key), s.usage, envName(s.key), s.value.String())
+	}
+	return usage.String()
+}
+
+func (c *Config) applyEnv(getenv func(string) string) error {
+	for _, s := range c.settings() {
+		value := getenv(envName(s.key))
+		if value == "" {
+			continue
+		}
+		if err := s.value.Set(value); err != nil {
+			return fmt.Errorf("%s: %v", envName(s.key), err)
+		}
+	}
+	return nil
+}
+
+func (c *Config) setting(flag string) (setting, bool) {
+	for _, s := range c.settings() {
+		if flagName(s.key) == flag {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+func flagName(key string) string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(key)
+}
+
+func envName(key string) string {
+	return envPrefix + strings.ToUpper(strings.NewReplacer(".", "_").Replace(key))
+}
+
+type stringValue string
+
+func (s *stringValue) Set(value string) error {
+	*s = stringValue(value)
+	return nil
+}
+
+func (s *stringValue) String() string {
+	return string(*s)
+}
+
+type stringListValue []string
+
+func (s *stringListValue) Set(value string) error {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*s = list
+	return nil
+}
+
+func (s *stringListValue) String() string {
+	return strings.Join(*s, ",")
+}
+
+type intValue int
+
+func (i *intValue) Set(value string) error {
+	parsed, err := strconv.Atoi(value)
+	*i = intValue(parsed)
+	return err
+}
+
+func (i *intValue) String() string {
+	return strconv.Itoa(int(*i))
+}
+
+type int64Value int64
+
+func (i *int64Value) Set(value string) error {
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	*i = int64Value(parsed)
+	return err
+}
+
+func (i *int64Value) String() string {
+	return strconv.FormatInt(int64(*i), 10)
+}
+
+type float64Value float64
+
+func (f *float64Value) Set(value string) error {
+	parsed, err := strconv.ParseFloat(value, 64)
+	*f = float64Value(parsed)
+	return err
+}
+
+func (f *float64Value) String() string {
+	return strconv.FormatFloat(float64(*f), 'g', -1, 64)
+}
+
+type boolValue bool
+
+func (b *boolValue) Set(value string) error {
+	parsed, err := strconv.ParseBool(value)
+	*b = boolValue(parsed)
+	return err
+}
+
+func (b *boolValue) String() string {
+	return strconv.FormatBool(bool(*b))
+}
+
+func (b *boolValue) IsBoolFlag() bool {
+	return true
+}
@@ -0,0 +1,566 @@
+package database
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/cyucelen/wirect/model"
+	"github.com/labstack/gommon/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltDialect selects the embedded pure-Go backend which does not need cgo
+const BoltDialect = "bolt"
+
+var (
+	packetsBucket      = []byte("packets")
+	sniffersBucket     = []byte("sniffers")
+	routersBucket      = []byte("routers")
+	sightingsBucket    = []byte("sightings")
+	fingerprintsBucket = []byte("fingerprints")
+	sequencesBucket    = []byte("sequences")
+)
+
+// errSnifferExists is returned when a sniffer is created with the MAC of an existing one
+var errSnifferExists = errors.New("sniffer already exists")
+
+// contextCheckInterval is the number of keys scanned between checks of the context
+const contextCheckInterval = 1024
+
+// BoltDatabase stores packets in bbolt keyed by sniffer and timestamp so time ranges are sequential scans.
+// Packets of a sniffer are in their own bucket under packets, keyed by timestamp and ID.
+// Routers are in a bucket per sniffer under routers keyed by access point, sniffers are under sniffers keyed by MAC.
+// Router sightings are in a bucket per sniffer under sightings keyed like packets, fingerprints are under fingerprints keyed by MAC.
+// Single packets sent at the same time are written in a shared transaction so they share a sync to the disk.
+type BoltDatabase struct {
+	DB *bolt.DB
+	// QueryTimeout bounds every query in addition to the deadline of its context, zero means no bound
+	QueryTimeout time.Duration
+	// Retention is the age after which packets and router sightings are deleted by Checkpoint and left out of reads,
+	// zero keeps everything
+	Retention time.Duration
+	now       func() time.Time
+	logger    Logger
+}
+
+// boltPacket is the value of a packet, its timestamp, ID and sniffer are in its key and bucket
+type boltPacket struct {
+	MAC               string  `json:"m"`
+	RSSI              float64 `json:"r"`
+	OriginalTimestamp int64   `json:"o,omitempty"`
+}
+
+// NewBolt opens or creates the bbolt database file at path
+func NewBolt(path string, opts ...Option) (*BoltDatabase, error) {
+	o := newOptions(opts)
+
+	if _, err := os.Stat(filepath.Dir(path)); os.IsNotExist(err) {
+		if err := mkdirAllFunc(filepath.Dir(path), 0777); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: o.busyTimeout})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{packetsBucket, sniffersBucket, routersBucket, sightingsBucket, fingerprintsBucket, sequencesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return migrateBoltRouters(tx)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltDatabase{DB: db, QueryTimeout: o.queryTimeout, Retention: o.retention, now: time.Now}, nil
+}
+
+// Close closes the database file
+func (b *BoltDatabase) Close() error {
+	return b.DB.Close()
+}
+
+// SetLogger writes failed transactions to logger
+func (b *BoltDatabase) SetLogger(logger Logger) {
+	b.logger = logger
+}
+
+// Checkpoint deletes the packets and router sightings which are older than the retention window
+func (b *BoltDatabase) Checkpoint(ctx context.Context) error {
+	if b.Retention <= 0 {
+		return ctx.Err()
+	}
+
+	oldest := b.oldest()
+	return b.update(ctx, func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{packetsBucket, sightingsBucket} {
+			parent := tx.Bucket(name)
+			err := parent.ForEach(func(snifferMAC, _ []byte) error {
+				evicted, err := evictBefore(ctx, parent.Bucket(snifferMAC), oldest)
+				if evicted > 0 && b.logger != nil && b.logger.Level() == log.DEBUG {
+					b.logger.Debugj(log.JSON{"component": "database", "message": string(name) + " evicted", "sniffer": string(snifferMAC), "count": evicted})
+				}
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// evictBefore deletes the values of a bucket keyed by packetKey which are older than oldest, keys are collected first
+// since deleting moves the cursor
+func evictBefore(ctx context.Context, bucket *bolt.Bucket, oldest int64) (int, error) {
+	expired := [][]byte{}
+	cursor := bucket.Cursor()
+	for key, _ := cursor.First(); key != nil; key, _ = cursor.Next() {
+		if timestamp, _ := parsePacketKey(key); timestamp >= oldest {
+			break
+		}
+		expired = append(expired, key)
+		if len(expired)%contextCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	for _, key := range expired {
+		if err := bucket.Delete(key); err != nil {
+			return 0, err
+		}
+	}
+	return len(expired), nil
+}
+
+// oldest returns the timestamp of the oldest packets and router sightings within the retention window
+func (b *BoltDatabase) oldest() int64 {
+	if b.Retention <= 0 {
+		return minTimestamp
+	}
+	return b.now().Add(-b.Retention).Unix()
+}
+
+// since moves from to the start of the retention window, so packets which were not deleted yet are not read
+func (b *BoltDatabase) since(from int64) int64 {
+	if oldest := b.oldest(); from < oldest {
+		return oldest
+	}
+	return from
+}
+
+func (b *BoltDatabase) CreatePacket(ctx context.Context, packet *model.Packet) error {
+	return b.batch(ctx, func(tx *bolt.Tx) error {
+		return putPacket(tx, packet)
+	})
+}
+
+func (b *BoltDatabase) CreatePackets(ctx context.Context, packets []model.Packet) error {
+	return b.update(ctx, func(tx *bolt.Tx) error {
+		for i := range packets {
+			if err := putPacket(tx, &packets[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *BoltDatabase) CreatePacketBatch(ctx context.Context, packets []model.Packet, sequence *model.SnifferSequence) error {
+	return b.update(ctx, func(tx *bolt.Tx) error {
+		for i := range packets {
+			if err := putPacket(tx, &packets[i]); err != nil {
+				return err
+			}
+		}
+		return putJSON(tx.Bucket(sequencesBucket), []byte(sequence.SnifferMAC), sequence)
+	})
+}
+
+func (b *BoltDatabase) GetSnifferSequence(ctx context.Context, snifferMAC string) (model.SnifferSequence, error) {
+	sequence := model.SnifferSequence{SnifferMAC: snifferMAC}
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		value := tx.Bucket(sequencesBucket).Get([]byte(snifferMAC))
+		if value == nil {
+			return nil
+		}
+		return json.Unmarshal(value, &sequence)
+	})
+	return sequence, err
+}
+
+// putPacket stores the packet in the bucket of its sniffer and assigns its ID
+func putPacket(tx *bolt.Tx, packet *model.Packet) error {
+	packets := tx.Bucket(packetsBucket)
+	bucket, err := packets.CreateBucketIfNotExists([]byte(packet.SnifferMAC))
+	if err != nil {
+		return err
+	}
+
+	id, err := packets.NextSequence()
+	if err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(boltPacket{MAC: packet.MAC, RSSI: packet.RSSI, OriginalTimestamp: packet.OriginalTimestamp})
+	if err != nil {
+		return err
+	}
+	if err := bucket.Put(packetKey(packet.Timestamp, id), value); err != nil {
+		return err
+	}
+
+	packet.ID = uint(id)
+	return nil
+}
+
+func (b *BoltDatabase) GetPacketsBySniffer(ctx context.Context, snifferMAC string) ([]model.Packet, error) {
+	return b.packetsBetween(ctx, snifferMAC, minTimestamp, maxTimestamp)
+}
+
+func (b *BoltDatabase) GetPacketsBySnifferSince(ctx context.Context, snifferMAC string, since int64) ([]model.Packet, error) {
+	return b.packetsBetween(ctx, snifferMAC, since, maxTimestamp)
+}
+
+func (b *BoltDatabase) GetPacketsBySnifferBetweenDates(ctx context.Context, snifferMAC string, from, until int64) ([]model.Packet, error) {
+	return b.packetsBetween(ctx, snifferMAC, from, until)
+}
+
+func (b *BoltDatabase) GetUniqueMACCountBySnifferBetweenDates(ctx context.Context, snifferMAC string, from, until int64) (int, error) {
+	uniqueMACs := map[string]bool{}
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		return scanPackets(ctx, tx, snifferMAC, b.since(from), until, func(timestamp int64, id uint64, packet boltPacket) {
+			uniqueMACs[packet.MAC] = true
+		})
+	})
+	return len(uniqueMACs), err
+}
+
+func (b *BoltDatabase) GetUniqueMACCountsBetweenDates(ctx context.Context, from, until int64) (map[string]int, error) {
+	counts := map[string]int{}
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		return tx.Bucket(packetsBucket).ForEach(func(snifferMAC, _ []byte) error {
+			uniqueMACs := map[string]bool{}
+			err := scanPackets(ctx, tx, string(snifferMAC), b.since(from), until, func(timestamp int64, id uint64, packet boltPacket) {
+				uniqueMACs[packet.MAC] = true
+			})
+			if len(uniqueMACs) > 0 {
+				counts[string(snifferMAC)] = len(uniqueMACs)
+			}
+			return err
+		})
+	})
+	return counts, err
+}
+
+func (b *BoltDatabase) GetLastSeenOfSniffersBetweenDates(ctx context.Context, from, until int64) (map[string]int64, error) {
+	from = b.since(from)
+	lastSeen := map[string]int64{}
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		return tx.Bucket(packetsBucket).ForEach(func(snifferMAC, _ []byte) error {
+			cursor := tx.Bucket(packetsBucket).Bucket(snifferMAC).Cursor()
+			// the latest packet is the one before the first key after until
+			key, _ := cursor.Seek(packetKey(until, math.MaxUint64))
+			if key == nil {
+				key, _ = cursor.Last()
+			} else if timestamp, _ := parsePacketKey(key); timestamp > until {
+				key, _ = cursor.Prev()
+			}
+			if key == nil {
+				return nil
+			}
+			if timestamp, _ := parsePacketKey(key); timestamp >= from {
+				lastSeen[string(snifferMAC)] = timestamp
+			}
+			return nil
+		})
+	})
+	return lastSeen, err
+}
+
+func (b *BoltDatabase) CreateSniffer(ctx context.Context, sniffer *model.Sniffer) error {
+	return b.update(ctx, func(tx *bolt.Tx) error {
+		sniffers := tx.Bucket(sniffersBucket)
+		if sniffers.Get([]byte(sniffer.MAC)) != nil {
+			return errSnifferExists
+		}
+		return putJSON(sniffers, []byte(sniffer.MAC), sniffer)
+	})
+}
+
+func (b *BoltDatabase) GetSniffers(ctx context.Context) ([]model.Sniffer, error) {
+	sniffers := []model.Sniffer{}
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		return tx.Bucket(sniffersBucket).ForEach(func(mac, value []byte) error {
+			var sniffer model.Sniffer
+			if err := json.Unmarshal(value, &sniffer); err != nil {
+				return err
+			}
+			sniffers = append(sniffers, sniffer)
+			return nil
+		})
+	})
+	return sniffers, err
+}
+
+func (b *BoltDatabase) UpdateSniffer(ctx context.Context, sniffer *model.Sniffer) error {
+	return b.update(ctx, func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(sniffersBucket), []byte(sniffer.MAC), sniffer)
+	})
+}
+
+func (b *BoltDatabase) CreateRouter(ctx context.Context, router *model.Router) error {
+	return b.update(ctx, func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(routersBucket).CreateBucketIfNotExists([]byte(router.SnifferMAC))
+		if err != nil {
+			return err
+		}
+		router.AccessPoint = model.RouterAccessPoint(router.SSID, router.BSSID)
+		return putJSON(bucket, []byte(router.AccessPoint), router)
+	})
+}
+
+// migrateBoltRouters moves routers which were keyed by SSID to the key of their access point
+func migrateBoltRouters(tx *bolt.Tx) error {
+	return tx.Bucket(routersBucket).ForEach(func(snifferMAC, _ []byte) error {
+		bucket := tx.Bucket(routersBucket).Bucket(snifferMAC)
+		var keyedBySSID []model.Router
+		err := bucket.ForEach(func(key, value []byte) error {
+			var router model.Router
+			if err := json.Unmarshal(value, &router); err != nil {
+				return err
+			}
+			if router.AccessPoint == "" {
+				keyedBySSID = append(keyedBySSID, router)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, router := range keyedBySSID {
+			if err := bucket.Delete([]byte(router.SSID)); err != nil {
+				return err
+			}
+			router.AccessPoint = model.RouterAccessPoint(router.SSID, router.BSSID)
+			if err := putJSON(bucket, []byte(router.AccessPoint), &router); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *BoltDatabase) GetRoutersBySniffer(ctx context.Context, snifferMAC string) ([]model.Router, error) {
+	routers := []model.Router{}
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(routersBucket).Bucket([]byte(snifferMAC))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(accessPoint, value []byte) error {
+			var router model.Router
+			if err := json.Unmarshal(value, &router); err != nil {
+				return err
+			}
+			routers = append(routers, router)
+			return nil
+		})
+	})
+
+	// routers are scanned in the order of access point, so equal LastSeen keeps them ordered by access point
+	sort.SliceStable(routers, func(i, j int) bool {
+		return routers[i].LastSeen > routers[j].LastSeen
+	})
+	return routers, err
+}
+
+func (b *BoltDatabase) CreateRouterSighting(ctx context.Context, sighting *model.RouterSighting) error {
+	return b.update(ctx, func(tx *bolt.Tx) error {
+		sightings := tx.Bucket(sightingsBucket)
+		bucket, err := sightings.CreateBucketIfNotExists([]byte(sighting.SnifferMAC))
+		if err != nil {
+			return err
+		}
+
+		id, err := sightings.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		sighting.ID = uint(id)
+		if err := putJSON(bucket, packetKey(sighting.Timestamp, id), sighting); err != nil {
+			sighting.ID = 0
+			return err
+		}
+		return nil
+	})
+}
+
+func (b *BoltDatabase) GetRouterSightingsBySnifferBetweenDates(ctx context.Context, snifferMAC string, from, until int64) ([]model.RouterSighting, error) {
+	sightings := []model.RouterSighting{}
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		return scanRange(ctx, tx.Bucket(sightingsBucket).Bucket([]byte(snifferMAC)), b.since(from), until, func(timestamp int64, id uint64, value []byte) error {
+			var sighting model.RouterSighting
+			if err := json.Unmarshal(value, &sighting); err != nil {
+				return err
+			}
+			sightings = append(sightings, sighting)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sightings, nil
+}
+
+func (b *BoltDatabase) GetSnifferFingerprint(ctx context.Context, snifferMAC string) (model.SnifferFingerprint, error) {
+	fingerprint := model.SnifferFingerprint{SnifferMAC: snifferMAC}
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		value := tx.Bucket(fingerprintsBucket).Get([]byte(snifferMAC))
+		if value == nil {
+			return nil
+		}
+		return json.Unmarshal(value, &fingerprint)
+	})
+	return fingerprint, err
+}
+
+func (b *BoltDatabase) UpdateSnifferFingerprint(ctx context.Context, fingerprint *model.SnifferFingerprint) error {
+	return b.update(ctx, func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(fingerprintsBucket), []byte(fingerprint.SnifferMAC), fingerprint)
+	})
+}
+
+func (b *BoltDatabase) packetsBetween(ctx context.Context, snifferMAC string, from, until int64) ([]model.Packet, error) {
+	packets := []model.Packet{}
+	err := b.view(ctx, func(tx *bolt.Tx) error {
+		return scanPackets(ctx, tx, snifferMAC, b.since(from), until, func(timestamp int64, id uint64, packet boltPacket) {
+			packets = append(packets, model.Packet{
+				ID:                uint(id),
+				MAC:               packet.MAC,
+				Timestamp:         timestamp,
+				RSSI:              packet.RSSI,
+				OriginalTimestamp: packet.OriginalTimestamp,
+				SnifferMAC:        snifferMAC,
+			})
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return packets, nil
+}
+
+// scanPackets calls found for every packet of the sniffer from until until, both inclusive, in the order of time
+func scanPackets(ctx context.Context, tx *bolt.Tx, snifferMAC string, from, until int64, found func(int64, uint64, boltPacket)) error {
+	return scanRange(ctx, tx.Bucket(packetsBucket).Bucket([]byte(snifferMAC)), from, until, func(timestamp int64, id uint64, value []byte) error {
+		var packet boltPacket
+		if err := json.Unmarshal(value, &packet); err != nil {
+			return err
+		}
+		found(timestamp, id, packet)
+		return nil
+	})
+}
+
+// scanRange calls found for every value of a bucket keyed by packetKey from until until, both inclusive, in the order of time
+func scanRange(ctx context.Context, bucket *bolt.Bucket, from, until int64, found func(int64, uint64, []byte) error) error {
+	if bucket == nil {
+		return nil
+	}
+
+	cursor := bucket.Cursor()
+	scanned := 0
+	for key, value := cursor.Seek(packetKey(from, 0)); key != nil; key, value = cursor.Next() {
+		timestamp, id := parsePacketKey(key)
+		if timestamp > until {
+			break
+		}
+
+		if scanned++; scanned%contextCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+
+		if err := found(timestamp, id, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *BoltDatabase) view(ctx context.Context, query func(tx *bolt.Tx) error) error {
+	return b.run(ctx, b.DB.View, query)
+}
+
+func (b *BoltDatabase) update(ctx context.Context, query func(tx *bolt.Tx) error) error {
+	return b.run(ctx, b.DB.Update, query)
+}
+
+// batch runs query in a transaction shared with the queries of other goroutines, query may run more than once
+// if another query of the transaction fails
+func (b *BoltDatabase) batch(ctx context.Context, query func(tx *bolt.Tx) error) error {
+	return b.run(ctx, b.DB.Batch, query)
+}
+
+// run executes query in a transaction unless ctx is done or the query timeout passes before it starts,
+// bbolt transactions cannot be interrupted so long scans check ctx themselves
+func (b *BoltDatabase) run(ctx context.Context, transaction func(func(*bolt.Tx) error) error, query func(tx *bolt.Tx) error) error {
+	if b.QueryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.QueryTimeout)
+		defer cancel()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	err := transaction(query)
+	if err != nil && ctx.Err() == nil && err != errSnifferExists && b.logger != nil {
+		b.logger.Errorj(log.JSON{"component": "database", "message": "transaction failed", "error": err.Error()})
+	}
+	return err
+}
+
+const minTimestamp = int64(-1 << 63)
+const maxTimestamp = int64(1<<63 - 1)
+
+// packetKey orders packets by timestamp, the sign bit is flipped so negative timestamps sort first,
+// the ID keeps packets sniffed in the same second apart
+func packetKey(timestamp int64, id uint64) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key, uint64(timestamp)^(1<<63))
+	binary.BigEndian.PutUint64(key[8:], id)
+	return key
+}
+
+func parsePacketKey(key []byte) (int64, uint64) {
+	return int64(binary.BigEndian.Uint64(key) ^ (1 << 63)), binary.BigEndian.Uint64(key[8:])
+}
+
+func putJSON(bucket *bolt.Bucket, key []byte, value interface{}) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, encoded)
+}
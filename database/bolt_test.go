@@ -0,0 +1,114 @@
+package database
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cyucelen/wirect/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	bolt "go.etcd.io/bbolt"
+)
+
+type BoltSuite struct {
+	suite.Suite
+	db   *BoltDatabase
+	path string
+}
+
+func TestBoltSuite(t *testing.T) {
+	suite.Run(t, new(BoltSuite))
+}
+
+func (s *BoltSuite) BeforeTest(suiteName, testName string) {
+	s.path = filepath.Join(os.TempDir(), "wirect-bolt-test", testName+".db")
+	os.RemoveAll(filepath.Dir(s.path))
+	os.MkdirAll(filepath.Dir(s.path), 0777)
+
+	db, err := Open(BoltDialect, s.path)
+	assert.Nil(s.T(), err)
+	s.db = db.(*BoltDatabase)
+}
+
+func (s *BoltSuite) AfterTest(suiteName, testName string) {
+	s.db.Close()
+	os.RemoveAll(filepath.Dir(s.path))
+}
+
+func (s *BoltSuite) TestNegativeTimestampsSortFirst() {
+	ctx := context.Background()
+	snifferMAC := "01:02:03:04:05:06"
+	for _, timestamp := range []int64{5, -5, 0} {
+		s.db.CreatePacket(ctx, &model.Packet{MAC: "AA:BB:22:11:44:55", Timestamp: timestamp, SnifferMAC: snifferMAC})
+	}
+
+	packets, err := s.db.GetPacketsBySnifferBetweenDates(ctx, snifferMAC, -5, 0)
+	assert.Nil(s.T(), err)
+	if assert.Len(s.T(), packets, 2) {
+		assert.Equal(s.T(), int64(-5), packets[0].Timestamp)
+		assert.Equal(s.T(), int64(0), packets[1].Timestamp)
+	}
+}
+
+func (s *BoltSuite) TestDataSurvivesReopening() {
+	ctx := context.Background()
+	s.db.CreateSniffer(ctx, &model.Sniffer{MAC: "11:22:33:44:55:66"})
+	s.db.Close()
+
+	db, err := NewBolt(s.path)
+	assert.Nil(s.T(), err)
+	s.db = db
+
+	sniffers, err := s.db.GetSniffers(ctx)
+	assert.Nil(s.T(), err)
+	assert.Len(s.T(), sniffers, 1)
+}
+
+func (s *BoltSuite) TestRoutersKeyedBySSIDAreMigrated() {
+	ctx := context.Background()
+	snifferMAC := "01:02:03:04:05:06"
+	s.db.DB.Update(func(tx *bolt.Tx) error {
+		bucket, _ := tx.Bucket(routersBucket).CreateBucketIfNotExists([]byte(snifferMAC))
+		return putJSON(bucket, []byte("eduroam"), model.Router{SSID: "eduroam", SnifferMAC: snifferMAC, LastSeen: 100, BSSID: "AA:AA:AA:AA:AA:01"})
+	})
+	s.db.Close()
+
+	db, err := NewBolt(s.path)
+	assert.Nil(s.T(), err)
+	s.db = db
+
+	s.db.CreateRouter(ctx, &model.Router{SSID: "eduroam", SnifferMAC: snifferMAC, LastSeen: 200, BSSID: "AA:AA:AA:AA:AA:01"})
+	routers, err := s.db.GetRoutersBySniffer(ctx, snifferMAC)
+	assert.Nil(s.T(), err)
+	if assert.Len(s.T(), routers, 1) {
+		assert.Equal(s.T(), int64(200), routers[0].LastSeen)
+	}
+}
+
+func (s *BoltSuite) TestPacketsOlderThanRetentionAreEvicted() {
+	ctx := context.Background()
+	now := time.Unix(1560000000, 0)
+	s.db.Retention = time.Hour
+	s.db.now = func() time.Time { return now }
+
+	snifferMAC := "01:02:03:04:05:06"
+	s.db.CreatePacket(ctx, &model.Packet{MAC: "AA:BB:22:11:44:55", Timestamp: now.Add(-2 * time.Hour).Unix(), SnifferMAC: snifferMAC})
+	s.db.CreatePacket(ctx, &model.Packet{MAC: "CC:BB:FA:AE:FC:6C", Timestamp: now.Add(-10 * time.Minute).Unix(), SnifferMAC: snifferMAC})
+	s.db.CreateRouterSighting(ctx, &model.RouterSighting{SSID: "2020", SnifferMAC: snifferMAC, Timestamp: now.Add(-2 * time.Hour).Unix()})
+
+	// expired packets are not read even before a checkpoint deletes them
+	packets, _ := s.db.GetPacketsBySniffer(ctx, snifferMAC)
+	assert.Len(s.T(), packets, 1)
+	sightings, _ := s.db.GetRouterSightingsBySnifferBetweenDates(ctx, snifferMAC, 0, now.Unix())
+	assert.Empty(s.T(), sightings)
+
+	assert.Nil(s.T(), s.db.Checkpoint(ctx))
+	s.db.Retention = 0
+	packets, _ = s.db.GetPacketsBySniffer(ctx, snifferMAC)
+	assert.Len(s.T(), packets, 1)
+	sightings, _ = s.db.GetRouterSightingsBySnifferBetweenDates(ctx, snifferMAC, 0, now.Unix())
+	assert.Empty(s.T(), sightings)
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cyucelen/wirect/test/conformance"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGormConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) (conformance.Database, func()) {
+		dir, err := ioutil.TempDir("", "wirect-gorm-conformance")
+		require.Nil(t, err)
+
+		db, err := New("sqlite3", filepath.Join(dir, "test.db"))
+		require.Nil(t, err)
+		return db, func() {
+			db.Close()
+			os.RemoveAll(dir)
+		}
+	})
+}
+
+func TestBoltConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) (conformance.Database, func()) {
+		dir, err := ioutil.TempDir("", "wirect-bolt-conformance")
+		require.Nil(t, err)
+
+		db, err := NewBolt(filepath.Join(dir, "test.db"))
+		require.Nil(t, err)
+		return db, func() {
+			db.Close()
+			os.RemoveAll(dir)
+		}
+	})
+}
+
+func TestMemoryConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) (conformance.Database, func()) {
+		db, err := NewMemory(memoryWithoutSnapshots)
+		require.Nil(t, err)
+		return db, nil
+	})
+}
@@ -1,9 +1,14 @@
 package database
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/cyucelen/wirect/api"
 	"github.com/cyucelen/wirect/model"
 	"github.com/jinzhu/gorm"
 )
@@ -12,34 +17,219 @@ var mkdirAllFunc = os.MkdirAll
 
 // GormDatabase is a wrapper for the gorm framework
 type GormDatabase struct {
+	// DB is the connection every write goes through, for sqlite it is a single connection
 	DB *gorm.DB
+	// QueryTimeout bounds every query in addition to the deadline of its context, zero means no bound
+	QueryTimeout time.Duration
+	// reader is a pool of read-only connections which serves queries concurrently with writes
+	reader *gorm.DB
+	// logger writes the queries of requests with their log fields, nil until SetLogger
+	logger Logger
 }
 
-// New creates a new wrapper for the gorm database framework
-func New(dialect, connection string) (*GormDatabase, error) {
+// Store is implemented by every database backend the server can run on
+type Store interface {
+	api.PacketDatabase
+	api.SnifferDatabase
+	api.RouterDatabase
+	api.SequenceDatabase
+	SetLogger(logger Logger)
+	Close() error
+}
+
+// Checkpointer is implemented by backends which need periodic maintenance such as checkpoints of their write-ahead log
+type Checkpointer interface {
+	Checkpoint(ctx context.Context) error
+}
+
+type options struct {
+	busyTimeout     time.Duration
+	readConnections int
+	queryTimeout    time.Duration
+	retention       time.Duration
+}
+
+type Option func(*options)
+
+func newOptions(opts []Option) *options {
+	o := &options{busyTimeout: defaultBusyTimeout, readConnections: defaultReadConnections}
+	for i := range opts {
+		opts[i](o)
+	}
+	return o
+}
+
+const defaultBusyTimeout = 5 * time.Second
+const defaultReadConnections = 4
+
+// Open creates the backend of dialect which is either BoltDialect, MemoryDialect or a dialect of gorm
+func Open(dialect, connection string, opts ...Option) (Store, error) {
+	switch dialect {
+	case BoltDialect:
+		return NewBolt(connection, opts...)
+	case MemoryDialect:
+		return NewMemory(connection, opts...)
+	}
+	return New(dialect, connection, opts...)
+}
+
+// New creates a new wrapper for the gorm database framework.
+// SQLite databases are opened in WAL mode with a single writer connection and a pool of read-only connections.
+func New(dialect, connection string, opts ...Option) (*GormDatabase, error) {
+	o := newOptions(opts)
+
+	if dialect != "sqlite3" {
+		db, err := gorm.Open(dialect, connection)
+		if err != nil {
+			return nil, err
+		}
+		if err := migrateRouters(db); err != nil {
+			db.Close()
+			return nil, err
+		}
+		db.AutoMigrate(&model.Packet{}, &model.Router{}, &model.RouterSighting{}, &model.Sniffer{}, &model.SnifferFingerprint{}, &model.SnifferSequence{})
+		return &GormDatabase{DB: db, QueryTimeout: o.queryTimeout, reader: db}, nil
+	}
+
 	createDirectoryIfSqlite(dialect, connection)
-	db, err := gorm.Open(dialect, connection)
+	writer, err := gorm.Open(dialect, sqliteDSN(connection, o.busyTimeout, false))
+	if err != nil {
+		return nil, err
+	}
+	writer.DB().SetMaxOpenConns(1) // sqlite cannot handle concurrent writes
+	if err := migrateRouters(writer); err != nil {
+		writer.Close()
+		return nil, err
+	}
+	writer.AutoMigrate(&model.Packet{}, &model.Router{}, &model.RouterSighting{}, &model.Sniffer{}, &model.SnifferFingerprint{}, &model.SnifferSequence{})
+
+	if isSqliteInMemory(connection) {
+		// every connection to an in-memory database sees a different database
+		return &GormDatabase{DB: writer, QueryTimeout: o.queryTimeout, reader: writer}, nil
+	}
+
+	reader, err := gorm.Open(dialect, sqliteDSN(connection, o.busyTimeout, true))
 	if err != nil {
+		writer.Close()
 		return nil, err
 	}
+	reader.DB().SetMaxOpenConns(o.readConnections)
+	reader.DB().SetMaxIdleConns(o.readConnections)
+
+	return &GormDatabase{DB: writer, QueryTimeout: o.queryTimeout, reader: reader}, nil
+}
+
+// Close closes the database connections
+func (d *GormDatabase) Close() error {
+	var readerErr error
+	if d.reader != nil && d.reader != d.DB {
+		readerErr = d.reader.Close()
+	}
+	if err := d.DB.Close(); err != nil {
+		return err
+	}
+	return readerErr
+}
+
+// Checkpoint moves the content of the SQLite write-ahead log into the database file and truncates the log
+func (d *GormDatabase) Checkpoint(ctx context.Context) error {
+	if d.DB.Dialect().GetName() != "sqlite3" {
+		return nil
+	}
+	return d.write(ctx, func(tx *gorm.DB) error {
+		return tx.Exec("PRAGMA wal_checkpoint(TRUNCATE)").Error
+	})
+}
+
+// read executes query on the read-only connections
+func (d *GormDatabase) read(ctx context.Context, query func(tx *gorm.DB) error) error {
+	return d.run(ctx, d.reader, query)
+}
+
+// write executes query on the writer connection
+func (d *GormDatabase) write(ctx context.Context, query func(tx *gorm.DB) error) error {
+	return d.run(ctx, d.DB, query)
+}
+
+// run executes query in a transaction which is rolled back as soon as ctx is done or the query timeout passes
+func (d *GormDatabase) run(ctx context.Context, db *gorm.DB, query func(tx *gorm.DB) error) error {
+	if d.QueryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.QueryTimeout)
+		defer cancel()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	tx := d.withLogFields(ctx, db).BeginTx(ctx, nil)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if err := query(tx); err != nil {
+		tx.Rollback()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	if err := tx.Commit().Error; err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
 
-	db.DB().SetMaxOpenConns(1) // sqlite cannot handle concurrent writes
-	db.AutoMigrate(&model.Packet{}, &model.Router{}, &model.Sniffer{})
+// sqliteDSN adds the WAL journal mode and the busy timeout to the connection string of a sqlite database
+func sqliteDSN(connection string, busyTimeout time.Duration, queryOnly bool) string {
+	params := fmt.Sprintf("_journal_mode=WAL&_busy_timeout=%d", busyTimeout/time.Millisecond)
+	if queryOnly {
+		params += "&_query_only=true"
+	}
 
-	return &GormDatabase{DB: db}, nil
+	if strings.Contains(connection, "?") {
+		return connection + "&" + params
+	}
+	return connection + "?" + params
 }
 
-// Close closes the database connection
-func (d *GormDatabase) Close() {
-	d.DB.Close()
+func isSqliteInMemory(connection string) bool {
+	return strings.HasPrefix(connection, ":memory:") || strings.Contains(connection, "mode=memory")
 }
 
 func createDirectoryIfSqlite(dialect string, connection string) {
-	if dialect == "sqlite3" {
-		if _, err := os.Stat(filepath.Dir(connection)); os.IsNotExist(err) {
-			if err := mkdirAllFunc(filepath.Dir(connection), 0777); err != nil {
+	if dialect == "sqlite3" && !isSqliteInMemory(connection) {
+		path := strings.TrimPrefix(strings.SplitN(connection, "?", 2)[0], "file:")
+		if _, err := os.Stat(filepath.Dir(path)); os.IsNotExist(err) {
+			if err := mkdirAllFunc(filepath.Dir(path), 0777); err != nil {
 				panic(err)
 			}
 		}
 	}
 }
+
+func SetBusyTimeout(busyTimeout time.Duration) Option {
+	return func(o *options) {
+		o.busyTimeout = busyTimeout
+	}
+}
+
+func SetQueryTimeout(queryTimeout time.Duration) Option {
+	return func(o *options) {
+		o.queryTimeout = queryTimeout
+	}
+}
+
+func SetReadConnections(readConnections int) Option {
+	return func(o *options) {
+		o.readConnections = readConnections
+	}
+}
+
+func SetRetention(retention time.Duration) Option {
+	return func(o *options) {
+		o.retention = retention
+	}
+}
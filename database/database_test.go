@@ -1,11 +1,15 @@
 package database
 
 import (
+	"context"
 	"errors"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/cyucelen/wirect/model"
+	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
 
 	"github.com/stretchr/testify/assert"
@@ -56,3 +60,85 @@ func TestMkdirError(t *testing.T) {
 
 	assert.Panics(t, createNewDBFunc)
 }
+
+func (s *DatabaseSuite) TestQueriesStopWhenContextIsDone() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := s.db.GetSniffers(ctx)
+	assert.Equal(s.T(), context.Canceled, err)
+
+	s.db.QueryTimeout = time.Nanosecond
+	_, err = s.db.GetPacketsBySniffer(context.Background(), "00:00:00:00:00:00")
+	assert.Equal(s.T(), context.DeadlineExceeded, err)
+}
+
+func (s *DatabaseSuite) TestSqliteRunsInWALMode() {
+	var journalMode string
+	s.db.DB.Raw("PRAGMA journal_mode").Row().Scan(&journalMode)
+	assert.Equal(s.T(), "wal", journalMode)
+
+	assert.Nil(s.T(), s.db.Checkpoint(context.Background()))
+}
+
+func (s *DatabaseSuite) TestReadersDoNotWaitForWriter() {
+	tx := s.db.DB.Begin()
+	assert.Nil(s.T(), tx.Create(&model.Sniffer{MAC: "00:00:00:00:00:00"}).Error)
+
+	// the writer connection is held by the transaction, reads must still be served
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	sniffers, err := s.db.GetSniffers(ctx)
+	assert.Nil(s.T(), err)
+	assert.Empty(s.T(), sniffers)
+
+	assert.Nil(s.T(), tx.Commit().Error)
+	sniffers, err = s.db.GetSniffers(ctx)
+	assert.Nil(s.T(), err)
+	assert.Len(s.T(), sniffers, 1)
+}
+
+func (s *DatabaseSuite) TestReadersAreReadOnly() {
+	err := s.db.read(context.Background(), func(tx *gorm.DB) error {
+		return tx.Create(&model.Sniffer{MAC: "00:00:00:00:00:00"}).Error
+	})
+	assert.Error(s.T(), err)
+}
+
+func TestInMemorySqlite(t *testing.T) {
+	db, err := New("sqlite3", ":memory:")
+	assert.Nil(t, err)
+	defer db.Close()
+
+	assert.Nil(t, db.CreateSniffer(context.Background(), &model.Sniffer{MAC: "00:00:00:00:00:00"}))
+	sniffers, err := db.GetSniffers(context.Background())
+	assert.Nil(t, err)
+	assert.Len(t, sniffers, 1)
+}
+
+func TestRoutersKeyedBySSIDAreMigrated(t *testing.T) {
+	path := "./testDBs/routers.db"
+	defer os.RemoveAll(filepath.Dir(path))
+	os.MkdirAll(filepath.Dir(path), 0777)
+
+	old, err := gorm.Open("sqlite3", path)
+	assert.Nil(t, err)
+	assert.Nil(t, old.Exec(`CREATE TABLE routers (ss_id varchar(255), sniffer_mac varchar(255), last_seen bigint, bss_id varchar(255),
+		channel integer, band varchar(255), security varchar(255), rssi real, PRIMARY KEY (ss_id, sniffer_mac))`).Error)
+	assert.Nil(t, old.Exec(`INSERT INTO routers (ss_id, sniffer_mac, last_seen, bss_id) VALUES ('eduroam', '00:00:00:00:00:00', 100, 'AA:AA:AA:AA:AA:01'), ('1010', '00:00:00:00:00:00', 50, '')`).Error)
+	old.Close()
+
+	db, err := New("sqlite3", path)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	assert.Nil(t, db.CreateRouter(ctx, &model.Router{SSID: "eduroam", SnifferMAC: "00:00:00:00:00:00", LastSeen: 200, BSSID: "AA:AA:AA:AA:AA:02"}))
+	routers, err := db.GetRoutersBySniffer(ctx, "00:00:00:00:00:00")
+	assert.Nil(t, err)
+	if assert.Len(t, routers, 3) {
+		assert.Equal(t, "AA:AA:AA:AA:AA:02", routers[0].AccessPoint)
+		assert.Equal(t, "AA:AA:AA:AA:AA:01", routers[1].AccessPoint)
+		assert.Equal(t, "1010", routers[2].AccessPoint)
+	}
+}
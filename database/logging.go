@@ -0,0 +1,102 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/gommon/log"
+)
+
+// Logger writes structured log lines, it is satisfied by the echo logger
+type Logger interface {
+	Level() log.Lvl
+	Debugj(j log.JSON)
+	Errorj(j log.JSON)
+}
+
+// SetLogger writes the errors of the database and, on debug level, every query to logger.
+// Query arguments are never logged since they contain MAC addresses.
+func (d *GormDatabase) SetLogger(logger Logger) {
+	d.logger = logger
+	for _, db := range []*gorm.DB{d.DB, d.reader} {
+		db.SetLogger(gormLogger{logger: logger})
+		if logger.Level() == log.DEBUG {
+			db.LogMode(true)
+		}
+	}
+}
+
+type logFieldsKey struct{}
+
+// WithLogFields returns a context whose queries are logged with the fields, such as the request ID and route of a request
+func WithLogFields(ctx context.Context, fields log.JSON) context.Context {
+	return context.WithValue(ctx, logFieldsKey{}, fields)
+}
+
+func logFields(ctx context.Context) log.JSON {
+	fields, _ := ctx.Value(logFieldsKey{}).(log.JSON)
+	return fields
+}
+
+// withLogFields returns db with a logger which adds the log fields of ctx to every line, db itself if there are none
+func (d *GormDatabase) withLogFields(ctx context.Context, db *gorm.DB) *gorm.DB {
+	fields := logFields(ctx)
+	if d.logger == nil || fields == nil {
+		return db
+	}
+	db = db.New()
+	db.SetLogger(gormLogger{logger: d.logger, fields: fields})
+	return db
+}
+
+type gormLogger struct {
+	logger Logger
+	fields log.JSON
+}
+
+// Print receives the values gorm logs, which start with the kind of the line and its source
+func (g gormLogger) Print(values ...interface{}) {
+	if len(values) < 2 {
+		return
+	}
+
+	fields := log.JSON{}
+	for key, value := range g.fields {
+		fields[key] = value
+	}
+	fields["component"] = "database"
+	fields["source"] = values[1]
+	switch values[0] {
+	case "sql":
+		if len(values) < 6 {
+			return
+		}
+		if duration, ok := values[2].(time.Duration); ok {
+			fields["duration_ms"] = float64(duration.Nanoseconds()) / float64(time.Millisecond)
+		}
+		fields["message"] = "query executed"
+		fields["query"] = values[3]
+		fields["rows_affected"] = values[5]
+		fields["outcome"] = "ok"
+		g.logger.Debugj(fields)
+	case "error":
+		fields["message"] = "query failed"
+		fields["error"] = fmt.Sprint(values[2:]...)
+		fields["outcome"] = "query_failed"
+		g.logger.Errorj(fields)
+	case "log":
+		// in detailed mode gorm reports errors as plain log lines
+		if len(values) == 3 {
+			if err, ok := values[2].(error); ok {
+				g.Print("error", values[1], err)
+				return
+			}
+		}
+		fallthrough
+	default:
+		fields["message"] = fmt.Sprint(values[2:]...)
+		g.logger.Debugj(fields)
+	}
+}
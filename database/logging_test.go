@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/cyucelen/wirect/model"
+	"github.com/labstack/gommon/log"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingLogger struct {
+	level  log.Lvl
+	debugs []log.JSON
+	errors chan log.JSON
+}
+
+func (r *recordingLogger) Level() log.Lvl    { return r.level }
+func (r *recordingLogger) Debugj(j log.JSON) { r.debugs = append(r.debugs, j) }
+func (r *recordingLogger) Errorj(j log.JSON) { r.errors <- j }
+
+func (s *DatabaseSuite) TestLoggerOmitsQueryArguments() {
+	logger := &recordingLogger{level: log.DEBUG, errors: make(chan log.JSON, 1)}
+	s.db.SetLogger(logger)
+
+	s.db.CreatePacket(context.Background(), &model.Packet{MAC: "AA:BB:CC:DD:EE:FF", SnifferMAC: "11:22:33:44:55:66", Timestamp: 1})
+
+	assert.NotEmpty(s.T(), logger.debugs)
+	for _, line := range logger.debugs {
+		assert.Equal(s.T(), "database", line["component"])
+		assert.NotContains(s.T(), line["query"], "AA:BB:CC:DD:EE:FF")
+	}
+}
+
+func (s *DatabaseSuite) TestLoggerReportsErrors() {
+	logger := &recordingLogger{level: log.INFO, errors: make(chan log.JSON, 1)}
+	s.db.SetLogger(logger)
+
+	s.db.DB.Exec("SELECT * FROM missing_table")
+
+	// gorm logs errors from a goroutine when queries are not logged
+	select {
+	case line := <-logger.errors:
+		assert.Contains(s.T(), line["error"], "missing_table")
+	case <-time.After(time.Second):
+		assert.Fail(s.T(), "error was not logged")
+	}
+	assert.Empty(s.T(), logger.debugs)
+}
+
+func (s *DatabaseSuite) TestLoggerAddsLogFieldsOfContext() {
+	logger := &recordingLogger{level: log.DEBUG, errors: make(chan log.JSON, 1)}
+	s.db.SetLogger(logger)
+
+	ctx := WithLogFields(context.Background(), log.JSON{"request_id": "upload-42", "route": "/sniffers/:snifferMAC/packets"})
+	s.db.CreatePacket(ctx, &model.Packet{MAC: "AA:BB:CC:DD:EE:FF", SnifferMAC: "11:22:33:44:55:66", Timestamp: 1})
+
+	assert.NotEmpty(s.T(), logger.debugs)
+	for _, line := range logger.debugs {
+		assert.Equal(s.T(), "upload-42", line["request_id"])
+		assert.Equal(s.T(), "/sniffers/:snifferMAC/packets", line["route"])
+		assert.Equal(s.T(), "ok", line["outcome"])
+	}
+}
@@ -0,0 +1,593 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cyucelen/wirect/model"
+	"github.com/labstack/gommon/log"
+)
+
+// MemoryDialect selects the in-memory backend for edge gateways which only serve recent data
+const MemoryDialect = "memory"
+
+// memoryWithoutSnapshots is the connection string of a memory database which is never written to disk
+const memoryWithoutSnapshots = ":memory:"
+
+// MemoryDatabase keeps packets and router sightings of the retention window in memory, sorted by time in a slice per sniffer.
+// It is written to the snapshot file on every Checkpoint and on Close, and restored from it when opened.
+type MemoryDatabase struct {
+	// Retention is the age after which packets and router sightings are evicted, zero keeps everything
+	Retention time.Duration
+	// SnapshotPath is the file the database is written to, empty means the database is never written
+	SnapshotPath string
+
+	mu sync.RWMutex
+	// snapshotMu keeps concurrent snapshots from writing the same temporary file
+	snapshotMu sync.Mutex
+	packets    map[string][]model.Packet
+	sniffers   map[string]model.Sniffer
+	routers    map[string]map[string]model.Router
+	sightings  map[string][]model.RouterSighting
+	// fingerprints are kept regardless of the retention window
+	fingerprints map[string]model.SnifferFingerprint
+	sequences    map[string]model.SnifferSequence
+	lastID       uint
+	now          func() time.Time
+	logger       Logger
+}
+
+// memorySnapshot is the content of the snapshot file
+type memorySnapshot struct {
+	Packets      map[string][]model.Packet
+	Sniffers     map[string]model.Sniffer
+	Routers      map[string]map[string]model.Router
+	Sightings    map[string][]model.RouterSighting
+	Fingerprints map[string]model.SnifferFingerprint
+	Sequences    map[string]model.SnifferSequence
+	LastID       uint
+}
+
+// NewMemory creates a memory database which is restored from the snapshot at path unless path is ":memory:"
+func NewMemory(path string, opts ...Option) (*MemoryDatabase, error) {
+	o := newOptions(opts)
+
+	m := &MemoryDatabase{
+		Retention:    o.retention,
+		packets:      map[string][]model.Packet{},
+		sniffers:     map[string]model.Sniffer{},
+		routers:      map[string]map[string]model.Router{},
+		sightings:    map[string][]model.RouterSighting{},
+		fingerprints: map[string]model.SnifferFingerprint{},
+		sequences:    map[string]model.SnifferSequence{},
+		now:          time.Now,
+	}
+	if path == memoryWithoutSnapshots {
+		return m, nil
+	}
+
+	m.SnapshotPath = path
+	if err := m.restore(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Close writes the final snapshot
+func (m *MemoryDatabase) Close() error {
+	return m.Checkpoint(context.Background())
+}
+
+// SetLogger writes evictions to logger on debug level
+func (m *MemoryDatabase) SetLogger(logger Logger) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.logger = logger
+}
+
+// Checkpoint evicts what is older than the retention window and writes the snapshot
+func (m *MemoryDatabase) Checkpoint(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	for snifferMAC := range m.packets {
+		m.evict(snifferMAC)
+	}
+	for snifferMAC := range m.sightings {
+		m.evictSightings(snifferMAC)
+	}
+	m.mu.Unlock()
+
+	if m.SnapshotPath == "" {
+		return nil
+	}
+	return m.snapshot()
+}
+
+func (m *MemoryDatabase) CreatePacket(ctx context.Context, packet *model.Packet) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.insertPacket(packet)
+	return nil
+}
+
+func (m *MemoryDatabase) CreatePackets(ctx context.Context, packets []model.Packet) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range packets {
+		m.insertPacket(&packets[i])
+	}
+	return nil
+}
+
+func (m *MemoryDatabase) CreatePacketBatch(ctx context.Context, packets []model.Packet, sequence *model.SnifferSequence) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range packets {
+		m.insertPacket(&packets[i])
+	}
+	m.sequences[sequence.SnifferMAC] = sequence.Copy()
+	return nil
+}
+
+func (m *MemoryDatabase) GetSnifferSequence(ctx context.Context, snifferMAC string) (model.SnifferSequence, error) {
+	if err := ctx.Err(); err != nil {
+		return model.SnifferSequence{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sequence, exists := m.sequences[snifferMAC]
+	if !exists {
+		return model.SnifferSequence{SnifferMAC: snifferMAC}, nil
+	}
+	return sequence.Copy(), nil
+}
+
+// insertPacket assigns the ID of the packet and inserts it in the order of time, m.mu must be locked
+func (m *MemoryDatabase) insertPacket(packet *model.Packet) {
+	m.lastID++
+	packet.ID = m.lastID
+
+	packets := m.packets[packet.SnifferMAC]
+	// packets mostly arrive in order, so the position is usually the end of the slice
+	index := sort.Search(len(packets), func(i int) bool {
+		return packets[i].Timestamp > packet.Timestamp
+	})
+	packets = append(packets, model.Packet{})
+	copy(packets[index+1:], packets[index:])
+	packets[index] = *packet
+	m.packets[packet.SnifferMAC] = packets
+
+	m.evict(packet.SnifferMAC)
+}
+
+func (m *MemoryDatabase) GetPacketsBySniffer(ctx context.Context, snifferMAC string) ([]model.Packet, error) {
+	return m.packetsBetween(ctx, snifferMAC, minTimestamp, maxTimestamp)
+}
+
+func (m *MemoryDatabase) GetPacketsBySnifferSince(ctx context.Context, snifferMAC string, since int64) ([]model.Packet, error) {
+	return m.packetsBetween(ctx, snifferMAC, since, maxTimestamp)
+}
+
+func (m *MemoryDatabase) GetPacketsBySnifferBetweenDates(ctx context.Context, snifferMAC string, from, until int64) ([]model.Packet, error) {
+	return m.packetsBetween(ctx, snifferMAC, from, until)
+}
+
+func (m *MemoryDatabase) GetUniqueMACCountBySnifferBetweenDates(ctx context.Context, snifferMAC string, from, until int64) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	uniqueMACs := map[string]bool{}
+	for _, packet := range m.between(snifferMAC, from, until) {
+		uniqueMACs[packet.MAC] = true
+	}
+	return len(uniqueMACs), nil
+}
+
+func (m *MemoryDatabase) GetUniqueMACCountsBetweenDates(ctx context.Context, from, until int64) (map[string]int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	counts := map[string]int{}
+	for snifferMAC := range m.packets {
+		uniqueMACs := map[string]bool{}
+		for _, packet := range m.between(snifferMAC, from, until) {
+			uniqueMACs[packet.MAC] = true
+		}
+		if len(uniqueMACs) > 0 {
+			counts[snifferMAC] = len(uniqueMACs)
+		}
+	}
+	return counts, nil
+}
+
+func (m *MemoryDatabase) GetLastSeenOfSniffersBetweenDates(ctx context.Context, from, until int64) (map[string]int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	lastSeen := map[string]int64{}
+	for snifferMAC := range m.packets {
+		if packets := m.between(snifferMAC, from, until); len(packets) > 0 {
+			lastSeen[snifferMAC] = packets[len(packets)-1].Timestamp
+		}
+	}
+	return lastSeen, nil
+}
+
+func (m *MemoryDatabase) CreateSniffer(ctx context.Context, sniffer *model.Sniffer) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.sniffers[sniffer.MAC]; ok {
+		return errSnifferExists
+	}
+	m.sniffers[sniffer.MAC] = *sniffer
+	return nil
+}
+
+func (m *MemoryDatabase) GetSniffers(ctx context.Context) ([]model.Sniffer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sniffers := make([]model.Sniffer, 0, len(m.sniffers))
+	for _, sniffer := range m.sniffers {
+		sniffers = append(sniffers, sniffer)
+	}
+	sort.Slice(sniffers, func(i, j int) bool {
+		return sniffers[i].MAC < sniffers[j].MAC
+	})
+	return sniffers, nil
+}
+
+func (m *MemoryDatabase) UpdateSniffer(ctx context.Context, sniffer *model.Sniffer) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sniffers[sniffer.MAC] = *sniffer
+	return nil
+}
+
+func (m *MemoryDatabase) CreateRouter(ctx context.Context, router *model.Router) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	routers, ok := m.routers[router.SnifferMAC]
+	if !ok {
+		routers = map[string]model.Router{}
+		m.routers[router.SnifferMAC] = routers
+	}
+	router.AccessPoint = model.RouterAccessPoint(router.SSID, router.BSSID)
+	routers[router.AccessPoint] = *router
+	return nil
+}
+
+func (m *MemoryDatabase) GetRoutersBySniffer(ctx context.Context, snifferMAC string) ([]model.Router, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	routers := make([]model.Router, 0, len(m.routers[snifferMAC]))
+	for _, router := range m.routers[snifferMAC] {
+		routers = append(routers, router)
+	}
+	sort.Slice(routers, func(i, j int) bool {
+		if routers[i].LastSeen != routers[j].LastSeen {
+			return routers[i].LastSeen > routers[j].LastSeen
+		}
+		return routers[i].AccessPoint < routers[j].AccessPoint
+	})
+	return routers, nil
+}
+
+func (m *MemoryDatabase) CreateRouterSighting(ctx context.Context, sighting *model.RouterSighting) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastID++
+	sighting.ID = m.lastID
+
+	sightings := m.sightings[sighting.SnifferMAC]
+	index := sort.Search(len(sightings), func(i int) bool {
+		return sightings[i].Timestamp > sighting.Timestamp
+	})
+	sightings = append(sightings, model.RouterSighting{})
+	copy(sightings[index+1:], sightings[index:])
+	sightings[index] = *sighting
+	m.sightings[sighting.SnifferMAC] = sightings
+
+	m.evictSightings(sighting.SnifferMAC)
+	return nil
+}
+
+func (m *MemoryDatabase) GetRouterSightingsBySnifferBetweenDates(ctx context.Context, snifferMAC string, from, until int64) ([]model.RouterSighting, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if oldest := m.oldest(); from < oldest {
+		from = oldest
+	}
+	sightings := m.sightings[snifferMAC]
+	start := sort.Search(len(sightings), func(i int) bool {
+		return sightings[i].Timestamp >= from
+	})
+	end := sort.Search(len(sightings), func(i int) bool {
+		return sightings[i].Timestamp > until
+	})
+
+	found := []model.RouterSighting{}
+	if start < end {
+		found = append(found, sightings[start:end]...)
+	}
+	return found, nil
+}
+
+func (m *MemoryDatabase) GetSnifferFingerprint(ctx context.Context, snifferMAC string) (model.SnifferFingerprint, error) {
+	if err := ctx.Err(); err != nil {
+		return model.SnifferFingerprint{}, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	fingerprint, exists := m.fingerprints[snifferMAC]
+	if !exists {
+		return model.SnifferFingerprint{SnifferMAC: snifferMAC}, nil
+	}
+	fingerprint.Baseline = fingerprint.Baseline.Copy()
+	return fingerprint, nil
+}
+
+func (m *MemoryDatabase) UpdateSnifferFingerprint(ctx context.Context, fingerprint *model.SnifferFingerprint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := *fingerprint
+	stored.Baseline = fingerprint.Baseline.Copy()
+	m.fingerprints[fingerprint.SnifferMAC] = stored
+	return nil
+}
+
+func (m *MemoryDatabase) packetsBetween(ctx context.Context, snifferMAC string, from, until int64) ([]model.Packet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	found := m.between(snifferMAC, from, until)
+	packets := make([]model.Packet, len(found))
+	copy(packets, found)
+	return packets, nil
+}
+
+// between returns the packets of the sniffer from until until, both inclusive, which are within the retention window
+// even if they were not evicted yet, the caller must hold the lock
+func (m *MemoryDatabase) between(snifferMAC string, from, until int64) []model.Packet {
+	if oldest := m.oldest(); from < oldest {
+		from = oldest
+	}
+	packets := m.packets[snifferMAC]
+	start := sort.Search(len(packets), func(i int) bool {
+		return packets[i].Timestamp >= from
+	})
+	end := sort.Search(len(packets), func(i int) bool {
+		return packets[i].Timestamp > until
+	})
+	if start >= end {
+		return nil
+	}
+	return packets[start:end]
+}
+
+// oldest returns the timestamp of the oldest packets and router sightings within the retention window
+func (m *MemoryDatabase) oldest() int64 {
+	if m.Retention <= 0 {
+		return minTimestamp
+	}
+	return m.now().Add(-m.Retention).Unix()
+}
+
+// evict drops the packets of the sniffer which are older than the retention window, the caller must hold the lock
+func (m *MemoryDatabase) evict(snifferMAC string) {
+	if m.Retention <= 0 {
+		return
+	}
+
+	packets := m.packets[snifferMAC]
+	oldest := m.oldest()
+	expired := sort.Search(len(packets), func(i int) bool {
+		return packets[i].Timestamp >= oldest
+	})
+	if expired == 0 {
+		return
+	}
+
+	if expired == len(packets) {
+		delete(m.packets, snifferMAC)
+	} else {
+		// copying lets the evicted packets be collected instead of being kept by the underlying array
+		m.packets[snifferMAC] = append([]model.Packet(nil), packets[expired:]...)
+	}
+
+	if m.logger != nil && m.logger.Level() == log.DEBUG {
+		m.logger.Debugj(log.JSON{"component": "database", "message": "packets evicted", "sniffer": snifferMAC, "count": expired})
+	}
+}
+
+// evictSightings drops the router sightings of the sniffer which are older than the retention window, the caller must hold the lock
+func (m *MemoryDatabase) evictSightings(snifferMAC string) {
+	if m.Retention <= 0 {
+		return
+	}
+
+	sightings := m.sightings[snifferMAC]
+	oldest := m.oldest()
+	expired := sort.Search(len(sightings), func(i int) bool {
+		return sightings[i].Timestamp >= oldest
+	})
+	if expired == len(sightings) {
+		delete(m.sightings, snifferMAC)
+	} else if expired > 0 {
+		m.sightings[snifferMAC] = append([]model.RouterSighting(nil), sightings[expired:]...)
+	}
+}
+
+// snapshot writes the database to a temporary file which replaces the snapshot file once it is complete,
+// so a crash while writing leaves the previous snapshot intact. The database is encoded in memory first,
+// writers only wait for the encoding and not for the slow write to the disk.
+func (m *MemoryDatabase) snapshot() error {
+	m.snapshotMu.Lock()
+	defer m.snapshotMu.Unlock()
+
+	var encoded bytes.Buffer
+	m.mu.RLock()
+	err := gob.NewEncoder(&encoded).Encode(memorySnapshot{Packets: m.packets, Sniffers: m.sniffers, Routers: m.routers, Sightings: m.sightings, Fingerprints: m.fingerprints, Sequences: m.sequences, LastID: m.lastID})
+	m.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(filepath.Dir(m.SnapshotPath)); os.IsNotExist(err) {
+		if err := mkdirAllFunc(filepath.Dir(m.SnapshotPath), 0777); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.Create(m.SnapshotPath + ".tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = encoded.WriteTo(file)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return os.Rename(file.Name(), m.SnapshotPath)
+}
+
+// restore reads the snapshot file if there is one, packets which expired while the server was down are evicted by the next checkpoint
+func (m *MemoryDatabase) restore() error {
+	file, err := os.Open(m.SnapshotPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var snapshot memorySnapshot
+	if err := gob.NewDecoder(file).Decode(&snapshot); err != nil {
+		return err
+	}
+
+	if snapshot.Packets != nil {
+		m.packets = snapshot.Packets
+	}
+	if snapshot.Sniffers != nil {
+		m.sniffers = snapshot.Sniffers
+	}
+	if snapshot.Routers != nil {
+		m.routers = rekeyRouters(snapshot.Routers)
+	}
+	if snapshot.Sightings != nil {
+		m.sightings = snapshot.Sightings
+	}
+	if snapshot.Fingerprints != nil {
+		m.fingerprints = snapshot.Fingerprints
+	}
+	if snapshot.Sequences != nil {
+		m.sequences = snapshot.Sequences
+	}
+	m.lastID = snapshot.LastID
+	return nil
+}
+
+// rekeyRouters keys routers of snapshots which were keyed by SSID by their access point
+func rekeyRouters(routersOfSniffers map[string]map[string]model.Router) map[string]map[string]model.Router {
+	for snifferMAC, routers := range routersOfSniffers {
+		rekeyed := make(map[string]model.Router, len(routers))
+		for _, router := range routers {
+			router.AccessPoint = model.RouterAccessPoint(router.SSID, router.BSSID)
+			rekeyed[router.AccessPoint] = router
+		}
+		routersOfSniffers[snifferMAC] = rekeyed
+	}
+	return routersOfSniffers
+}
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cyucelen/wirect/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type MemorySuite struct {
+	suite.Suite
+	db  *MemoryDatabase
+	dir string
+	now time.Time
+}
+
+func TestMemorySuite(t *testing.T) {
+	suite.Run(t, new(MemorySuite))
+}
+
+func (s *MemorySuite) BeforeTest(suiteName, testName string) {
+	dir, err := ioutil.TempDir("", "wirect-memory-test")
+	assert.Nil(s.T(), err)
+	s.dir = dir
+
+	s.db = s.open(SetRetention(time.Hour))
+}
+
+func (s *MemorySuite) AfterTest(suiteName, testName string) {
+	os.RemoveAll(s.dir)
+}
+
+func (s *MemorySuite) open(opts ...Option) *MemoryDatabase {
+	db, err := Open(MemoryDialect, filepath.Join(s.dir, "snapshot.gob"), opts...)
+	assert.Nil(s.T(), err)
+
+	s.now = time.Unix(1000000, 0)
+	memory := db.(*MemoryDatabase)
+	memory.now = func() time.Time { return s.now }
+	return memory
+}
+
+func (s *MemorySuite) TestPacketsOlderThanRetentionAreEvicted() {
+	ctx := context.Background()
+	snifferOne, snifferTwo := "01:02:03:04:05:06", "00:00:00:00:00:00"
+	s.db.CreatePacket(ctx, &model.Packet{MAC: "AA:BB:22:11:44:55", Timestamp: s.now.Add(-2 * time.Hour).Unix(), SnifferMAC: snifferOne})
+	s.db.CreatePacket(ctx, &model.Packet{MAC: "CC:BB:FA:AE:FC:6C", Timestamp: s.now.Add(-10 * time.Minute).Unix(), SnifferMAC: snifferTwo})
+
+	s.now = s.now.Add(time.Hour)
+	s.db.CreatePacket(ctx, &model.Packet{MAC: "FF:FB:44:21:64:25", Timestamp: s.now.Unix(), SnifferMAC: snifferOne})
+
+	packets, _ := s.db.GetPacketsBySniffer(ctx, snifferOne)
+	assert.Len(s.T(), packets, 1)
+
+	// sniffers which stopped sending are evicted by checkpoints, until then their expired packets are not read
+	packets, _ = s.db.GetPacketsBySniffer(ctx, snifferTwo)
+	assert.Empty(s.T(), packets)
+	count, _ := s.db.GetUniqueMACCountBySnifferBetweenDates(ctx, snifferTwo, 0, s.now.Unix())
+	assert.Zero(s.T(), count)
+	assert.Len(s.T(), s.db.packets[snifferTwo], 1)
+	assert.Nil(s.T(), s.db.Checkpoint(ctx))
+	assert.Empty(s.T(), s.db.packets[snifferTwo])
+}
+
+func (s *MemorySuite) TestSnapshotIsRestored() {
+	ctx := context.Background()
+	sniffer := model.Sniffer{MAC: "11:22:33:44:55:66", Name: "library_sniffer", Description: "library"}
+	router := model.Router{SSID: "2020", SnifferMAC: sniffer.MAC, LastSeen: s.now.Unix()}
+	packet := model.Packet{MAC: "AA:BB:22:11:44:55", Timestamp: s.now.Unix(), RSSI: -40, SnifferMAC: sniffer.MAC}
+	s.db.CreateSniffer(ctx, &sniffer)
+	s.db.CreateRouter(ctx, &router)
+	s.db.CreatePacket(ctx, &packet)
+	assert.Nil(s.T(), s.db.Close())
+
+	s.db = s.open(SetRetention(time.Hour))
+
+	sniffers, _ := s.db.GetSniffers(ctx)
+	assert.Equal(s.T(), []model.Sniffer{sniffer}, sniffers)
+	routers, _ := s.db.GetRoutersBySniffer(ctx, sniffer.MAC)
+	assert.Equal(s.T(), []model.Router{router}, routers)
+	packets, _ := s.db.GetPacketsBySniffer(ctx, sniffer.MAC)
+	assert.Equal(s.T(), []model.Packet{packet}, packets)
+
+	next := model.Packet{MAC: "AA:BB:22:11:44:55", Timestamp: s.now.Unix(), SnifferMAC: sniffer.MAC}
+	s.db.CreatePacket(ctx, &next)
+	assert.True(s.T(), next.ID > packet.ID)
+}
+
+func (s *MemorySuite) TestCorruptSnapshotFailsToOpen() {
+	path := filepath.Join(s.dir, "snapshot.gob")
+	assert.Nil(s.T(), ioutil.WriteFile(path, []byte("not a snapshot"), 0600))
+
+	_, err := NewMemory(path)
+	assert.Error(s.T(), err)
+}
+
+func (s *MemorySuite) TestConcurrentAccess() {
+	ctx := context.Background()
+	snifferMAC := "01:02:03:04:05:06"
+
+	var wg sync.WaitGroup
+	for writer := 0; writer < 4; writer++ {
+		wg.Add(2)
+		go func(writer int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				s.db.CreatePacket(ctx, &model.Packet{MAC: "AA:BB:22:11:44:55", Timestamp: s.now.Unix() - int64(i), SnifferMAC: snifferMAC})
+				s.db.CreateRouter(ctx, &model.Router{SSID: "2020", SnifferMAC: snifferMAC, LastSeen: int64(i)})
+			}
+		}(writer)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				s.db.GetPacketsBySnifferSince(ctx, snifferMAC, s.now.Unix()-50)
+				s.db.GetRoutersBySniffer(ctx, snifferMAC)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Nil(s.T(), s.db.Checkpoint(ctx))
+
+	packets, _ := s.db.GetPacketsBySniffer(ctx, snifferMAC)
+	assert.Len(s.T(), packets, 400)
+	for i := 1; i < len(packets); i++ {
+		assert.True(s.T(), packets[i-1].Timestamp <= packets[i].Timestamp)
+	}
+}
+
+func TestMemoryWithoutSnapshots(t *testing.T) {
+	db, err := Open(MemoryDialect, memoryWithoutSnapshots)
+	assert.Nil(t, err)
+
+	assert.Nil(t, db.CreateSniffer(context.Background(), &model.Sniffer{MAC: "00:00:00:00:00:00"}))
+	assert.Nil(t, db.Close())
+
+	_, err = os.Stat(memoryWithoutSnapshots)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -1,33 +1,110 @@
 package database
 
 import (
+	"context"
+
 	"github.com/cyucelen/wirect/model"
+	"github.com/jinzhu/gorm"
 )
 
-func (g *GormDatabase) CreatePacket(packet *model.Packet) error {
-	return g.DB.Create(packet).Error
+func (g *GormDatabase) CreatePacket(ctx context.Context, packet *model.Packet) error {
+	return g.write(ctx, func(tx *gorm.DB) error {
+		return tx.Create(packet).Error
+	})
+}
+
+func (g *GormDatabase) CreatePackets(ctx context.Context, packets []model.Packet) error {
+	return g.write(ctx, func(tx *gorm.DB) error {
+		for i := range packets {
+			if err := tx.Create(&packets[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-func (g *GormDatabase) GetPacketsBySniffer(snifferMAC string) []model.Packet {
+func (g *GormDatabase) GetPacketsBySniffer(ctx context.Context, snifferMAC string) ([]model.Packet, error) {
 	var packets []model.Packet
-	g.DB.Order("timestamp asc").Where("sniffer_mac = ?", snifferMAC).Find(&packets)
-	return packets
+	err := g.read(ctx, func(tx *gorm.DB) error {
+		return tx.Order("timestamp asc, id asc").Where("sniffer_mac = ?", snifferMAC).Find(&packets).Error
+	})
+	return packets, err
 }
 
-func (g *GormDatabase) GetPacketsBySnifferSince(snifferMAC string, since int64) []model.Packet {
+func (g *GormDatabase) GetPacketsBySnifferSince(ctx context.Context, snifferMAC string, since int64) ([]model.Packet, error) {
 	var packets []model.Packet
-	g.DB.Order("timestamp asc").Where("sniffer_mac = ? AND timestamp >= ?", snifferMAC, since).Find(&packets)
-	return packets
+	err := g.read(ctx, func(tx *gorm.DB) error {
+		return tx.Order("timestamp asc, id asc").Where("sniffer_mac = ? AND timestamp >= ?", snifferMAC, since).Find(&packets).Error
+	})
+	return packets, err
 }
 
-func (g *GormDatabase) GetPacketsBySnifferBetweenDates(snifferMAC string, from, until int64) []model.Packet {
+func (g *GormDatabase) GetPacketsBySnifferBetweenDates(ctx context.Context, snifferMAC string, from, until int64) ([]model.Packet, error) {
 	var packets []model.Packet
-	g.DB.Order("timestamp asc").Where("sniffer_mac = ? AND timestamp between ? AND ?", snifferMAC, from, until).Find(&packets)
-	return packets
+	err := g.read(ctx, func(tx *gorm.DB) error {
+		return tx.Order("timestamp asc, id asc").Where("sniffer_mac = ? AND timestamp between ? AND ?", snifferMAC, from, until).Find(&packets).Error
+	})
+	return packets, err
 }
 
-func (g *GormDatabase) GetUniqueMACCountBySnifferBetweenDates(snifferMAC string, from, until int64) int {
+func (g *GormDatabase) GetUniqueMACCountBySnifferBetweenDates(ctx context.Context, snifferMAC string, from, until int64) (int, error) {
 	count := 0
-	g.DB.Where("sniffer_mac = ? AND timestamp between ? AND ?", snifferMAC, from, until).Select("count(distinct(mac))").Find(new(model.Packet)).Count(&count)
-	return count
+	err := g.read(ctx, func(tx *gorm.DB) error {
+		return tx.Model(&model.Packet{}).Where("sniffer_mac = ? AND timestamp between ? AND ?", snifferMAC, from, until).Select("count(distinct(mac))").Count(&count).Error
+	})
+	return count, err
+}
+
+func (g *GormDatabase) GetUniqueMACCountsBetweenDates(ctx context.Context, from, until int64) (map[string]int, error) {
+	var rows []struct {
+		SnifferMAC string
+		Count      int
+	}
+	err := g.read(ctx, func(tx *gorm.DB) error {
+		return tx.Model(&model.Packet{}).Select("sniffer_mac, count(distinct(mac)) as count").Where("timestamp between ? AND ?", from, until).Group("sniffer_mac").Scan(&rows).Error
+	})
+	counts := map[string]int{}
+	for _, row := range rows {
+		counts[row.SnifferMAC] = row.Count
+	}
+	return counts, err
+}
+
+func (g *GormDatabase) GetLastSeenOfSniffersBetweenDates(ctx context.Context, from, until int64) (map[string]int64, error) {
+	var rows []struct {
+		SnifferMAC string
+		LastSeen   int64
+	}
+	err := g.read(ctx, func(tx *gorm.DB) error {
+		return tx.Model(&model.Packet{}).Select("sniffer_mac, max(timestamp) as last_seen").Where("timestamp between ? AND ?", from, until).Group("sniffer_mac").Scan(&rows).Error
+	})
+	lastSeen := map[string]int64{}
+	for _, row := range rows {
+		lastSeen[row.SnifferMAC] = row.LastSeen
+	}
+	return lastSeen, err
+}
+
+func (g *GormDatabase) GetSnifferSequence(ctx context.Context, snifferMAC string) (model.SnifferSequence, error) {
+	sequence := model.SnifferSequence{SnifferMAC: snifferMAC}
+	err := g.read(ctx, func(tx *gorm.DB) error {
+		err := tx.Where("sniffer_mac = ?", snifferMAC).First(&sequence).Error
+		if gorm.IsRecordNotFoundError(err) {
+			return nil
+		}
+		return err
+	})
+	return sequence, err
+}
+
+func (g *GormDatabase) CreatePacketBatch(ctx context.Context, packets []model.Packet, sequence *model.SnifferSequence) error {
+	return g.write(ctx, func(tx *gorm.DB) error {
+		for i := range packets {
+			if err := tx.Create(&packets[i]).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(sequence).Error
+	})
 }
@@ -1,15 +1,89 @@
 package database
 
 import (
+	"context"
+
 	"github.com/cyucelen/wirect/model"
+	"github.com/jinzhu/gorm"
 )
 
-func (g *GormDatabase) CreateRouter(router *model.Router) error {
-	return g.DB.Save(router).Error
+func (g *GormDatabase) CreateRouter(ctx context.Context, router *model.Router) error {
+	router.AccessPoint = model.RouterAccessPoint(router.SSID, router.BSSID)
+	return g.write(ctx, func(tx *gorm.DB) error {
+		return tx.Save(router).Error
+	})
 }
 
-func (g *GormDatabase) GetRoutersBySniffer(snifferMAC string) []model.Router {
+func (g *GormDatabase) GetRoutersBySniffer(ctx context.Context, snifferMAC string) ([]model.Router, error) {
 	var routers []model.Router
-	g.DB.Order("last_seen desc").Where("sniffer_mac = ?", snifferMAC).Find(&routers)
-	return routers
+	err := g.read(ctx, func(tx *gorm.DB) error {
+		return tx.Order("last_seen desc, access_point asc").Where("sniffer_mac = ?", snifferMAC).Find(&routers).Error
+	})
+	return routers, err
+}
+
+func (g *GormDatabase) CreateRouterSighting(ctx context.Context, sighting *model.RouterSighting) error {
+	return g.write(ctx, func(tx *gorm.DB) error {
+		return tx.Create(sighting).Error
+	})
+}
+
+func (g *GormDatabase) GetRouterSightingsBySnifferBetweenDates(ctx context.Context, snifferMAC string, from, until int64) ([]model.RouterSighting, error) {
+	var sightings []model.RouterSighting
+	err := g.read(ctx, func(tx *gorm.DB) error {
+		return tx.Order("timestamp asc, id asc").Where("sniffer_mac = ? AND timestamp between ? AND ?", snifferMAC, from, until).Find(&sightings).Error
+	})
+	return sightings, err
+}
+
+func (g *GormDatabase) GetSnifferFingerprint(ctx context.Context, snifferMAC string) (model.SnifferFingerprint, error) {
+	fingerprint := model.SnifferFingerprint{SnifferMAC: snifferMAC}
+	err := g.read(ctx, func(tx *gorm.DB) error {
+		err := tx.Where("sniffer_mac = ?", snifferMAC).First(&fingerprint).Error
+		if gorm.IsRecordNotFoundError(err) {
+			return nil
+		}
+		return err
+	})
+	return fingerprint, err
+}
+
+func (g *GormDatabase) UpdateSnifferFingerprint(ctx context.Context, fingerprint *model.SnifferFingerprint) error {
+	return g.write(ctx, func(tx *gorm.DB) error {
+		return tx.Save(fingerprint).Error
+	})
+}
+
+// migrateRouters moves routers which were keyed by SSID to the table keyed by access point
+func migrateRouters(db *gorm.DB) error {
+	if !db.HasTable(&model.Router{}) || db.Dialect().HasColumn("routers", "access_point") {
+		return nil
+	}
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if err := copyRoutersByAccessPoint(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+func copyRoutersByAccessPoint(tx *gorm.DB) error {
+	if err := tx.Exec("ALTER TABLE routers RENAME TO routers_by_ssid").Error; err != nil {
+		return err
+	}
+	if err := tx.CreateTable(&model.Router{}).Error; err != nil {
+		return err
+	}
+	// the latest sighting of an SSID was the only one kept, so there is a single row for every access point
+	err := tx.Exec(`INSERT INTO routers (access_point, sniffer_mac, ss_id, last_seen, bss_id, channel, band, security, rssi)
+		SELECT CASE WHEN bss_id IS NULL OR bss_id = '' THEN ss_id ELSE bss_id END, sniffer_mac, ss_id, last_seen, bss_id, channel, band, security, rssi
+		FROM routers_by_ssid`).Error
+	if err != nil {
+		return err
+	}
+	return tx.Exec("DROP TABLE routers_by_ssid").Error
 }
@@ -1,18 +1,28 @@
 package database
 
-import "github.com/cyucelen/wirect/model"
+import (
+	"context"
 
-func (g *GormDatabase) CreateSniffer(sniffer *model.Sniffer) error {
-	return g.DB.Create(sniffer).Error
+	"github.com/cyucelen/wirect/model"
+	"github.com/jinzhu/gorm"
+)
+
+func (g *GormDatabase) CreateSniffer(ctx context.Context, sniffer *model.Sniffer) error {
+	return g.write(ctx, func(tx *gorm.DB) error {
+		return tx.Create(sniffer).Error
+	})
 }
 
-func (g *GormDatabase) GetSniffers() []model.Sniffer {
+func (g *GormDatabase) GetSniffers(ctx context.Context) ([]model.Sniffer, error) {
 	var sniffers []model.Sniffer
-	g.DB.Find(&sniffers)
-
-	return sniffers
+	err := g.read(ctx, func(tx *gorm.DB) error {
+		return tx.Order("mac asc").Find(&sniffers).Error
+	})
+	return sniffers, err
 }
 
-func (g *GormDatabase) UpdateSniffer(sniffer *model.Sniffer) error {
-	return g.DB.Save(sniffer).Error
+func (g *GormDatabase) UpdateSniffer(ctx context.Context, sniffer *model.Sniffer) error {
+	return g.write(ctx, func(tx *gorm.DB) error {
+		return tx.Save(sniffer).Error
+	})
 }
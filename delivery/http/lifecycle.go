@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// Flusher is implemented by components which buffer writes
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// FlushFunc adapts a function to a Flusher
+type FlushFunc func(ctx context.Context) error
+
+// Flush calls f(ctx)
+func (f FlushFunc) Flush(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Closer is implemented by components which hold resources until the server stops, such as the database
+type Closer interface {
+	Close() error
+}
+
+// Lifecycle tracks in-flight requests and background jobs so they can be drained on shutdown
+type Lifecycle struct {
+	inFlight     int64
+	jobs         sync.WaitGroup
+	runningJobs  int64
+	jobsCtx      context.Context
+	cancelJobs   context.CancelFunc
+	flushers     []Flusher
+	closers      []Closer
+	shutdownOnce sync.Once
+}
+
+// ShutdownSummary reports what was drained and what was dropped during shutdown
+type ShutdownSummary struct {
+	RequestsInFlight int64
+	RequestsDrained  int64
+	RequestsDropped  int64
+	JobsStopped      int64
+	JobsDropped      int64
+	FlushErrors      []error
+	CloseErrors      []error
+	// ClosersSkipped are the components left open because dropped requests or jobs may still use them
+	ClosersSkipped int
+	Duration       time.Duration
+}
+
+func NewLifecycle() *Lifecycle {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Lifecycle{jobsCtx: ctx, cancelJobs: cancel}
+}
+
+// Track is a middleware which counts the requests that are being served
+func (l *Lifecycle) Track(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		atomic.AddInt64(&l.inFlight, 1)
+		defer atomic.AddInt64(&l.inFlight, -1)
+		return next(ctx)
+	}
+}
+
+// InFlight returns the number of requests which are being served
+func (l *Lifecycle) InFlight() int64 {
+	return atomic.LoadInt64(&l.inFlight)
+}
+
+// Go runs job in the background until shutdown cancels its context
+func (l *Lifecycle) Go(job func(ctx context.Context)) {
+	l.jobs.Add(1)
+	atomic.AddInt64(&l.runningJobs, 1)
+	go func() {
+		defer l.jobs.Done()
+		defer atomic.AddInt64(&l.runningJobs, -1)
+		job(l.jobsCtx)
+	}()
+}
+
+// Every runs job periodically in the background until shutdown
+func (l *Lifecycle) Every(interval time.Duration, job func(ctx context.Context)) {
+	l.Go(func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				job(ctx)
+			}
+		}
+	})
+}
+
+// OnFlush registers a component whose buffered writes are flushed after requests and jobs are drained
+func (l *Lifecycle) OnFlush(flusher Flusher) {
+	l.flushers = append(l.flushers, flusher)
+}
+
+// OnClose registers a component which is closed as the last step of shutdown
+func (l *Lifecycle) OnClose(closer Closer) {
+	l.closers = append(l.closers, closer)
+}
+
+// Shutdown stops accepting connections, drains in-flight requests and background jobs until ctx is done,
+// always flushes buffered writes and closes the registered components unless something was dropped
+func (l *Lifecycle) Shutdown(ctx context.Context, e *echo.Echo) ShutdownSummary {
+	summary := ShutdownSummary{}
+	l.shutdownOnce.Do(func() {
+		start := time.Now()
+		summary.RequestsInFlight = l.InFlight()
+
+		if err := e.Shutdown(ctx); err != nil {
+			summary.RequestsDropped = l.InFlight()
+			e.Close()
+		}
+		summary.RequestsDrained = summary.RequestsInFlight - summary.RequestsDropped
+
+		runningJobs := atomic.LoadInt64(&l.runningJobs)
+		l.cancelJobs()
+		if waitGroupWithContext(ctx, &l.jobs) != nil {
+			summary.JobsDropped = atomic.LoadInt64(&l.runningJobs)
+		}
+		summary.JobsStopped = runningJobs - summary.JobsDropped
+
+		// buffered writes are lost unless they are flushed, so flushing outlives the deadline of draining
+		flushCtx := ctx
+		if ctx.Err() != nil {
+			flushCtx = context.Background()
+		}
+		for _, flusher := range l.flushers {
+			if err := flusher.Flush(flushCtx); err != nil {
+				summary.FlushErrors = append(summary.FlushErrors, err)
+			}
+		}
+
+		// handlers of dropped requests and dropped jobs keep running, closing the database under them would fail their writes
+		if summary.RequestsDropped > 0 || summary.JobsDropped > 0 {
+			summary.ClosersSkipped = len(l.closers)
+		} else {
+			for _, closer := range l.closers {
+				if err := closer.Close(); err != nil {
+					summary.CloseErrors = append(summary.CloseErrors, err)
+				}
+			}
+		}
+
+		summary.Duration = time.Since(start)
+	})
+	return summary
+}
+
+func (s ShutdownSummary) String() string {
+	return fmt.Sprintf("shutdown finished in %v: drained %d of %d in-flight requests, dropped %d; stopped %d background jobs, dropped %d; %d flush errors %v; %d close errors %v; %d components left open",
+		s.Duration, s.RequestsDrained, s.RequestsInFlight, s.RequestsDropped, s.JobsStopped, s.JobsDropped,
+		len(s.FlushErrors), s.FlushErrors, len(s.CloseErrors), s.CloseErrors, s.ClosersSkipped)
+}
+
+func waitGroupWithContext(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingComponent struct {
+	flushed bool
+	closed  bool
+}
+
+func (r *recordingComponent) Flush(ctx context.Context) error {
+	r.flushed = true
+	return ctx.Err()
+}
+
+func (r *recordingComponent) Close() error {
+	r.closed = true
+	return errors.New("already closed")
+}
+
+func startLifecycleTestServer(t *testing.T, lifecycle *Lifecycle, handler echo.HandlerFunc) (*echo.Echo, string) {
+	e := echo.New()
+	e.HideBanner = true
+	e.Use(lifecycle.Track)
+	e.GET("/slow", handler)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	e.Listener = listener
+	go e.Start("")
+
+	return e, "http://" + listener.Addr().String() + "/slow"
+}
+
+func waitForInFlight(lifecycle *Lifecycle, count int64) {
+	for lifecycle.InFlight() != count {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestShutdownDrainsInFlightRequests(t *testing.T) {
+	lifecycle := NewLifecycle()
+	release := make(chan struct{})
+	e, url := startLifecycleTestServer(t, lifecycle, func(ctx echo.Context) error {
+		<-release
+		return ctx.NoContent(http.StatusCreated)
+	})
+
+	responses := make(chan int)
+	go func() {
+		res, err := http.Get(url)
+		assert.Nil(t, err)
+		responses <- res.StatusCode
+	}()
+	waitForInFlight(lifecycle, 1)
+
+	component := &recordingComponent{}
+	lifecycle.OnFlush(component)
+	lifecycle.OnClose(component)
+
+	stoppedJob := make(chan struct{})
+	lifecycle.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		close(stoppedJob)
+	})
+
+	// the request is released once shutdown started, while it is in flight
+	shutdownStarted := make(chan struct{})
+	e.Server.RegisterOnShutdown(func() { close(shutdownStarted) })
+	summaries := make(chan ShutdownSummary)
+	go func() {
+		summaries <- lifecycle.Shutdown(context.Background(), e)
+	}()
+	<-shutdownStarted
+	close(release)
+
+	assert.Equal(t, http.StatusCreated, <-responses)
+	summary := <-summaries
+	<-stoppedJob
+
+	assert.Equal(t, int64(1), summary.RequestsInFlight)
+	assert.Equal(t, int64(1), summary.RequestsDrained)
+	assert.Equal(t, int64(0), summary.RequestsDropped)
+	assert.Equal(t, int64(1), summary.JobsStopped)
+	assert.Equal(t, int64(0), summary.JobsDropped)
+	assert.True(t, component.flushed)
+	assert.True(t, component.closed)
+	assert.Len(t, summary.CloseErrors, 1)
+}
+
+func TestShutdownDropsWhatDoesNotFinishBeforeDeadline(t *testing.T) {
+	lifecycle := NewLifecycle()
+	release := make(chan struct{})
+	defer close(release)
+
+	e, url := startLifecycleTestServer(t, lifecycle, func(ctx echo.Context) error {
+		<-release
+		return ctx.NoContent(http.StatusOK)
+	})
+
+	go http.Get(url)
+	waitForInFlight(lifecycle, 1)
+
+	lifecycle.Go(func(ctx context.Context) {
+		<-release
+	})
+	component := &recordingComponent{}
+	lifecycle.OnFlush(component)
+	lifecycle.OnClose(component)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	summary := lifecycle.Shutdown(ctx, e)
+
+	assert.Equal(t, int64(1), summary.RequestsDropped)
+	assert.Equal(t, int64(0), summary.RequestsDrained)
+	assert.Equal(t, int64(1), summary.JobsDropped)
+	assert.Contains(t, summary.String(), "dropped 1")
+	assert.True(t, component.flushed)
+	assert.Empty(t, summary.FlushErrors)
+	assert.False(t, component.closed)
+	assert.Equal(t, 1, summary.ClosersSkipped)
+}
+
+func TestEveryRunsJobUntilShutdown(t *testing.T) {
+	lifecycle := NewLifecycle()
+	runs := make(chan struct{}, 10)
+	lifecycle.Every(time.Millisecond, func(ctx context.Context) {
+		runs <- struct{}{}
+	})
+
+	<-runs
+	<-runs
+	summary := lifecycle.Shutdown(context.Background(), echo.New())
+	assert.Equal(t, int64(1), summary.JobsStopped)
+}
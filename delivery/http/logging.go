@@ -0,0 +1,69 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/cyucelen/wirect/api"
+	"github.com/cyucelen/wirect/database"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+)
+
+// logHeader makes every log line a single JSON object, the fields of Infoj and friends are merged into it
+const logHeader = `{"time":"${time_rfc3339_nano}","level":"${level}","file":"${short_file}","line":"${line}"}`
+
+// macPrivacy is a middleware which stores the MAC redactor in the context of every request
+func macPrivacy(redactor api.MACRedactor) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			api.SetMACRedactor(ctx, redactor)
+			return next(ctx)
+		}
+	}
+}
+
+// logQueries is a middleware which passes the log fields of the request down to the database logger
+func logQueries(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		req := ctx.Request()
+		ctx.SetRequest(req.WithContext(database.WithLogFields(req.Context(), api.LogFields(ctx))))
+		return next(ctx)
+	}
+}
+
+// logRequests is a middleware which writes a JSON log line with the outcome of every request
+func logRequests(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		start := time.Now()
+		if err := next(ctx); err != nil {
+			ctx.Error(err)
+		}
+
+		fields := api.LogFields(ctx)
+		fields["message"] = "request served"
+		fields["status"] = ctx.Response().Status
+		fields["outcome"] = api.Outcome(ctx)
+		fields["latency_ms"] = float64(time.Since(start).Nanoseconds()) / float64(time.Millisecond)
+		fields["bytes_out"] = ctx.Response().Size
+		fields["remote_ip"] = ctx.RealIP()
+
+		switch status := ctx.Response().Status; {
+		case status >= http.StatusInternalServerError:
+			ctx.Logger().Errorj(fields)
+		case status >= http.StatusBadRequest:
+			ctx.Logger().Warnj(fields)
+		default:
+			ctx.Logger().Infoj(fields)
+		}
+		return nil
+	}
+}
+
+var logLevels = map[string]log.Lvl{
+	"debug": log.DEBUG,
+	"info":  log.INFO,
+	"warn":  log.WARN,
+	"error": log.ERROR,
+	"off":   log.OFF,
+}
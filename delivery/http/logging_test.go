@@ -0,0 +1,51 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cyucelen/wirect/config"
+	"github.com/cyucelen/wirect/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestsAreLoggedAsJSONWithRequestID(t *testing.T) {
+	cfg := config.Default()
+	cfg.Privacy.MACRedaction = "mask"
+	e := Create(&test.InMemoryDB{}, SetConfig(cfg), SetClock(clock.New()))
+	logs := &bytes.Buffer{}
+	e.Logger.SetOutput(logs)
+
+	req := httptest.NewRequest(http.MethodPost, "/sniffers/11:22:33:44:55:66/packets", strings.NewReader(`{"MAC": ""}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-ID", "upload-42")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "upload-42", rec.Header().Get("X-Request-ID"))
+
+	var line map[string]interface{}
+	assert.Nil(t, json.Unmarshal(logs.Bytes(), &line), logs.String())
+	assert.Equal(t, "upload-42", line["request_id"])
+	assert.Equal(t, "/sniffers/:snifferMAC/packets", line["route"])
+	assert.Equal(t, "11:22:33:XX:XX:XX", line["sniffer"])
+	assert.Equal(t, "validation_failed", line["outcome"])
+	assert.Equal(t, "WARN", line["level"])
+	assert.NotContains(t, logs.String(), "44:55:66")
+}
+
+func TestRequestIDIsGeneratedWhenMissing(t *testing.T) {
+	e := createTestServer(&test.InMemoryDB{}, clock.New())
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, timeEndpoint, nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("X-Request-ID"))
+}
@@ -0,0 +1,324 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cyucelen/wirect/api"
+	"github.com/cyucelen/wirect/model"
+	"github.com/labstack/echo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsEndpoint = "/metrics"
+
+// crowdCollectTimeout bounds the queries of a single scrape
+const crowdCollectTimeout = 10 * time.Second
+
+// unregisteredSniffer is the sniffer label of every MAC which is not a registered sniffer,
+// MACs in the path are not authenticated so labeling them would create a time series for every one
+const unregisteredSniffer = "unregistered"
+
+// snifferLabelRefresh is how long registered sniffers are cached before an unknown MAC reloads them
+const snifferLabelRefresh = 30 * time.Second
+
+type metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	packetsIngested *prometheus.CounterVec
+	packetsRejected *prometheus.CounterVec
+	queryDuration   *prometheus.HistogramVec
+	rogues          *prometheus.CounterVec
+	sniffers        *snifferLabels
+}
+
+// snifferLabels tells registered sniffers apart from other MACs, loading the sniffers at most once per snifferLabelRefresh.
+// The registered sniffers are replaced as a whole, so labeling never waits for a load.
+type snifferLabels struct {
+	db    api.SnifferDatabase
+	clock clock.Clock
+	// registered holds the map[string]bool of the sniffers which were loaded last
+	registered atomic.Value
+
+	mu      sync.Mutex
+	loaded  time.Time
+	loading bool
+}
+
+func (l *snifferLabels) label(snifferMAC string) string {
+	if l == nil {
+		return unregisteredSniffer
+	}
+
+	registered, _ := l.registered.Load().(map[string]bool)
+	if !registered[snifferMAC] && l.startLoading() {
+		registered = l.load()
+	}
+	if registered[snifferMAC] {
+		return snifferMAC
+	}
+	return unregisteredSniffer
+}
+
+// startLoading tells whether the caller should load the sniffers, which is when they are due and nobody else loads them
+func (l *snifferLabels) startLoading() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.loading || l.clock.Now().Sub(l.loaded) < snifferLabelRefresh {
+		return false
+	}
+	l.loading = true
+	return true
+}
+
+// load replaces the registered sniffers and returns them, the previous ones are kept if loading fails
+func (l *snifferLabels) load() map[string]bool {
+	ctx, cancel := context.WithTimeout(context.Background(), crowdCollectTimeout)
+	defer cancel()
+	sniffers, err := l.db.GetSniffers(ctx)
+
+	l.mu.Lock()
+	l.loading = false
+	l.loaded = l.clock.Now()
+	l.mu.Unlock()
+
+	if err != nil {
+		registered, _ := l.registered.Load().(map[string]bool)
+		return registered
+	}
+	registered := map[string]bool{}
+	for _, sniffer := range sniffers {
+		registered[sniffer.MAC] = true
+	}
+	l.registered.Store(registered)
+	return registered
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "wirect_http_requests_total",
+			Help: "HTTP requests by method, route and status code.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "wirect_http_request_duration_seconds",
+			Help:    "HTTP request latencies by method and route.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		packetsIngested: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "wirect_packets_ingested_total",
+			Help: "Packets stored by sniffer.",
+		}, []string{"sniffer"}),
+		packetsRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "wirect_packets_rejected_total",
+			Help: "Packets rejected by validation by sniffer.",
+		}, []string{"sniffer"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "wirect_database_query_duration_seconds",
+			Help:    "Database query latencies by query.",
+			Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+		}, []string{"query"}),
+		rogues: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "wirect_rogue_access_points_total",
+			Help: "Sightings of rogue access points by sniffer and reason.",
+		}, []string{"sniffer", "reason"}),
+	}
+
+	m.registry.MustRegister(
+		m.requests, m.requestDuration, m.packetsIngested, m.packetsRejected, m.queryDuration, m.rogues,
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+// instrument is a middleware which records the count and latency of requests
+func (m *metrics) instrument(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		start := time.Now()
+		err := next(ctx)
+
+		route := ctx.Path()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := ctx.Request().Method
+		// the error is rendered by an outer middleware or echo, with the status it maps to
+		status := ctx.Response().Status
+		if err != nil && !ctx.Response().Committed {
+			status = api.ErrorStatus(err)
+		}
+
+		m.requests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+		m.requestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+func (m *metrics) PacketsIngested(snifferMAC string, count int) {
+	m.packetsIngested.WithLabelValues(m.sniffers.label(snifferMAC)).Add(float64(count))
+}
+
+func (m *metrics) PacketsRejected(snifferMAC string, count int) {
+	m.packetsRejected.WithLabelValues(m.sniffers.label(snifferMAC)).Add(float64(count))
+}
+
+func (m *metrics) RogueAccessPointDetected(rogue model.RogueAccessPoint) {
+	m.rogues.WithLabelValues(m.sniffers.label(rogue.SnifferMAC), rogue.Reason).Inc()
+}
+
+func (m *metrics) handler() echo.HandlerFunc {
+	return echo.WrapHandler(promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+}
+
+// crowdCollector reports the current crowd of every sniffer at scrape time
+type crowdCollector struct {
+	db       Database
+	crowdAPI *api.CrowdAPI
+	desc     *prometheus.Desc
+}
+
+func newCrowdCollector(db Database, crowdAPI *api.CrowdAPI) *crowdCollector {
+	return &crowdCollector{
+		db:       db,
+		crowdAPI: crowdAPI,
+		desc:     prometheus.NewDesc("wirect_crowd", "Unique MAC addresses sniffed in the crowd calculation interval.", []string{"sniffer"}, nil),
+	}
+}
+
+func (c *crowdCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *crowdCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), crowdCollectTimeout)
+	defer cancel()
+
+	sniffers, err := c.db.GetSniffers(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	crowds, err := c.crowdAPI.CurrentCrowds(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	for _, sniffer := range sniffers {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(crowds[sniffer.MAC]), sniffer.MAC)
+	}
+}
+
+// instrumentedDatabase records the latency of every query of the wrapped database
+type instrumentedDatabase struct {
+	db      Database
+	metrics *metrics
+}
+
+func (i *instrumentedDatabase) observe(query string, start time.Time) {
+	i.metrics.queryDuration.WithLabelValues(query).Observe(time.Since(start).Seconds())
+}
+
+func (i *instrumentedDatabase) CreatePacket(ctx context.Context, packet *model.Packet) error {
+	defer i.observe("CreatePacket", time.Now())
+	return i.db.CreatePacket(ctx, packet)
+}
+
+func (i *instrumentedDatabase) CreatePackets(ctx context.Context, packets []model.Packet) error {
+	defer i.observe("CreatePackets", time.Now())
+	return i.db.CreatePackets(ctx, packets)
+}
+
+func (i *instrumentedDatabase) GetPacketsBySniffer(ctx context.Context, snifferMAC string) ([]model.Packet, error) {
+	defer i.observe("GetPacketsBySniffer", time.Now())
+	return i.db.GetPacketsBySniffer(ctx, snifferMAC)
+}
+
+func (i *instrumentedDatabase) GetPacketsBySnifferSince(ctx context.Context, snifferMAC string, since int64) ([]model.Packet, error) {
+	defer i.observe("GetPacketsBySnifferSince", time.Now())
+	return i.db.GetPacketsBySnifferSince(ctx, snifferMAC, since)
+}
+
+func (i *instrumentedDatabase) GetPacketsBySnifferBetweenDates(ctx context.Context, snifferMAC string, from, until int64) ([]model.Packet, error) {
+	defer i.observe("GetPacketsBySnifferBetweenDates", time.Now())
+	return i.db.GetPacketsBySnifferBetweenDates(ctx, snifferMAC, from, until)
+}
+
+func (i *instrumentedDatabase) GetUniqueMACCountBySnifferBetweenDates(ctx context.Context, snifferMAC string, from, until int64) (int, error) {
+	defer i.observe("GetUniqueMACCountBySnifferBetweenDates", time.Now())
+	return i.db.GetUniqueMACCountBySnifferBetweenDates(ctx, snifferMAC, from, until)
+}
+
+func (i *instrumentedDatabase) GetUniqueMACCountsBetweenDates(ctx context.Context, from, until int64) (map[string]int, error) {
+	defer i.observe("GetUniqueMACCountsBetweenDates", time.Now())
+	return i.db.GetUniqueMACCountsBetweenDates(ctx, from, until)
+}
+
+func (i *instrumentedDatabase) GetLastSeenOfSniffersBetweenDates(ctx context.Context, from, until int64) (map[string]int64, error) {
+	defer i.observe("GetLastSeenOfSniffersBetweenDates", time.Now())
+	return i.db.GetLastSeenOfSniffersBetweenDates(ctx, from, until)
+}
+
+func (i *instrumentedDatabase) CreateSniffer(ctx context.Context, sniffer *model.Sniffer) error {
+	defer i.observe("CreateSniffer", time.Now())
+	return i.db.CreateSniffer(ctx, sniffer)
+}
+
+func (i *instrumentedDatabase) GetSniffers(ctx context.Context) ([]model.Sniffer, error) {
+	defer i.observe("GetSniffers", time.Now())
+	return i.db.GetSniffers(ctx)
+}
+
+func (i *instrumentedDatabase) UpdateSniffer(ctx context.Context, sniffer *model.Sniffer) error {
+	defer i.observe("UpdateSniffer", time.Now())
+	return i.db.UpdateSniffer(ctx, sniffer)
+}
+
+func (i *instrumentedDatabase) CreateRouter(ctx context.Context, router *model.Router) error {
+	defer i.observe("CreateRouter", time.Now())
+	return i.db.CreateRouter(ctx, router)
+}
+
+func (i *instrumentedDatabase) GetRoutersBySniffer(ctx context.Context, snifferMAC string) ([]model.Router, error) {
+	defer i.observe("GetRoutersBySniffer", time.Now())
+	return i.db.GetRoutersBySniffer(ctx, snifferMAC)
+}
+
+func (i *instrumentedDatabase) CreateRouterSighting(ctx context.Context, sighting *model.RouterSighting) error {
+	defer i.observe("CreateRouterSighting", time.Now())
+	return i.db.CreateRouterSighting(ctx, sighting)
+}
+
+func (i *instrumentedDatabase) GetRouterSightingsBySnifferBetweenDates(ctx context.Context, snifferMAC string, from, until int64) ([]model.RouterSighting, error) {
+	defer i.observe("GetRouterSightingsBySnifferBetweenDates", time.Now())
+	return i.db.GetRouterSightingsBySnifferBetweenDates(ctx, snifferMAC, from, until)
+}
+
+func (i *instrumentedDatabase) GetSnifferFingerprint(ctx context.Context, snifferMAC string) (model.SnifferFingerprint, error) {
+	defer i.observe("GetSnifferFingerprint", time.Now())
+	return i.db.GetSnifferFingerprint(ctx, snifferMAC)
+}
+
+func (i *instrumentedDatabase) UpdateSnifferFingerprint(ctx context.Context, fingerprint *model.SnifferFingerprint) error {
+	defer i.observe("UpdateSnifferFingerprint", time.Now())
+	return i.db.UpdateSnifferFingerprint(ctx, fingerprint)
+}
+
+func (i *instrumentedDatabase) GetSnifferSequence(ctx context.Context, snifferMAC string) (model.SnifferSequence, error) {
+	defer i.observe("GetSnifferSequence", time.Now())
+	return i.db.GetSnifferSequence(ctx, snifferMAC)
+}
+
+func (i *instrumentedDatabase) CreatePacketBatch(ctx context.Context, packets []model.Packet, sequence *model.SnifferSequence) error {
+	defer i.observe("CreatePacketBatch", time.Now())
+	return i.db.CreatePacketBatch(ctx, packets, sequence)
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cyucelen/wirect/model"
+	"github.com/cyucelen/wirect/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	now := time.Now()
+	mockClock := clock.NewMock()
+	mockClock.Set(now)
+
+	snifferMAC := "11:22:33:44:55:66"
+	db := &test.InMemoryDB{Sniffers: []model.Sniffer{{MAC: snifferMAC, Name: "sniffer"}}}
+	server := httptest.NewServer(createTestServer(db, mockClock))
+	defer server.Close()
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	packets := `[
+		{"MAC": "AA:AA:AA:AA:AA:AA", "timestamp": ` + timestamp + `, "RSSI": -40},
+		{"MAC": "BB:BB:BB:BB:BB:BB", "timestamp": ` + timestamp + `, "RSSI": -50},
+		{"MAC": "not a mac", "timestamp": ` + timestamp + `, "RSSI": -50}
+	]`
+	resp, err := http.Post(server.URL+"/sniffers/"+snifferMAC+"/packets-collection", "application/json", strings.NewReader(packets))
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	// MACs which are not registered share a label so random paths do not create time series
+	for _, unregisteredMAC := range []string{"99:99:99:99:99:01", "99:99:99:99:99:02"} {
+		resp, err = http.Post(server.URL+"/sniffers/"+unregisteredMAC+"/packets", "application/json",
+			strings.NewReader(`{"MAC": "AA:AA:AA:AA:AA:AA", "timestamp": `+timestamp+`, "RSSI": -40}`))
+		assert.Nil(t, err)
+		resp.Body.Close()
+	}
+
+	resp, err = http.Post(server.URL+"/sniffers/"+snifferMAC+"/packets-collection", "application/json", strings.NewReader("not json"))
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + metricsEndpoint)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	metrics := string(body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, metrics, `wirect_http_requests_total{method="POST",route="/sniffers/:snifferMAC/packets-collection",status="201"} 1`)
+	assert.Contains(t, metrics, `wirect_http_request_duration_seconds_count{method="POST",route="/sniffers/:snifferMAC/packets-collection"} 2`)
+	assert.Contains(t, metrics, `wirect_packets_ingested_total{sniffer="11:22:33:44:55:66"} 2`)
+	assert.Contains(t, metrics, `wirect_packets_rejected_total{sniffer="11:22:33:44:55:66"} 1`)
+	assert.Contains(t, metrics, `wirect_packets_ingested_total{sniffer="unregistered"} 2`)
+	assert.NotContains(t, metrics, "99:99:99:99:99:01")
+	assert.Contains(t, metrics, `wirect_http_requests_total{method="POST",route="/sniffers/:snifferMAC/packets-collection",status="400"} 1`)
+	assert.Contains(t, metrics, `wirect_database_query_duration_seconds_count{query="CreatePacket"} 2`)
+	assert.Contains(t, metrics, `wirect_database_query_duration_seconds_count{query="CreatePackets"} 1`)
+	assert.Contains(t, metrics, `wirect_crowd{sniffer="11:22:33:44:55:66"} 2`)
+}
+
+func TestSnifferLabelsReloadSniffersByClock(t *testing.T) {
+	mockClock := clock.NewMock()
+	mockClock.Set(time.Unix(100000, 0))
+	db := &test.InMemoryDB{Sniffers: []model.Sniffer{{MAC: "11:22:33:44:55:66"}}}
+	labels := &snifferLabels{db: db, clock: mockClock}
+
+	assert.Equal(t, "11:22:33:44:55:66", labels.label("11:22:33:44:55:66"))
+
+	// a sniffer registered after the load is labeled once the sniffers are due again
+	db.Sniffers = append(db.Sniffers, model.Sniffer{MAC: "11:22:33:44:55:77"})
+	assert.Equal(t, unregisteredSniffer, labels.label("11:22:33:44:55:77"))
+	mockClock.Add(snifferLabelRefresh)
+	assert.Equal(t, "11:22:33:44:55:77", labels.label("11:22:33:44:55:77"))
+	assert.Equal(t, "11:22:33:44:55:66", labels.label("11:22:33:44:55:66"))
+}
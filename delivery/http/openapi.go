@@ -0,0 +1,478 @@
+package server
+
+import (
+	"embed"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cyucelen/wirect/api"
+	"github.com/cyucelen/wirect/model"
+	"github.com/cyucelen/wirect/packetcodec"
+	"github.com/labstack/echo"
+)
+
+const openAPIEndpoint = "/openapi.json"
+const apiDocsEndpoint = "/docs"
+const apiDocsAssetEndpoint = "/docs/:asset"
+
+// swaggerUIAssets are the files of the bundled API explorer, see swaggerui/README.md
+//
+//go:embed swaggerui/swagger-ui-bundle.js swaggerui/swagger-ui.css
+var swaggerUIAssets embed.FS
+
+var swaggerUIContentTypes = map[string]string{
+	"swagger-ui-bundle.js": "application/javascript; charset=utf-8",
+	"swagger-ui.css":       "text/css; charset=utf-8",
+	"swagger-ui-init.js":   "application/javascript; charset=utf-8",
+}
+
+type parameter struct {
+	name        string
+	in          string
+	description string
+	schemaType  string
+	required    bool
+}
+
+type operation struct {
+	method      string
+	path        string
+	summary     string
+	parameters  []parameter
+	requestBody interface{}
+	// requestContentType of the request body, JSON if empty
+	requestContentType string
+	// binaryContentType is an alternative binary request body
+	binaryContentType string
+	status            int
+	response          interface{}
+	// contentType of the response, JSON if empty
+	contentType string
+	// errorResponse is the body of unsuccessful responses, model.Error if nil
+	errorResponse interface{}
+}
+
+var snifferMACParameter = parameter{
+	name:        "snifferMAC",
+	in:          "path",
+	description: "URL encoded MAC address of the sniffer",
+	schemaType:  "string",
+	required:    true,
+}
+
+var contentEncodingParameter = parameter{
+	name:        echo.HeaderContentEncoding,
+	in:          "header",
+	description: "gzip or deflate if the request body is compressed",
+	schemaType:  "string",
+}
+
+var rangeParameters = []parameter{
+	{name: "from", in: "query", description: "Start of the range as unix seconds, RFC3339 or relative to now such as -2h, defaults to 24 hours before until", schemaType: "string"},
+	{name: "until", in: "query", description: "End of the range as unix seconds, RFC3339 or relative to now such as -1h, defaults to now", schemaType: "string"},
+}
+
+var operations = []operation{
+	{
+		method: http.MethodPost, path: packetsEndpoint, summary: "Create a packet sniffed by the sniffer, in JSON or as a binary batch of one packet",
+		parameters: []parameter{snifferMACParameter, contentEncodingParameter}, requestBody: model.SnifferPacket{}, binaryContentType: packetcodec.MIMEType,
+		status: http.StatusCreated, response: model.SnifferPacket{},
+	},
+	{
+		method: http.MethodPost, path: packetsCollectionEndpoint, summary: "Create a collection of packets sniffed by the sniffer, in JSON or as a binary batch, sequenced collections are stored once and acknowledged in the X-Sequence-Ack header",
+		parameters: []parameter{
+			snifferMACParameter,
+			contentEncodingParameter,
+			{name: api.HeaderBatchID, in: "header", description: "ID of the upload which stays the same when it is retried, required with X-Sequence-Range", schemaType: "string"},
+			{name: api.HeaderSequenceRange, in: "header", description: "Sequence numbers of the first and the last packet such as 101-150, the numbers of a sniffer increase with every packet", schemaType: "string"},
+		},
+		requestBody: []model.SnifferPacket{}, binaryContentType: packetcodec.MIMEType,
+		status: http.StatusCreated, response: model.PacketCollectionResult{},
+	},
+	{
+		method: http.MethodGet, path: packetSequenceEndpoint, summary: "Sequence numbers of the packets of the sniffer which were received, the packets after acknowledged and outside the received ranges are to be resent",
+		parameters: []parameter{snifferMACParameter},
+		status:     http.StatusOK, response: model.SnifferSequence{},
+	},
+	{
+		method: http.MethodDelete, path: packetSequenceEndpoint, summary: "Forget the sequence of the sniffer after it was reflashed or replaced and numbers its packets from 1 again, its stored packets are kept",
+		parameters: []parameter{snifferMACParameter},
+		status:     http.StatusOK, response: model.SnifferSequence{},
+	},
+	{
+		method: http.MethodPost, path: packetsStreamEndpoint, summary: "Stream packets sniffed by the sniffer as newline delimited JSON, one packet per line, which are stored in chunks as they arrive",
+		parameters: []parameter{
+			snifferMACParameter,
+			contentEncodingParameter,
+			{name: api.HeaderBatchID, in: "header", description: "ID of the stream which stays the same when it is retried, required with X-Sequence-Range", schemaType: "string"},
+			{name: api.HeaderSequenceRange, in: "header", description: "Sequence numbers of the first and the last packet of the stream, the packets are numbered by their order", schemaType: "string"},
+		},
+		requestBody: model.SnifferPacket{}, requestContentType: api.MIMEApplicationNDJSON,
+		status: http.StatusCreated, response: model.PacketStreamResult{},
+		errorResponse: model.PacketStreamResult{},
+	},
+	{
+		method: http.MethodGet, path: sniffersEndpoint, summary: "List sniffers",
+		status: http.StatusOK, response: []model.Sniffer{},
+	},
+	{
+		method: http.MethodPost, path: sniffersEndpoint, summary: "Create a sniffer",
+		requestBody: model.Sniffer{},
+		status:      http.StatusCreated, response: model.Sniffer{},
+	},
+	{
+		method: http.MethodGet, path: sniffersGeoJSONEndpoint, summary: "GeoJSON FeatureCollection of the sniffers with a location, their current crowd, whether they are online and their relocation status",
+		status: http.StatusOK, response: model.SnifferFeatureCollection{}, contentType: model.MIMEApplicationGeoJSON,
+	},
+	{
+		method: http.MethodPut, path: updateSnifferEndpoint, summary: "Update a sniffer, fields which are not sent keep their value and null clears them",
+		parameters: []parameter{snifferMACParameter}, requestBody: model.Sniffer{},
+		status: http.StatusOK,
+	},
+	{
+		method: http.MethodPost, path: routersEndpoint, summary: "Create routers seen by the sniffer",
+		parameters: []parameter{snifferMACParameter}, requestBody: []model.RouterExternal{},
+		status: http.StatusCreated, response: []model.RouterExternal{},
+	},
+	{
+		method: http.MethodGet, path: routersEndpoint, summary: "List routers seen by the sniffer, most recent first",
+		parameters: []parameter{snifferMACParameter},
+		status:     http.StatusOK, response: []model.RouterExternal{},
+	},
+	{
+		method: http.MethodGet, path: routerHistoryEndpoint, summary: "Every sighting of routers by the sniffer in the range, oldest first",
+		parameters: append([]parameter{snifferMACParameter}, rangeParameters...),
+		status:     http.StatusOK, response: []model.RouterExternal{},
+	},
+	{
+		method: http.MethodGet, path: bssidsEndpoint, summary: "Summary of every access point seen by the sniffer in the range, most recent first",
+		parameters: append([]parameter{snifferMACParameter}, rangeParameters...),
+		status:     http.StatusOK, response: []model.RouterDetail{},
+	},
+	{
+		method: http.MethodGet, path: bssidEndpoint, summary: "Summary and sightings of an access point seen by the sniffer in the range",
+		parameters: append([]parameter{
+			snifferMACParameter,
+			{name: "BSSID", in: "path", description: "URL encoded BSSID of the access point", schemaType: "string", required: true},
+		}, rangeParameters...),
+		status: http.StatusOK, response: model.RouterDetail{},
+	},
+	{
+		method: http.MethodGet, path: relocationEndpoint, summary: "Whether the routers around the sniffer still match the baseline of its location",
+		parameters: []parameter{snifferMACParameter},
+		status:     http.StatusOK, response: model.Relocation{},
+	},
+	{
+		method: http.MethodDelete, path: relocationEndpoint, summary: "Forget the baseline of the sniffer after it was moved on purpose, the next upload of routers becomes the new baseline",
+		parameters: []parameter{snifferMACParameter},
+		status:     http.StatusOK, response: model.Relocation{},
+	},
+	{
+		method: http.MethodPost, path: calibrationEndpoint, summary: "Derive and store the RSSI offset of the sniffer from a reference device at a known distance, seen within a range of at most an hour",
+		parameters: []parameter{snifferMACParameter}, requestBody: model.CalibrationRequest{},
+		status: http.StatusOK, response: model.Calibration{},
+	},
+	{
+		method: http.MethodGet, path: snifferGraphEndpoint, summary: "Graph of sniffers weighted by the routers and devices they share in the range",
+		parameters: []parameter{
+			{name: "from", in: "query", description: "Start of the range as unix seconds, RFC3339 or relative to now such as -2h, defaults to an hour before until, at most 24h before until", schemaType: "string"},
+			{name: "until", in: "query", description: "End of the range as unix seconds, RFC3339 or relative to now such as -1h, defaults to now", schemaType: "string"},
+			{name: "window", in: "query", description: "Window in which a device seen by two sniffers is co-observed as seconds or a duration such as 5m, defaults to the crowd calculation interval", schemaType: "string"},
+			{name: "minWeight", in: "query", description: "Minimum weight of an edge from 0 to 1", schemaType: "number"},
+			{name: "format", in: "query", description: "json, or dot for the Graphviz DOT language", schemaType: "string"},
+		},
+		status: http.StatusOK, response: model.SnifferGraph{},
+	},
+	{
+		method: http.MethodGet, path: floorHeatmapEndpoint, summary: "Density of the estimated positions of devices on the floor in the range",
+		parameters: []parameter{
+			{name: "floor", in: "path", description: "URL encoded floor of the sniffers", schemaType: "string", required: true},
+			{name: "from", in: "query", description: "Start of the range as unix seconds, RFC3339 or relative to now such as -2h, defaults to an hour before until, at most 24h before until", schemaType: "string"},
+			{name: "until", in: "query", description: "End of the range as unix seconds, RFC3339 or relative to now such as -1h, defaults to now", schemaType: "string"},
+			{name: "window", in: "query", description: "Window in which the sniffers seeing a device locate it together as seconds or a duration such as 1m, defaults to 1m, the range may span at most 10000 windows", schemaType: "string"},
+			{name: "cellSize", in: "query", description: "Size of a cell in meters, defaults to 1", schemaType: "number"},
+		},
+		status: http.StatusOK, response: model.Heatmap{},
+	},
+	{
+		method: http.MethodGet, path: rogueAccessPointsEndpoint, summary: "Sightings in the range which imitate an authorized network, by sniffer",
+		parameters: append([]parameter{
+			{name: "sniffer", in: "query", description: "MAC address of a sniffer to limit the list to", schemaType: "string"},
+		}, rangeParameters...),
+		status: http.StatusOK, response: []model.SnifferRogueAccessPoints{},
+	},
+	{
+		method: http.MethodGet, path: crowdEndpoint, summary: "Crowd around the sniffer over time",
+		parameters: []parameter{
+			snifferMACParameter,
+			{name: "from", in: "query", description: "Start of the range as unix seconds, RFC3339 or relative to now such as -2h, defaults to 10 minutes before until", schemaType: "string"},
+			{name: "until", in: "query", description: "End of the range as unix seconds, RFC3339 or relative to now such as -1h, defaults to now", schemaType: "string"},
+			{name: "for", in: "query", description: "Step between crowd calculations as seconds or a duration such as 30s, defaults to 60 seconds", schemaType: "string"},
+			{name: "window", in: "query", description: "Time window a device is counted in as seconds or a duration such as 5m, defaults to the crowd calculation interval", schemaType: "string"},
+		},
+		status: http.StatusOK, response: []model.Crowd{},
+	},
+	{
+		method: http.MethodGet, path: dailyTotalSniffedMACEndpoint, summary: "Unique MAC addresses sniffed in the last 24 hours",
+		parameters: []parameter{snifferMACParameter},
+		status:     http.StatusOK, response: model.TotalSniffed{},
+	},
+	{
+		method: http.MethodGet, path: timeEndpoint, summary: "Current server time as unix seconds",
+		status: http.StatusOK, response: model.Time{},
+	},
+	{
+		method: http.MethodPost, path: timeSyncEndpoint, summary: "Synchronize the clock of the sniffer like NTP, the times the request was received and answered let it compute its offset and delay",
+		parameters: []parameter{snifferMACParameter}, requestBody: model.TimeSyncRequest{},
+		status: http.StatusOK, response: model.TimeSync{},
+	},
+	{
+		method: http.MethodGet, path: snifferStatusEndpoint, summary: "Runtime status of the sniffer such as the offset and drift of its clock",
+		parameters: []parameter{snifferMACParameter},
+		status:     http.StatusOK, response: model.SnifferStatus{},
+	},
+	{
+		method: http.MethodGet, path: skewIncidentsEndpoint, summary: "Latest uploads of the sniffer whose clock was skewed beyond the tolerance, most recent first, with the packets they quarantined",
+		parameters: []parameter{snifferMACParameter},
+		status:     http.StatusOK, response: []model.SkewIncident{},
+	},
+	{
+		method: http.MethodGet, path: metricsEndpoint, summary: "Prometheus metrics in the text exposition format",
+		status: http.StatusOK,
+	},
+	{
+		method: http.MethodGet, path: openAPIEndpoint, summary: "OpenAPI specification of this API",
+		status: http.StatusOK,
+	},
+	{
+		method: http.MethodGet, path: apiDocsEndpoint, summary: "Interactive API explorer",
+		status: http.StatusOK,
+	},
+	{
+		method: http.MethodGet, path: apiDocsAssetEndpoint, summary: "Scripts and styles of the interactive API explorer",
+		parameters: []parameter{{name: "asset", in: "path", description: "swagger-ui-bundle.js, swagger-ui.css or swagger-ui-init.js", schemaType: "string", required: true}},
+		status:     http.StatusOK,
+	},
+}
+
+var pathParamPattern = regexp.MustCompile(`:([^/]+)`)
+
+func toOpenAPIPath(echoPath string) string {
+	return pathParamPattern.ReplaceAllString(echoPath, "{$1}")
+}
+
+// OpenAPISpec builds the OpenAPI 3 document of every endpoint registered by Create
+func OpenAPISpec() map[string]interface{} {
+	schemas := map[string]interface{}{}
+	paths := map[string]interface{}{}
+
+	for _, op := range operations {
+		path := toOpenAPIPath(op.path)
+		item, exists := paths[path].(map[string]interface{})
+		if !exists {
+			item = map[string]interface{}{}
+			paths[path] = item
+		}
+		item[strings.ToLower(op.method)] = op.toSpec(schemas)
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.2",
+		"info": map[string]interface{}{
+			"title":       "Wirect",
+			"description": "WiFi realtime crowd tracker server",
+			"version":     "1.0.0",
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas},
+	}
+}
+
+func (op operation) toSpec(schemas map[string]interface{}) map[string]interface{} {
+	spec := map[string]interface{}{"summary": op.summary}
+
+	if len(op.parameters) > 0 {
+		parameters := []interface{}{}
+		for _, p := range op.parameters {
+			parameters = append(parameters, map[string]interface{}{
+				"name":        p.name,
+				"in":          p.in,
+				"description": p.description,
+				"required":    p.required,
+				"schema":      map[string]interface{}{"type": p.schemaType},
+			})
+		}
+		spec["parameters"] = parameters
+	}
+
+	if op.requestBody != nil {
+		requestContentType := op.requestContentType
+		if requestContentType == "" {
+			requestContentType = echo.MIMEApplicationJSON
+		}
+		content := map[string]interface{}{
+			requestContentType: map[string]interface{}{"schema": schemaOf(reflect.TypeOf(op.requestBody), schemas)},
+		}
+		if op.binaryContentType != "" {
+			content[op.binaryContentType] = map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}}
+		}
+		spec["requestBody"] = map[string]interface{}{"required": true, "content": content}
+	}
+
+	response := map[string]interface{}{"description": http.StatusText(op.status)}
+	if op.response != nil {
+		contentType := op.contentType
+		if contentType == "" {
+			contentType = echo.MIMEApplicationJSON
+		}
+		response["content"] = map[string]interface{}{
+			contentType: map[string]interface{}{"schema": schemaOf(reflect.TypeOf(op.response), schemas)},
+		}
+	}
+	errorResponse := op.errorResponse
+	if errorResponse == nil {
+		errorResponse = model.Error{}
+	}
+	spec["responses"] = map[string]interface{}{
+		strconv.Itoa(op.status): response,
+		"default": map[string]interface{}{
+			"description": "Error",
+			"content":     jsonContent(schemaOf(reflect.TypeOf(errorResponse), schemas)),
+		},
+	}
+
+	return spec
+}
+
+func jsonContent(schema map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		echo.MIMEApplicationJSON: map[string]interface{}{"schema": schema},
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaOf converts a Go type to an OpenAPI schema, registering structs as components
+func schemaOf(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem(), schemas)
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem(), schemas)}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case reflect.Struct:
+		if _, registered := schemas[t.Name()]; !registered {
+			schemas[t.Name()] = nil // guards against recursive types
+			schemas[t.Name()] = structSchema(t, schemas)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+
+	return map[string]interface{}{}
+}
+
+func structSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	properties := map[string]interface{}{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if isEmbeddedStruct(field) {
+			// the fields of embedded structs are encoded as fields of the struct
+			for name, property := range structSchema(field.Type, schemas)["properties"].(map[string]interface{}) {
+				properties[name] = property
+			}
+			continue
+		}
+		name, ok := jsonFieldName(field)
+		if !ok {
+			continue
+		}
+		properties[name] = schemaOf(field.Type, schemas)
+	}
+
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+func isEmbeddedStruct(field reflect.StructField) bool {
+	return field.Anonymous && field.Type.Kind() == reflect.Struct && field.Tag.Get("json") == ""
+}
+
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	if field.PkgPath != "" {
+		return "", false
+	}
+
+	tag := strings.Split(field.Tag.Get("json"), ",")[0]
+	if tag == "-" {
+		return "", false
+	}
+	if tag == "" {
+		return field.Name, true
+	}
+	return tag, true
+}
+
+func createOpenAPIEndpoints(e *echo.Echo) {
+	spec := OpenAPISpec()
+	e.GET(openAPIEndpoint, func(ctx echo.Context) error {
+		return ctx.JSON(http.StatusOK, spec)
+	})
+	e.GET(apiDocsEndpoint, func(ctx echo.Context) error {
+		return ctx.HTML(http.StatusOK, swaggerUIPage)
+	})
+	e.GET(apiDocsAssetEndpoint, func(ctx echo.Context) error {
+		asset := ctx.Param("asset")
+		contentType, exists := swaggerUIContentTypes[asset]
+		if !exists {
+			return echo.ErrNotFound
+		}
+		content := []byte(swaggerUIInit)
+		if asset != "swagger-ui-init.js" {
+			var err error
+			if content, err = swaggerUIAssets.ReadFile("swaggerui/" + asset); err != nil {
+				return err
+			}
+		}
+		ctx.Response().Header().Set("Cache-Control", "public, max-age=86400")
+		return ctx.Blob(http.StatusOK, contentType, content)
+	})
+}
+
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Wirect API</title>
+  <link rel="stylesheet" href="` + apiDocsEndpoint + `/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="` + apiDocsEndpoint + `/swagger-ui-bundle.js"></script>
+  <script src="` + apiDocsEndpoint + `/swagger-ui-init.js"></script>
+</body>
+</html>
+`
+
+// swaggerUIInit starts the API explorer, it is a script of its own so /docs works under a Content-Security-Policy without inline scripts
+const swaggerUIInit = `window.onload = function() {
+  SwaggerUIBundle({url: "` + openAPIEndpoint + `", dom_id: "#swagger-ui"});
+};
+`
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cyucelen/wirect/model"
+	"github.com/cyucelen/wirect/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenAPISpecCoversRegisteredRoutes(t *testing.T) {
+	e := createTestServer(&test.InMemoryDB{}, clock.New())
+	paths := OpenAPISpec()["paths"].(map[string]interface{})
+
+	registered := map[string]bool{}
+	for _, route := range e.Routes() {
+		path := toOpenAPIPath(route.Path)
+		method := strings.ToLower(route.Method)
+		registered[method+" "+path] = true
+
+		item, exists := paths[path].(map[string]interface{})
+		if assert.True(t, exists, "%s is not documented", path) {
+			assert.Contains(t, item, method, "%s %s is not documented", route.Method, path)
+		}
+	}
+
+	for path, item := range paths {
+		for method := range item.(map[string]interface{}) {
+			assert.True(t, registered[method+" "+path], "%s %s is documented but not registered", method, path)
+		}
+	}
+}
+
+func TestOpenAPISchemasMatchModels(t *testing.T) {
+	// the models are collected from the operations like the spec does, so every schema in the spec is checked
+	models := map[string]reflect.Type{}
+	for _, op := range operations {
+		errorResponse := op.errorResponse
+		if errorResponse == nil {
+			errorResponse = model.Error{}
+		}
+		for _, body := range []interface{}{op.requestBody, op.response, errorResponse} {
+			if body != nil {
+				collectModels(reflect.TypeOf(body), models)
+			}
+		}
+	}
+
+	schemas := OpenAPISpec()["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	assert.Equal(t, len(models), len(schemas), "schemas are not the models of the operations")
+
+	for name, modelType := range models {
+		schema, exists := schemas[name].(map[string]interface{})
+		if !assert.True(t, exists, "schema of %s is missing", name) {
+			continue
+		}
+
+		properties := []string{}
+		for property := range schema["properties"].(map[string]interface{}) {
+			properties = append(properties, property)
+		}
+
+		m := reflect.New(modelType).Elem().Interface()
+		assert.Equal(t, marshaledFieldNames(m), withoutOmitEmpty(modelType, sorted(properties)), "schema of %s drifted", name)
+	}
+}
+
+// collectModels adds the structs which t is made of to models by name
+func collectModels(t reflect.Type, models map[string]reflect.Type) {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		collectModels(t.Elem(), models)
+	case reflect.Struct:
+		if _, collected := models[t.Name()]; collected || t == timeType {
+			return
+		}
+		models[t.Name()] = t
+		collectFieldModels(t, models)
+	}
+}
+
+// collectFieldModels adds the structs which the fields of t are made of to models, embedded structs are not models themselves
+func collectFieldModels(t reflect.Type, models map[string]reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if isEmbeddedStruct(field) {
+			collectFieldModels(field.Type, models)
+		} else if _, ok := jsonFieldName(field); ok {
+			collectModels(field.Type, models)
+		}
+	}
+}
+
+func (s *IntegrationSuite) TestGetOpenAPISpec() {
+	res := s.sendRequest(http.MethodGet, "openapi.json", "")
+	assert.Equal(s.T(), http.StatusOK, res.StatusCode)
+
+	var spec map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&spec)
+	assert.Equal(s.T(), "3.0.2", spec["openapi"])
+
+	res = s.sendRequest(http.MethodGet, "docs", "")
+	assert.Equal(s.T(), http.StatusOK, res.StatusCode)
+	page, _ := ioutil.ReadAll(res.Body)
+	assert.NotContains(s.T(), string(page), "https://")
+
+	// the explorer is served from the binary so it works offline
+	for _, asset := range []string{"swagger-ui-bundle.js", "swagger-ui.css", "swagger-ui-init.js"} {
+		res = s.sendRequest(http.MethodGet, "docs/"+asset, "")
+		assert.Equal(s.T(), http.StatusOK, res.StatusCode, asset)
+		content, _ := ioutil.ReadAll(res.Body)
+		assert.NotEmpty(s.T(), content, asset)
+	}
+
+	res = s.sendRequest(http.MethodGet, "docs/index.html", "")
+	assert.Equal(s.T(), http.StatusNotFound, res.StatusCode)
+}
+
+func marshaledFieldNames(v interface{}) []string {
+	marshaled, _ := json.Marshal(v)
+	var fields map[string]interface{}
+	json.Unmarshal(marshaled, &fields)
+
+	names := []string{}
+	for name := range fields {
+		names = append(names, name)
+	}
+	return sorted(names)
+}
+
+func withoutOmitEmpty(t reflect.Type, properties []string) []string {
+	omitted := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("json"), ",")
+		if len(tag) > 1 && tag[1] == "omitempty" {
+			omitted[tag[0]] = true
+		}
+	}
+
+	filtered := []string{}
+	for _, property := range properties {
+		if !omitted[property] {
+			filtered = append(filtered, property)
+		}
+	}
+	return filtered
+}
+
+func sorted(s []string) []string {
+	sort.Strings(s)
+	return s
+}
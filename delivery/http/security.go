@@ -0,0 +1,146 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cyucelen/wirect/api"
+	"github.com/cyucelen/wirect/config"
+	"github.com/cyucelen/wirect/model"
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+)
+
+const rogueAccessPointsEndpoint = "/security/rogue-aps"
+
+// webhookQueueSize is the number of events which wait for delivery before new ones are dropped
+const webhookQueueSize = 100
+const webhookTimeout = 10 * time.Second
+
+// webhookRepeatInterval is the time an access point is not reported again for the same sniffer and reason,
+// since sniffers upload the routers around them over and over
+const webhookRepeatInterval = time.Hour
+
+func createSecurityEndpoints(e *echo.Echo, db Database, detector *api.RogueDetector, o *options) {
+	securityAPI := api.SecurityAPI{DB: db, Detector: detector, Clock: o.clock}
+	e.GET(rogueAccessPointsEndpoint, securityAPI.GetRogueAccessPoints)
+}
+
+func newRogueDetector(security config.Security) *api.RogueDetector {
+	allowlist := []api.AuthorizedAccessPoint{}
+	for _, accessPoint := range security.AuthorizedAccessPoints {
+		allowlist = append(allowlist, api.AuthorizedAccessPoint{SSID: accessPoint.SSID, BSSID: accessPoint.BSSID, Security: accessPoint.Security})
+	}
+	return api.NewRogueDetector(allowlist)
+}
+
+// rogueObservers notifies every observer about rogue access points
+type rogueObservers []api.RogueObserver
+
+func (r rogueObservers) RogueAccessPointDetected(rogue model.RogueAccessPoint) {
+	for _, observer := range r {
+		observer.RogueAccessPointDetected(rogue)
+	}
+}
+
+// webhookNotifier posts rogue access points to a URL in the background so uploads of routers do not wait for it
+type webhookNotifier struct {
+	url      string
+	client   *http.Client
+	clock    clock.Clock
+	logger   echo.Logger
+	events   chan model.SecurityEvent
+	mu       sync.Mutex
+	lastSent map[string]time.Time
+	// lastPruned is when lastSent was last cleared of entries which no longer suppress anything
+	lastPruned time.Time
+}
+
+func newWebhookNotifier(url string, clock clock.Clock, logger echo.Logger) *webhookNotifier {
+	return &webhookNotifier{
+		url:      url,
+		client:   &http.Client{Timeout: webhookTimeout},
+		clock:    clock,
+		logger:   logger,
+		events:   make(chan model.SecurityEvent, webhookQueueSize),
+		lastSent: map[string]time.Time{},
+	}
+}
+
+func (w *webhookNotifier) RogueAccessPointDetected(rogue model.RogueAccessPoint) {
+	now := w.clock.Now()
+	key := rogue.SnifferMAC + "/" + rogue.BSSID + "/" + rogue.Reason
+
+	w.mu.Lock()
+	w.prune(now)
+	if lastSent, sent := w.lastSent[key]; sent && now.Sub(lastSent) < webhookRepeatInterval {
+		w.mu.Unlock()
+		return
+	}
+	w.lastSent[key] = now
+	w.mu.Unlock()
+
+	select {
+	case w.events <- model.SecurityEvent{Type: model.SecurityEventRogueAccessPoint, Time: now.Unix(), RogueAccessPoint: rogue}:
+	default:
+		w.logger.Warnj(log.JSON{"component": "webhook", "message": "security event dropped, delivery is too slow", "reason": rogue.Reason})
+	}
+}
+
+// prune forgets events which were sent longer than webhookRepeatInterval ago, at most once per interval,
+// since the keys come from uploads of any sniffer and would otherwise pile up
+func (w *webhookNotifier) prune(now time.Time) {
+	if now.Sub(w.lastPruned) < webhookRepeatInterval {
+		return
+	}
+	for key, lastSent := range w.lastSent {
+		if now.Sub(lastSent) >= webhookRepeatInterval {
+			delete(w.lastSent, key)
+		}
+	}
+	w.lastPruned = now
+}
+
+// run delivers events until ctx is done
+func (w *webhookNotifier) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-w.events:
+			if err := w.post(ctx, event); err != nil {
+				w.logger.Errorj(log.JSON{"component": "webhook", "message": "security event was not delivered", "error": err.Error()})
+			}
+		}
+	}
+}
+
+func (w *webhookNotifier) post(ctx context.Context, event model.SecurityEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+	res, err := w.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/cyucelen/wirect/config"
+	"github.com/cyucelen/wirect/model"
+	"github.com/cyucelen/wirect/test"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRogueAccessPointsArePostedToWebhook(t *testing.T) {
+	events := make(chan model.SecurityEvent, 10)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event model.SecurityEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		events <- event
+	}))
+	defer webhook.Close()
+
+	mockClock := clock.NewMock()
+	mockClock.Set(time.Now())
+	cfg := config.Default()
+	cfg.Log.Requests = false
+	cfg.Security.AuthorizedAccessPoints = []config.AuthorizedAccessPoint{{SSID: "eduroam", BSSID: "AA:AA:AA:AA:AA:01", Security: "wpa2"}}
+	cfg.Security.WebhookURL = webhook.URL
+	snifferMAC := "01:01:01:01:01:01"
+	lifecycle := NewLifecycle()
+	e := Create(&test.InMemoryDB{Sniffers: []model.Sniffer{{MAC: snifferMAC}}}, SetConfig(cfg), SetClock(mockClock), SetLifecycle(lifecycle))
+	server := httptest.NewServer(e)
+	defer server.Close()
+	defer lifecycle.Shutdown(context.Background(), e)
+
+	routers, _ := json.Marshal([]model.RouterExternal{{SSID: "eduroam", BSSID: "AA:AA:AA:AA:AA:09", Security: "wpa2", LastSeen: mockClock.Now().Unix()}})
+	res, err := http.Post(server.URL+"/sniffers/"+url.QueryEscape(snifferMAC)+"/routers", echo.MIMEApplicationJSON, bytes.NewReader(routers))
+	assert.Nil(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	select {
+	case event := <-events:
+		assert.Equal(t, model.SecurityEventRogueAccessPoint, event.Type)
+		assert.Equal(t, "AA:AA:AA:AA:AA:09", event.RogueAccessPoint.BSSID)
+		assert.Equal(t, model.RogueUnknownBSSID, event.RogueAccessPoint.Reason)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event was posted to the webhook")
+	}
+
+	res, err = http.Get(server.URL + rogueAccessPointsEndpoint)
+	assert.Nil(t, err)
+	defer res.Body.Close()
+	var rogues []model.SnifferRogueAccessPoints
+	json.NewDecoder(res.Body).Decode(&rogues)
+	if assert.Len(t, rogues, 1) {
+		assert.Equal(t, snifferMAC, rogues[0].SnifferMAC)
+	}
+}
+
+func TestWebhookNotifierSuppressesRepeats(t *testing.T) {
+	mockClock := clock.NewMock()
+	notifier := newWebhookNotifier("http://localhost", mockClock, echo.New().Logger)
+	rogue := model.RogueAccessPoint{SnifferMAC: "01:01:01:01:01:01", BSSID: "AA:AA:AA:AA:AA:09", Reason: model.RogueUnknownBSSID}
+
+	notifier.RogueAccessPointDetected(rogue)
+	notifier.RogueAccessPointDetected(rogue)
+	assert.Len(t, notifier.events, 1)
+
+	mockClock.Add(webhookRepeatInterval)
+	notifier.RogueAccessPointDetected(rogue)
+	assert.Len(t, notifier.events, 2)
+
+	for i := 0; i < webhookQueueSize; i++ {
+		notifier.RogueAccessPointDetected(model.RogueAccessPoint{BSSID: string(rune(i))})
+	}
+	assert.Len(t, notifier.events, webhookQueueSize)
+}
+
+func TestWebhookNotifierForgetsOldEvents(t *testing.T) {
+	mockClock := clock.NewMock()
+	notifier := newWebhookNotifier("http://localhost", mockClock, echo.New().Logger)
+
+	for i := 0; i < 10; i++ {
+		notifier.RogueAccessPointDetected(model.RogueAccessPoint{SnifferMAC: string(rune(i)), BSSID: "AA:AA:AA:AA:AA:09"})
+	}
+	assert.Len(t, notifier.lastSent, 10)
+
+	mockClock.Add(webhookRepeatInterval)
+	notifier.RogueAccessPointDetected(model.RogueAccessPoint{SnifferMAC: "01:01:01:01:01:01", BSSID: "AA:AA:AA:AA:AA:09"})
+	assert.Len(t, notifier.lastSent, 1)
+}
@@ -1,65 +1,214 @@
 package server
 
 import (
+	"net/http"
+	"time"
+
 	"github.com/benbjohnson/clock"
 	"github.com/cyucelen/wirect/api"
+	"github.com/cyucelen/wirect/config"
 	"github.com/labstack/echo"
+	"github.com/labstack/echo/middleware"
 )
 
 type Database interface {
 	api.PacketDatabase
 	api.SnifferDatabase
 	api.RouterDatabase
+	api.SequenceDatabase
+}
+
+type options struct {
+	clock     clock.Clock
+	config    config.Config
+	lifecycle *Lifecycle
 }
 
-var tick = clock.New()
+type Option func(*options)
 
 const packetsEndpoint = "/sniffers/:snifferMAC/packets"
 const packetsCollectionEndpoint = "/sniffers/:snifferMAC/packets-collection"
+const packetSequenceEndpoint = "/sniffers/:snifferMAC/packets-collection/sequence"
+const packetsStreamEndpoint = "/sniffers/:snifferMAC/packets-stream"
 const sniffersEndpoint = "/sniffers"
+const sniffersGeoJSONEndpoint = "/sniffers.geojson"
 const routersEndpoint = "/sniffers/:snifferMAC/routers"
+const routerHistoryEndpoint = "/sniffers/:snifferMAC/routers/history"
+const bssidsEndpoint = "/sniffers/:snifferMAC/bssids"
+const bssidEndpoint = "/sniffers/:snifferMAC/bssids/:BSSID"
 const updateSnifferEndpoint = "/sniffers/:snifferMAC"
+const relocationEndpoint = "/sniffers/:snifferMAC/relocation"
+const calibrationEndpoint = "/sniffers/:snifferMAC/calibration"
 const crowdEndpoint = "/sniffers/:snifferMAC/stats/crowd"
 const dailyTotalSniffedMACEndpoint = "/sniffers/:snifferMAC/stats/total-sniffed/daily"
 const timeEndpoint = "/time"
+const timeSyncEndpoint = "/sniffers/:snifferMAC/time"
+const snifferStatusEndpoint = "/sniffers/:snifferMAC/status"
+const skewIncidentsEndpoint = "/sniffers/:snifferMAC/skew-incidents"
+const snifferGraphEndpoint = "/analytics/sniffer-graph"
+const floorHeatmapEndpoint = "/floors/:floor/heatmap"
+
+// maxInflatedBodySize bounds uploads of packets, compressed ones once they are inflated
+const maxInflatedBodySize = 32 << 20
+
+// maxStreamBodySize bounds streams of packets, which are read in chunks, like maxInflatedBodySize
+const maxStreamBodySize = 1 << 30
+
+func Create(db Database, opts ...Option) *echo.Echo {
+	o := &options{clock: clock.New(), config: config.Default(), lifecycle: NewLifecycle()}
+	for i := range opts {
+		opts[i](o)
+	}
+	validator := api.NewValidator(validationRules(o.config.Validation), o.clock)
+	metrics := newMetrics()
+	db = &instrumentedDatabase{db: db, metrics: metrics}
+	metrics.sniffers = &snifferLabels{db: db, clock: o.clock}
 
-func Create(db Database) *echo.Echo {
 	e := echo.New()
-	createPacketEndpoints(e, db)
-	createSnifferEndpoints(e, db)
-	createStatsEndpoints(e, db)
-	createRouterEndpoint(e, db)
-	createTimeEndpoint(e)
+	e.HTTPErrorHandler = api.HTTPErrorHandler
+	e.Logger.SetHeader(logHeader)
+	e.Logger.SetLevel(logLevels[o.config.Log.Level])
+	e.Use(o.lifecycle.Track)
+	e.Use(middleware.RequestID())
+	e.Use(macPrivacy(api.NewMACRedactor(api.MACPrivacy(o.config.Privacy.MACRedaction), o.config.Privacy.HashSecret)))
+	e.Use(logQueries)
+	if o.config.Log.Requests {
+		e.Use(logRequests)
+	}
+	e.Use(metrics.instrument)
+	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOrigins: o.config.Server.CORSOrigins,
+		AllowMethods: []string{http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete},
+	}))
+
+	clocks := api.NewClockTracker()
+	skew := api.NewSkewCorrector(api.SkewMode(o.config.Skew.Mode), time.Duration(o.config.Skew.Tolerance), o.clock)
+	skew.Clocks = clocks
+	createPacketEndpoints(e, db, validator, skew, metrics)
+	createSnifferEndpoints(e, db, validator)
+	crowdAPI := createStatsEndpoints(e, db, o)
+	createAnalyticsEndpoints(e, db, o)
+	createGeoJSONEndpoint(e, db, crowdAPI)
+	detector := newRogueDetector(o.config.Security)
+	observers := rogueObservers{metrics}
+	if o.config.Security.WebhookURL != "" {
+		notifier := newWebhookNotifier(o.config.Security.WebhookURL, o.clock, e.Logger)
+		o.lifecycle.Go(notifier.run)
+		observers = append(observers, notifier)
+	}
+	createRouterEndpoint(e, db, validator, detector, observers, o)
+	createSecurityEndpoints(e, db, detector, o)
+	createTimeEndpoint(e, db, clocks, o)
+	createStatusEndpoint(e, clocks, skew)
+	createMetricsEndpoint(e, db, crowdAPI, metrics)
+	createOpenAPIEndpoints(e)
 
 	return e
 }
 
-func createPacketEndpoints(e *echo.Echo, db Database) {
-	packetAPI := api.PacketAPI{DB: db}
-	e.POST(packetsEndpoint, packetAPI.CreatePacket)
-	e.POST(packetsCollectionEndpoint, packetAPI.CreatePackets)
+func createPacketEndpoints(e *echo.Echo, db Database, validator *api.Validator, skew *api.SkewCorrector, observer api.IngestObserver) {
+	sequencer := api.NewSequencer(db)
+	packetAPI := api.PacketAPI{DB: db, Validator: validator, Observer: observer, Skew: skew, Sequencer: sequencer}
+	e.POST(packetsEndpoint, packetAPI.CreatePacket, api.DecompressBody(maxInflatedBodySize))
+	e.POST(packetsCollectionEndpoint, packetAPI.CreatePackets, api.DecompressBody(maxInflatedBodySize))
+	e.GET(packetSequenceEndpoint, sequencer.GetSequence)
+	e.DELETE(packetSequenceEndpoint, sequencer.ResetSequence)
+	e.POST(packetsStreamEndpoint, packetAPI.CreatePacketStream, api.DecompressBody(maxStreamBodySize))
 }
 
-func createSnifferEndpoints(e *echo.Echo, db Database) {
-	snifferAPI := api.SnifferAPI{DB: db}
+func createSnifferEndpoints(e *echo.Echo, db Database, validator *api.Validator) {
+	snifferAPI := api.SnifferAPI{DB: db, Validator: validator}
 	e.GET(sniffersEndpoint, snifferAPI.GetSniffers)
 	e.POST(sniffersEndpoint, snifferAPI.CreateSniffer)
 	e.PUT(updateSnifferEndpoint, snifferAPI.UpdateSniffer)
 }
 
-func createStatsEndpoints(e *echo.Echo, db Database) {
-	crowdAPI := api.CreateCrowdAPI(db, api.SetCrowdClock(tick))
+func createStatsEndpoints(e *echo.Echo, db Database, o *options) *api.CrowdAPI {
+	crowdAPI := api.CreateCrowdAPI(db,
+		api.SetCrowdClock(o.clock),
+		api.SetCrowdCalculationInterval(time.Duration(o.config.Crowd.CalculationInterval)),
+		api.SetCrowdMaxBuckets(o.config.Crowd.MaxBuckets),
+	)
 	e.GET(crowdEndpoint, crowdAPI.GetCrowd)
 	e.GET(dailyTotalSniffedMACEndpoint, crowdAPI.GetTotalSniffedMACDaily)
+	return crowdAPI
+}
+
+func createGeoJSONEndpoint(e *echo.Echo, db Database, crowdAPI *api.CrowdAPI) {
+	geoJSONAPI := api.GeoJSONAPI{DB: db, Crowd: crowdAPI}
+	e.GET(sniffersGeoJSONEndpoint, geoJSONAPI.GetSniffersGeoJSON)
+}
+
+func createAnalyticsEndpoints(e *echo.Echo, db Database, o *options) {
+	neighborAPI := api.NeighborAPI{DB: db, Clock: o.clock, Window: time.Duration(o.config.Crowd.CalculationInterval)}
+	e.GET(snifferGraphEndpoint, neighborAPI.GetSnifferGraph)
+
+	pathLoss := api.PathLossModel{ReferenceRSSI: o.config.Positioning.ReferenceRSSI, Exponent: o.config.Positioning.PathLossExponent}
+	positioningAPI := api.PositioningAPI{DB: db, Clock: o.clock, Model: pathLoss}
+	e.GET(floorHeatmapEndpoint, positioningAPI.GetHeatmap)
+
+	calibrationAPI := api.CalibrationAPI{DB: db, Clock: o.clock, Model: pathLoss}
+	e.POST(calibrationEndpoint, calibrationAPI.Calibrate)
 }
 
-func createRouterEndpoint(e *echo.Echo, db Database) {
-	routerAPI := api.RouterAPI{DB: db}
+func createMetricsEndpoint(e *echo.Echo, db Database, crowdAPI *api.CrowdAPI, metrics *metrics) {
+	metrics.registry.MustRegister(newCrowdCollector(db, crowdAPI))
+	e.GET(metricsEndpoint, metrics.handler())
+}
+
+func createRouterEndpoint(e *echo.Echo, db Database, validator *api.Validator, detector *api.RogueDetector, observer api.RogueObserver, o *options) {
+	relocation := &api.RelocationDetector{
+		JaccardThreshold: o.config.Relocation.JaccardThreshold,
+		RSSIShift:        o.config.Relocation.RSSIShift,
+		Confirmations:    o.config.Relocation.Confirmations,
+	}
+	routerAPI := api.RouterAPI{DB: db, Validator: validator, Clock: o.clock, Detector: detector, RogueObserver: observer, Relocation: relocation, Sniffers: db}
 	e.POST(routersEndpoint, routerAPI.CreateRouters)
 	e.GET(routersEndpoint, routerAPI.GetRouters)
+	e.GET(routerHistoryEndpoint, routerAPI.GetRouterHistory)
+	e.GET(bssidsEndpoint, routerAPI.GetBSSIDs)
+	e.GET(bssidEndpoint, routerAPI.GetBSSID)
+	e.GET(relocationEndpoint, routerAPI.GetRelocation)
+	e.DELETE(relocationEndpoint, routerAPI.ResetRelocation)
 }
 
-func createTimeEndpoint(e *echo.Echo) {
-	timeAPI := api.TimeAPI{Clock: tick}
+func createTimeEndpoint(e *echo.Echo, db Database, clocks *api.ClockTracker, o *options) {
+	timeAPI := api.TimeAPI{Clock: o.clock, Clocks: clocks, DB: db}
 	e.GET(timeEndpoint, timeAPI.GetTime)
+	e.POST(timeSyncEndpoint, timeAPI.SyncTime)
+}
+
+func createStatusEndpoint(e *echo.Echo, clocks *api.ClockTracker, skew *api.SkewCorrector) {
+	statusAPI := api.StatusAPI{Clocks: clocks, Skew: skew}
+	e.GET(snifferStatusEndpoint, statusAPI.GetSnifferStatus)
+	e.GET(skewIncidentsEndpoint, statusAPI.GetSkewIncidents)
+}
+
+func validationRules(validation config.Validation) api.ValidationRules {
+	return api.ValidationRules{
+		Mode:          api.ValidationMode(validation.Mode),
+		MinRSSI:       validation.MinRSSI,
+		MaxRSSI:       validation.MaxRSSI,
+		MaxPastAge:    time.Duration(validation.MaxPastAge),
+		MaxFutureSkew: time.Duration(validation.MaxFutureSkew),
+		MaxSSIDLength: validation.MaxSSIDLength,
+	}
+}
+
+func SetClock(clock clock.Clock) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+func SetConfig(config config.Config) Option {
+	return func(o *options) {
+		o.config = config
+	}
+}
+
+func SetLifecycle(lifecycle *Lifecycle) Option {
+	return func(o *options) {
+		o.lifecycle = lifecycle
+	}
 }
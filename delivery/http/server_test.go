@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -11,9 +12,11 @@ import (
 	"time"
 
 	"github.com/benbjohnson/clock"
+	"github.com/cyucelen/wirect/config"
 	"github.com/cyucelen/wirect/model"
 	"github.com/cyucelen/wirect/test"
 	testutil "github.com/cyucelen/wirect/test/util"
+	"github.com/labstack/echo"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 )
@@ -35,23 +38,25 @@ func (s *IntegrationSuite) BeforeTest(string, string) {
 	mockClock := clock.NewMock()
 	mockClock.Add(12 * time.Hour)
 	s.clock = mockClock
-	tick = mockClock
 	s.db = &test.InMemoryDB{}
-	server := Create(s.db)
-	s.server = httptest.NewServer(server)
+	s.server = httptest.NewServer(createTestServer(s.db, mockClock))
 }
 
 func (s *IntegrationSuite) AfterTest(string, string) {
 	s.server.Close()
 }
 
+func createTestServer(db Database, clock clock.Clock) *echo.Echo {
+	cfg := config.Default()
+	cfg.Log.Requests = false
+	return Create(db, SetConfig(cfg), SetClock(clock))
+}
+
 func (s *IntegrationSuite) setCurrentTime(time time.Time) {
 	mockClock := clock.NewMock()
 	mockClock.Set(time)
-	tick = mockClock
 	s.clock = mockClock
-	server := Create(s.db)
-	s.server = httptest.NewServer(server)
+	s.server = httptest.NewServer(createTestServer(s.db, mockClock))
 }
 
 func (s *IntegrationSuite) TestCreateSniffer() {
@@ -98,11 +103,11 @@ func (s *IntegrationSuite) TestGetCurrentCrowd() {
 
 	now := s.clock.Now()
 	packets := []model.Packet{
-		{MAC: "AA:BB:22:11:44:55", Timestamp: now.Add(-15 * time.Second).Unix(), RSSI: 23.4},
-		{MAC: "00:11:CC:CC:44:55", Timestamp: now.Add(-10 * time.Second).Unix(), RSSI: 44},
-		{MAC: "AA:BB:22:11:44:55", Timestamp: now.Add(-7 * time.Second).Unix(), RSSI: 333},
-		{MAC: "AA:BB:22:11:44:55", Timestamp: now.Add(-5 * time.Second).Unix(), RSSI: 1.2232},
-		{MAC: "AA:BB:22:11:44:55", Timestamp: now.Unix(), RSSI: 1.2},
+		{MAC: "AA:BB:22:11:44:55", Timestamp: now.Add(-15 * time.Second).Unix(), RSSI: -23.4},
+		{MAC: "00:11:CC:CC:44:55", Timestamp: now.Add(-10 * time.Second).Unix(), RSSI: -44},
+		{MAC: "AA:BB:22:11:44:55", Timestamp: now.Add(-7 * time.Second).Unix(), RSSI: -33},
+		{MAC: "AA:BB:22:11:44:55", Timestamp: now.Add(-5 * time.Second).Unix(), RSSI: -1.2232},
+		{MAC: "AA:BB:22:11:44:55", Timestamp: now.Unix(), RSSI: -1.2},
 	}
 
 	for _, packet := range packets {
@@ -117,8 +122,8 @@ func (s *IntegrationSuite) TestGetCurrentCrowd() {
 	now = now.Add(1 * time.Minute)
 	s.setCurrentTime(now)
 	packets = []model.Packet{
-		{MAC: "CC:FF:CC:FF:CC:FF", Timestamp: now.Add(-35 * time.Second).Unix(), RSSI: 44},
-		{MAC: "DD:CC:DD:CC:DD:CC", Timestamp: now.Add(-25 * time.Second).Unix(), RSSI: 23.4},
+		{MAC: "CC:FF:CC:FF:CC:FF", Timestamp: now.Add(-35 * time.Second).Unix(), RSSI: -44},
+		{MAC: "DD:CC:DD:CC:DD:CC", Timestamp: now.Add(-25 * time.Second).Unix(), RSSI: -23.4},
 	}
 
 	packetsJSON, _ := json.Marshal(packets)
@@ -137,11 +142,11 @@ func (s *IntegrationSuite) TestGetCrowdBetweenDates() {
 
 	now := s.clock.Now()
 	packets := []model.Packet{
-		{MAC: "AA:BB:22:11:44:55", Timestamp: now.Add(-15 * time.Second).Unix(), RSSI: 23.4},
-		{MAC: "00:11:CC:CC:44:55", Timestamp: now.Add(-10 * time.Second).Unix(), RSSI: 44},
-		{MAC: "CC:BB:22:11:44:55", Timestamp: now.Add(-7 * time.Second).Unix(), RSSI: 333},
-		{MAC: "DD:BB:22:11:44:55", Timestamp: now.Add(-5 * time.Second).Unix(), RSSI: 1.2232},
-		{MAC: "EE:BB:22:11:44:55", Timestamp: now.Unix(), RSSI: 1.2},
+		{MAC: "AA:BB:22:11:44:55", Timestamp: now.Add(-15 * time.Second).Unix(), RSSI: -23.4},
+		{MAC: "00:11:CC:CC:44:55", Timestamp: now.Add(-10 * time.Second).Unix(), RSSI: -44},
+		{MAC: "CC:BB:22:11:44:55", Timestamp: now.Add(-7 * time.Second).Unix(), RSSI: -33},
+		{MAC: "DD:BB:22:11:44:55", Timestamp: now.Add(-5 * time.Second).Unix(), RSSI: -1.2232},
+		{MAC: "EE:BB:22:11:44:55", Timestamp: now.Unix(), RSSI: -1.2},
 	}
 
 	for _, packet := range packets {
@@ -166,12 +171,11 @@ func (s *IntegrationSuite) TestGetTotalSniffedMACDaily() {
 
 	now := s.clock.Now()
 	packets := []model.Packet{
-		{MAC: "AA:BB:22:11:44:55", Timestamp: now.Add(-15 * time.Second).Unix(), RSSI: 23.4},
-		{MAC: "00:11:CC:CC:44:55", Timestamp: now.Add(-10 * time.Second).Unix(), RSSI: 44},
-		{MAC: "DD:BB:22:11:44:55", Timestamp: now.Add(-7 * time.Second).Unix(), RSSI: 333},
-		{MAC: "DD:BB:22:11:44:55", Timestamp: now.Add(-5 * time.Second).Unix(), RSSI: 1.2232},
-		{MAC: "EE:BB:22:11:44:55", Timestamp: now.Unix(), RSSI: 1.2},
-		{MAC: "FF:FB:F2:F1:F4:F5", Timestamp: now.Add(25 * time.Hour).Unix(), RSSI: 1.2},
+		{MAC: "AA:BB:22:11:44:55", Timestamp: now.Add(-15 * time.Second).Unix(), RSSI: -23.4},
+		{MAC: "00:11:CC:CC:44:55", Timestamp: now.Add(-10 * time.Second).Unix(), RSSI: -44},
+		{MAC: "DD:BB:22:11:44:55", Timestamp: now.Add(-7 * time.Second).Unix(), RSSI: -33},
+		{MAC: "DD:BB:22:11:44:55", Timestamp: now.Add(-5 * time.Second).Unix(), RSSI: -1.2232},
+		{MAC: "EE:BB:22:11:44:55", Timestamp: now.Unix(), RSSI: -1.2},
 	}
 
 	for _, packet := range packets {
@@ -179,6 +183,9 @@ func (s *IntegrationSuite) TestGetTotalSniffedMACDaily() {
 		s.sendCreatePacketRequest(snifferMAC, string(packetJSON))
 	}
 
+	// packets from the future are rejected by the API, so it is inserted directly
+	s.db.CreatePacket(context.Background(), &model.Packet{MAC: "FF:FB:F2:F1:F4:F5", Timestamp: now.Add(25 * time.Hour).Unix(), RSSI: -1.2, SnifferMAC: snifferMAC})
+
 	actualTotalSniffed := s.sendGetTotalSniffedMACDailyRequest(snifferMAC)
 	expectedTotalSniffed := model.TotalSniffed{Count: 4}
 
@@ -207,6 +214,36 @@ func (s *IntegrationSuite) TestGetRouters() {
 	assert.Equal(s.T(), expectedRouters, actualRouters)
 }
 
+func (s *IntegrationSuite) TestGetRouterHistoryAndBSSIDs() {
+	snifferMAC := "01:01:01:01:01:01"
+	now := s.clock.Now()
+	routers := []model.RouterExternal{
+		{SSID: "eduroam", BSSID: "AA:AA:AA:AA:AA:01", Channel: 1, Band: "2.4GHz", Security: "wpa2", RSSI: -70, LastSeen: now.Add(-time.Hour).Unix()},
+		{SSID: "eduroam", BSSID: "AA:AA:AA:AA:AA:02", Channel: 36, Band: "5GHz", Security: "wpa2", RSSI: -50, LastSeen: now.Unix()},
+	}
+	routersJSON, _ := json.Marshal(routers)
+	s.sendCreateRoutersRequest(snifferMAC, string(routersJSON))
+
+	var history []model.RouterExternal
+	res := s.sendRequest(http.MethodGet, fmt.Sprintf("sniffers/%s/routers/history", url.QueryEscape(snifferMAC)), "")
+	assert.Equal(s.T(), http.StatusOK, res.StatusCode)
+	json.NewDecoder(res.Body).Decode(&history)
+	assert.Equal(s.T(), routers, history)
+
+	var details []model.RouterDetail
+	res = s.sendRequest(http.MethodGet, fmt.Sprintf("sniffers/%s/bssids", url.QueryEscape(snifferMAC)), "")
+	assert.Equal(s.T(), http.StatusOK, res.StatusCode)
+	json.NewDecoder(res.Body).Decode(&details)
+	assert.Len(s.T(), details, 2)
+
+	var detail model.RouterDetail
+	res = s.sendRequest(http.MethodGet, fmt.Sprintf("sniffers/%s/bssids/%s", url.QueryEscape(snifferMAC), url.QueryEscape("AA:AA:AA:AA:AA:01")), "")
+	assert.Equal(s.T(), http.StatusOK, res.StatusCode)
+	json.NewDecoder(res.Body).Decode(&detail)
+	assert.Equal(s.T(), 1, detail.Channel)
+	assert.Len(s.T(), detail.History, 1)
+}
+
 func (s *IntegrationSuite) TestGetTime() {
 	expectedTime := s.clock.Now().Unix()
 	actualTime := s.sendGetTimeRequest()
@@ -296,13 +333,14 @@ func (s *IntegrationSuite) sendCreatePacketsRequest(snifferMAC, payload string)
 	resource := fmt.Sprintf("sniffers/%s/packets-collection", snifferMAC)
 	res := s.sendRequest(http.MethodPost, resource, payload)
 
-	var actualResponse []model.Packet
+	var actualResponse model.PacketCollectionResult
 	json.NewDecoder(res.Body).Decode(&actualResponse)
 
-	var expectedResponse []model.Packet
-	json.NewDecoder(strings.NewReader(payload)).Decode(&expectedResponse)
+	var expectedAccepted []model.SnifferPacket
+	json.NewDecoder(strings.NewReader(payload)).Decode(&expectedAccepted)
 
-	assert.Equal(s.T(), expectedResponse, actualResponse)
+	assert.Equal(s.T(), expectedAccepted, actualResponse.Accepted)
+	assert.Empty(s.T(), actualResponse.Rejected)
 	assert.Equal(s.T(), http.StatusCreated, res.StatusCode)
 }
 
@@ -1,31 +1,79 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/cyucelen/wirect/config"
 	"github.com/cyucelen/wirect/database"
 	"github.com/cyucelen/wirect/delivery/http"
-	_ "github.com/jinzhu/gorm/dialects/sqlite"
-	"github.com/labstack/echo/middleware"
+	"github.com/labstack/gommon/log"
 )
 
 func main() {
-	db, err := database.New("sqlite3", "./wirect.db")
+	cfg, printConfig, err := config.Load(os.Args[1:], os.Getenv)
+	if err == flag.ErrHelp {
+		fmt.Print("Usage of wirect:\n" + config.Usage())
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if printConfig {
+		fmt.Print(cfg.YAML())
+		return
+	}
+
+	db, err := database.Open(cfg.Database.Dialect, cfg.Database.DSN,
+		database.SetBusyTimeout(time.Duration(cfg.Database.BusyTimeout)),
+		database.SetReadConnections(cfg.Database.ReadConnections),
+		database.SetQueryTimeout(time.Duration(cfg.Database.QueryTimeout)),
+		database.SetRetention(time.Duration(cfg.Database.Retention)),
+	)
 
 	if err != nil {
 		panic(err)
 	}
 
-	e := server.Create(db)
+	lifecycle := server.NewLifecycle()
+	lifecycle.OnClose(db)
 
-	// e.Use(middleware.Logger())
+	e := server.Create(db, server.SetConfig(cfg), server.SetLifecycle(lifecycle))
+	db.SetLogger(e.Logger)
 
-	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{"*"},
-		AllowMethods: []string{http.MethodGet, http.MethodPut, http.MethodPost, http.MethodDelete},
-	}))
-
-	if err := e.Start(":1323"); err != nil {
-		panic(err)
+	checkpointer, ok := db.(database.Checkpointer)
+	if ok {
+		// the final checkpoint runs even when shutdown drops requests and leaves the database open
+		lifecycle.OnFlush(server.FlushFunc(checkpointer.Checkpoint))
+	}
+	if ok && cfg.Database.CheckpointInterval > 0 {
+		lifecycle.Every(time.Duration(cfg.Database.CheckpointInterval), func(ctx context.Context) {
+			if err := checkpointer.Checkpoint(ctx); err != nil {
+				e.Logger.Errorj(log.JSON{"component": "database", "message": "checkpoint failed", "error": err.Error()})
+			}
+		})
 	}
+
+	go func() {
+		if err := e.Start(cfg.Server.ListenAddress); err != nil && err != http.ErrServerClosed {
+			e.Logger.Fatal(err)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	sig := <-quit
+	e.Logger.Infof("received %v, shutting down", sig)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeout))
+	defer cancel()
+	e.Logger.Info(lifecycle.Shutdown(ctx, e))
 }
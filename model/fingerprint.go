@@ -0,0 +1,78 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// Relocation statuses of a sniffer
+const (
+	// RelocationUnknown means no routers were uploaded by the sniffer since its baseline was reset
+	RelocationUnknown = "unknown"
+	// RelocationStable means the routers around the sniffer match its baseline
+	RelocationStable = "stable"
+	// RelocationPossible means the routers around the sniffer kept differing from its baseline
+	RelocationPossible = "possibly_relocated"
+)
+
+// Fingerprint maps the routers around a sniffer, by BSSID or by SSID if the BSSID is not reported, to their RSSI.
+// An RSSI of zero means it was not reported.
+type Fingerprint map[string]float64
+
+// Value stores the fingerprint as JSON in SQL databases
+func (f Fingerprint) Value() (driver.Value, error) {
+	encoded, err := json.Marshal(f)
+	return string(encoded), err
+}
+
+// Copy returns a fingerprint which does not share its map with f
+func (f Fingerprint) Copy() Fingerprint {
+	if f == nil {
+		return nil
+	}
+	copied := make(Fingerprint, len(f))
+	for router, rssi := range f {
+		copied[router] = rssi
+	}
+	return copied
+}
+
+func (f *Fingerprint) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case nil:
+		*f = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(value), f)
+	case []byte:
+		return json.Unmarshal(value, f)
+	}
+	return fmt.Errorf("cannot scan %T into a fingerprint", src)
+}
+
+// SnifferFingerprint represents database schema of the baseline fingerprint of the location of a sniffer
+// and how its latest upload of routers compares to it
+type SnifferFingerprint struct {
+	SnifferMAC    string      `gorm:"primary_key"`
+	Baseline      Fingerprint `gorm:"type:text"`
+	BaselineSince int64
+	LastChecked   int64
+	Distance      float64
+	RSSIShift     float64
+	// Strikes counts the consecutive uploads which differ from the baseline
+	Strikes     int
+	RelocatedAt int64
+}
+
+// Relocation is the relocation status of a sniffer
+type Relocation struct {
+	SnifferMAC    string  `json:"snifferMAC"`
+	Status        string  `json:"status"`
+	RelocatedAt   int64   `json:"relocatedAt,omitempty"`
+	BaselineSince int64   `json:"baselineSince,omitempty"`
+	LastChecked   int64   `json:"lastChecked,omitempty"`
+	Routers       int     `json:"routers"`
+	Distance      float64 `json:"distance"`
+	RSSIShift     float64 `json:"RSSIShift"`
+}
@@ -0,0 +1,49 @@
+package model
+
+// MIMEApplicationGeoJSON is the content type of GeoJSON documents
+const MIMEApplicationGeoJSON = "application/geo+json"
+
+// SnifferFeatureCollection is a GeoJSON FeatureCollection of sniffers
+type SnifferFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []SnifferFeature `json:"features"`
+}
+
+// SnifferFeature is a GeoJSON Feature of a sniffer at its location
+type SnifferFeature struct {
+	Type       string            `json:"type"`
+	ID         string            `json:"id"`
+	Geometry   Point             `json:"geometry"`
+	Properties SnifferProperties `json:"properties"`
+}
+
+// Point is a GeoJSON Point, its coordinates are longitude and latitude in this order
+type Point struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"`
+}
+
+// Statuses of a sniffer feature
+const (
+	// SnifferOnline means the sniffer sent packets recently
+	SnifferOnline = "online"
+	// SnifferOffline means the sniffer did not send packets for a while
+	SnifferOffline = "offline"
+)
+
+// SnifferProperties are the properties of a sniffer feature, Status tells whether the sniffer is online
+// and Relocation is its relocation status
+type SnifferProperties struct {
+	MAC         string `json:"MAC"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Building    string `json:"building,omitempty"`
+	Floor       string `json:"floor,omitempty"`
+	Room        string `json:"room,omitempty"`
+	Tags        Tags   `json:"tags,omitempty"`
+	Crowd       int    `json:"crowd"`
+	Status      string `json:"status"`
+	LastSeen    int64  `json:"lastSeen,omitempty"`
+	Relocation  string `json:"relocation"`
+	RelocatedAt int64  `json:"relocatedAt,omitempty"`
+}
@@ -0,0 +1,29 @@
+package model
+
+// SnifferGraph connects sniffers which see the same routers and devices, sniffers with heavier edges are closer to each other
+type SnifferGraph struct {
+	From  int64       `json:"from"`
+	Until int64       `json:"until"`
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphNode is a sniffer with the number of routers and devices it saw
+type GraphNode struct {
+	SnifferMAC string `json:"snifferMAC"`
+	Name       string `json:"name"`
+	Routers    int    `json:"routers"`
+	Devices    int    `json:"devices"`
+}
+
+// GraphEdge connects two sniffers, its weight is the mean of the similarities of their routers and of their devices
+type GraphEdge struct {
+	From             string  `json:"from"`
+	To               string  `json:"to"`
+	Weight           float64 `json:"weight"`
+	SharedRouters    int     `json:"sharedRouters"`
+	RouterSimilarity float64 `json:"routerSimilarity"`
+	// CoObservations counts the devices seen by both sniffers within the same window, once per window
+	CoObservations   int     `json:"coObservations"`
+	DeviceSimilarity float64 `json:"deviceSimilarity"`
+}
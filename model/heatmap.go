@@ -0,0 +1,18 @@
+package model
+
+// Heatmap counts the estimated positions of devices on a floor in a grid of square cells.
+// Cells are rows from OriginY upwards, each row from OriginX to the right.
+type Heatmap struct {
+	Floor    string  `json:"floor"`
+	From     int64   `json:"from"`
+	Until    int64   `json:"until"`
+	CellSize float64 `json:"cellSize"`
+	OriginX  float64 `json:"originX"`
+	OriginY  float64 `json:"originY"`
+	Width    int     `json:"width"`
+	Height   int     `json:"height"`
+	Cells    [][]int `json:"cells"`
+	// Estimates is the number of positions, one for each device in each window it was seen by enough sniffers
+	Estimates int `json:"estimates"`
+	Max       int `json:"max"`
+}
@@ -5,14 +5,55 @@ type SnifferPacket struct {
 	MAC       string  `json:"MAC"`
 	Timestamp int64   `json:"timestamp"`
 	RSSI      float64 `json:"RSSI"`
+	// OriginalTimestamp is the timestamp the sniffer sent when Timestamp was corrected for the skew of its clock
+	OriginalTimestamp int64 `json:"originalTimestamp,omitempty"`
 }
 
 // Packet represents database schema of a collected data
 type Packet struct {
-	ID         uint `gorm:"AUTO_INCREMENT"`
-	MAC        string
-	Timestamp  int64
-	RSSI       float64
-	Sniffer    Sniffer `gorm:"foreignkey:SnifferMAC"`
-	SnifferMAC string
+	ID        uint `gorm:"AUTO_INCREMENT"`
+	MAC       string
+	Timestamp int64
+	RSSI      float64
+	// OriginalTimestamp is zero unless Timestamp was corrected for the skew of the clock of the sniffer
+	OriginalTimestamp int64
+	Sniffer           Sniffer `gorm:"foreignkey:SnifferMAC"`
+	SnifferMAC        string
+}
+
+// RejectedPacket holds a SnifferPacket which was not stored and the reasons of rejection
+type RejectedPacket struct {
+	Index  int           `json:"index"`
+	Packet SnifferPacket `json:"packet"`
+	Errors []FieldError  `json:"errors"`
+}
+
+// PacketCollectionResult reports which packets of a collection were stored and which were rejected
+type PacketCollectionResult struct {
+	Accepted []SnifferPacket  `json:"accepted"`
+	Rejected []RejectedPacket `json:"rejected"`
+	// Duplicates are the indexes of packets of a sequenced upload which were received before and not stored again
+	Duplicates []int `json:"duplicates,omitempty"`
+}
+
+// RejectedLine is a line of a stream of packets which was not stored and the reasons of rejection
+type RejectedLine struct {
+	Line   int          `json:"line"`
+	Errors []FieldError `json:"errors"`
+}
+
+// PacketStreamResult reports the fate of the lines of a stream of packets, lines are numbered from 1 and blank lines are skipped.
+// Only the first rejected and duplicate lines are listed, their counts cover every line.
+// A stream which failed reports what happened until then together with the error.
+type PacketStreamResult struct {
+	Lines         int            `json:"lines"`
+	Accepted      int            `json:"accepted"`
+	Rejected      []RejectedLine `json:"rejected"`
+	RejectedCount int            `json:"rejectedCount"`
+	// Duplicates are the lines of a sequenced stream which were received before and not stored again
+	Duplicates     []int `json:"duplicates"`
+	DuplicateCount int   `json:"duplicateCount"`
+	// FailedLine is the first line which was not stored when the stream failed, the stream is resent from it
+	FailedLine int    `json:"failedLine,omitempty"`
+	Error      *Error `json:"error,omitempty"`
 }
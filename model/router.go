@@ -1,15 +1,64 @@
 package model
 
-// Router represents database schema of a router
+// Router represents database schema of a router, it holds the latest sighting of an access point by a sniffer.
+// AccessPoint is set by the database when the router is created, see RouterAccessPoint.
 type Router struct {
-	SSID       string  `gorm:"primary_key"`
-	Sniffer    Sniffer `gorm:"foreignkey:SnifferMAC"`
-	SnifferMAC string  `gorm:"primary_key"`
-	LastSeen   int64
+	AccessPoint string  `gorm:"primary_key"`
+	Sniffer     Sniffer `gorm:"foreignkey:SnifferMAC"`
+	SnifferMAC  string  `gorm:"primary_key"`
+	SSID        string
+	LastSeen    int64
+	BSSID       string
+	Channel     int
+	Band        string
+	Security    string
+	RSSI        float64
+}
+
+// RouterAccessPoint returns what tells an access point apart, its BSSID or its SSID for sniffers which do not report BSSIDs
+func RouterAccessPoint(ssid, bssid string) string {
+	if bssid != "" {
+		return bssid
+	}
+	return ssid
+}
+
+// RouterSighting represents database schema of a single report of a router by a sniffer
+type RouterSighting struct {
+	ID         uint `gorm:"AUTO_INCREMENT"`
+	SnifferMAC string
+	SSID       string
+	BSSID      string
+	Channel    int
+	Band       string
+	Security   string
+	RSSI       float64
+	Timestamp  int64
 }
 
 // RouterExternal holds information about a router in the area of sniffer
 type RouterExternal struct {
-	SSID     string `json:"SSID"`
-	LastSeen int64  `json:"lastSeen"`
+	SSID     string  `json:"SSID"`
+	BSSID    string  `json:"BSSID,omitempty"`
+	Channel  int     `json:"channel,omitempty"`
+	Band     string  `json:"band,omitempty"`
+	Security string  `json:"security,omitempty"`
+	RSSI     float64 `json:"RSSI,omitempty"`
+	LastSeen int64   `json:"lastSeen"`
+}
+
+// RouterDetail summarizes the sightings of a single access point by a sniffer
+type RouterDetail struct {
+	BSSID     string           `json:"BSSID"`
+	SSID      string           `json:"SSID"`
+	Channel   int              `json:"channel"`
+	Band      string           `json:"band"`
+	Security  string           `json:"security"`
+	FirstSeen int64            `json:"firstSeen"`
+	LastSeen  int64            `json:"lastSeen"`
+	Sightings int              `json:"sightings"`
+	MinRSSI   float64          `json:"minRSSI"`
+	MaxRSSI   float64          `json:"maxRSSI"`
+	MeanRSSI  float64          `json:"meanRSSI"`
+	History   []RouterExternal `json:"history,omitempty"`
 }
@@ -0,0 +1,39 @@
+package model
+
+// Reasons a sighting of a router is suspicious
+const (
+	// RogueUnknownBSSID means the SSID of an authorized network was seen with a BSSID which is not authorized for it
+	RogueUnknownBSSID = "unknown_bssid"
+	// RogueSecurityMismatch means an authorized access point was seen with different security than authorized
+	RogueSecurityMismatch = "security_mismatch"
+)
+
+// RogueAccessPoint is a suspicious sighting of a router which imitates an authorized network
+type RogueAccessPoint struct {
+	SnifferMAC       string  `json:"snifferMAC"`
+	SSID             string  `json:"SSID"`
+	BSSID            string  `json:"BSSID"`
+	Channel          int     `json:"channel,omitempty"`
+	Band             string  `json:"band,omitempty"`
+	Security         string  `json:"security,omitempty"`
+	ExpectedSecurity string  `json:"expectedSecurity,omitempty"`
+	RSSI             float64 `json:"RSSI,omitempty"`
+	LastSeen         int64   `json:"lastSeen"`
+	Reason           string  `json:"reason"`
+}
+
+// SnifferRogueAccessPoints holds the suspicious sightings of a sniffer
+type SnifferRogueAccessPoints struct {
+	SnifferMAC        string             `json:"snifferMAC"`
+	RogueAccessPoints []RogueAccessPoint `json:"rogueAccessPoints"`
+}
+
+// SecurityEventRogueAccessPoint is the type of the event sent for every rogue access point
+const SecurityEventRogueAccessPoint = "rogue_access_point"
+
+// SecurityEvent is sent to notification webhooks
+type SecurityEvent struct {
+	Type             string           `json:"type"`
+	Time             int64            `json:"time"`
+	RogueAccessPoint RogueAccessPoint `json:"rogueAccessPoint"`
+}
@@ -0,0 +1,83 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// SequenceRange is an inclusive range of the sequence numbers of packets uploaded by a sniffer
+type SequenceRange struct {
+	First int64 `json:"first"`
+	Last  int64 `json:"last"`
+}
+
+// SequenceRanges are stored as JSON in SQL databases
+type SequenceRanges []SequenceRange
+
+func (r SequenceRanges) Value() (driver.Value, error) {
+	encoded, err := json.Marshal(r)
+	return string(encoded), err
+}
+
+func (r *SequenceRanges) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case nil:
+		*r = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(value), r)
+	case []byte:
+		return json.Unmarshal(value, r)
+	}
+	return fmt.Errorf("cannot scan %T into sequence ranges", src)
+}
+
+// Batch is a sequenced upload of a sniffer
+type Batch struct {
+	ID string `json:"id"`
+	SequenceRange
+}
+
+// Batches are stored as JSON in SQL databases
+type Batches []Batch
+
+func (b Batches) Value() (driver.Value, error) {
+	encoded, err := json.Marshal(b)
+	return string(encoded), err
+}
+
+func (b *Batches) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case nil:
+		*b = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(value), b)
+	case []byte:
+		return json.Unmarshal(value, b)
+	}
+	return fmt.Errorf("cannot scan %T into batches", src)
+}
+
+// SnifferSequence represents database schema of the progress of the sequenced uploads of a sniffer
+type SnifferSequence struct {
+	SnifferMAC string `gorm:"primary_key" json:"snifferMAC"`
+	// Acknowledged is the highest sequence number up to which every packet of the sniffer was received
+	Acknowledged int64 `json:"acknowledged"`
+	// Received are the ranges received beyond Acknowledged in ascending order, the gaps between them are to be resent
+	Received SequenceRanges `gorm:"type:text" json:"received,omitempty"`
+	// Batches are the latest uploads, their IDs are not accepted again for different ranges
+	Batches Batches `gorm:"type:text" json:"batches,omitempty"`
+}
+
+// Copy returns a sequence which does not share its slices with s
+func (s SnifferSequence) Copy() SnifferSequence {
+	if s.Received != nil {
+		s.Received = append(SequenceRanges{}, s.Received...)
+	}
+	if s.Batches != nil {
+		s.Batches = append(Batches{}, s.Batches...)
+	}
+	return s
+}
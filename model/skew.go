@@ -0,0 +1,22 @@
+package model
+
+// Actions taken on the packets of an upload whose clock was skewed
+const (
+	SkewCorrected   = "corrected"
+	SkewQuarantined = "quarantined"
+)
+
+// SkewIncident is an upload of a sniffer whose latest packet was further from the time the server received it than the tolerance
+type SkewIncident struct {
+	SnifferMAC string `json:"snifferMAC"`
+	Time       int64  `json:"time"`
+	// Offset is the seconds the clock of the server was ahead of the clock of the sniffer
+	Offset  int64  `json:"offset"`
+	Action  string `json:"action"`
+	Packets int    `json:"packets"`
+	// OriginalFrom and OriginalUntil are the earliest and latest timestamps of the packets as the sniffer sent them
+	OriginalFrom  int64 `json:"originalFrom"`
+	OriginalUntil int64 `json:"originalUntil"`
+	// Quarantined holds the packets which were not stored as the sniffer sent them, up to a limit
+	Quarantined []SnifferPacket `json:"quarantined,omitempty"`
+}
@@ -1,8 +1,73 @@
 package model
 
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
 // Sniffer holds information about a Sniffer
 type Sniffer struct {
 	MAC         string `gorm:"primary_key" json:"MAC"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	// Latitude and Longitude are WGS 84 degrees, they are either both set or both nil
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+	Building  string   `json:"building,omitempty"`
+	Floor     string   `json:"floor,omitempty"`
+	Room      string   `json:"room,omitempty"`
+	Tags      Tags     `gorm:"type:text" json:"tags,omitempty"`
+	// X and Y are meters on the floorplan of Floor, they are either both set or both nil
+	X *float64 `json:"x,omitempty"`
+	Y *float64 `json:"y,omitempty"`
+	// RSSIOffset is added to every RSSI of the sniffer so its hardware reads like the reference hardware
+	RSSIOffset float64 `json:"RSSIOffset,omitempty"`
+	// PathLossExponent replaces the configured exponent of the path loss model around the sniffer if it is set
+	PathLossExponent *float64 `json:"pathLossExponent,omitempty"`
+}
+
+// Tags are free-form labels of a sniffer such as entrance or outdoor
+type Tags []string
+
+// Value stores the tags as JSON in SQL databases
+func (t Tags) Value() (driver.Value, error) {
+	encoded, err := json.Marshal(t)
+	return string(encoded), err
+}
+
+func (t *Tags) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case nil:
+		*t = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(value), t)
+	case []byte:
+		return json.Unmarshal(value, t)
+	}
+	return fmt.Errorf("cannot scan %T into tags", src)
+}
+
+// CalibrationRequest describes a reference device placed at a known distance from a sniffer
+type CalibrationRequest struct {
+	DeviceMAC string  `json:"deviceMAC"`
+	Distance  float64 `json:"distance"`
+	// ReferenceRSSI is the RSSI of the device 1 meter away from the reference hardware, the configured one if it is zero
+	ReferenceRSSI float64 `json:"referenceRSSI,omitempty"`
+	From          int64   `json:"from,omitempty"`
+	Until         int64   `json:"until,omitempty"`
+}
+
+// Calibration is the offset derived from the packets of a reference device, it is stored as the RSSIOffset of the sniffer
+type Calibration struct {
+	SnifferMAC   string  `json:"snifferMAC"`
+	DeviceMAC    string  `json:"deviceMAC"`
+	Distance     float64 `json:"distance"`
+	From         int64   `json:"from"`
+	Until        int64   `json:"until"`
+	Samples      int     `json:"samples"`
+	MeasuredRSSI float64 `json:"measuredRSSI"`
+	ExpectedRSSI float64 `json:"expectedRSSI"`
+	RSSIOffset   float64 `json:"RSSIOffset"`
 }
@@ -3,3 +3,48 @@ package model
 type Time struct {
 	Now int64 `json:"now"`
 }
+
+// Precisions of the times of a clock synchronization
+const (
+	PrecisionMillisecond = "ms"
+	PrecisionMicrosecond = "us"
+)
+
+// TimeSyncRequest starts a clock synchronization, all of its times are unix times in Precision which defaults to ms
+type TimeSyncRequest struct {
+	// Originate is the time the sniffer sent the request by its own clock
+	Originate int64  `json:"originate"`
+	Precision string `json:"precision,omitempty"`
+	// Delay is the round trip delay the sniffer measured in its previous synchronization, if it has one
+	Delay int64 `json:"delay,omitempty"`
+}
+
+// TimeSync answers a TimeSyncRequest like NTP does. With Destination, the time the sniffer received the answer, the sniffer
+// computes its offset as ((Receive - Originate) + (Transmit - Destination)) / 2
+// and the round trip delay as (Destination - Originate) - (Transmit - Receive).
+type TimeSync struct {
+	Originate int64  `json:"originate"`
+	Receive   int64  `json:"receive"`
+	Transmit  int64  `json:"transmit"`
+	Precision string `json:"precision"`
+}
+
+// ClockStatus is the clock of a sniffer as the server estimated it from its synchronizations
+type ClockStatus struct {
+	Samples  int   `json:"samples"`
+	LastSync int64 `json:"lastSync"`
+	// OffsetMillis is how far the clock of the server is ahead of the clock of the sniffer
+	OffsetMillis float64 `json:"offsetMillis"`
+	DelayMillis  float64 `json:"delayMillis,omitempty"`
+	// DriftPPM is how many microseconds the clock of the sniffer loses every second, nil until the synchronizations span long enough
+	DriftPPM *float64 `json:"driftPPM,omitempty"`
+}
+
+// SnifferStatus is the runtime status of a sniffer which is kept by the server rather than stored
+type SnifferStatus struct {
+	SnifferMAC string       `json:"snifferMAC"`
+	Clock      *ClockStatus `json:"clock,omitempty"`
+	// SkewIncidents counts the uploads whose clock was skewed since the server started, LastSkew is the latest of them
+	SkewIncidents int           `json:"skewIncidents,omitempty"`
+	LastSkew      *SkewIncident `json:"lastSkew,omitempty"`
+}
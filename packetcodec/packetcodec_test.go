@@ -0,0 +1,93 @@
+package packetcodec
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/cyucelen/wirect/model"
+	"github.com/stretchr/testify/assert"
+)
+
+var packets = []model.SnifferPacket{
+	{MAC: "AA:BB:CC:DD:EE:01", Timestamp: 1571000000, RSSI: -40},
+	{MAC: "aa-bb-cc-dd-ee-02", Timestamp: 1571000003, RSSI: -87.6},
+	{MAC: "AA:BB:CC:DD:EE:03", Timestamp: 1570999990, RSSI: -120},
+}
+
+func TestEncodeDecode(t *testing.T) {
+	for _, withCRC := range []bool{false, true} {
+		data, err := Encode(packets, withCRC)
+		assert.Nil(t, err)
+
+		decoded, err := Decode(data)
+		assert.Nil(t, err)
+		assert.Equal(t, []model.SnifferPacket{
+			{MAC: "AA:BB:CC:DD:EE:01", Timestamp: 1571000000, RSSI: -40},
+			{MAC: "AA:BB:CC:DD:EE:02", Timestamp: 1571000003, RSSI: -88},
+			{MAC: "AA:BB:CC:DD:EE:03", Timestamp: 1570999990, RSSI: -120},
+		}, decoded)
+	}
+}
+
+func TestEncodeIsCompact(t *testing.T) {
+	data, _ := Encode(packets, true)
+	asJSON, _ := json.Marshal(packets)
+
+	// header, count, the first packet with its whole timestamp, two packets with a one byte delta and the checksum
+	assert.Equal(t, 4+1+(6+5+1)+2*(6+1+1)+4, len(data))
+	assert.True(t, len(data)*4 < len(asJSON))
+}
+
+func TestEncodeEmptyBatch(t *testing.T) {
+	data, err := Encode(nil, false)
+	assert.Nil(t, err)
+
+	decoded, err := Decode(data)
+	assert.Nil(t, err)
+	assert.Empty(t, decoded)
+}
+
+func TestEncodeNotValidPackets(t *testing.T) {
+	_, err := Encode([]model.SnifferPacket{{MAC: "AA:BB:CC:DD:EE:FF:00:11", RSSI: -40}}, false)
+	assert.NotNil(t, err)
+
+	_, err = Encode([]model.SnifferPacket{{MAC: "AA:BB:CC:DD:EE:FF", RSSI: -130}}, false)
+	assert.NotNil(t, err)
+}
+
+func TestDecodeCorruptedBatch(t *testing.T) {
+	data, _ := Encode(packets, true)
+	withoutCRC, _ := Encode(packets, false)
+
+	corrupted := append([]byte{}, data...)
+	corrupted[10] ^= 0xFF
+	unknownFlags := append([]byte{}, withoutCRC...)
+	unknownFlags[3] = 0x80
+	unknownVersion := append([]byte{}, withoutCRC...)
+	unknownVersion[2] = 2
+	hugeCount := append([]byte{}, withoutCRC[:4]...)
+	hugeCount = append(hugeCount, 0xFF, 0xFF, 0xFF, 0xFF, 0x0F)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected error
+	}{
+		{"empty", nil, ErrNotBatch},
+		{"JSON", []byte(`[{"MAC":"AA:BB:CC:DD:EE:01"}]`), ErrNotBatch},
+		{"unknown version", unknownVersion, ErrUnknownVersion},
+		{"unknown flags", unknownFlags, ErrUnknownFlags},
+		{"checksum mismatch", corrupted, ErrChecksumMismatch},
+		{"truncated", withoutCRC[:len(withoutCRC)-3], ErrTruncated},
+		{"count beyond data", hugeCount, ErrTruncated},
+		{"trailing data", append(append([]byte{}, withoutCRC...), 0), ErrTrailingData},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decoded, err := Decode(test.data)
+			assert.Equal(t, test.expected, err)
+			assert.Nil(t, decoded)
+		})
+	}
+}
@@ -0,0 +1,7 @@
+//go:build cgo
+// +build cgo
+
+package main
+
+// the sqlite driver needs cgo, without it only the bolt dialect is available
+import _ "github.com/jinzhu/gorm/dialects/sqlite"
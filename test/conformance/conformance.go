@@ -0,0 +1,485 @@
+// Package conformance specifies the behavior every implementation of the database of the server must have.
+// A backend runs it from its own tests with Run.
+package conformance
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cyucelen/wirect/api"
+	"github.com/cyucelen/wirect/model"
+	"github.com/stretchr/testify/suite"
+)
+
+// Database is the interface the server runs on, the same as server.Database
+type Database interface {
+	api.PacketDatabase
+	api.SnifferDatabase
+	api.RouterDatabase
+	api.SequenceDatabase
+}
+
+// Factory creates an empty database for a single test and returns a function which releases it
+type Factory func(t *testing.T) (db Database, release func())
+
+// Suite holds the behavior a Database must have:
+//   - packets are returned in ascending order of their timestamps, packets with the same timestamp in the order they were created
+//   - packets keep the original timestamp of a correction of their clock skew
+//   - since, from and until are inclusive, from after until matches nothing
+//   - a sniffer without packets or routers has empty results rather than an error
+//   - creating a sniffer with the MAC of an existing one fails, updating a sniffer which does not exist creates it
+//   - sniffers are returned in ascending order of their MACs with their location and calibration, updating a sniffer replaces its location
+//   - creating a router with the SSID of an existing router of the same sniffer replaces it
+//   - routers are returned in descending order of LastSeen, routers seen at the same time in ascending order of SSID
+//   - router sightings are kept like packets, in ascending order of their timestamps
+//   - fingerprints are upserted by sniffer, a sniffer without one has an empty fingerprint rather than an error
+//   - packet batches are stored together with the sequence of their sniffer, a sniffer without one has an empty sequence
+//   - every method returns the error of its context when the context is done before it runs
+type Suite struct {
+	suite.Suite
+	factory Factory
+	db      Database
+	release func()
+}
+
+// Run runs the conformance suite against the databases created by factory
+func Run(t *testing.T, factory Factory) {
+	suite.Run(t, &Suite{factory: factory})
+}
+
+func (s *Suite) SetupTest() {
+	s.db, s.release = s.factory(s.T())
+}
+
+func (s *Suite) TearDownTest() {
+	if s.release != nil {
+		s.release()
+	}
+}
+
+const snifferOne = "01:02:03:04:05:06"
+const snifferTwo = "00:00:00:00:00:00"
+
+func (s *Suite) createPackets(packets []model.Packet) {
+	for i := range packets {
+		s.Require().Nil(s.db.CreatePacket(context.Background(), &packets[i]))
+	}
+}
+
+// withoutIDs returns packets without the IDs databases assign
+func withoutIDs(packets []model.Packet) []model.Packet {
+	stripped := []model.Packet{}
+	for _, packet := range packets {
+		packet.ID = 0
+		stripped = append(stripped, packet)
+	}
+	return stripped
+}
+
+func (s *Suite) TestGetPacketsBySnifferOrdersByTimestamp() {
+	packets := []model.Packet{
+		{MAC: "AA:BB:22:11:44:55", Timestamp: 1600, RSSI: -40, SnifferMAC: snifferOne},
+		{MAC: "00:11:CC:CC:44:55", Timestamp: 1200, RSSI: -50, SnifferMAC: snifferTwo},
+		{MAC: "CC:BB:FA:AE:FC:6C", Timestamp: 1000, RSSI: -60, SnifferMAC: snifferOne},
+		{MAC: "AA:BB:22:11:44:55", Timestamp: 1300, RSSI: -70, SnifferMAC: snifferOne, OriginalTimestamp: 42},
+		{MAC: "FF:FB:44:21:64:25", Timestamp: 1300, RSSI: -80, SnifferMAC: snifferOne},
+	}
+	s.createPackets(packets)
+	expected := withoutIDs([]model.Packet{packets[2], packets[3], packets[4], packets[0]})
+
+	actual, err := s.db.GetPacketsBySniffer(context.Background(), snifferOne)
+
+	s.Nil(err)
+	s.Equal(expected, withoutIDs(actual))
+}
+
+func (s *Suite) TestGetPacketsBySnifferSinceIsInclusive() {
+	packets := []model.Packet{
+		{MAC: "AA:BB:22:11:44:55", Timestamp: 999, RSSI: -40, SnifferMAC: snifferOne},
+		{MAC: "AA:BB:22:11:44:55", Timestamp: 1100, RSSI: -40, SnifferMAC: snifferOne},
+		{MAC: "AA:BB:22:11:44:55", Timestamp: 1000, RSSI: -40, SnifferMAC: snifferOne},
+		{MAC: "00:11:CC:CC:44:55", Timestamp: 1000, RSSI: -50, SnifferMAC: snifferTwo},
+	}
+	s.createPackets(packets)
+
+	actual, err := s.db.GetPacketsBySnifferSince(context.Background(), snifferOne, 1000)
+
+	s.Nil(err)
+	s.Equal(withoutIDs([]model.Packet{packets[2], packets[1]}), withoutIDs(actual))
+}
+
+func (s *Suite) TestGetPacketsBySnifferBetweenDatesIsInclusive() {
+	packets := []model.Packet{
+		{MAC: "AA:BB:22:11:44:55", Timestamp: 999, RSSI: -40, SnifferMAC: snifferOne},
+		{MAC: "AA:BB:22:11:44:55", Timestamp: 1200, RSSI: -40, SnifferMAC: snifferOne},
+		{MAC: "AA:BB:22:11:44:55", Timestamp: 1000, RSSI: -40, SnifferMAC: snifferOne},
+		{MAC: "AA:BB:22:11:44:55", Timestamp: 1201, RSSI: -40, SnifferMAC: snifferOne},
+		{MAC: "AA:BB:22:11:44:55", Timestamp: 1100, RSSI: -40, SnifferMAC: snifferOne},
+		{MAC: "00:11:CC:CC:44:55", Timestamp: 1100, RSSI: -50, SnifferMAC: snifferTwo},
+	}
+	s.createPackets(packets)
+
+	actual, err := s.db.GetPacketsBySnifferBetweenDates(context.Background(), snifferOne, 1000, 1200)
+
+	s.Nil(err)
+	s.Equal(withoutIDs([]model.Packet{packets[2], packets[4], packets[1]}), withoutIDs(actual))
+
+	actual, err = s.db.GetPacketsBySnifferBetweenDates(context.Background(), snifferOne, 1200, 1000)
+	s.Nil(err)
+	s.Empty(actual)
+}
+
+func (s *Suite) TestGetUniqueMACCountBySnifferBetweenDates() {
+	s.createPackets([]model.Packet{
+		{MAC: "AA:BB:22:11:44:55", Timestamp: 1000, RSSI: -40, SnifferMAC: snifferOne},
+		{MAC: "00:11:CC:CC:44:55", Timestamp: 1100, RSSI: -50, SnifferMAC: snifferTwo},
+		{MAC: "CC:BB:FA:AE:FC:6C", Timestamp: 1100, RSSI: -60, SnifferMAC: snifferOne},
+		{MAC: "AA:BB:22:11:44:55", Timestamp: 1150, RSSI: -70, SnifferMAC: snifferOne},
+		{MAC: "FF:FB:44:21:64:25", Timestamp: 1200, RSSI: -80, SnifferMAC: snifferOne},
+		{MAC: "A2:CC:F2:D1:E4:F5", Timestamp: 1201, RSSI: -80, SnifferMAC: snifferOne},
+	})
+
+	count, err := s.db.GetUniqueMACCountBySnifferBetweenDates(context.Background(), snifferOne, 1000, 1200)
+	s.Nil(err)
+	s.Equal(3, count)
+
+	count, err = s.db.GetUniqueMACCountBySnifferBetweenDates(context.Background(), snifferOne, 1200, 1000)
+	s.Nil(err)
+	s.Equal(0, count)
+}
+
+func (s *Suite) TestCrowdsAndLastSeenOfSniffersAreReadAtOnce() {
+	s.createPackets([]model.Packet{
+		{MAC: "AA:BB:22:11:44:55", Timestamp: 1000, RSSI: -40, SnifferMAC: snifferOne},
+		{MAC: "00:11:CC:CC:44:55", Timestamp: 1100, RSSI: -50, SnifferMAC: snifferTwo},
+		{MAC: "CC:BB:FA:AE:FC:6C", Timestamp: 1100, RSSI: -60, SnifferMAC: snifferOne},
+		{MAC: "AA:BB:22:11:44:55", Timestamp: 1150, RSSI: -70, SnifferMAC: snifferOne},
+		{MAC: "FF:FB:44:21:64:25", Timestamp: 1200, RSSI: -80, SnifferMAC: snifferOne},
+		{MAC: "A2:CC:F2:D1:E4:F5", Timestamp: 1201, RSSI: -80, SnifferMAC: snifferOne},
+		{MAC: "00:11:CC:CC:44:55", Timestamp: 900, RSSI: -50, SnifferMAC: snifferTwo},
+	})
+
+	counts, err := s.db.GetUniqueMACCountsBetweenDates(context.Background(), 1000, 1200)
+	s.Nil(err)
+	s.Equal(map[string]int{snifferOne: 3, snifferTwo: 1}, counts)
+
+	lastSeen, err := s.db.GetLastSeenOfSniffersBetweenDates(context.Background(), 1000, 1200)
+	s.Nil(err)
+	s.Equal(map[string]int64{snifferOne: 1200, snifferTwo: 1100}, lastSeen)
+
+	lastSeen, err = s.db.GetLastSeenOfSniffersBetweenDates(context.Background(), 1101, 1300)
+	s.Nil(err)
+	s.Equal(map[string]int64{snifferOne: 1201}, lastSeen)
+
+	counts, err = s.db.GetUniqueMACCountsBetweenDates(context.Background(), 1200, 1000)
+	s.Nil(err)
+	s.Empty(counts)
+	lastSeen, err = s.db.GetLastSeenOfSniffersBetweenDates(context.Background(), 0, 800)
+	s.Nil(err)
+	s.Empty(lastSeen)
+}
+
+func (s *Suite) TestUnknownSnifferHasEmptyResults() {
+	ctx := context.Background()
+	s.createPackets([]model.Packet{{MAC: "AA:BB:22:11:44:55", Timestamp: 1000, RSSI: -40, SnifferMAC: snifferOne}})
+	s.Require().Nil(s.db.CreateRouter(ctx, &model.Router{SSID: "2020", SnifferMAC: snifferOne, LastSeen: 1000}))
+
+	packets, err := s.db.GetPacketsBySniffer(ctx, snifferTwo)
+	s.Nil(err)
+	s.Empty(packets)
+
+	packets, err = s.db.GetPacketsBySnifferSince(ctx, snifferTwo, 0)
+	s.Nil(err)
+	s.Empty(packets)
+
+	packets, err = s.db.GetPacketsBySnifferBetweenDates(ctx, snifferTwo, 0, 2000)
+	s.Nil(err)
+	s.Empty(packets)
+
+	count, err := s.db.GetUniqueMACCountBySnifferBetweenDates(ctx, snifferTwo, 0, 2000)
+	s.Nil(err)
+	s.Equal(0, count)
+
+	routers, err := s.db.GetRoutersBySniffer(ctx, snifferTwo)
+	s.Nil(err)
+	s.Empty(routers)
+
+	sniffers, err := s.db.GetSniffers(ctx)
+	s.Nil(err)
+	s.Empty(sniffers)
+}
+
+func (s *Suite) TestSniffersAreOrderedByMAC() {
+	ctx := context.Background()
+	sniffers := []model.Sniffer{
+		{MAC: "33:44:55:88:99:33", Name: "copy_center_sniffer", Description: "copy_center"},
+		{MAC: "11:22:33:44:55:66", Name: "library_sniffer", Description: "library"},
+	}
+	for i := range sniffers {
+		s.Require().Nil(s.db.CreateSniffer(ctx, &sniffers[i]))
+	}
+
+	actual, err := s.db.GetSniffers(ctx)
+
+	s.Nil(err)
+	s.Equal([]model.Sniffer{sniffers[1], sniffers[0]}, actual)
+}
+
+func (s *Suite) TestCreateSnifferWithExistingMACFails() {
+	ctx := context.Background()
+	sniffer := model.Sniffer{MAC: "11:22:33:44:55:66", Name: "library_sniffer", Description: "library"}
+	s.Require().Nil(s.db.CreateSniffer(ctx, &sniffer))
+
+	duplicate := model.Sniffer{MAC: sniffer.MAC, Name: "another_sniffer"}
+	s.Error(s.db.CreateSniffer(ctx, &duplicate))
+
+	actual, err := s.db.GetSniffers(ctx)
+	s.Nil(err)
+	s.Equal([]model.Sniffer{sniffer}, actual)
+}
+
+func (s *Suite) TestUpdateSniffer() {
+	ctx := context.Background()
+	sniffers := []model.Sniffer{
+		{MAC: "11:22:33:44:55:66", Name: "library_sniffer", Description: "library"},
+		{MAC: "33:44:55:88:99:33", Name: "copy_center_sniffer", Description: "copy_center"},
+	}
+	for i := range sniffers {
+		s.Require().Nil(s.db.CreateSniffer(ctx, &sniffers[i]))
+	}
+
+	update := model.Sniffer{MAC: sniffers[1].MAC, Name: "room_sniffer", Description: "room"}
+	s.Nil(s.db.UpdateSniffer(ctx, &update))
+
+	actual, err := s.db.GetSniffers(ctx)
+	s.Nil(err)
+	s.Equal([]model.Sniffer{sniffers[0], update}, actual)
+}
+
+func (s *Suite) TestUpdateSnifferCreatesMissingSniffer() {
+	ctx := context.Background()
+	sniffer := model.Sniffer{MAC: "11:22:33:44:55:66", Name: "library_sniffer", Description: "library"}
+
+	s.Nil(s.db.UpdateSniffer(ctx, &sniffer))
+
+	actual, err := s.db.GetSniffers(ctx)
+	s.Nil(err)
+	s.Equal([]model.Sniffer{sniffer}, actual)
+}
+
+func (s *Suite) TestSnifferLocationIsKeptAndCanBeRemoved() {
+	ctx := context.Background()
+	latitude, longitude, x, y, exponent := 0.0, -73.9857, 12.5, 0.0, 3.1
+	sniffer := model.Sniffer{
+		MAC: "11:22:33:44:55:66", Name: "library_sniffer", Latitude: &latitude, Longitude: &longitude,
+		Building: "Library", Floor: "B1", Room: "12", Tags: model.Tags{"entrance", "indoor"}, X: &x, Y: &y,
+		RSSIOffset: -4.5, PathLossExponent: &exponent,
+	}
+	s.Require().Nil(s.db.CreateSniffer(ctx, &sniffer))
+
+	actual, err := s.db.GetSniffers(ctx)
+	s.Nil(err)
+	s.Equal([]model.Sniffer{sniffer}, actual)
+
+	update := model.Sniffer{MAC: sniffer.MAC, Name: "library_sniffer"}
+	s.Require().Nil(s.db.UpdateSniffer(ctx, &update))
+
+	actual, err = s.db.GetSniffers(ctx)
+	s.Nil(err)
+	s.Equal([]model.Sniffer{update}, actual)
+}
+
+func (s *Suite) TestRoutersAreUpsertedAndOrderedByLastSeen() {
+	ctx := context.Background()
+	routers := []model.Router{
+		{SSID: "2020", SnifferMAC: snifferOne, LastSeen: 1000},
+		{SSID: "1010", SnifferMAC: snifferOne, LastSeen: 1200},
+		{SSID: "dont h@ck m3", SnifferMAC: snifferOne, LastSeen: 800},
+		{SSID: "Arch", SnifferMAC: snifferOne, LastSeen: 800},
+		{SSID: "2020", SnifferMAC: snifferOne, LastSeen: 1500},
+		{SSID: "2020", SnifferMAC: snifferTwo, LastSeen: 100},
+	}
+	for i := range routers {
+		s.Require().Nil(s.db.CreateRouter(ctx, &routers[i]))
+	}
+
+	actual, err := s.db.GetRoutersBySniffer(ctx, snifferOne)
+
+	s.Nil(err)
+	s.Equal([]model.Router{routers[4], routers[1], routers[3], routers[2]}, actual)
+}
+
+func (s *Suite) TestRoutersAreKeptPerBSSID() {
+	ctx := context.Background()
+	first := model.Router{SSID: "2020", SnifferMAC: snifferOne, LastSeen: 1000, BSSID: "AA:AA:AA:AA:AA:01", Channel: 1, Band: "2.4GHz", Security: "wpa2", RSSI: -70}
+	second := model.Router{SSID: "2020", SnifferMAC: snifferOne, LastSeen: 1100, BSSID: "AA:AA:AA:AA:AA:02", Channel: 36, Band: "5GHz", Security: "wpa3", RSSI: -50}
+	latest := model.Router{SSID: "2020", SnifferMAC: snifferOne, LastSeen: 1200, BSSID: "AA:AA:AA:AA:AA:01", Channel: 6, Band: "2.4GHz", Security: "wpa2", RSSI: -60}
+	s.Require().Nil(s.db.CreateRouter(ctx, &first))
+	s.Require().Nil(s.db.CreateRouter(ctx, &second))
+	s.Require().Nil(s.db.CreateRouter(ctx, &latest))
+
+	actual, err := s.db.GetRoutersBySniffer(ctx, snifferOne)
+
+	s.Nil(err)
+	s.Equal([]model.Router{latest, second}, actual)
+	s.Equal("AA:AA:AA:AA:AA:01", actual[0].AccessPoint)
+}
+
+func (s *Suite) TestRouterSightingsAreOrderedByTimestampAndRangesAreInclusive() {
+	ctx := context.Background()
+	sightings := []model.RouterSighting{
+		{SnifferMAC: snifferOne, SSID: "2020", BSSID: "AA:AA:AA:AA:AA:01", Channel: 1, Band: "2.4GHz", Security: "wpa2", RSSI: -70, Timestamp: 1200},
+		{SnifferMAC: snifferOne, SSID: "2020", BSSID: "AA:AA:AA:AA:AA:02", Channel: 36, Band: "5GHz", Security: "wpa3", RSSI: -50, Timestamp: 1000},
+		{SnifferMAC: snifferTwo, SSID: "2020", BSSID: "AA:AA:AA:AA:AA:01", Channel: 1, Band: "2.4GHz", Security: "wpa2", RSSI: -60, Timestamp: 1100},
+		{SnifferMAC: snifferOne, SSID: "1010", RSSI: -80, Timestamp: 999},
+		{SnifferMAC: snifferOne, SSID: "1010", RSSI: -80, Timestamp: 1201},
+		{SnifferMAC: snifferOne, SSID: "Arch", BSSID: "AA:AA:AA:AA:AA:03", Timestamp: 1000},
+	}
+	for i := range sightings {
+		s.Require().Nil(s.db.CreateRouterSighting(ctx, &sightings[i]))
+		s.NotZero(sightings[i].ID)
+	}
+
+	actual, err := s.db.GetRouterSightingsBySnifferBetweenDates(ctx, snifferOne, 1000, 1200)
+	s.Nil(err)
+	s.Equal(withoutSightingIDs([]model.RouterSighting{sightings[1], sightings[5], sightings[0]}), withoutSightingIDs(actual))
+
+	actual, err = s.db.GetRouterSightingsBySnifferBetweenDates(ctx, snifferOne, 1200, 1000)
+	s.Nil(err)
+	s.Empty(actual)
+
+	actual, err = s.db.GetRouterSightingsBySnifferBetweenDates(ctx, "11:11:11:11:11:11", 0, 2000)
+	s.Nil(err)
+	s.Empty(actual)
+}
+
+// withoutSightingIDs returns sightings without the IDs databases assign
+func withoutSightingIDs(sightings []model.RouterSighting) []model.RouterSighting {
+	stripped := []model.RouterSighting{}
+	for _, sighting := range sightings {
+		sighting.ID = 0
+		stripped = append(stripped, sighting)
+	}
+	return stripped
+}
+
+func (s *Suite) TestSnifferFingerprintsAreUpserted() {
+	ctx := context.Background()
+
+	missing, err := s.db.GetSnifferFingerprint(ctx, snifferOne)
+	s.Nil(err)
+	s.Equal(model.SnifferFingerprint{SnifferMAC: snifferOne}, missing)
+
+	fingerprint := model.SnifferFingerprint{
+		SnifferMAC: snifferOne, Baseline: model.Fingerprint{"AA:AA:AA:AA:AA:01": -60.5, "SSID:1010": 0},
+		BaselineSince: 1000, LastChecked: 1200, Distance: 0.5, RSSIShift: 4, Strikes: 1,
+	}
+	s.Require().Nil(s.db.UpdateSnifferFingerprint(ctx, &fingerprint))
+	fingerprint.Strikes = 2
+	fingerprint.RelocatedAt = 1300
+	s.Require().Nil(s.db.UpdateSnifferFingerprint(ctx, &fingerprint))
+	s.Require().Nil(s.db.UpdateSnifferFingerprint(ctx, &model.SnifferFingerprint{SnifferMAC: snifferTwo, BaselineSince: 900}))
+
+	actual, err := s.db.GetSnifferFingerprint(ctx, snifferOne)
+	s.Nil(err)
+	s.Equal(fingerprint, actual)
+
+	s.Require().Nil(s.db.UpdateSnifferFingerprint(ctx, &model.SnifferFingerprint{SnifferMAC: snifferOne}))
+	actual, err = s.db.GetSnifferFingerprint(ctx, snifferOne)
+	s.Nil(err)
+	s.Empty(actual.Baseline)
+	s.Zero(actual.RelocatedAt)
+}
+
+func (s *Suite) TestPacketsAreCreatedTogether() {
+	ctx := context.Background()
+	packets := []model.Packet{
+		{MAC: "AA:BB:22:11:44:55", Timestamp: 1100, RSSI: -40, SnifferMAC: snifferOne},
+		{MAC: "CC:BB:FA:AE:FC:6C", Timestamp: 1000, RSSI: -60, SnifferMAC: snifferOne},
+	}
+	s.Require().Nil(s.db.CreatePackets(ctx, packets))
+
+	stored, err := s.db.GetPacketsBySniffer(ctx, snifferOne)
+	s.Nil(err)
+	s.Equal(withoutIDs([]model.Packet{packets[1], packets[0]}), withoutIDs(stored))
+	s.Nil(s.db.CreatePackets(ctx, nil))
+}
+
+func (s *Suite) TestPacketBatchesAreStoredWithTheirSequence() {
+	ctx := context.Background()
+
+	missing, err := s.db.GetSnifferSequence(ctx, snifferOne)
+	s.Nil(err)
+	s.Equal(model.SnifferSequence{SnifferMAC: snifferOne}, missing)
+
+	packets := []model.Packet{
+		{MAC: "AA:BB:22:11:44:55", Timestamp: 1100, RSSI: -40, SnifferMAC: snifferOne},
+		{MAC: "CC:BB:FA:AE:FC:6C", Timestamp: 1000, RSSI: -60, SnifferMAC: snifferOne},
+	}
+	sequence := model.SnifferSequence{
+		SnifferMAC: snifferOne, Acknowledged: 2,
+		Received: model.SequenceRanges{{First: 5, Last: 6}},
+		Batches:  model.Batches{{ID: "a", SequenceRange: model.SequenceRange{First: 1, Last: 2}}, {ID: "b", SequenceRange: model.SequenceRange{First: 5, Last: 6}}},
+	}
+	s.Require().Nil(s.db.CreatePacketBatch(ctx, packets, &sequence))
+
+	actual, err := s.db.GetSnifferSequence(ctx, snifferOne)
+	s.Nil(err)
+	s.Equal(sequence, actual)
+	stored, err := s.db.GetPacketsBySniffer(ctx, snifferOne)
+	s.Nil(err)
+	s.Equal(withoutIDs([]model.Packet{packets[1], packets[0]}), withoutIDs(stored))
+
+	sequence = model.SnifferSequence{SnifferMAC: snifferOne, Acknowledged: 6}
+	s.Require().Nil(s.db.CreatePacketBatch(ctx, []model.Packet{}, &sequence))
+	actual, err = s.db.GetSnifferSequence(ctx, snifferOne)
+	s.Nil(err)
+	s.Equal(int64(6), actual.Acknowledged)
+	s.Empty(actual.Received)
+}
+
+func (s *Suite) TestMethodsFailWhenContextIsDone() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	s.Equal(context.Canceled, s.db.CreatePacket(ctx, &model.Packet{MAC: "AA:BB:22:11:44:55", Timestamp: 1000, SnifferMAC: snifferOne}))
+	s.Equal(context.Canceled, s.db.CreatePackets(ctx, []model.Packet{{MAC: "AA:BB:22:11:44:55", Timestamp: 1000, SnifferMAC: snifferOne}}))
+	s.Equal(context.Canceled, s.db.CreateSniffer(ctx, &model.Sniffer{MAC: snifferOne}))
+	s.Equal(context.Canceled, s.db.UpdateSniffer(ctx, &model.Sniffer{MAC: snifferOne}))
+	s.Equal(context.Canceled, s.db.CreateRouter(ctx, &model.Router{SSID: "2020", SnifferMAC: snifferOne}))
+	s.Equal(context.Canceled, s.db.CreateRouterSighting(ctx, &model.RouterSighting{SSID: "2020", SnifferMAC: snifferOne}))
+	s.Equal(context.Canceled, s.db.UpdateSnifferFingerprint(ctx, &model.SnifferFingerprint{SnifferMAC: snifferOne}))
+	batch := []model.Packet{{MAC: "AA:BB:22:11:44:55", Timestamp: 1000, SnifferMAC: snifferOne}}
+	s.Equal(context.Canceled, s.db.CreatePacketBatch(ctx, batch, &model.SnifferSequence{SnifferMAC: snifferOne, Acknowledged: 1}))
+
+	_, err := s.db.GetPacketsBySniffer(ctx, snifferOne)
+	s.Equal(context.Canceled, err)
+	_, err = s.db.GetPacketsBySnifferSince(ctx, snifferOne, 0)
+	s.Equal(context.Canceled, err)
+	_, err = s.db.GetPacketsBySnifferBetweenDates(ctx, snifferOne, 0, 2000)
+	s.Equal(context.Canceled, err)
+	_, err = s.db.GetUniqueMACCountBySnifferBetweenDates(ctx, snifferOne, 0, 2000)
+	s.Equal(context.Canceled, err)
+	_, err = s.db.GetUniqueMACCountsBetweenDates(ctx, 0, 2000)
+	s.Equal(context.Canceled, err)
+	_, err = s.db.GetLastSeenOfSniffersBetweenDates(ctx, 0, 2000)
+	s.Equal(context.Canceled, err)
+	_, err = s.db.GetSniffers(ctx)
+	s.Equal(context.Canceled, err)
+	_, err = s.db.GetRoutersBySniffer(ctx, snifferOne)
+	s.Equal(context.Canceled, err)
+	_, err = s.db.GetRouterSightingsBySnifferBetweenDates(ctx, snifferOne, 0, 2000)
+	s.Equal(context.Canceled, err)
+	_, err = s.db.GetSnifferFingerprint(ctx, snifferOne)
+	s.Equal(context.Canceled, err)
+	_, err = s.db.GetSnifferSequence(ctx, snifferOne)
+	s.Equal(context.Canceled, err)
+
+	// nothing was written by the failed calls
+	sniffers, err := s.db.GetSniffers(context.Background())
+	s.Nil(err)
+	s.Empty(sniffers)
+	packets, err := s.db.GetPacketsBySniffer(context.Background(), snifferOne)
+	s.Nil(err)
+	s.Empty(packets)
+}
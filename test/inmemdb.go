@@ -1,23 +1,83 @@
 package test
 
 import (
+	"context"
+	"errors"
 	"sort"
 
 	"github.com/cyucelen/wirect/model"
 )
 
+// errSnifferExists is returned when a sniffer is created with the MAC of an existing one
+var errSnifferExists = errors.New("sniffer already exists")
+
 type InMemoryDB struct {
 	Packets  []model.Packet
 	Sniffers []model.Sniffer
 	Routers  []model.Router
+	// RouterSightings holds every sighting in the order they were created
+	RouterSightings []model.RouterSighting
+	Fingerprints    []model.SnifferFingerprint
+	Sequences       []model.SnifferSequence
+
+	lastSightingID uint
 }
 
-func (i *InMemoryDB) CreatePacket(packet *model.Packet) error {
+func (i *InMemoryDB) CreatePacket(ctx context.Context, packet *model.Packet) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	i.Packets = append(i.Packets, *packet)
 	return nil
 }
 
-func (i *InMemoryDB) GetPacketsBySniffer(snifferMAC string) []model.Packet {
+func (i *InMemoryDB) GetUniqueMACCountsBetweenDates(ctx context.Context, from, until int64) (map[string]int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	uniqueMACs := map[string]map[string]bool{}
+	for _, packet := range i.Packets {
+		if packet.Timestamp >= from && packet.Timestamp <= until {
+			if uniqueMACs[packet.SnifferMAC] == nil {
+				uniqueMACs[packet.SnifferMAC] = map[string]bool{}
+			}
+			uniqueMACs[packet.SnifferMAC][packet.MAC] = true
+		}
+	}
+	counts := map[string]int{}
+	for snifferMAC, macs := range uniqueMACs {
+		counts[snifferMAC] = len(macs)
+	}
+	return counts, nil
+}
+
+func (i *InMemoryDB) GetLastSeenOfSniffersBetweenDates(ctx context.Context, from, until int64) (map[string]int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	lastSeen := map[string]int64{}
+	for _, packet := range i.Packets {
+		if packet.Timestamp >= from && packet.Timestamp <= until {
+			if seen, exists := lastSeen[packet.SnifferMAC]; !exists || packet.Timestamp > seen {
+				lastSeen[packet.SnifferMAC] = packet.Timestamp
+			}
+		}
+	}
+	return lastSeen, nil
+}
+
+func (i *InMemoryDB) CreatePackets(ctx context.Context, packets []model.Packet) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	i.Packets = append(i.Packets, packets...)
+	return nil
+}
+
+func (i *InMemoryDB) GetPacketsBySniffer(ctx context.Context, snifferMAC string) ([]model.Packet, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	filteredPackets := []model.Packet{}
 
 	for _, packet := range i.Packets {
@@ -25,59 +85,91 @@ func (i *InMemoryDB) GetPacketsBySniffer(snifferMAC string) []model.Packet {
 			filteredPackets = append(filteredPackets, packet)
 		}
 	}
-	return filteredPackets
+	return sortByPacketsTime(filteredPackets), nil
 }
 
-func (i *InMemoryDB) GetPacketsBySnifferSince(snifferMAC string, since int64) []model.Packet {
+func (i *InMemoryDB) GetPacketsBySnifferSince(ctx context.Context, snifferMAC string, since int64) ([]model.Packet, error) {
+	packets, err := i.GetPacketsBySniffer(ctx, snifferMAC)
+	if err != nil {
+		return nil, err
+	}
 	filteredPackets := []model.Packet{}
 
-	for _, packet := range i.GetPacketsBySniffer(snifferMAC) {
+	for _, packet := range packets {
 		if packet.Timestamp >= since {
 			filteredPackets = append(filteredPackets, packet)
 		}
 	}
-	return sortByPacketsTime(filteredPackets)
+	return filteredPackets, nil
 }
 
-func (i *InMemoryDB) GetPacketsBySnifferBetweenDates(snifferMAC string, from, until int64) []model.Packet {
+func (i *InMemoryDB) GetPacketsBySnifferBetweenDates(ctx context.Context, snifferMAC string, from, until int64) ([]model.Packet, error) {
+	packets, err := i.GetPacketsBySniffer(ctx, snifferMAC)
+	if err != nil {
+		return nil, err
+	}
 	filteredPackets := []model.Packet{}
 
-	for _, packet := range i.GetPacketsBySniffer(snifferMAC) {
+	for _, packet := range packets {
 		if packet.Timestamp >= from && packet.Timestamp <= until {
 			filteredPackets = append(filteredPackets, packet)
 		}
 	}
-	return sortByPacketsTime(filteredPackets)
+	return filteredPackets, nil
 }
 
-func (i *InMemoryDB) GetUniqueMACCountBySnifferBetweenDates(snifferMAC string, from, until int64) int {
-	filteredPackets := i.GetPacketsBySnifferBetweenDates(snifferMAC, from, until)
-	return countUniqueMACAddresses(filteredPackets)
+func (i *InMemoryDB) GetUniqueMACCountBySnifferBetweenDates(ctx context.Context, snifferMAC string, from, until int64) (int, error) {
+	filteredPackets, err := i.GetPacketsBySnifferBetweenDates(ctx, snifferMAC, from, until)
+	if err != nil {
+		return 0, err
+	}
+	return countUniqueMACAddresses(filteredPackets), nil
 }
 
-func (i *InMemoryDB) CreateSniffer(sniffer *model.Sniffer) error {
+func (i *InMemoryDB) CreateSniffer(ctx context.Context, sniffer *model.Sniffer) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, existing := range i.Sniffers {
+		if existing.MAC == sniffer.MAC {
+			return errSnifferExists
+		}
+	}
 	i.Sniffers = append(i.Sniffers, *sniffer)
 	return nil
 }
 
-func (i *InMemoryDB) GetSniffers() []model.Sniffer {
-	return i.Sniffers
+func (i *InMemoryDB) GetSniffers(ctx context.Context) ([]model.Sniffer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return sortSniffersByMAC(i.Sniffers), nil
 }
 
-func (i *InMemoryDB) UpdateSniffer(sniffer *model.Sniffer) error {
+func (i *InMemoryDB) UpdateSniffer(ctx context.Context, sniffer *model.Sniffer) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	for index := range i.Sniffers {
 		if i.Sniffers[index].MAC == sniffer.MAC {
 			i.Sniffers[index] = *sniffer
+			return nil
 		}
 	}
+	i.Sniffers = append(i.Sniffers, *sniffer)
 	return nil
 }
 
-func (i *InMemoryDB) CreateRouter(router *model.Router) error {
+func (i *InMemoryDB) CreateRouter(ctx context.Context, router *model.Router) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	router.AccessPoint = model.RouterAccessPoint(router.SSID, router.BSSID)
 	updated := false
 	for index := range i.Routers {
-		if i.Routers[index].SSID == router.SSID && i.Routers[index].SnifferMAC == router.SnifferMAC {
-			i.Routers[index].LastSeen = router.LastSeen
+		stored := i.Routers[index]
+		if model.RouterAccessPoint(stored.SSID, stored.BSSID) == router.AccessPoint && stored.SnifferMAC == router.SnifferMAC {
+			i.Routers[index] = *router
 			updated = true
 			break
 		}
@@ -89,14 +181,72 @@ func (i *InMemoryDB) CreateRouter(router *model.Router) error {
 	return nil
 }
 
-func (i *InMemoryDB) GetRoutersBySniffer(snifferMAC string) []model.Router {
+func (i *InMemoryDB) GetRoutersBySniffer(ctx context.Context, snifferMAC string) ([]model.Router, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	filteredRouters := []model.Router{}
 	for _, router := range i.Routers {
 		if router.SnifferMAC == snifferMAC {
 			filteredRouters = append(filteredRouters, router)
 		}
 	}
-	return sortRoutersByLastSeen(filteredRouters)
+	return sortRoutersByLastSeen(filteredRouters), nil
+}
+
+func (i *InMemoryDB) CreateRouterSighting(ctx context.Context, sighting *model.RouterSighting) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	i.lastSightingID++
+	sighting.ID = i.lastSightingID
+	i.RouterSightings = append(i.RouterSightings, *sighting)
+	return nil
+}
+
+func (i *InMemoryDB) GetRouterSightingsBySnifferBetweenDates(ctx context.Context, snifferMAC string, from, until int64) ([]model.RouterSighting, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	filteredSightings := []model.RouterSighting{}
+	for _, sighting := range i.RouterSightings {
+		if sighting.SnifferMAC == snifferMAC && sighting.Timestamp >= from && sighting.Timestamp <= until {
+			filteredSightings = append(filteredSightings, sighting)
+		}
+	}
+	sort.SliceStable(filteredSightings, func(i int, j int) bool {
+		return filteredSightings[i].Timestamp < filteredSightings[j].Timestamp
+	})
+	return filteredSightings, nil
+}
+
+func (i *InMemoryDB) GetSnifferFingerprint(ctx context.Context, snifferMAC string) (model.SnifferFingerprint, error) {
+	if err := ctx.Err(); err != nil {
+		return model.SnifferFingerprint{}, err
+	}
+	for _, fingerprint := range i.Fingerprints {
+		if fingerprint.SnifferMAC == snifferMAC {
+			fingerprint.Baseline = fingerprint.Baseline.Copy()
+			return fingerprint, nil
+		}
+	}
+	return model.SnifferFingerprint{SnifferMAC: snifferMAC}, nil
+}
+
+func (i *InMemoryDB) UpdateSnifferFingerprint(ctx context.Context, fingerprint *model.SnifferFingerprint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	stored := *fingerprint
+	stored.Baseline = fingerprint.Baseline.Copy()
+	for index := range i.Fingerprints {
+		if i.Fingerprints[index].SnifferMAC == fingerprint.SnifferMAC {
+			i.Fingerprints[index] = stored
+			return nil
+		}
+	}
+	i.Fingerprints = append(i.Fingerprints, stored)
+	return nil
 }
 
 func sortRoutersByLastSeen(s []model.Router) []model.Router {
@@ -104,10 +254,10 @@ func sortRoutersByLastSeen(s []model.Router) []model.Router {
 	copy(sc, s)
 
 	sort.Slice(sc, func(i int, j int) bool {
-		if sc[i].LastSeen > sc[j].LastSeen {
-			return true
+		if sc[i].LastSeen != sc[j].LastSeen {
+			return sc[i].LastSeen > sc[j].LastSeen
 		}
-		return false
+		return model.RouterAccessPoint(sc[i].SSID, sc[i].BSSID) < model.RouterAccessPoint(sc[j].SSID, sc[j].BSSID)
 	})
 	return sc
 }
@@ -116,7 +266,7 @@ func sortByPacketsTime(s []model.Packet) []model.Packet {
 	sc := make([]model.Packet, len(s))
 	copy(sc, s)
 
-	sort.Slice(sc, func(i int, j int) bool {
+	sort.SliceStable(sc, func(i int, j int) bool {
 		if sc[i].Timestamp < sc[j].Timestamp {
 			return true
 		}
@@ -125,6 +275,16 @@ func sortByPacketsTime(s []model.Packet) []model.Packet {
 	return sc
 }
 
+func sortSniffersByMAC(s []model.Sniffer) []model.Sniffer {
+	sc := make([]model.Sniffer, len(s))
+	copy(sc, s)
+
+	sort.Slice(sc, func(i int, j int) bool {
+		return sc[i].MAC < sc[j].MAC
+	})
+	return sc
+}
+
 func countUniqueMACAddresses(packets []model.Packet) int {
 	uniqueMACs := make(map[string]bool)
 	for _, packet := range packets {
@@ -132,3 +292,30 @@ func countUniqueMACAddresses(packets []model.Packet) int {
 	}
 	return len(uniqueMACs)
 }
+
+func (i *InMemoryDB) GetSnifferSequence(ctx context.Context, snifferMAC string) (model.SnifferSequence, error) {
+	if err := ctx.Err(); err != nil {
+		return model.SnifferSequence{}, err
+	}
+	for _, sequence := range i.Sequences {
+		if sequence.SnifferMAC == snifferMAC {
+			return sequence.Copy(), nil
+		}
+	}
+	return model.SnifferSequence{SnifferMAC: snifferMAC}, nil
+}
+
+func (i *InMemoryDB) CreatePacketBatch(ctx context.Context, packets []model.Packet, sequence *model.SnifferSequence) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	i.Packets = append(i.Packets, packets...)
+	for index := range i.Sequences {
+		if i.Sequences[index].SnifferMAC == sequence.SnifferMAC {
+			i.Sequences[index] = sequence.Copy()
+			return nil
+		}
+	}
+	i.Sequences = append(i.Sequences, sequence.Copy())
+	return nil
+}